@@ -1,7 +1,7 @@
 import { test } from "node:test";
 import assert from "node:assert/strict";
 import { Hono } from "hono";
-import { proxyToGo } from "../proxy.js";
+import { proxyToGo, proxyPublicToGo } from "../proxy.js";
 
 function makeApp(captured: { headers?: Headers; url?: string }) {
   // mock Go backend with a simple fetch shim
@@ -65,3 +65,34 @@ test("proxy preserves query string", async () => {
   restore();
   assert.equal(captured.url, "http://backend.test/torrents?limit=10");
 });
+
+test("public proxy forwards share links without any user identity", async () => {
+  const captured: any = {};
+  const originalFetch = globalThis.fetch;
+  globalThis.fetch = (async (input: any, init: any) => {
+    captured.url = typeof input === "string" ? input : input.url;
+    captured.headers = new Headers(init?.headers);
+    return new Response("data", { status: 206 });
+  }) as any;
+  process.env.GO_BACKEND_URL = "http://backend.test";
+
+  const app = new Hono();
+  app.on(["GET", "HEAD"], "/api/share/*", proxyPublicToGo);
+
+  const res = await app.request("/api/share/abc.def?inline=true", {
+    headers: {
+      "cookie": "session=x",
+      "x-user-id": "spoofed",
+      "x-user-role": "admin",
+      "range": "bytes=0-99",
+    },
+  });
+
+  globalThis.fetch = originalFetch;
+  assert.equal(res.status, 206);
+  assert.equal(captured.url, "http://backend.test/share/abc.def?inline=true");
+  assert.equal(captured.headers.get("cookie"), null);
+  assert.equal(captured.headers.get("x-user-id"), null);
+  assert.equal(captured.headers.get("x-user-role"), null);
+  assert.equal(captured.headers.get("range"), "bytes=0-99");
+});
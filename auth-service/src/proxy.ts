@@ -3,8 +3,7 @@ import type { AuthUser } from "./auth.js";
 
 const GO_BACKEND = () => process.env.GO_BACKEND_URL ?? "http://backend:8080";
 
-export const proxyToGo = async (c: Context) => {
-  const user = c.get("user") as AuthUser;
+const forward = (c: Context, user?: AuthUser) => {
   const url = new URL(c.req.url);
   const target = GO_BACKEND() + url.pathname.replace(/^\/api/, "") + url.search;
 
@@ -13,9 +12,11 @@ export const proxyToGo = async (c: Context) => {
   headers.delete("x-user-id");
   headers.delete("x-user-email");
   headers.delete("x-user-role");
-  headers.set("x-user-id", user.id);
-  headers.set("x-user-email", user.email);
-  headers.set("x-user-role", (user as any).role ?? "user");
+  if (user) {
+    headers.set("x-user-id", user.id);
+    headers.set("x-user-email", user.email);
+    headers.set("x-user-role", (user as any).role ?? "user");
+  }
 
   const init: RequestInit = {
     method: c.req.method,
@@ -31,3 +32,9 @@ export const proxyToGo = async (c: Context) => {
 
   return fetch(target, init);
 };
+
+export const proxyToGo = async (c: Context) => forward(c, c.get("user") as AuthUser);
+
+// Share links are signed by the backend, so they go through without a
+// session and without any user identity.
+export const proxyPublicToGo = async (c: Context) => forward(c);
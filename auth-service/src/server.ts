@@ -8,7 +8,7 @@ import { join } from "node:path";
 import { auth } from "./auth.js";
 import { runOwnedMigrations, reconcileBootstrapAdmins } from "./db.js";
 import { requireAuth, requireAdmin } from "./middleware.js";
-import { proxyToGo } from "./proxy.js";
+import { proxyToGo, proxyPublicToGo } from "./proxy.js";
 import { mountAdminRoutes } from "./admin-routes.js";
 
 // Migration order matters: Better Auth's own schema first (creates user,
@@ -28,6 +28,9 @@ app.on(["GET", "POST"], "/api/auth/*", (c) => auth.handler(c.req.raw));
 app.use("/api/admin/*", requireAuth, requireAdmin);
 mountAdminRoutes(app);
 
+// Signed share links work without a session; the backend checks the signature
+app.on(["GET", "HEAD"], "/api/share/*", proxyPublicToGo);
+
 app.use("/api/*", requireAuth);
 app.all("/api/*", proxyToGo);
 
@@ -0,0 +1,221 @@
+// Package browse lists what is on disk in the category roots and which
+// torrent each file or folder belongs to, so files added by hand or left
+// behind by removed torrents can be found.
+package browse
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/hasmikatom/torrent/category"
+)
+
+// ErrOutside says a path is not inside any of the roots it may be in
+var ErrOutside = errors.New("path is outside the media folders")
+
+// Owned is a file or folder a torrent keeps data at: its download, or a
+// file linked from it into the library
+type Owned struct {
+	Path      string
+	TorrentID int
+	Name      string
+}
+
+// Torrent is the torrent an item belongs to
+type Torrent struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// Item is one entry of a directory listing
+type Item struct {
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Dir     bool   `json:"dir"`
+	Symlink bool   `json:"symlink,omitempty"`
+	Size    int64  `json:"size"`
+	// SizeUnknown marks a folder whose size hasn't been measured yet
+	SizeUnknown bool      `json:"sizeUnknown,omitempty"`
+	ModTime     time.Time `json:"modTime"`
+	// Torrent is set when the item is a torrent's data or inside it
+	Torrent *Torrent `json:"torrent,omitempty"`
+	// Holds counts the torrents with data below a folder that isn't itself
+	// a torrent's
+	Holds int `json:"holds,omitempty"`
+}
+
+// Tracked reports whether any torrent has data at or below the item
+func (i Item) Tracked() bool {
+	return i.Torrent != nil || i.Holds > 0
+}
+
+// Index answers which torrent owns a path
+type Index struct {
+	owned []Owned
+	// byPath holds the owner of each owned path
+	byPath map[string]Owned
+	// downloading are the download folders of torrents still downloading
+	downloading []Owned
+}
+
+// NewIndex indexes the paths torrents keep data at. downloading lists the
+// download folders of incomplete torrents, which may hold partial files
+// the daemon hasn't named yet.
+func NewIndex(owned, downloading []Owned) *Index {
+	x := &Index{byPath: make(map[string]Owned, len(owned))}
+	for _, o := range owned {
+		if o.Path == "" {
+			continue
+		}
+		o.Path = filepath.Clean(o.Path)
+		if _, ok := x.byPath[o.Path]; !ok {
+			x.owned = append(x.owned, o)
+		}
+		x.byPath[o.Path] = o
+	}
+	for _, o := range downloading {
+		if o.Path != "" {
+			o.Path = filepath.Clean(o.Path)
+			x.downloading = append(x.downloading, o)
+		}
+	}
+	return x
+}
+
+// Owner returns the torrent whose data path is, or is inside. The most
+// specific owner wins, so a library link is told from the folder around it.
+func (x *Index) Owner(path string) (Owned, bool) {
+	for p := filepath.Clean(path); ; p = filepath.Dir(p) {
+		if o, ok := x.byPath[p]; ok {
+			return o, true
+		}
+		if p == filepath.Dir(p) {
+			return Owned{}, false
+		}
+	}
+}
+
+// Downloading returns the incomplete torrent whose download folder holds
+// path, or is held by it
+func (x *Index) Downloading(path string) (Owned, bool) {
+	for _, o := range x.downloading {
+		if category.Within(o.Path, path) || category.Within(filepath.Clean(path), o.Path) {
+			return o, true
+		}
+	}
+	return Owned{}, false
+}
+
+// Holds counts the torrents with data strictly below path
+func (x *Index) Holds(path string) int {
+	seen := make(map[int]bool)
+	for _, o := range x.owned {
+		if o.Path != filepath.Clean(path) && category.Within(path, o.Path) {
+			seen[o.TorrentID] = true
+		}
+	}
+	return len(seen)
+}
+
+// Describe fills in which torrent an item belongs to
+func (x *Index) Describe(item *Item) {
+	if o, ok := x.Owner(item.Path); ok {
+		item.Torrent = &Torrent{ID: o.TorrentID, Name: o.Name}
+		return
+	}
+	if item.Dir {
+		item.Holds = x.Holds(item.Path)
+	}
+}
+
+// Resolve checks that path is absolute and, once cleaned and with symlinks
+// resolved, inside one of roots. It returns the root and the cleaned path;
+// a path that doesn't exist is an os.ErrNotExist error.
+func Resolve(roots []string, path string) (string, string, error) {
+	if !filepath.IsAbs(path) {
+		return "", "", fmt.Errorf("path must be absolute")
+	}
+	path = filepath.Clean(path)
+
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", "", err
+	}
+	for _, root := range roots {
+		if !category.Within(root, path) {
+			continue
+		}
+		// A symlink inside the root must not lead out of it
+		realRoot, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			return "", "", err
+		}
+		if !category.Within(realRoot, real) {
+			return "", "", ErrOutside
+		}
+		return root, path, nil
+	}
+	return "", "", ErrOutside
+}
+
+// Sizes looks up how much a folder takes up, usually in the disk usage
+// cache so a listing never walks the tree below it
+type Sizes func(path string) (int64, bool)
+
+// Stat describes one file or folder without following a symlink. Folder
+// sizes come from sizes and are marked unknown when it has none.
+func Stat(path string, sizes Sizes) (Item, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return Item{}, err
+	}
+
+	item := Item{
+		Name:    filepath.Base(path),
+		Path:    path,
+		Dir:     info.IsDir(),
+		Symlink: info.Mode()&os.ModeSymlink != 0,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}
+	if item.Dir {
+		item.Size, item.SizeUnknown = 0, true
+		if sizes != nil {
+			if size, ok := sizes(path); ok {
+				item.Size, item.SizeUnknown = size, false
+			}
+		}
+	}
+	return item, nil
+}
+
+// List returns the entries of dir, folders first and then by name. Entries
+// that vanish while being listed are left out.
+func List(dir string, index *Index, sizes Sizes) ([]Item, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]Item, 0, len(entries))
+	for _, e := range entries {
+		item, err := Stat(filepath.Join(dir, e.Name()), sizes)
+		if err != nil {
+			continue
+		}
+		index.Describe(&item)
+		items = append(items, item)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Dir != items[j].Dir {
+			return items[i].Dir
+		}
+		return items[i].Name < items[j].Name
+	})
+	return items, nil
+}
@@ -0,0 +1,265 @@
+package browse
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path string, size int) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func removeAll(o Orphan) error {
+	return os.RemoveAll(o.Path)
+}
+
+func TestResolve(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "Movies")
+	outside := filepath.Join(base, "private")
+	writeFile(t, filepath.Join(root, "Film", "film.mkv"), 10)
+	writeFile(t, filepath.Join(outside, "secret.txt"), 10)
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	roots := []string{root}
+
+	if r, p, err := Resolve(roots, filepath.Join(root, "Film", "..", "Film")); err != nil || r != root || p != filepath.Join(root, "Film") {
+		t.Fatalf("unexpected %q, %q, %v", r, p, err)
+	}
+	for _, path := range []string{
+		filepath.Join(root, "..", "private"),
+		filepath.Join(root, "escape", "secret.txt"),
+		outside,
+	} {
+		if _, _, err := Resolve(roots, path); !errors.Is(err, ErrOutside) {
+			t.Errorf("Resolve(%s) = %v, want ErrOutside", path, err)
+		}
+	}
+	if _, _, err := Resolve(roots, "Film"); err == nil {
+		t.Error("expected a relative path to be refused")
+	}
+	if _, _, err := Resolve(roots, filepath.Join(root, "missing")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected not found, got %v", err)
+	}
+}
+
+func TestList(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "Film (2020)", "Film.mkv"), 100)
+	writeFile(t, filepath.Join(root, "Film (2020)", "extra.srt"), 5)
+	writeFile(t, filepath.Join(root, "Show", "Season 01", "e01.mkv"), 50)
+	writeFile(t, filepath.Join(root, "by-hand.mkv"), 20)
+
+	index := NewIndex([]Owned{
+		{Path: filepath.Join(root, "Film (2020)"), TorrentID: 1, Name: "Film (2020)"},
+		{Path: filepath.Join(root, "Show", "Season 01") + "/", TorrentID: 2, Name: "Season 01"},
+	}, nil)
+
+	// Only the film's folder size is known, as if the cache kept one level
+	sizes := func(path string) (int64, bool) {
+		if path == filepath.Join(root, "Film (2020)") {
+			return 105, true
+		}
+		return 0, false
+	}
+	items, err := List(root, index, sizes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("expected 3 items, got %+v", items)
+	}
+
+	film, show, file := items[0], items[1], items[2]
+	if film.Name != "Film (2020)" || !film.Dir || film.Size != 105 || film.Torrent == nil || film.Torrent.ID != 1 {
+		t.Errorf("unexpected film %+v", film)
+	}
+	if show.Name != "Show" || show.Torrent != nil || show.Holds != 1 || !show.Tracked() || !show.SizeUnknown {
+		t.Errorf("unexpected show %+v", show)
+	}
+	if file.Name != "by-hand.mkv" || file.Dir || file.Size != 20 || file.Tracked() {
+		t.Errorf("unexpected file %+v", file)
+	}
+
+	inside, err := List(filepath.Join(root, "Film (2020)"), index, sizes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range inside {
+		if item.Torrent == nil || item.Torrent.ID != 1 {
+			t.Errorf("expected %s to belong to the film torrent", item.Name)
+		}
+	}
+}
+
+func TestFindOrphans(t *testing.T) {
+	base := t.TempDir()
+	movies := filepath.Join(base, "Movies")
+	kids := filepath.Join(movies, "Kids")
+	files := filepath.Join(base, "torrent-files")
+	staging := filepath.Join(movies, ".staging")
+	writeFile(t, filepath.Join(movies, "Seeding", "film.mkv"), 100)
+	writeFile(t, filepath.Join(movies, "Removed", "film.mkv"), 40)
+	writeFile(t, filepath.Join(movies, "Mixed", "Kept", "a.mkv"), 10)
+	writeFile(t, filepath.Join(movies, "Mixed", "left.nfo"), 3)
+	writeFile(t, filepath.Join(kids, "Cartoon", "c.mkv"), 7)
+	writeFile(t, filepath.Join(staging, "Movies", "x.mkv"), 9)
+	writeFile(t, filepath.Join(files, "[rutracker.org].t1.torrent"), 2)
+	writeFile(t, filepath.Join(files, "fresh.torrent"), 2)
+
+	now := time.Now()
+	old := now.Add(-2 * time.Hour)
+	filepath.WalkDir(base, func(p string, _ os.DirEntry, _ error) error {
+		if filepath.Base(p) != "fresh.torrent" {
+			os.Chtimes(p, old, old)
+		}
+		return nil
+	})
+
+	index := NewIndex([]Owned{
+		{Path: filepath.Join(movies, "Seeding"), TorrentID: 1},
+		{Path: filepath.Join(movies, "Mixed", "Kept"), TorrentID: 2},
+	}, nil)
+	scan := OrphanScan{Roots: []string{movies, kids, files, filepath.Join(base, "missing")}, Skip: []string{staging}, MinAge: time.Hour}
+	report := FindOrphans(scan, index, now)
+
+	got := map[string]int64{}
+	for _, o := range report.Orphans {
+		got[o.Path] = o.Size
+	}
+	want := map[string]int64{
+		filepath.Join(movies, "Removed"):                   40,
+		filepath.Join(movies, "Mixed", "left.nfo"):         3,
+		filepath.Join(kids, "Cartoon"):                     7,
+		filepath.Join(files, "[rutracker.org].t1.torrent"): 2,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("unexpected orphans %+v", report.Orphans)
+	}
+	for p, size := range want {
+		if got[p] != size {
+			t.Errorf("orphan %s: got %d bytes, want %d", p, got[p], size)
+		}
+	}
+	if report.Bytes != 52 || len(report.Errors) != 1 {
+		t.Errorf("unexpected totals %+v", report)
+	}
+
+	dry := Reclaim(report, index, nil, true, removeAll)
+	if dry.Bytes != 52 {
+		t.Fatalf("unexpected dry run %+v", dry)
+	}
+	if _, err := os.Stat(filepath.Join(movies, "Removed")); err != nil {
+		t.Fatal("dry run removed data")
+	}
+
+	done := Reclaim(report, index, []string{filepath.Join(movies, "Removed")}, false, removeAll)
+	if len(done.Orphans) != 1 || !done.Orphans[0].Removed || done.Bytes != 40 {
+		t.Fatalf("unexpected reclaim %+v", done)
+	}
+	if _, err := os.Stat(filepath.Join(movies, "Removed")); err == nil {
+		t.Fatal("orphan was not removed")
+	}
+	if _, err := os.Stat(filepath.Join(movies, "Mixed", "left.nfo")); err != nil {
+		t.Fatal("an orphan that wasn't picked was removed")
+	}
+
+	// A torrent added since the scan owns what was an orphan
+	later := NewIndex([]Owned{{Path: filepath.Join(kids, "Cartoon"), TorrentID: 3}}, nil)
+	stale := Reclaim(report, later, []string{filepath.Join(kids, "Cartoon")}, false, removeAll)
+	if len(stale.Orphans) != 1 || stale.Orphans[0].Removed || stale.Orphans[0].Error == "" {
+		t.Fatalf("reclaimed data a torrent owns now %+v", stale)
+	}
+	if _, err := os.Stat(filepath.Join(kids, "Cartoon", "c.mkv")); err != nil {
+		t.Fatal("data of a torrent added since the scan was removed")
+	}
+}
+
+func TestFindOrphans_PartialDownloads(t *testing.T) {
+	movies := t.TempDir()
+	film := filepath.Join(movies, "Film (2020)")
+	writeFile(t, filepath.Join(movies, "Single.mkv.part"), 30)
+	writeFile(t, filepath.Join(film, "film.mkv.part"), 20)
+	writeFile(t, filepath.Join(film, "leftover.nfo"), 4)
+	writeFile(t, filepath.Join(movies, "Gone", "gone.mkv"), 8)
+
+	now := time.Now()
+	old := now.Add(-2 * time.Hour)
+	filepath.WalkDir(movies, func(p string, _ os.DirEntry, _ error) error {
+		os.Chtimes(p, old, old)
+		return nil
+	})
+
+	// The daemon names files of an incomplete single file torrent and of
+	// incomplete files in a folder with .part
+	index := NewIndex([]Owned{
+		{Path: filepath.Join(movies, "Single.mkv"), TorrentID: 1},
+		{Path: filepath.Join(movies, "Single.mkv.part"), TorrentID: 1},
+		{Path: filepath.Join(film, "film.mkv.part"), TorrentID: 2},
+	}, []Owned{
+		{Path: film, TorrentID: 2},
+	})
+	report := FindOrphans(OrphanScan{Roots: []string{movies}, MinAge: time.Hour}, index, now)
+
+	got := map[string]bool{}
+	for _, o := range report.Orphans {
+		got[o.Path] = true
+	}
+	if len(got) != 2 || !got[filepath.Join(film, "leftover.nfo")] || !got[filepath.Join(movies, "Gone")] {
+		t.Fatalf("unexpected orphans %+v", report.Orphans)
+	}
+
+	// Nothing in the folder of a torrent still downloading is removed
+	done := Reclaim(report, index, nil, false, removeAll)
+	for _, o := range done.Orphans {
+		if o.Path == filepath.Join(film, "leftover.nfo") && (o.Removed || o.Error == "") {
+			t.Errorf("reclaimed %s from a downloading torrent's folder", o.Path)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(film, "leftover.nfo")); err != nil {
+		t.Fatal("data in a downloading torrent's folder was removed")
+	}
+	if _, err := os.Stat(filepath.Join(movies, "Gone")); err == nil {
+		t.Fatal("orphan was not removed")
+	}
+	if done.Bytes != 8 {
+		t.Errorf("unexpected reclaimed bytes %d", done.Bytes)
+	}
+}
+
+func TestFindOrphans_LibraryLinks(t *testing.T) {
+	movies := t.TempDir()
+	library := filepath.Join(movies, "Film (2020)")
+	writeFile(t, filepath.Join(library, "Film (2020).mkv"), 60)
+	writeFile(t, filepath.Join(library, "Film (2020).en.srt"), 2)
+	writeFile(t, filepath.Join(movies, "Stray", "stray.mkv"), 9)
+
+	now := time.Now()
+	old := now.Add(-2 * time.Hour)
+	filepath.WalkDir(movies, func(p string, _ os.DirEntry, _ error) error {
+		os.Chtimes(p, old, old)
+		return nil
+	})
+
+	// Torrent 5 was removed from the daemon, but the files linked from it
+	// are the library copy and stay owned
+	index := NewIndex([]Owned{
+		{Path: filepath.Join(library, "Film (2020).mkv"), TorrentID: 5, Name: "Film.2020.1080p"},
+		{Path: filepath.Join(library, "Film (2020).en.srt"), TorrentID: 5, Name: "Film.2020.1080p"},
+	}, nil)
+	report := FindOrphans(OrphanScan{Roots: []string{movies}, MinAge: time.Hour}, index, now)
+
+	if len(report.Orphans) != 1 || report.Orphans[0].Path != filepath.Join(movies, "Stray") {
+		t.Fatalf("unexpected orphans %+v", report.Orphans)
+	}
+}
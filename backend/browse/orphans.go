@@ -0,0 +1,150 @@
+package browse
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/hasmikatom/torrent/category"
+	"github.com/hasmikatom/torrent/usage"
+)
+
+// Orphan is a file or folder in a scanned root that no torrent has data at
+// or below
+type Orphan struct {
+	Path    string    `json:"path"`
+	Root    string    `json:"root"`
+	Dir     bool      `json:"dir"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	Removed bool      `json:"removed,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// OrphanReport lists what a scan found and, unless it was a dry run, what
+// was removed
+type OrphanReport struct {
+	DryRun  bool     `json:"dryRun"`
+	Orphans []Orphan `json:"orphans"`
+	// Bytes is what the orphans take up, or what removing them freed
+	Bytes int64 `json:"bytes"`
+	// Errors are roots that couldn't be scanned
+	Errors    []string  `json:"errors,omitempty"`
+	ScannedAt time.Time `json:"scannedAt"`
+}
+
+// OrphanScan says what to scan for orphans
+type OrphanScan struct {
+	Roots []string
+	// Skip are folders inside the roots left alone, such as link mode
+	// staging, which has its own cleanup
+	Skip []string
+	// MinAge leaves out anything changed more recently, so files of a
+	// download being added aren't caught before the daemon knows them
+	MinAge time.Duration
+}
+
+// FindOrphans walks the roots and returns the biggest files and folders no
+// torrent in index owns. A folder that holds a torrent's data is walked
+// into instead.
+func FindOrphans(scan OrphanScan, index *Index, now time.Time) OrphanReport {
+	report := OrphanReport{DryRun: true, Orphans: []Orphan{}, ScannedAt: now}
+	for _, root := range scan.Roots {
+		if err := scan.walk(root, root, index, now, &report); err != nil {
+			report.Errors = append(report.Errors, err.Error())
+		}
+	}
+	return report
+}
+
+func (s OrphanScan) walk(root, dir string, index *Index, now time.Time, report *OrphanReport) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		if slices.ContainsFunc(s.Skip, func(skip string) bool { return category.Within(skip, path) }) {
+			continue
+		}
+		// A nested root is scanned on its own
+		if _, owned := index.Owner(path); owned || s.isRoot(path) {
+			continue
+		}
+		if e.IsDir() && index.Holds(path) > 0 {
+			s.walk(root, path, index, now, report)
+			continue
+		}
+
+		// An orphan is measured in full, since its size is what reclaiming it frees
+		o, err := measure(path)
+		if err != nil {
+			continue
+		}
+		if now.Sub(o.ModTime) < s.MinAge {
+			continue
+		}
+		o.Root = root
+		report.Orphans = append(report.Orphans, o)
+		report.Bytes += o.Size
+	}
+	return nil
+}
+
+func (s OrphanScan) isRoot(path string) bool {
+	return slices.Contains(s.Roots, filepath.Clean(path))
+}
+
+// measure returns the size of path and the latest change at or below it,
+// walking a folder once for both
+func measure(path string) (Orphan, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return Orphan{}, err
+	}
+	o := Orphan{Path: path, Dir: info.IsDir(), Size: info.Size(), ModTime: info.ModTime()}
+	if o.Dir {
+		node, err := usage.Scan(path, 0, 0)
+		if err != nil {
+			return Orphan{}, err
+		}
+		o.Size, o.ModTime = node.Bytes, node.ModTime
+	}
+	return o, nil
+}
+
+// Reclaim removes the orphans of a report with remove, only those in paths
+// when it isn't empty. The report may be older than index, so an orphan a
+// torrent has data at or below by now is kept. Nothing in the download
+// folder of a torrent that is still downloading is removed either, since
+// the daemon may be writing partial files there. With dryRun it only
+// reports what it would remove.
+func Reclaim(report OrphanReport, index *Index, paths []string, dryRun bool, remove func(Orphan) error) OrphanReport {
+	result := OrphanReport{DryRun: dryRun, Orphans: []Orphan{}, Errors: report.Errors, ScannedAt: report.ScannedAt}
+	for _, o := range report.Orphans {
+		if len(paths) > 0 && !slices.Contains(paths, o.Path) {
+			continue
+		}
+		if t, owned := index.Owner(o.Path); owned {
+			o.Error = fmt.Sprintf("torrent %d has data at %s", t.TorrentID, t.Path)
+		} else if index.Holds(o.Path) > 0 {
+			o.Error = "a torrent has data below it"
+		} else if t, busy := index.Downloading(o.Path); busy {
+			o.Error = fmt.Sprintf("torrent %d is still downloading into %s", t.TorrentID, t.Path)
+		} else if !dryRun {
+			if err := remove(o); err != nil {
+				o.Error = err.Error()
+			} else {
+				o.Removed = true
+			}
+		}
+		if o.Error == "" {
+			result.Bytes += o.Size
+		}
+		result.Orphans = append(result.Orphans, o)
+	}
+	return result
+}
@@ -0,0 +1,254 @@
+package category
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/hasmikatom/torrent/configfile"
+)
+
+// SeedingPolicy is applied to every torrent added to a category.
+// Unset fields leave Transmission's global settings in charge.
+type SeedingPolicy struct {
+	// RatioLimit stops seeding once the upload ratio reaches this value
+	RatioLimit *float64 `json:"ratioLimit,omitempty"`
+	// IdleLimitMinutes stops seeding after this many minutes without uploads
+	IdleLimitMinutes *int `json:"idleLimitMinutes,omitempty"`
+	// SeedTimeLimitMinutes stops seeding after this many minutes of seeding.
+	// Transmission has no such limit, so only the seeding enforcer applies it.
+	SeedTimeLimitMinutes *int `json:"seedTimeLimitMinutes,omitempty"`
+}
+
+// How a category with several roots picks one for a torrent
+const (
+	// PlacementMostFree picks the root with the most room left
+	PlacementMostFree = "mostFree"
+	// PlacementFillInOrder picks the first root the torrent fits on
+	PlacementFillInOrder = "fillInOrder"
+)
+
+// Category is a media library the user can download into
+type Category struct {
+	// ID is the contentType value sent by the UI
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Root is the primary root, the first of Roots
+	Root string `json:"root"`
+	// Roots is the pool of folders, usually on different disks, the
+	// category's torrents are spread over
+	Roots []string `json:"roots,omitempty"`
+	// Placement is "mostFree" (the default) or "fillInOrder"
+	Placement string        `json:"placement,omitempty"`
+	Seeding   SeedingPolicy `json:"seeding"`
+	// PathTemplate places torrents below Root, e.g. "{title}/Season {season:00}"
+	PathTemplate string `json:"pathTemplate,omitempty"`
+	// AllowedRoles limits who may download into the category; empty means everyone
+	AllowedRoles []string `json:"allowedRoles,omitempty"`
+}
+
+// Config is the contents of config/categories.json
+type Config struct {
+	Categories []Category `json:"categories"`
+	// MediaServers are Jellyfin or Emby servers told about finished downloads
+	MediaServers []MediaServer `json:"mediaServers,omitempty"`
+}
+
+var (
+	categoryConfig     *Config
+	categoryConfigOnce sync.Once
+)
+
+var validID = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9 _-]*$`)
+
+// Load reads config/categories.json once, falling back to the original
+// Movies, Series and Music libraries under /mediastorage
+func Load() *Config {
+	categoryConfigOnce.Do(func() {
+		var config Config
+		path, err := configfile.Load("categories.json", &config)
+		if err != nil {
+			log.Printf("Warning: %v, using default categories", err)
+			categoryConfig = getDefaultConfig()
+			return
+		}
+		log.Printf("Loaded category config from: %s", path)
+
+		categoryConfig = &Config{Categories: validCategories(config.Categories)}
+		if len(categoryConfig.Categories) == 0 {
+			log.Printf("Warning: no valid categories in %s, using defaults", path)
+			categoryConfig = getDefaultConfig()
+		}
+		categoryConfig.MediaServers = validMediaServers(config.MediaServers)
+	})
+
+	return categoryConfig
+}
+
+func getDefaultConfig() *Config {
+	return &Config{
+		Categories: []Category{
+			{ID: "Movies", Name: "Movies", Root: "/mediastorage/Movies"},
+			{ID: "Series", Name: "Series", Root: "/mediastorage/Series"},
+			{ID: "Music", Name: "Music", Root: "/mediastorage/Music"},
+		},
+	}
+}
+
+// validCategories drops categories with unusable ids or roots, logging why
+func validCategories(categories []Category) []Category {
+	seen := make(map[string]bool)
+	var valid []Category
+	for _, cat := range categories {
+		if err := cat.validate(); err != nil {
+			log.Printf("Warning: skipping category %q: %v", cat.ID, err)
+			continue
+		}
+		if seen[cat.ID] {
+			log.Printf("Warning: skipping duplicate category %q", cat.ID)
+			continue
+		}
+		seen[cat.ID] = true
+		if cat.Name == "" {
+			cat.Name = cat.ID
+		}
+		valid = append(valid, cat)
+	}
+	return valid
+}
+
+func (cat *Category) validate() error {
+	if !validID.MatchString(cat.ID) {
+		return fmt.Errorf("id must be letters, digits, spaces, '-' or '_'")
+	}
+
+	// Root and Roots may each be given alone; Root always leads the pool
+	switch {
+	case len(cat.Roots) == 0:
+		cat.Roots = []string{cat.Root}
+	case cat.Root == "":
+		cat.Root = cat.Roots[0]
+	case !slices.Contains(cat.Roots, cat.Root):
+		cat.Roots = append([]string{cat.Root}, cat.Roots...)
+	}
+	for _, root := range cat.Roots {
+		if err := ValidateRoot(root); err != nil {
+			return err
+		}
+	}
+
+	switch cat.Placement {
+	case "":
+		cat.Placement = PlacementMostFree
+	case PlacementMostFree, PlacementFillInOrder:
+	default:
+		return fmt.Errorf("unknown placement %q", cat.Placement)
+	}
+	return nil
+}
+
+// ValidateRoot checks that a library root is an absolute, clean path that is
+// not the filesystem root
+func ValidateRoot(root string) error {
+	if !filepath.IsAbs(root) {
+		return fmt.Errorf("root %q must be an absolute path", root)
+	}
+	if filepath.Clean(root) != root {
+		return fmt.Errorf("root %q must be a clean path", root)
+	}
+	if root == "/" {
+		return fmt.Errorf("root cannot be /")
+	}
+	return nil
+}
+
+// Get returns the category with the given id
+func (c *Config) Get(id string) (Category, bool) {
+	for _, cat := range c.Categories {
+		if cat.ID == id {
+			return cat, true
+		}
+	}
+	return Category{}, false
+}
+
+// ForPath returns the category whose root holds path, preferring the
+// deepest root when roots are nested
+func (c *Config) ForPath(path string) (Category, bool) {
+	var found Category
+	var foundRoot string
+	ok := false
+	for _, cat := range c.Categories {
+		if root, in := cat.RootOf(path); in && (!ok || len(root) > len(foundRoot)) {
+			found, foundRoot, ok = cat, root, true
+		}
+	}
+	return found, ok
+}
+
+// AllowedFor returns the categories a role may download into
+func (c *Config) AllowedFor(role string) []Category {
+	allowed := make([]Category, 0, len(c.Categories))
+	for _, cat := range c.Categories {
+		if cat.Allows(role) {
+			allowed = append(allowed, cat)
+		}
+	}
+	return allowed
+}
+
+// Allows reports whether a role may download into the category
+func (cat Category) Allows(role string) bool {
+	if len(cat.AllowedRoles) == 0 {
+		return true
+	}
+	for _, r := range cat.AllowedRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Pool returns the category's roots, primary first
+func (cat Category) Pool() []string {
+	if len(cat.Roots) == 0 {
+		return []string{cat.Root}
+	}
+	return cat.Roots
+}
+
+// RootOf returns the root of the pool that holds path, the deepest when
+// roots are nested
+func (cat Category) RootOf(path string) (string, bool) {
+	found := ""
+	for _, root := range cat.Pool() {
+		if Within(root, path) && len(root) > len(found) {
+			found = root
+		}
+	}
+	return found, found != ""
+}
+
+// Contains reports whether path is one of the category's roots or inside it
+func (cat Category) Contains(path string) bool {
+	_, ok := cat.RootOf(path)
+	return ok
+}
+
+// In returns the category with root as its primary root, so Dir places
+// torrents there. root should be one of the pool.
+func (cat Category) In(root string) Category {
+	cat.Root = root
+	return cat
+}
+
+// Within reports whether path is root itself or below it once cleaned
+func Within(root, path string) bool {
+	path = filepath.Clean(path)
+	return path == root || strings.HasPrefix(path, root+string(filepath.Separator))
+}
@@ -0,0 +1,216 @@
+package category
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestValidCategories_RejectsUnsafeRootsAndIDs(t *testing.T) {
+	categories := validCategories([]Category{
+		{ID: "Movies", Root: "/mediastorage/Movies"},
+		{ID: "Anime", Name: "Anime", Root: "/srv/anime"},
+		{ID: "Relative", Root: "mediastorage/Relative"},
+		{ID: "Dotted", Root: "/mediastorage/../etc"},
+		{ID: "Slash", Root: "/"},
+		{ID: "../Escape", Root: "/mediastorage/Escape"},
+		{ID: "Movies", Root: "/elsewhere/Movies"},
+	})
+
+	if len(categories) != 2 {
+		t.Fatalf("expected 2 valid categories, got %+v", categories)
+	}
+	if categories[0].Name != "Movies" {
+		t.Fatalf("name should default to id, got %q", categories[0].Name)
+	}
+	if categories[1].Root != "/srv/anime" {
+		t.Fatalf("roots outside /mediastorage should be allowed, got %q", categories[1].Root)
+	}
+}
+
+func TestAllowedFor(t *testing.T) {
+	config := &Config{Categories: []Category{
+		{ID: "Movies", Root: "/m/Movies"},
+		{ID: "Kids", Root: "/m/Kids", AllowedRoles: []string{"user", "admin"}},
+		{ID: "Private", Root: "/m/Private", AllowedRoles: []string{"admin"}},
+	}}
+
+	if got := len(config.AllowedFor("user")); got != 2 {
+		t.Fatalf("user should see 2 categories, got %d", got)
+	}
+	if got := len(config.AllowedFor("admin")); got != 3 {
+		t.Fatalf("admin should see 3 categories, got %d", got)
+	}
+	if cat, _ := config.Get("Private"); cat.Allows("user") {
+		t.Fatalf("user must not be allowed into Private")
+	}
+}
+
+func TestForPath(t *testing.T) {
+	config := &Config{Categories: []Category{
+		{ID: "Movies", Root: "/m/Movies"},
+		{ID: "Kids", Root: "/m/Movies/Kids"},
+	}}
+
+	cases := map[string]string{
+		"/m/Movies/Film (2020)":    "Movies",
+		"/m/Movies/Kids/Cartoon":   "Kids",
+		"/m/MoviesExtra/Something": "",
+	}
+	for path, want := range cases {
+		cat, _ := config.ForPath(path)
+		if cat.ID != want {
+			t.Errorf("ForPath(%q) = %q, want %q", path, cat.ID, want)
+		}
+	}
+}
+
+func TestWithin(t *testing.T) {
+	cases := []struct {
+		path string
+		want bool
+	}{
+		{"/m/Movies", true},
+		{"/m/Movies/Film (2020)", true},
+		{"/m/Movies/../Series", false},
+		{"/m/MoviesExtra", false},
+		{"/m", false},
+	}
+	for _, tc := range cases {
+		if got := Within("/m/Movies", tc.path); got != tc.want {
+			t.Errorf("Within(%q) = %v, want %v", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestDir_RendersTemplateSegments(t *testing.T) {
+	series := Category{ID: "Series", Root: "/m/Series", PathTemplate: "{title}/Season {season:00}"}
+	music := Category{ID: "Music", Root: "/m/Music", PathTemplate: "{artist}/{album}"}
+	movies := Category{ID: "Movies", Root: "/m/Movies"}
+	titled := Category{ID: "Movies", Root: "/m/Movies", PathTemplate: "{title}"}
+
+	cases := []struct {
+		name   string
+		cat    Category
+		fields Fields
+		want   string
+	}{
+		{"series with season", series, Fields{Title: "Show Name", Season: 1}, "/m/Series/Show Name/Season 01"},
+		{"series without season", series, Fields{Title: "Show Name"}, "/m/Series/Show Name"},
+		{"nothing known", series, Fields{}, "/m/Series"},
+		{"music", music, Fields{Artist: "Artist", Album: "Album"}, "/m/Music/Artist/Album"},
+		{"no template", movies, Fields{Title: "Film"}, "/m/Movies"},
+		{"traversal in title", series, Fields{Title: "../../etc", Season: 2}, "/m/Series/etc/Season 02"},
+		{"separators in title", series, Fields{Title: "AC/DC: Live?"}, "/m/Series/AC DC Live"},
+		{"dot dot only", series, Fields{Title: ".."}, "/m/Series"},
+		{"long cyrillic title", titled, Fields{Title: "Я" + strings.Repeat("Ж", 150)}, "/m/Movies/Я" + strings.Repeat("Ж", 99)},
+		{"long title cut mid rune", titled, Fields{Title: "a" + strings.Repeat("Ж", 150)}, "/m/Movies/a" + strings.Repeat("Ж", 99)},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.cat.Dir(tc.fields)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want || !utf8.ValidString(got) {
+				t.Fatalf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestGuessFields(t *testing.T) {
+	cases := []struct {
+		name string
+		want Fields
+	}{
+		{"Show.Name.S02E05.1080p.WEB-DL.x265-GRP", Fields{Title: "Show Name", Season: 2}},
+		{"Show Name S03 Complete 720p", Fields{Title: "Show Name", Season: 3}},
+		{"Movie.Title.2021.1080p.BluRay.x264", Fields{Title: "Movie Title", Year: 2021}},
+		{"Artist - Album (2019) [FLAC]", Fields{Title: "Artist - Album", Year: 2019, Artist: "Artist", Album: "Album"}},
+		{"2001.A.Space.Odyssey.1968.1080p", Fields{Title: "2001 A Space Odyssey", Year: 1968}},
+		{"Blade.Runner.2049.2017.2160p", Fields{Title: "Blade Runner 2049", Year: 2017}},
+		{"Во все тяжкие / Breaking Bad / Сезон: 2 / Серии: 1-13 из 13 [2009, BDRip 1080p]", Fields{Title: "Breaking Bad", Year: 2009, Season: 2}},
+		{"Show.Name.S01-S04.1080p.BluRay", Fields{Title: "Show Name"}},
+	}
+
+	for _, tc := range cases {
+		if got := GuessFields(tc.name); got != tc.want {
+			t.Errorf("GuessFields(%q) = %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestMapPath(t *testing.T) {
+	mappings := []PathMapping{
+		{From: "/mediastorage", To: "/data"},
+		{From: "/mediastorage/Movies", To: "/movies"},
+	}
+
+	cases := map[string]string{
+		"/mediastorage/Series/Show/Season 01": "/data/Series/Show/Season 01",
+		"/mediastorage/Movies/Film (2020)":    "/movies/Film (2020)",
+		"/mediastorage/Movies":                "/movies",
+		"/other/path":                         "/other/path",
+	}
+	for in, want := range cases {
+		if got := MapPath(mappings, in); got != want {
+			t.Errorf("MapPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestValidMediaServers(t *testing.T) {
+	t.Setenv("TEST_JELLYFIN_KEY", "from-env")
+	servers := validMediaServers([]MediaServer{
+		{ID: "jellyfin", Type: ServerJellyfin, URL: "http://jellyfin:8096", APIKeyEnv: "TEST_JELLYFIN_KEY"},
+		{ID: "emby", Type: ServerEmby, URL: "http://emby:8096", APIKey: "k", Categories: []string{"Movies"}},
+		{ID: "nokey", Type: ServerJellyfin, URL: "http://jellyfin:8096"},
+		{ID: "plex", Type: "plex", URL: "http://plex:32400", APIKey: "k"},
+		{ID: "badmap", Type: ServerEmby, URL: "http://emby:8096", APIKey: "k", PathMappings: []PathMapping{{From: "media", To: "/m"}}},
+		{ID: "emby", Type: ServerEmby, URL: "http://emby2:8096", APIKey: "k"},
+	})
+
+	if len(servers) != 2 {
+		t.Fatalf("expected 2 valid servers, got %+v", servers)
+	}
+	if servers[0].APIKey != "from-env" || servers[0].MaxAttempts != defaultServerAttempts {
+		t.Errorf("unexpected server %+v", servers[0])
+	}
+	if !servers[0].Serves("Music") || servers[1].Serves("Music") || !servers[1].Serves("Movies") {
+		t.Error("category filter not applied")
+	}
+}
+
+func TestValidCategories_Pools(t *testing.T) {
+	categories := validCategories([]Category{
+		{ID: "Movies", Roots: []string{"/disk1/Movies", "/disk2/Movies"}, Placement: PlacementFillInOrder},
+		{ID: "Series", Root: "/disk1/Series", Roots: []string{"/disk2/Series"}, PathTemplate: "{title}"},
+		{ID: "Bad", Roots: []string{"/disk1/Bad", "disk2/Bad"}},
+		{ID: "Odd", Roots: []string{"/disk1/Odd"}, Placement: "random"},
+	})
+
+	if len(categories) != 2 {
+		t.Fatalf("expected 2 valid categories, got %+v", categories)
+	}
+	if movies := categories[0]; movies.Root != "/disk1/Movies" || movies.Placement != PlacementFillInOrder {
+		t.Fatalf("root should default to the first of the pool, got %+v", movies)
+	}
+	series := categories[1]
+	if len(series.Roots) != 2 || series.Roots[0] != "/disk1/Series" || series.Placement != PlacementMostFree {
+		t.Fatalf("root should lead the pool, got %+v", series)
+	}
+
+	config := &Config{Categories: categories}
+	if cat, ok := config.ForPath("/disk2/Series/Show/Season 01"); !ok || cat.ID != "Series" {
+		t.Fatalf("expected a path on the second root to be Series, got %+v", cat)
+	}
+	if root, ok := series.RootOf("/disk2/Series/Show"); !ok || root != "/disk2/Series" {
+		t.Fatalf("unexpected root %q", root)
+	}
+	dir, err := series.In("/disk2/Series").Dir(Fields{Title: "Show"})
+	if err != nil || dir != "/disk2/Series/Show" {
+		t.Fatalf("expected the torrent in the chosen root, got %q, %v", dir, err)
+	}
+}
@@ -0,0 +1,31 @@
+package category
+
+import (
+	"path"
+	"strings"
+)
+
+// PathMapping rewrites paths as the backend sees them into paths as another
+// program sees them, e.g. a media server that mounts /mediastorage as /data
+type PathMapping struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// MapPath rewrites p with the mapping whose From is the longest prefix of
+// it, leaving p alone when none applies
+func MapPath(mappings []PathMapping, p string) string {
+	best := -1
+	for i, m := range mappings {
+		if Within(m.From, p) && (best < 0 || len(m.From) > len(mappings[best].From)) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return p
+	}
+
+	m := mappings[best]
+	rest := strings.TrimPrefix(path.Clean(p), m.From)
+	return path.Join(m.To, rest)
+}
@@ -0,0 +1,96 @@
+package category
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+)
+
+// Media server types
+const (
+	ServerJellyfin = "jellyfin"
+	ServerEmby     = "emby"
+)
+
+// MediaServer is a Jellyfin or Emby server whose libraries cover category roots
+type MediaServer struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	URL  string `json:"url"`
+	// APIKey may be given inline or read from the variable named by APIKeyEnv
+	APIKey    string `json:"apiKey,omitempty"`
+	APIKeyEnv string `json:"apiKeyEnv,omitempty"`
+	// PathMappings translate download paths to the paths the server sees
+	PathMappings []PathMapping `json:"pathMappings,omitempty"`
+	// Categories limits which category ids the server is told about; empty means all
+	Categories  []string `json:"categories,omitempty"`
+	MaxAttempts int      `json:"maxAttempts,omitempty"`
+}
+
+// defaultServerAttempts is how often a refresh is tried when the server doesn't say
+const defaultServerAttempts = 5
+
+// Serves reports whether the server's libraries cover a category
+func (s MediaServer) Serves(categoryID string) bool {
+	if len(s.Categories) == 0 {
+		return true
+	}
+	for _, id := range s.Categories {
+		if id == categoryID {
+			return true
+		}
+	}
+	return false
+}
+
+// validMediaServers resolves API keys and drops servers that can't be used,
+// logging why
+func validMediaServers(servers []MediaServer) []MediaServer {
+	seen := make(map[string]bool)
+	var valid []MediaServer
+	for _, s := range servers {
+		if s.APIKeyEnv != "" {
+			s.APIKey = os.Getenv(s.APIKeyEnv)
+		}
+		if err := s.validate(); err != nil {
+			log.Printf("Warning: skipping media server %q: %v", s.ID, err)
+			continue
+		}
+		if seen[s.ID] {
+			log.Printf("Warning: skipping duplicate media server %q", s.ID)
+			continue
+		}
+		seen[s.ID] = true
+		if s.MaxAttempts <= 0 {
+			s.MaxAttempts = defaultServerAttempts
+		}
+		valid = append(valid, s)
+	}
+	return valid
+}
+
+func (s MediaServer) validate() error {
+	if !validID.MatchString(s.ID) {
+		return fmt.Errorf("id must be letters, digits, spaces, '-' or '_'")
+	}
+	if s.Type != ServerJellyfin && s.Type != ServerEmby {
+		return fmt.Errorf("type must be %q or %q", ServerJellyfin, ServerEmby)
+	}
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url %q must be an absolute http(s) URL", s.URL)
+	}
+	if s.APIKey == "" {
+		return fmt.Errorf("an API key is required")
+	}
+	for _, m := range s.PathMappings {
+		if err := ValidateRoot(m.From); err != nil {
+			return fmt.Errorf("path mapping from: %v", err)
+		}
+		if m.To == "" {
+			return fmt.Errorf("path mapping for %q needs a to path", m.From)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package category
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hasmikatom/torrent/release"
+)
+
+// Fields fill in a category's path template
+type Fields struct {
+	Title  string `json:"title,omitempty"`
+	Year   int    `json:"year,omitempty"`
+	Season int    `json:"season,omitempty"`
+	Artist string `json:"artist,omitempty"`
+	Album  string `json:"album,omitempty"`
+}
+
+// Merge returns f with empty fields taken from other
+func (f Fields) Merge(other Fields) Fields {
+	if f.Title == "" {
+		f.Title = other.Title
+	}
+	if f.Year == 0 {
+		f.Year = other.Year
+	}
+	if f.Season == 0 {
+		f.Season = other.Season
+	}
+	if f.Artist == "" {
+		f.Artist = other.Artist
+	}
+	if f.Album == "" {
+		f.Album = other.Album
+	}
+	return f
+}
+
+// placeholder matches {name} and {name:00}, where the zeros give the padded width
+var placeholder = regexp.MustCompile(`\{([a-z]+)(?::(0+))?\}`)
+
+// Dir renders the category's path template below its root. Every segment
+// of the template is rendered on its own: a segment whose placeholders have
+// no value is left out, and the rest are sanitized so request fields can't
+// add separators or climb out of the root.
+//
+// With the template "{title}/Season {season:00}", a title of "Show" and
+// season 1 give "<root>/Show/Season 01"; without a season just "<root>/Show".
+func (cat Category) Dir(f Fields) (string, error) {
+	segments := []string{cat.Root}
+
+	for _, tmpl := range strings.Split(cat.PathTemplate, "/") {
+		segment, ok := renderSegment(tmpl, f)
+		if !ok {
+			continue
+		}
+		if segment = SanitizeSegment(segment); segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+
+	dir := filepath.Join(segments...)
+	if !Within(cat.Root, dir) {
+		return "", fmt.Errorf("download path %q escapes category root", dir)
+	}
+	return dir, nil
+}
+
+func renderSegment(tmpl string, f Fields) (string, bool) {
+	complete := true
+	rendered := placeholder.ReplaceAllStringFunc(tmpl, func(match string) string {
+		parts := placeholder.FindStringSubmatch(match)
+		value := fieldValue(f, parts[1], len(parts[2]))
+		if value == "" {
+			complete = false
+		}
+		return value
+	})
+	return rendered, complete
+}
+
+func fieldValue(f Fields, name string, width int) string {
+	number := func(n int) string {
+		if n <= 0 {
+			return ""
+		}
+		return fmt.Sprintf("%0*d", width, n)
+	}
+
+	switch name {
+	case "title":
+		return f.Title
+	case "year":
+		return number(f.Year)
+	case "season":
+		return number(f.Season)
+	case "artist":
+		return f.Artist
+	case "album":
+		return f.Album
+	}
+	return ""
+}
+
+// maxSegment is the longest path component in bytes, kept under the usual
+// 255 byte filesystem limit
+const maxSegment = 200
+
+var (
+	unsafeChars = regexp.MustCompile(`[<>:"/\\|?*\x00-\x1f]`)
+	spaces      = regexp.MustCompile(`\s+`)
+)
+
+// SanitizeSegment makes s safe to use as a single path component on the
+// filesystems media servers usually sit on. It returns "" if nothing usable is left.
+func SanitizeSegment(s string) string {
+	s = unsafeChars.ReplaceAllString(s, " ")
+	s = spaces.ReplaceAllString(s, " ")
+	s = strings.Trim(s, " .")
+	if s == "" || s == "." || s == ".." {
+		return ""
+	}
+	if len(s) > maxSegment {
+		// Back off to the start of a rune so a long title isn't cut in half
+		end := maxSegment
+		for end > 0 && !utf8.RuneStart(s[end]) {
+			end--
+		}
+		s = strings.TrimRight(s[:end], " .")
+	}
+	return s
+}
+
+// GuessFields fills template fields from a torrent name using the release
+// parser: the title (the original one for RuTracker style names), the year,
+// the season when the torrent covers exactly one, and for "Artist - Album"
+// style names the artist and album.
+func GuessFields(name string) Fields {
+	info := release.Parse(name)
+	f := Fields{
+		Title: info.PreferredTitle(),
+		Year:  info.Year,
+	}
+	if len(info.Seasons) == 1 {
+		f.Season = info.Seasons[0]
+	}
+	if !info.IsEpisodic() {
+		if artist, album, ok := strings.Cut(f.Title, " - "); ok {
+			f.Artist = strings.TrimSpace(artist)
+			f.Album = strings.TrimSpace(album)
+		}
+	}
+	return f
+}
@@ -0,0 +1,151 @@
+// Package classify suggests which content type (category) a torrent belongs
+// to from the tracker category it was listed under and cues in its name.
+package classify
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/hasmikatom/torrent/category"
+	"github.com/hasmikatom/torrent/release"
+)
+
+// Result is the classifier's verdict about a torrent
+type Result struct {
+	Kind       string
+	Confidence float64
+	Reasons    []string
+}
+
+// Suggestion is a Result resolved to a configured category
+type Suggestion struct {
+	ContentType string   `json:"contentType"`
+	Kind        string   `json:"kind"`
+	Confidence  float64  `json:"confidence"`
+	Reasons     []string `json:"reasons,omitempty"`
+}
+
+// fallbacks are tried when a kind has no category of its own
+var fallbacks = map[string]string{
+	Anime:       Series,
+	Documentary: Movie,
+}
+
+var (
+	audiobookWords = []string{"audiobook", "audio book", "аудиокнига", "читает"}
+	musicWords     = []string{"discography", "дискография", "album", "альбом"}
+	musicAudio     = map[string]bool{"FLAC": true, "ALAC": true, "MP3": true, "PCM": true, "Opus": true}
+)
+
+// Classify weighs the tracker category and the name cues against each other.
+// Evidence for the same kind adds up; evidence for another kind lowers the
+// confidence of the winner.
+func Classify(config *Config, trackerCategory, name string, info release.Info) Result {
+	scores := map[string]float64{}
+	reasons := map[string][]string{}
+	add := func(kind string, weight float64, reason string) {
+		scores[kind] = 1 - (1-scores[kind])*(1-weight)
+		reasons[kind] = append(reasons[kind], reason)
+	}
+
+	if rule, ok := config.matchTracker(trackerCategory); ok {
+		add(rule.Kind, rule.Weight, fmt.Sprintf("tracker category %q", trackerCategory))
+	}
+
+	lower := strings.ToLower(name)
+	video := info.Resolution != "" || info.Source != "" || info.Codec != "" || info.HDR != ""
+
+	switch {
+	case containsAny(lower, audiobookWords):
+		add(Audiobook, 0.6, "audiobook in name")
+	case info.IsEpisodic() && strings.HasPrefix(strings.TrimSpace(name), "[") && len(info.Seasons) == 0:
+		add(Anime, 0.5, "fansub style episode name")
+	case info.IsEpisodic():
+		add(Series, 0.6, "season/episode markers in name")
+	case !video && (musicAudio[info.Audio] || containsAny(lower, musicWords)):
+		add(Music, 0.6, "audio only release")
+	case video && info.Year > 0:
+		add(Movie, 0.5, "video release with a year")
+	case video:
+		add(Movie, 0.3, "video release")
+	}
+
+	if strings.Contains(lower, "documentary") {
+		add(Documentary, 0.4, "documentary in name")
+	}
+
+	if len(scores) == 0 {
+		return Result{}
+	}
+
+	kinds := make([]string, 0, len(scores))
+	for kind := range scores {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		if scores[kinds[i]] != scores[kinds[j]] {
+			return scores[kinds[i]] > scores[kinds[j]]
+		}
+		return kinds[i] < kinds[j]
+	})
+
+	best := kinds[0]
+	confidence := scores[best]
+	if len(kinds) > 1 {
+		confidence -= scores[kinds[1]] / 2
+	}
+	return Result{
+		Kind:       best,
+		Confidence: math.Round(math.Max(confidence, 0)*100) / 100,
+		Reasons:    reasons[best],
+	}
+}
+
+// ContentType returns the category id for a kind, using the fallback kind
+// when the first choice isn't a configured category
+func (c *Config) ContentType(kind string, exists func(id string) bool) (string, bool) {
+	for kind != "" {
+		if id, ok := c.ContentTypes[kind]; ok && exists(id) {
+			return id, true
+		}
+		kind = fallbacks[kind]
+	}
+	return "", false
+}
+
+// Suggest classifies a torrent and resolves the result to one of the
+// configured categories. It returns nil when there is nothing to go on.
+func Suggest(trackerCategory, name string, info release.Info) *Suggestion {
+	config := LoadConfig()
+	result := Classify(config, trackerCategory, name, info)
+	if result.Kind == "" {
+		return nil
+	}
+
+	categories := category.Load()
+	id, ok := config.ContentType(result.Kind, func(id string) bool {
+		_, ok := categories.Get(id)
+		return ok
+	})
+	if !ok {
+		return nil
+	}
+
+	return &Suggestion{
+		ContentType: id,
+		Kind:        result.Kind,
+		Confidence:  result.Confidence,
+		Reasons:     result.Reasons,
+	}
+}
+
+func containsAny(s string, words []string) bool {
+	for _, w := range words {
+		if strings.Contains(s, w) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package classify
+
+import (
+	"testing"
+
+	"github.com/hasmikatom/torrent/release"
+)
+
+func TestClassify(t *testing.T) {
+	config := getDefaultConfig()
+
+	cases := []struct {
+		tracker string
+		name    string
+		kind    string
+		minConf float64
+		maxConf float64
+	}{
+		{"Video > HD - TV shows", "Show.Name.S02E05.1080p.WEB-DL.x265-GRP", Series, 0.9, 1},
+		{"Video > HD - Movies", "Movie.Title.2021.1080p.BluRay.x264-GRP", Movie, 0.85, 1},
+		{"Зарубежные сериалы (HD Video)", "Во все тяжкие / Breaking Bad / Сезон: 1 / Серии: 1-7 из 7 [2008, BDRip 1080p] MVO", Series, 0.9, 1},
+		{"Наше кино", "Брат (Алексей Балабанов) [1997, Россия, драма, BDRip 720p]", Movie, 0.85, 1},
+		{"Документальные фильмы (HD Video)", "Планета Земля / Planet Earth [2006, BDRip 1080p]", Documentary, 0.5, 1},
+		{"Аниме (HD Video)", "[SubsPlease] Frieren - 05 (1080p)", Anime, 0.85, 1},
+		{"Аудиокниги", "Толстой - Война и мир [2010, MP3, 128kbps]", Audiobook, 0.5, 1},
+		{"Rock (lossless)", "Artist - Album (2019) [FLAC]", Music, 0.9, 1},
+		{"Audio > Music", "Artist - Album (2019) [MP3 320]", Music, 0.9, 1},
+		{"", "Show.Name.S01E01.720p.HDTV.x264-GRP", Series, 0.6, 0.6},
+		{"", "Movie.Title.2021.1080p.BluRay.x264-GRP", Movie, 0.5, 0.5},
+		// The tracker says movie, the name says series: still a movie, but unsure
+		{"Video > Movies", "Show.Name.S01E01.720p.HDTV.x264-GRP", Movie, 0.4, 0.6},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.tracker+"|"+tc.name, func(t *testing.T) {
+			got := Classify(config, tc.tracker, tc.name, release.Parse(tc.name))
+			if got.Kind != tc.kind {
+				t.Fatalf("kind = %q, want %q (%+v)", got.Kind, tc.kind, got)
+			}
+			if got.Confidence < tc.minConf || got.Confidence > tc.maxConf {
+				t.Fatalf("confidence = %v, want between %v and %v", got.Confidence, tc.minConf, tc.maxConf)
+			}
+			if len(got.Reasons) == 0 {
+				t.Fatalf("expected reasons")
+			}
+		})
+	}
+}
+
+func TestClassify_NothingToGoOn(t *testing.T) {
+	got := Classify(getDefaultConfig(), "Other > Other", "something", release.Parse("something"))
+	if got.Kind != "" || got.Confidence != 0 {
+		t.Fatalf("expected no verdict, got %+v", got)
+	}
+}
+
+func TestClassify_ConfiguredRulesComeFirst(t *testing.T) {
+	config := getDefaultConfig()
+	config.TrackerCategories = []TrackerRule{{Match: []string{"Мультсериалы"}, Kind: "kids", Weight: 0.9}}
+
+	got := Classify(config, "Мультсериалы", "", release.Info{})
+	if got.Kind != "kids" || got.Confidence != 0.9 {
+		t.Fatalf("got %+v", got)
+	}
+}
+
+func TestContentType_FallsBack(t *testing.T) {
+	config := getDefaultConfig()
+	exists := func(id string) bool { return id == "Movies" || id == "Series" }
+
+	cases := map[string]string{
+		Anime:       "Series",
+		Documentary: "Movies",
+		Movie:       "Movies",
+		Audiobook:   "",
+	}
+	for kind, want := range cases {
+		got, ok := config.ContentType(kind, exists)
+		if got != want || ok != (want != "") {
+			t.Errorf("ContentType(%q) = %q, %v; want %q", kind, got, ok, want)
+		}
+	}
+}
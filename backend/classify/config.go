@@ -0,0 +1,123 @@
+package classify
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/hasmikatom/torrent/configfile"
+)
+
+// Kinds of content the classifier can recognise
+const (
+	Movie       = "movie"
+	Series      = "series"
+	Music       = "music"
+	Anime       = "anime"
+	Audiobook   = "audiobook"
+	Documentary = "documentary"
+)
+
+// TrackerRule maps tracker categories containing any of Match
+// (case-insensitive) to a kind of content
+type TrackerRule struct {
+	Match  []string `json:"match"`
+	Kind   string   `json:"kind"`
+	Weight float64  `json:"weight,omitempty"`
+}
+
+// Config is the contents of config/classifier.json
+type Config struct {
+	// ContentTypes maps each kind to the category id it is downloaded into
+	ContentTypes map[string]string `json:"contentTypes"`
+	// MinConfidence is the lowest confidence finalize acts on by itself
+	MinConfidence float64 `json:"minConfidence"`
+	// TrackerCategories are checked before the built-in rules
+	TrackerCategories []TrackerRule `json:"trackerCategories,omitempty"`
+}
+
+// defaultTrackerWeight is how much a matching tracker category counts when
+// its rule doesn't say
+const defaultTrackerWeight = 0.8
+
+// builtinRules cover The Pirate Bay's "Video > HD - TV shows" style
+// categories and RuTracker's forum names. Order matters: the first rule
+// that matches wins, so "Документальные фильмы" must come before "фильм".
+var builtinRules = []TrackerRule{
+	{Match: []string{"audio book", "audiobook", "аудиокниг", "радиоспектакл"}, Kind: Audiobook},
+	{Match: []string{"anime", "аниме"}, Kind: Anime},
+	{Match: []string{"documentar", "документальн", "научно-популярн"}, Kind: Documentary},
+	{Match: []string{"music video", "концерт"}, Kind: Music, Weight: 0.5},
+	{Match: []string{"tv show", "tv series", "сериал"}, Kind: Series},
+	{Match: []string{"movie", "фильм", "кино"}, Kind: Movie},
+	{Match: []string{"music", "музык", "lossless", "lossy", "flac", "mp3", "audio >"}, Kind: Music},
+}
+
+var (
+	classifierConfig     *Config
+	classifierConfigOnce sync.Once
+)
+
+// LoadConfig reads config/classifier.json once, falling back to sending
+// each kind to the category of the same name in the shipped categories.json
+func LoadConfig() *Config {
+	classifierConfigOnce.Do(func() {
+		var config Config
+		path, err := configfile.Load("classifier.json", &config)
+		if err != nil {
+			log.Printf("Warning: %v, using default classifier config", err)
+			classifierConfig = getDefaultConfig()
+			return
+		}
+		log.Printf("Loaded classifier config from: %s", path)
+
+		defaults := getDefaultConfig()
+		if len(config.ContentTypes) == 0 {
+			config.ContentTypes = defaults.ContentTypes
+		}
+		if config.MinConfidence <= 0 {
+			config.MinConfidence = defaults.MinConfidence
+		}
+		classifierConfig = &config
+	})
+
+	return classifierConfig
+}
+
+func getDefaultConfig() *Config {
+	return &Config{
+		ContentTypes: map[string]string{
+			Movie:       "Movies",
+			Series:      "Series",
+			Music:       "Music",
+			Anime:       "Anime",
+			Audiobook:   "Audiobooks",
+			Documentary: "Documentaries",
+		},
+		MinConfidence: 0.5,
+	}
+}
+
+// rules returns the configured tracker rules followed by the built-in ones
+func (c *Config) rules() []TrackerRule {
+	return append(append([]TrackerRule{}, c.TrackerCategories...), builtinRules...)
+}
+
+// matchTracker returns the first rule matching a tracker category
+func (c *Config) matchTracker(trackerCategory string) (TrackerRule, bool) {
+	lower := strings.ToLower(trackerCategory)
+	if lower == "" {
+		return TrackerRule{}, false
+	}
+	for _, rule := range c.rules() {
+		for _, m := range rule.Match {
+			if m != "" && strings.Contains(lower, strings.ToLower(m)) {
+				if rule.Weight <= 0 {
+					rule.Weight = defaultTrackerWeight
+				}
+				return rule, true
+			}
+		}
+	}
+	return TrackerRule{}, false
+}
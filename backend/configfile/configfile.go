@@ -0,0 +1,42 @@
+package configfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// searchDirs are tried in order, mirroring where scrapers.json is looked up
+// for local runs, air hot reload and the Docker image
+var searchDirs = []string{
+	"config",
+	"../config",
+	"/app/config",
+}
+
+// Load finds name in the config search dirs and decodes it into v.
+// It returns the path that was read, or an error if no file was found or it
+// could not be parsed.
+func Load(name string, v any) (string, error) {
+	var data []byte
+	var err error
+	var path string
+	for _, dir := range searchDirs {
+		path = filepath.Join(dir, name)
+		data, err = os.ReadFile(path)
+		if err == nil {
+			break
+		}
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("could not load %s: %v", name, err)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return path, fmt.Errorf("could not parse %s: %v", path, err)
+	}
+
+	return path, nil
+}
@@ -0,0 +1,137 @@
+package disk
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/hasmikatom/torrent/category"
+	"github.com/hasmikatom/torrent/configfile"
+)
+
+// What happens to a torrent that doesn't fit
+const (
+	// OnFullRefuse refuses to add or start it
+	OnFullRefuse = "refuse"
+	// OnFullQueue keeps it paused until enough space frees up
+	OnFullQueue = "queue"
+)
+
+// defaultReserve is kept free on every mount when the config doesn't say
+const defaultReserve = configfile.ByteSize(1 << 30)
+
+// Mount describes one filesystem, named by its mount path. Category roots
+// under the path are bound to it.
+type Mount struct {
+	Path    string              `json:"path"`
+	Reserve configfile.ByteSize `json:"reserve"`
+	// Device or UUID pin the filesystem that must be mounted at Path, as
+	// /proc/mounts names the device or as listed in /dev/disk/by-uuid.
+	// Required only asks for something other than the root filesystem.
+	Device   string `json:"device,omitempty"`
+	UUID     string `json:"uuid,omitempty"`
+	Required bool   `json:"required,omitempty"`
+}
+
+// Config is the contents of config/storage.json
+type Config struct {
+	// OnFull is "refuse" (the default) or "queue"
+	OnFull string `json:"onFull,omitempty"`
+	// Reserve is kept free on mounts that aren't listed, 1 GiB by default
+	Reserve *configfile.ByteSize `json:"reserve,omitempty"`
+	Mounts  []Mount              `json:"mounts,omitempty"`
+}
+
+var (
+	storageConfig     *Config
+	storageConfigOnce sync.Once
+)
+
+// LoadConfig reads config/storage.json once. Without it torrents that would
+// leave less than 1 GiB free are refused.
+func LoadConfig() *Config {
+	storageConfigOnce.Do(func() {
+		var config Config
+		path, err := configfile.Load("storage.json", &config)
+		if err != nil {
+			log.Printf("Warning: %v, using default storage settings", err)
+			storageConfig = &Config{OnFull: OnFullRefuse}
+			return
+		}
+		log.Printf("Loaded storage config from: %s", path)
+
+		switch config.OnFull {
+		case OnFullRefuse, OnFullQueue:
+		case "":
+			config.OnFull = OnFullRefuse
+		default:
+			log.Printf("Warning: unknown onFull %q in %s, refusing torrents that don't fit", config.OnFull, path)
+			config.OnFull = OnFullRefuse
+		}
+		config.Mounts = validMounts(config.Mounts)
+		storageConfig = &config
+	})
+
+	return storageConfig
+}
+
+// validMounts drops mounts with unusable paths, logging why
+func validMounts(mounts []Mount) []Mount {
+	var valid []Mount
+	for _, m := range mounts {
+		if err := m.validate(); err != nil {
+			log.Printf("Warning: skipping mount %q: %v", m.Path, err)
+			continue
+		}
+		valid = append(valid, m)
+	}
+	return valid
+}
+
+func (m Mount) validate() error {
+	if err := category.ValidateRoot(m.Path); err != nil {
+		return err
+	}
+	if m.Reserve < 0 {
+		return fmt.Errorf("reserve cannot be negative")
+	}
+	if strings.ContainsAny(m.UUID, "/\\") || m.UUID == "." || m.UUID == ".." {
+		return fmt.Errorf("invalid uuid %q", m.UUID)
+	}
+	return nil
+}
+
+// Expected reports whether downloads into the mount depend on it being there
+func (m Mount) Expected() bool {
+	return m.Required || m.Device != "" || m.UUID != ""
+}
+
+// Queue reports whether torrents that don't fit wait for space
+func (c *Config) Queue() bool {
+	return c.OnFull == OnFullQueue
+}
+
+// MountFor returns the configured mount holding path, preferring the
+// deepest one
+func (c *Config) MountFor(path string) (Mount, bool) {
+	var found Mount
+	ok := false
+	for _, m := range c.Mounts {
+		if category.Within(m.Path, path) && (!ok || len(m.Path) > len(found.Path)) {
+			found, ok = m, true
+		}
+	}
+	return found, ok
+}
+
+// ReserveFor is the free space to keep on the filesystem holding path
+func (c *Config) ReserveFor(path string) int64 {
+	if m, ok := c.MountFor(path); ok {
+		return int64(m.Reserve)
+	}
+	if c.Reserve != nil {
+		return int64(*c.Reserve)
+	}
+	return int64(defaultReserve)
+}
@@ -0,0 +1,66 @@
+// Package disk answers questions about the filesystems downloads live on
+// and keeps torrents from filling them up.
+package disk
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Free returns the bytes available to unprivileged users on the
+// filesystem holding path
+func Free(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
+
+// Existing returns path or its closest ancestor that exists, so questions
+// about a download folder that hasn't been created yet can still be answered
+func Existing(path string) (string, bool) {
+	for p := filepath.Clean(path); ; p = filepath.Dir(p) {
+		if _, err := os.Stat(p); err == nil {
+			return p, true
+		}
+		if p == filepath.Dir(p) {
+			return "", false
+		}
+	}
+}
+
+// Device returns the id of the filesystem holding path
+func Device(path string) (uint64, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, false
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Dev), true
+}
+
+// MountPoint returns the top folder of the filesystem holding path, found
+// by walking up until the device changes
+func MountPoint(path string) (string, bool) {
+	p, ok := Existing(path)
+	if !ok {
+		return "", false
+	}
+	dev, ok := Device(p)
+	if !ok {
+		return "", false
+	}
+	for p != filepath.Dir(p) {
+		parent := filepath.Dir(p)
+		if d, ok := Device(parent); !ok || d != dev {
+			break
+		}
+		p = parent
+	}
+	return p, true
+}
@@ -0,0 +1,294 @@
+package disk
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hasmikatom/torrent/category"
+	"github.com/hasmikatom/torrent/configfile"
+	"github.com/hasmikatom/torrent/events"
+	"github.com/hasmikatom/torrent/transmission"
+)
+
+const gb = 1 << 30
+
+func testGuard(config *Config, free map[string]uint64, torrents *[]transmission.Torrent) *Guard {
+	g := NewGuard(config, func(dir string) (uint64, error) {
+		if m, ok := config.MountFor(dir); ok {
+			return free[m.Path], nil
+		}
+		return 0, errors.New("unknown disk")
+	}, func() ([]transmission.Torrent, error) {
+		return *torrents, nil
+	})
+	g.sameDisk = func(a, b string) bool {
+		ma, _ := config.MountFor(a)
+		mb, _ := config.MountFor(b)
+		return ma.Path == mb.Path
+	}
+	return g
+}
+
+func TestConfig_ReserveFor(t *testing.T) {
+	reserve := configfile.ByteSize(5 * gb)
+	c := &Config{Reserve: &reserve, Mounts: []Mount{
+		{Path: "/mediastorage", Reserve: 10 * gb},
+		{Path: "/mediastorage/ssd", Reserve: 0},
+	}}
+	cases := map[string]int64{
+		"/mediastorage/Movies":       10 * gb,
+		"/mediastorage/ssd/Incoming": 0,
+		"/srv/other":                 5 * gb,
+	}
+	for path, want := range cases {
+		if got := c.ReserveFor(path); got != want {
+			t.Errorf("ReserveFor(%s) = %d, want %d", path, got, want)
+		}
+	}
+	if got := (&Config{}).ReserveFor("/anything"); got != gb {
+		t.Errorf("default reserve = %d", got)
+	}
+}
+
+func TestGuard_Check(t *testing.T) {
+	config := &Config{Mounts: []Mount{{Path: "/hdd", Reserve: gb}, {Path: "/ssd", Reserve: gb}}}
+	free := map[string]uint64{"/hdd": 10 * gb, "/ssd": 10 * gb}
+	torrents := []transmission.Torrent{
+		{HashString: "aaa", Status: transmission.StatusDownload, DownloadDir: "/hdd/Movies", LeftUntilDone: 4 * gb},
+		{HashString: "bbb", Status: transmission.StatusDownload, DownloadDir: "/ssd/TV", LeftUntilDone: 8 * gb},
+		{HashString: "ccc", Status: transmission.StatusSeed, DownloadDir: "/hdd/Movies"},
+		{HashString: "ddd", Status: transmission.StatusStopped, DownloadDir: "/hdd/Movies", LeftUntilDone: 3 * gb},
+	}
+	g := testGuard(config, free, &torrents)
+
+	if err := g.Check("/hdd/Movies", 5*gb, "new"); err != nil {
+		t.Fatalf("5 GB should fit next to 4 GB pending and 1 GB reserve: %v", err)
+	}
+
+	err := g.Check("/hdd/Movies", 6*gb, "new")
+	var full *InsufficientSpaceError
+	if !errors.As(err, &full) || full.Pending != 4*gb || full.Available() != 5*gb {
+		t.Fatalf("expected insufficient space, got %v", err)
+	}
+
+	if err := g.Check("/hdd/Movies", 9*gb, "aaa"); err != nil {
+		t.Fatalf("a torrent shouldn't compete with itself: %v", err)
+	}
+	if err := g.Check("/ssd/TV", 2*gb, "new"); err == nil {
+		t.Fatal("expected the ssd to be full")
+	}
+	if err := g.Check("/nowhere", 1, "new"); err == nil || errors.As(err, &full) {
+		t.Fatalf("expected a lookup error, got %v", err)
+	}
+	if err := g.Check("/nowhere", 0, "new"); err != nil {
+		t.Fatalf("unknown sizes are never refused: %v", err)
+	}
+}
+
+func TestQueue(t *testing.T) {
+	config := &Config{OnFull: OnFullQueue, Mounts: []Mount{{Path: "/hdd"}}}
+	free := map[string]uint64{"/hdd": 10 * gb}
+	torrents := []transmission.Torrent{
+		{HashString: "big", Status: transmission.StatusStopped, DownloadDir: "/hdd"},
+		{HashString: "small", Status: transmission.StatusStopped, DownloadDir: "/hdd"},
+	}
+	g := testGuard(config, free, &torrents)
+
+	dir := t.TempDir()
+	var started, stopped []int
+	q, err := NewQueue(g, dir, nil, func(item Queued) error {
+		started = append(started, item.TorrentID)
+		return nil
+	}, func(id int) error {
+		stopped = append(stopped, id)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q.Add(Queued{TorrentID: 1, Hash: "big", Dir: "/hdd", Size: 20 * gb})
+	q.Add(Queued{TorrentID: 2, Hash: "small", Dir: "/hdd", Size: 2 * gb})
+	q.Add(Queued{TorrentID: 3, Hash: "gone", Dir: "/hdd", Size: gb})
+
+	q.Process()
+	if len(started) != 1 || started[0] != 2 {
+		t.Fatalf("started %v, want only the small torrent", started)
+	}
+	if items := q.Items(); len(items) != 1 || items[0].TorrentID != 1 {
+		t.Fatalf("unexpected queue %+v", items)
+	}
+
+	torrents = append(torrents,
+		transmission.Torrent{HashString: "magnet", Status: transmission.StatusDownload, DownloadDir: "/hdd", LeftUntilDone: 30 * gb},
+		transmission.Torrent{HashString: "finalize", Status: transmission.StatusStopped, DownloadDir: "/hdd", LeftUntilDone: 30 * gb},
+	)
+	q.CheckMetadata(events.Torrent{ID: 4, Hash: "magnet", DownloadDir: "/hdd"})
+	q.CheckMetadata(events.Torrent{ID: 5, Hash: "finalize", DownloadDir: "/hdd"})
+	if len(stopped) != 1 || stopped[0] != 4 || len(q.Items()) != 2 {
+		t.Fatalf("expected only the downloading magnet to be paused and queued, stopped %v", stopped)
+	}
+
+	free["/hdd"] = 100 * gb
+	torrents[2].Status = transmission.StatusStopped
+	q.Process()
+	if len(started) != 3 || len(q.Items()) != 0 {
+		t.Fatalf("started %v, queue %+v", started, q.Items())
+	}
+
+	reloaded, err := NewQueue(g, dir, nil, nil, nil)
+	if err != nil || len(reloaded.Items()) != 0 {
+		t.Fatalf("expected the empty queue to be saved, got %+v, %v", reloaded.Items(), err)
+	}
+}
+
+func TestParseMountTable(t *testing.T) {
+	table := "overlay / overlay rw,relatime 0 0\n" +
+		"/dev/sdb1 /media\\040storage ext4 ro,noatime 0 0\n"
+	entries, err := parseMountTable(strings.NewReader(table))
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("unexpected entries %+v, %v", entries, err)
+	}
+	if e := entries[1]; e.MountPoint != "/media storage" || e.Device != "/dev/sdb1" || !e.ReadOnly() || entries[0].ReadOnly() {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+}
+
+func TestMountChecker(t *testing.T) {
+	root := t.TempDir()
+	media := filepath.Join(root, "media")
+	if err := os.Mkdir(media, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(root, "missing")
+
+	table := []MountEntry{
+		{Device: "overlay", MountPoint: "/", Options: []string{"rw"}},
+		{Device: "/dev/sdb1", MountPoint: media, FSType: "ext4", Options: []string{"rw"}},
+	}
+	links := map[string]string{
+		"/dev/disk/by-uuid/1234-abcd": "/dev/sdb1",
+		"/dev/mapper/media":           "/dev/sdb1",
+	}
+	var readOnly error
+	m := NewMountChecker(&Config{})
+	m.table = func() ([]MountEntry, error) { return table, nil }
+	m.resolve = func(p string) (string, error) {
+		if to, ok := links[p]; ok {
+			return to, nil
+		}
+		if strings.HasPrefix(p, "/dev/disk") {
+			return "", os.ErrNotExist
+		}
+		return p, nil
+	}
+	m.writable = func(string) error { return readOnly }
+
+	cases := []struct {
+		name    string
+		mount   Mount
+		problem string
+	}{
+		{"by device", Mount{Path: media, Device: "/dev/sdb1"}, ""},
+		{"by device symlink", Mount{Path: media, Device: "/dev/mapper/media"}, ""},
+		{"by uuid", Mount{Path: media, UUID: "1234-abcd"}, ""},
+		{"other device", Mount{Path: media, Device: "/dev/sdc1"}, "expected /dev/sdc1"},
+		{"unknown uuid", Mount{Path: media, UUID: "ffff"}, "no filesystem with UUID"},
+		{"not mounted", Mount{Path: root, Required: true}, "on the root filesystem"},
+		{"missing folder", Mount{Path: missing, Required: true}, "does not exist"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m.config.Mounts = []Mount{tc.mount}
+			err := m.Ready(filepath.Join(tc.mount.Path, "Movies"))
+			var blocked *MountError
+			if tc.problem == "" {
+				if err != nil {
+					t.Fatalf("expected the mount to be ready, got %v", err)
+				}
+				return
+			}
+			if !errors.As(err, &blocked) || !strings.Contains(blocked.Problem, tc.problem) {
+				t.Fatalf("expected a problem with %q, got %v", tc.problem, err)
+			}
+		})
+	}
+
+	m.config.Mounts = []Mount{{Path: media, Device: "/dev/sdb1"}, {Path: missing}}
+	if err := m.Ready(filepath.Join(missing, "x")); err != nil {
+		t.Fatalf("mounts without expectations aren't checked: %v", err)
+	}
+	table[1].Options = []string{"ro"}
+	if s := m.Check(); len(s) != 1 || !strings.Contains(s[0].Problem, "read-only") || s[0].MountedFrom != "/dev/sdb1" {
+		t.Fatalf("unexpected statuses %+v", s)
+	}
+	table[1].Options = []string{"rw"}
+	readOnly = errors.New("permission denied")
+	if s := m.Check(); !strings.Contains(s[0].Problem, "not writable") {
+		t.Fatalf("unexpected statuses %+v", s)
+	}
+	if m.Healthy() {
+		t.Fatal("expected a failing mount to make the checker unhealthy")
+	}
+	readOnly = nil
+	m.Check()
+	if !m.Healthy() {
+		t.Fatal("expected the checker to be healthy once the mount recovers")
+	}
+}
+
+func TestPlacer_Place(t *testing.T) {
+	config := &Config{Mounts: []Mount{{Path: "/disk1", Reserve: gb}, {Path: "/disk2", Reserve: gb}, {Path: "/disk3", Reserve: gb}}}
+	free := map[string]uint64{"/disk1": 5 * gb, "/disk2": 20 * gb, "/disk3": 50 * gb}
+	torrents := []transmission.Torrent{}
+	down := map[string]bool{"/disk3/Movies": true}
+	ready := func(dir string) error {
+		if down[dir] {
+			return errors.New("not mounted")
+		}
+		return nil
+	}
+	dir := t.TempDir()
+	p, err := NewPlacer(testGuard(config, free, &torrents), dir, ready)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	movies := category.Category{ID: "Movies", Root: "/disk1/Movies", Roots: []string{"/disk1/Movies", "/disk2/Movies", "/disk3/Movies"}}
+	if root := p.Place("aaa", movies, 2*gb); root != "/disk2/Movies" {
+		t.Fatalf("most free should skip the missing mount, got %s", root)
+	}
+
+	movies.Placement = category.PlacementFillInOrder
+	if root := p.Place("bbb", movies, 2*gb); root != "/disk1/Movies" {
+		t.Fatalf("fill in order should take the first root that fits, got %s", root)
+	}
+	if root := p.Place("ccc", movies, 10*gb); root != "/disk2/Movies" {
+		t.Fatalf("fill in order should skip roots that are too small, got %s", root)
+	}
+
+	// A placed torrent keeps its root, even across restarts
+	p, err = NewPlacer(testGuard(config, free, &torrents), dir, ready)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root := p.Place("BBB", movies, 10*gb); root != "/disk1/Movies" {
+		t.Fatalf("expected the remembered root, got %s", root)
+	}
+
+	down["/disk1/Movies"], down["/disk2/Movies"] = true, true
+	if err := p.Ready(movies); err == nil {
+		t.Fatal("expected an error with every root missing")
+	}
+	if root := p.Place("ddd", movies, gb); root != "/disk1/Movies" {
+		t.Fatalf("expected the primary root when nothing can be checked, got %s", root)
+	}
+
+	p.Forget("aaa")
+	if _, ok := p.Root("aaa"); ok {
+		t.Fatal("expected the placement to be forgotten")
+	}
+}
@@ -0,0 +1,130 @@
+package disk
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hasmikatom/torrent/configfile"
+	"github.com/hasmikatom/torrent/transmission"
+)
+
+// Fields are the torrent-get fields the guard needs
+var Fields = []string{"id", "hashString", "name", "status", "downloadDir", "leftUntilDone", "sizeWhenDone", "totalSize"}
+
+// Space is the room a download directory has for new torrents
+type Space struct {
+	Path string
+	// Free is what the filesystem has left, Pending what torrents already
+	// downloading to it still need, Reserve what is kept free
+	Free    int64
+	Pending int64
+	Reserve int64
+}
+
+// Available is what a new torrent may still use
+func (s Space) Available() int64 {
+	return max(0, s.Free-s.Pending-s.Reserve)
+}
+
+// InsufficientSpaceError says a torrent doesn't fit on its disk
+type InsufficientSpaceError struct {
+	Space
+	Requested int64
+}
+
+func (e *InsufficientSpaceError) Error() string {
+	msg := fmt.Sprintf("not enough disk space at %s: needs %s, %s free", e.Path,
+		configfile.FormatByteSize(e.Requested), configfile.FormatByteSize(e.Free))
+	if e.Pending > 0 {
+		msg += fmt.Sprintf(", %s of it promised to downloads in progress", configfile.FormatByteSize(e.Pending))
+	}
+	return msg + fmt.Sprintf(", %s kept in reserve", configfile.FormatByteSize(e.Reserve))
+}
+
+// Guard checks that torrents fit on the disk they download to
+type Guard struct {
+	config *Config
+	// free returns the bytes available at a download directory
+	free func(dir string) (uint64, error)
+	// list returns every torrent with Fields
+	list func() ([]transmission.Torrent, error)
+	// sameDisk reports whether two download directories share a filesystem
+	sameDisk func(a, b string) bool
+}
+
+// NewGuard returns a guard for config
+func NewGuard(config *Config, free func(dir string) (uint64, error), list func() ([]transmission.Torrent, error)) *Guard {
+	return &Guard{config: config, free: free, list: list, sameDisk: config.SameDisk}
+}
+
+// Config returns the guard's config
+func (g *Guard) Config() *Config {
+	return g.config
+}
+
+// Check returns an *InsufficientSpaceError when size more bytes don't fit
+// in dir once the reserve and what downloading torrents on the same disk
+// still need are set aside. The torrent being checked, by hash, is not
+// counted as pending.
+func (g *Guard) Check(dir string, size int64, hash string) error {
+	if size <= 0 {
+		return nil
+	}
+
+	space, err := g.Space(dir, hash)
+	if err != nil {
+		return err
+	}
+	if size > space.Available() {
+		return &InsufficientSpaceError{Space: space, Requested: size}
+	}
+	return nil
+}
+
+// Space returns the room dir has, not counting the torrent with hash as
+// pending
+func (g *Guard) Space(dir, hash string) (Space, error) {
+	free, err := g.free(dir)
+	if err != nil {
+		return Space{}, fmt.Errorf("failed to check free space at %s: %v", dir, err)
+	}
+	torrents, err := g.list()
+	if err != nil {
+		return Space{}, fmt.Errorf("failed to list torrents: %v", err)
+	}
+
+	var pending int64
+	for _, t := range torrents {
+		if strings.EqualFold(t.HashString, hash) || t.LeftUntilDone <= 0 {
+			continue
+		}
+		if t.Status != transmission.StatusDownload && t.Status != transmission.StatusDownloadWait &&
+			t.Status != transmission.StatusCheck && t.Status != transmission.StatusCheckWait {
+			continue
+		}
+		if g.sameDisk(dir, t.DownloadDir) {
+			pending += t.LeftUntilDone
+		}
+	}
+
+	return Space{Path: dir, Free: int64(free), Pending: pending, Reserve: g.config.ReserveFor(dir)}, nil
+}
+
+// SameDisk reports whether two paths are on one filesystem. Paths that
+// exist here are compared by device; otherwise they share a disk when they
+// fall under the same configured mount, and are assumed to when neither
+// does.
+func (c *Config) SameDisk(a, b string) bool {
+	ea, okA := Existing(a)
+	eb, okB := Existing(b)
+	if okA && okB && ea != "/" && eb != "/" {
+		da, okA := Device(ea)
+		db, okB := Device(eb)
+		if okA && okB {
+			return da == db
+		}
+	}
+	ma, okA := c.MountFor(a)
+	mb, okB := c.MountFor(b)
+	return okA == okB && ma.Path == mb.Path
+}
@@ -0,0 +1,303 @@
+package disk
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hasmikatom/torrent/category"
+)
+
+// MountEntry is one line of /proc/mounts
+type MountEntry struct {
+	Device     string
+	MountPoint string
+	FSType     string
+	Options    []string
+}
+
+// ReadOnly reports whether the filesystem is mounted read-only
+func (e MountEntry) ReadOnly() bool {
+	for _, o := range e.Options {
+		if o == "ro" {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadMountTable parses a mount table such as /proc/mounts
+func ReadMountTable(path string) ([]MountEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseMountTable(f)
+}
+
+func parseMountTable(r io.Reader) ([]MountEntry, error) {
+	var entries []MountEntry
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		entries = append(entries, MountEntry{
+			Device:     unescapeMount(fields[0]),
+			MountPoint: unescapeMount(fields[1]),
+			FSType:     fields[2],
+			Options:    strings.Split(fields[3], ","),
+		})
+	}
+	return entries, scanner.Err()
+}
+
+// unescapeMount undoes the octal escapes the kernel uses for spaces, tabs,
+// newlines and backslashes in mount table fields
+func unescapeMount(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// MountStatus is the outcome of checking one expected mount
+type MountStatus struct {
+	Path string `json:"path"`
+	// Device and UUID are what the config expects
+	Device string `json:"device,omitempty"`
+	UUID   string `json:"uuid,omitempty"`
+	// MountedFrom, MountPoint and FSType describe what is actually there
+	MountedFrom string `json:"mountedFrom,omitempty"`
+	MountPoint  string `json:"mountPoint,omitempty"`
+	FSType      string `json:"fsType,omitempty"`
+	// Problem says why downloads into the mount are blocked, empty when fine
+	Problem   string    `json:"problem,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// MountError says a download directory's mount isn't fit to download into
+type MountError struct {
+	Dir     string
+	Mount   string
+	Problem string
+}
+
+func (e *MountError) Error() string {
+	return fmt.Sprintf("downloads into %s are blocked: %s", e.Dir, e.Problem)
+}
+
+// mountCheckInterval is how often Run checks the expected mounts
+const mountCheckInterval = time.Minute
+
+// byUUID is where udev links filesystems by UUID
+const byUUID = "/dev/disk/by-uuid"
+
+// MountChecker makes sure the mounts in the config are present, are the
+// expected filesystems and can be written to, so a missing disk doesn't
+// send downloads into the container's own filesystem
+type MountChecker struct {
+	config *Config
+	// table returns the current mount table
+	table func() ([]MountEntry, error)
+	// resolve follows device symlinks such as /dev/mapper or by-uuid names
+	resolve func(path string) (string, error)
+	// writable fails when a file can't be created in dir
+	writable func(dir string) error
+
+	mu   sync.Mutex
+	last map[string]MountStatus
+}
+
+// NewMountChecker returns a checker reading /proc/mounts
+func NewMountChecker(config *Config) *MountChecker {
+	return &MountChecker{
+		config: config,
+		table: func() ([]MountEntry, error) {
+			return ReadMountTable("/proc/mounts")
+		},
+		resolve:  filepath.EvalSymlinks,
+		writable: writable,
+		last:     make(map[string]MountStatus),
+	}
+}
+
+// Check checks every expected mount now
+func (m *MountChecker) Check() []MountStatus {
+	entries, err := m.table()
+
+	var statuses []MountStatus
+	for _, mount := range m.config.Mounts {
+		if !mount.Expected() {
+			continue
+		}
+		s := m.check(mount, entries, err)
+		m.remember(s)
+		statuses = append(statuses, s)
+	}
+	return statuses
+}
+
+// Healthy reports whether every expected mount passed its latest check,
+// without checking again
+func (m *MountChecker) Healthy() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, mount := range m.config.Mounts {
+		if s, ok := m.last[mount.Path]; ok && mount.Expected() && s.Problem != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Run checks every expected mount right away, then each minute until ctx
+// is cancelled, so Healthy stays current
+func (m *MountChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(mountCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		m.Check()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Ready returns a *MountError when a mount expected to hold dir is missing,
+// read-only or not the configured filesystem
+func (m *MountChecker) Ready(dir string) error {
+	var entries []MountEntry
+	var err error
+	read := false
+
+	for _, mount := range m.config.Mounts {
+		if !mount.Expected() || !category.Within(mount.Path, dir) {
+			continue
+		}
+		if !read {
+			entries, err = m.table()
+			read = true
+		}
+		s := m.check(mount, entries, err)
+		m.remember(s)
+		if s.Problem != "" {
+			return &MountError{Dir: dir, Mount: mount.Path, Problem: s.Problem}
+		}
+	}
+	return nil
+}
+
+func (m *MountChecker) check(mount Mount, entries []MountEntry, tableErr error) MountStatus {
+	s := MountStatus{Path: mount.Path, Device: mount.Device, UUID: mount.UUID, CheckedAt: time.Now()}
+	if tableErr != nil {
+		s.Problem = fmt.Sprintf("can't read the mount table: %v", tableErr)
+		return s
+	}
+
+	// The deepest mount point at or above the path is what holds it
+	var holder *MountEntry
+	for i, e := range entries {
+		if category.Within(e.MountPoint, mount.Path) && (holder == nil || len(e.MountPoint) >= len(holder.MountPoint)) {
+			holder = &entries[i]
+		}
+	}
+	if holder != nil {
+		s.MountedFrom, s.MountPoint, s.FSType = holder.Device, holder.MountPoint, holder.FSType
+	}
+
+	if info, err := os.Stat(mount.Path); err != nil || !info.IsDir() {
+		s.Problem = fmt.Sprintf("%s does not exist", mount.Path)
+		return s
+	}
+	if holder == nil || holder.MountPoint == "/" {
+		s.Problem = fmt.Sprintf("nothing is mounted at %s, it is on the root filesystem", mount.Path)
+		return s
+	}
+
+	if mount.Device != "" && !m.sameDevice(mount.Device, holder.Device) {
+		s.Problem = fmt.Sprintf("%s is mounted from %s, expected %s", holder.MountPoint, holder.Device, mount.Device)
+		return s
+	}
+	if mount.UUID != "" {
+		dev, err := m.resolve(filepath.Join(byUUID, mount.UUID))
+		if err != nil {
+			s.Problem = fmt.Sprintf("no filesystem with UUID %s is attached", mount.UUID)
+			return s
+		}
+		if !m.sameDevice(dev, holder.Device) {
+			s.Problem = fmt.Sprintf("%s is mounted from %s, not the filesystem with UUID %s", holder.MountPoint, holder.Device, mount.UUID)
+			return s
+		}
+	}
+
+	if holder.ReadOnly() {
+		s.Problem = fmt.Sprintf("%s is mounted read-only", holder.MountPoint)
+		return s
+	}
+	if err := m.writable(mount.Path); err != nil {
+		s.Problem = fmt.Sprintf("%s is not writable: %v", mount.Path, err)
+	}
+	return s
+}
+
+// sameDevice compares device names after following symlinks
+func (m *MountChecker) sameDevice(a, b string) bool {
+	if a == b {
+		return true
+	}
+	ra, errA := m.resolve(a)
+	rb, errB := m.resolve(b)
+	return errA == nil && errB == nil && ra == rb
+}
+
+// remember stores a status, logging when a mount breaks or recovers
+func (m *MountChecker) remember(s MountStatus) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	prev, known := m.last[s.Path]
+	m.last[s.Path] = s
+	switch {
+	case s.Problem != "" && (!known || prev.Problem != s.Problem):
+		log.Printf("Warning: mount %s: %s, downloads into it are blocked", s.Path, s.Problem)
+	case s.Problem == "" && known && prev.Problem != "":
+		log.Printf("Mount %s is back, downloads into it are allowed again", s.Path)
+	}
+}
+
+// writable creates and removes a file in dir
+func writable(dir string) error {
+	f, err := os.CreateTemp(dir, ".mount-check-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
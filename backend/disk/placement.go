@@ -0,0 +1,186 @@
+package disk
+
+import (
+	"context"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hasmikatom/torrent/category"
+	"github.com/hasmikatom/torrent/events"
+	"github.com/hasmikatom/torrent/store"
+)
+
+// Placement is the root of its category's pool a torrent was put on
+type Placement struct {
+	Hash     string    `json:"hash"`
+	Category string    `json:"category"`
+	Root     string    `json:"root"`
+	Size     int64     `json:"size,omitempty"`
+	PlacedAt time.Time `json:"placedAt"`
+}
+
+// Placer picks a root from a category's pool for each torrent and
+// remembers it, so the torrent stays on that root when it is placed again
+// and its library folder is rendered on the same disk
+type Placer struct {
+	guard *Guard
+	// ready returns an error when a root's mount can't be written to
+	ready func(dir string) error
+
+	file *store.JSONFile
+
+	mu         sync.Mutex
+	placements []Placement
+}
+
+// NewPlacer loads the remembered placements from dataDir
+func NewPlacer(guard *Guard, dataDir string, ready func(dir string) error) (*Placer, error) {
+	p := &Placer{guard: guard, ready: ready, file: store.NewJSONFile(dataDir, "placements.json")}
+	if err := p.file.Load(&p.placements); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Ready returns nil when at least one root of the category's pool can be
+// downloaded to, and the primary root's problem otherwise
+func (p *Placer) Ready(cat category.Category) error {
+	var first error
+	for _, root := range cat.Pool() {
+		err := p.ready(root)
+		if err == nil {
+			return nil
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Place returns the root of cat's pool a torrent of size bytes goes on. A
+// torrent placed before keeps its root while the root is still in the
+// pool. Otherwise roots whose mount isn't ready are skipped and the rest
+// are chosen by the category's placement; when none can be checked the
+// primary root is used.
+func (p *Placer) Place(hash string, cat category.Category, size int64) string {
+	pool := cat.Pool()
+	if len(pool) == 1 {
+		return pool[0]
+	}
+	if placed, ok := p.Root(hash); ok && slices.Contains(pool, placed) {
+		return placed
+	}
+
+	root, ok := p.choose(hash, cat, size)
+	if !ok {
+		log.Printf("Warning: no root of category %s could be checked, placing %s on %s", cat.ID, hash, pool[0])
+		return pool[0]
+	}
+	p.remember(Placement{Hash: hash, Category: cat.ID, Root: root, Size: size, PlacedAt: time.Now()})
+	return root
+}
+
+// choose picks a root by the category's placement. Fill in order takes the
+// first root the torrent fits on, or the one with most room when it fits
+// on none.
+func (p *Placer) choose(hash string, cat category.Category, size int64) (string, bool) {
+	best, bestAvailable := "", int64(-1)
+	for _, root := range cat.Pool() {
+		if err := p.ready(root); err != nil {
+			continue
+		}
+		space, err := p.guard.Space(root, hash)
+		if err != nil {
+			log.Printf("Warning: %v, skipping root %s", err, root)
+			continue
+		}
+		available := space.Available()
+		if cat.Placement == category.PlacementFillInOrder && available >= size {
+			return root, true
+		}
+		if available > bestAvailable {
+			best, bestAvailable = root, available
+		}
+	}
+	return best, best != ""
+}
+
+// Root returns the root a torrent was placed on
+func (p *Placer) Root(hash string) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, placed := range p.placements {
+		if strings.EqualFold(placed.Hash, hash) {
+			return placed.Root, true
+		}
+	}
+	return "", false
+}
+
+// Placements returns every remembered placement
+func (p *Placer) Placements() []Placement {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]Placement{}, p.placements...)
+}
+
+// Forget drops a torrent's placement
+func (p *Placer) Forget(hash string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.removeLocked(hash) {
+		p.save()
+	}
+}
+
+// Run forgets torrents as they are removed, until the channel closes or
+// ctx is cancelled
+func (p *Placer) Run(ctx context.Context, ch <-chan events.Event) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			if e.Type == events.Removed {
+				p.Forget(e.Torrent.Hash)
+			}
+		}
+	}
+}
+
+func (p *Placer) remember(placement Placement) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.removeLocked(placement.Hash)
+	p.placements = append(p.placements, placement)
+	p.save()
+}
+
+func (p *Placer) removeLocked(hash string) bool {
+	kept := p.placements[:0]
+	for _, placed := range p.placements {
+		if !strings.EqualFold(placed.Hash, hash) {
+			kept = append(kept, placed)
+		}
+	}
+	removed := len(kept) != len(p.placements)
+	p.placements = kept
+	return removed
+}
+
+func (p *Placer) save() {
+	if err := p.file.Save(p.placements); err != nil {
+		log.Printf("Failed to save root placements: %v", err)
+	}
+}
@@ -0,0 +1,228 @@
+package disk
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hasmikatom/torrent/events"
+	"github.com/hasmikatom/torrent/store"
+	"github.com/hasmikatom/torrent/transmission"
+)
+
+// checkInterval is how often queued torrents are tried when nothing
+// finished or was removed in the meantime
+const checkInterval = time.Minute
+
+// Queued is a paused torrent waiting for disk space
+type Queued struct {
+	TorrentID int    `json:"torrentId"`
+	Hash      string `json:"hash"`
+	Name      string `json:"name"`
+	Dir       string `json:"dir"`
+	Size      int64  `json:"size"`
+	// UserID is who added it, for quota accounting once it starts
+	UserID   string    `json:"userId,omitempty"`
+	Reason   string    `json:"reason"`
+	QueuedAt time.Time `json:"queuedAt"`
+}
+
+// Queue holds torrents that didn't fit and starts them, oldest first, once
+// they do. It also checks magnets when their metadata arrives, since their
+// size isn't known when they are added.
+type Queue struct {
+	guard *Guard
+	bus   *events.Bus
+	// start starts a queued torrent; stop pauses one that turned out too big
+	start func(Queued) error
+	stop  func(id int) error
+
+	file *store.JSONFile
+
+	mu    sync.Mutex
+	items []Queued
+}
+
+// NewQueue loads the queue from dataDir
+func NewQueue(guard *Guard, dataDir string, bus *events.Bus, start func(Queued) error, stop func(id int) error) (*Queue, error) {
+	q := &Queue{
+		guard: guard,
+		bus:   bus,
+		start: start,
+		stop:  stop,
+		file:  store.NewJSONFile(dataDir, "space-queue.json"),
+	}
+	if err := q.file.Load(&q.items); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// Add queues a paused torrent, replacing an earlier entry for it
+func (q *Queue) Add(item Queued) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if item.QueuedAt.IsZero() {
+		item.QueuedAt = time.Now()
+	}
+	q.removeLocked(item.Hash)
+	q.items = append(q.items, item)
+	q.save()
+}
+
+// Remove drops torrents from the queue by id, e.g. when they are cancelled
+func (q *Queue) Remove(ids []int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	kept := q.items[:0]
+	for _, item := range q.items {
+		drop := false
+		for _, id := range ids {
+			if item.TorrentID == id {
+				drop = true
+			}
+		}
+		if !drop {
+			kept = append(kept, item)
+		}
+	}
+	q.items = kept
+	q.save()
+}
+
+// Items returns the queue, oldest first
+func (q *Queue) Items() []Queued {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]Queued{}, q.items...)
+}
+
+// Run works through the queue every minute and whenever a torrent
+// completes or is removed, until the channel closes or ctx is cancelled
+func (q *Queue) Run(ctx context.Context, ch <-chan events.Event) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			q.Process()
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			switch e.Type {
+			case events.Completed, events.Removed:
+				q.Process()
+			case events.MetadataReady:
+				q.CheckMetadata(e.Torrent)
+			}
+		}
+	}
+}
+
+// Process starts every queued torrent that fits now, oldest first. A large
+// torrent doesn't hold back smaller ones behind it. Torrents that no longer
+// exist are dropped.
+func (q *Queue) Process() {
+	torrents, err := q.guard.list()
+	if err != nil {
+		log.Printf("Failed to check queued torrents: %v", err)
+		return
+	}
+	exists := make(map[string]bool, len(torrents))
+	for _, t := range torrents {
+		exists[strings.ToLower(t.HashString)] = true
+	}
+
+	for _, item := range q.Items() {
+		if !exists[strings.ToLower(item.Hash)] {
+			q.Remove([]int{item.TorrentID})
+			continue
+		}
+
+		err := q.guard.Check(item.Dir, item.Size, item.Hash)
+		var full *InsufficientSpaceError
+		if errors.As(err, &full) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to check space for queued torrent %d: %v", item.TorrentID, err)
+			return
+		}
+
+		if err := q.start(item); err != nil {
+			log.Printf("Failed to start queued torrent %d: %v", item.TorrentID, err)
+			continue
+		}
+		log.Printf("Started torrent %d (%s), there is enough disk space now", item.TorrentID, item.Name)
+		q.Remove([]int{item.TorrentID})
+	}
+}
+
+// CheckMetadata pauses a downloading magnet whose size turned out not to
+// fit, queueing it or, when queueing is off, reporting it as errored.
+// Torrents that are paused anyway, like ones waiting to be finalized, are
+// left alone; finalizing checks them.
+func (q *Queue) CheckMetadata(t events.Torrent) {
+	torrents, err := q.guard.list()
+	if err != nil {
+		log.Printf("Failed to check space for torrent %d: %v", t.ID, err)
+		return
+	}
+	var size int64
+	downloading := false
+	for _, tr := range torrents {
+		if strings.EqualFold(tr.HashString, t.Hash) {
+			size = tr.LeftUntilDone
+			downloading = tr.Status == transmission.StatusDownload || tr.Status == transmission.StatusDownloadWait
+		}
+	}
+	if !downloading {
+		return
+	}
+
+	err = q.guard.Check(t.DownloadDir, size, t.Hash)
+	var full *InsufficientSpaceError
+	if !errors.As(err, &full) {
+		return
+	}
+
+	if err := q.stop(t.ID); err != nil {
+		log.Printf("Failed to pause torrent %d that doesn't fit: %v", t.ID, err)
+		return
+	}
+	log.Printf("Paused torrent %d (%s): %v", t.ID, t.Name, full)
+
+	if q.guard.config.Queue() {
+		q.Add(Queued{TorrentID: t.ID, Hash: t.Hash, Name: t.Name, Dir: t.DownloadDir, Size: size, Reason: full.Error()})
+		return
+	}
+	if q.bus != nil {
+		e := events.New(events.Errored, t, time.Now())
+		e.Reason = full.Error()
+		q.bus.Publish(e)
+	}
+}
+
+func (q *Queue) removeLocked(hash string) {
+	for i, item := range q.items {
+		if strings.EqualFold(item.Hash, hash) {
+			q.items = append(q.items[:i], q.items[i+1:]...)
+			return
+		}
+	}
+}
+
+func (q *Queue) save() {
+	if err := q.file.Save(q.items); err != nil {
+		log.Printf("Failed to save the disk space queue: %v", err)
+	}
+}
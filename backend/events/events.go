@@ -0,0 +1,146 @@
+// Package events carries torrent state changes from the watcher to whoever
+// wants to react to them, such as webhooks and notifications.
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Type names a torrent state change
+type Type string
+
+const (
+	Added         Type = "torrent.added"
+	MetadataReady Type = "torrent.metadata_ready"
+	Completed     Type = "torrent.completed"
+	Errored       Type = "torrent.errored"
+	Stalled       Type = "torrent.stalled"
+	Removed       Type = "torrent.removed"
+	// Extracted follows Completed when post-processing unpacked archives
+	Extracted Type = "torrent.extracted"
+	// Linked follows Completed in link mode, once the files were linked into
+	// the library; the torrent's DownloadDir and Name are the library copy's
+	Linked Type = "torrent.linked"
+)
+
+// Types lists every event type in the order torrents usually go through them
+var Types = []Type{Added, MetadataReady, Completed, Extracted, Linked, Errored, Stalled, Removed}
+
+// Torrent is the snapshot of a torrent an event was raised for
+type Torrent struct {
+	ID          int    `json:"id"`
+	Hash        string `json:"hash"`
+	Name        string `json:"name"`
+	DownloadDir string `json:"downloadDir,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+	// AddedAt and DoneAt come from the daemon's addedDate and doneDate
+	AddedAt *time.Time `json:"addedAt,omitempty"`
+	DoneAt  *time.Time `json:"doneAt,omitempty"`
+	Error   string     `json:"error,omitempty"`
+}
+
+// Folder is the torrent's own folder when it has one, otherwise the
+// directory its single file was saved in
+func (t Torrent) Folder() string {
+	if t.Name != "" {
+		p := filepath.Join(t.DownloadDir, t.Name)
+		if info, err := os.Stat(p); err == nil && info.IsDir() {
+			return p
+		}
+	}
+	return t.DownloadDir
+}
+
+// Event is one state change
+type Event struct {
+	ID      string    `json:"id"`
+	Type    Type      `json:"type"`
+	Time    time.Time `json:"time"`
+	Torrent Torrent   `json:"torrent"`
+	// Reason explains errored and stalled events
+	Reason string `json:"reason,omitempty"`
+}
+
+// New returns an event with a fresh id
+func New(t Type, torrent Torrent, at time.Time) Event {
+	return Event{ID: NewID(), Type: t, Time: at, Torrent: torrent}
+}
+
+// NewID returns a random id for events and anything derived from them
+func NewID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Matches reports whether t is selected by filters. An empty filter list
+// selects everything, and "torrent.*" style prefixes select a group.
+func Matches(filters []string, t Type) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	for _, f := range filters {
+		if f == "*" || Type(f) == t {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(f, "*"); ok && strings.HasPrefix(string(t), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Bus fans events out to subscribers. Each subscriber gets its own buffered
+// channel so a slow one can't hold up the rest; events for a subscriber
+// whose buffer is full are dropped and logged.
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[string]chan Event
+}
+
+// NewBus returns an empty bus
+func NewBus() *Bus {
+	return &Bus{subs: make(map[string]chan Event)}
+}
+
+// Subscribe registers a named subscriber and returns its channel
+func (b *Bus) Subscribe(name string, buffer int) <-chan Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Event, buffer)
+	b.subs[name] = ch
+	return ch
+}
+
+// Unsubscribe removes a subscriber and closes its channel
+func (b *Bus) Unsubscribe(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ch, ok := b.subs[name]; ok {
+		close(ch)
+		delete(b.subs, name)
+	}
+}
+
+// Publish hands an event to every subscriber without blocking
+func (b *Bus) Publish(e Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for name, ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			log.Printf("Warning: dropping %s event for torrent %d, subscriber %s is full", e.Type, e.Torrent.ID, name)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package events
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		filters []string
+		t       Type
+		want    bool
+	}{
+		{nil, Completed, true},
+		{[]string{"*"}, Removed, true},
+		{[]string{"torrent.*"}, Stalled, true},
+		{[]string{"torrent.completed"}, Completed, true},
+		{[]string{"torrent.completed"}, Added, false},
+		{[]string{"torrent.added", "torrent.removed"}, Removed, true},
+		{[]string{"other.*"}, Added, false},
+	}
+
+	for _, tt := range tests {
+		if got := Matches(tt.filters, tt.t); got != tt.want {
+			t.Errorf("Matches(%v, %s) = %v, want %v", tt.filters, tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestBus_DropsWhenFull(t *testing.T) {
+	b := NewBus()
+	fast := b.Subscribe("fast", 2)
+	slow := b.Subscribe("slow", 1)
+
+	b.Publish(Event{Type: Added})
+	b.Publish(Event{Type: Completed})
+
+	if len(fast) != 2 {
+		t.Errorf("fast subscriber got %d events, want 2", len(fast))
+	}
+	if len(slow) != 1 || (<-slow).Type != Added {
+		t.Error("slow subscriber should keep the first event and drop the rest")
+	}
+
+	b.Unsubscribe("fast")
+	if _, ok := <-fast; !ok {
+		t.Error("buffered events should survive unsubscribe")
+	}
+}
+
+func TestTorrentFolder(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "Show.S01.1080p"), 0o755)
+
+	if got := (Torrent{DownloadDir: dir, Name: "Show.S01.1080p"}).Folder(); got != filepath.Join(dir, "Show.S01.1080p") {
+		t.Errorf("folder torrent gave %q", got)
+	}
+	if got := (Torrent{DownloadDir: dir, Name: "Film.mkv"}).Folder(); got != dir {
+		t.Errorf("single file torrent gave %q", got)
+	}
+}
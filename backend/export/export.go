@@ -0,0 +1,176 @@
+// Package export streams a set of files as a ZIP or TAR archive, written
+// straight to the client without temp files.
+package export
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+// Archive formats
+const (
+	Zip = "zip"
+	Tar = "tar"
+)
+
+// chunk is how much is copied between checks for cancellation
+const chunk = 1 << 20
+
+// File is one file to put in an archive
+type File struct {
+	// Name is the path inside the archive, with forward slashes
+	Name string
+	// Path is where the file is on disk
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Valid reports whether format is one Write knows
+func Valid(format string) bool {
+	return format == Zip || format == Tar
+}
+
+// ContentType is the media type of an archive format
+func ContentType(format string) string {
+	if format == Zip {
+		return "application/zip"
+	}
+	return "application/x-tar"
+}
+
+// Length is the exact size Write produces for files, when it can be told
+// up front. Files are stored uncompressed, so only headers add to their
+// sizes. ZIP archives big enough to need zip64 records aren't worked out.
+func Length(format string, files []File) (int64, bool) {
+	switch format {
+	case Tar:
+		var n int64
+		for _, f := range files {
+			h, err := tarHeaderLength(f)
+			if err != nil {
+				return 0, false
+			}
+			n += h + (f.Size+511)/512*512
+		}
+		// Two empty blocks end the archive
+		return n + 1024, true
+
+	case Zip:
+		// Local header, extended timestamp and data descriptor per file,
+		// then a central directory record, all with the name
+		const local, central, descriptor, end = 30, 46, 16, 22
+		var n int64
+		for _, f := range files {
+			var timestamp int64
+			if !f.ModTime.IsZero() {
+				timestamp = 9
+			}
+			n += local + central + 2*(int64(len(f.Name))+timestamp) + f.Size + descriptor
+		}
+		n += end
+		if len(files) >= math.MaxUint16 || n >= math.MaxUint32 {
+			return 0, false
+		}
+		return n, true
+	}
+	return 0, false
+}
+
+// tarHeaderLength is how many bytes a file's header takes, which grows
+// with PAX records for long names
+func tarHeaderLength(f File) (int64, error) {
+	var c counter
+	if err := tar.NewWriter(&c).WriteHeader(tarHeader(f)); err != nil {
+		return 0, err
+	}
+	return c.n, nil
+}
+
+func tarHeader(f File) *tar.Header {
+	return &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     f.Name,
+		Size:     f.Size,
+		Mode:     0644,
+		ModTime:  f.ModTime.Truncate(time.Second),
+	}
+}
+
+// Write streams files to w as an archive of format. It stops with ctx's
+// error once ctx is cancelled, such as when the client goes away. A file
+// that changed size since it was listed fails the archive, since its
+// length was already promised.
+func Write(ctx context.Context, w io.Writer, format string, files []File) error {
+	switch format {
+	case Tar:
+		tw := tar.NewWriter(w)
+		for _, f := range files {
+			if err := tw.WriteHeader(tarHeader(f)); err != nil {
+				return err
+			}
+			if err := copyFile(ctx, tw, f); err != nil {
+				return err
+			}
+		}
+		return tw.Close()
+
+	case Zip:
+		zw := zip.NewWriter(w)
+		for _, f := range files {
+			fw, err := zw.CreateHeader(&zip.FileHeader{
+				Name:     f.Name,
+				Method:   zip.Store,
+				Modified: f.ModTime,
+			})
+			if err != nil {
+				return err
+			}
+			if err := copyFile(ctx, fw, f); err != nil {
+				return err
+			}
+		}
+		return zw.Close()
+	}
+	return fmt.Errorf("unknown archive format %q", format)
+}
+
+// copyFile copies exactly f.Size bytes of f, a chunk at a time
+func copyFile(ctx context.Context, w io.Writer, f File) error {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	for left := f.Size; left > 0; {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := io.CopyN(w, file, min(left, chunk))
+		left -= n
+		if err == io.EOF {
+			return fmt.Errorf("%s is %d bytes shorter than listed", f.Name, left)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// counter counts what is written to it
+type counter struct {
+	n int64
+}
+
+func (c *counter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,96 @@
+package export
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testFiles(t *testing.T) []File {
+	t.Helper()
+	dir := t.TempDir()
+	contents := map[string]string{
+		"Film/Film.mkv":      strings.Repeat("v", 3000),
+		"Film/Subs/Film.srt": "subtitle",
+		"Film/" + strings.Repeat("long name ", 15) + ".nfo": "",
+	}
+	var files []File
+	for name, content := range contents {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, File{Name: name, Path: path, Size: int64(len(content)), ModTime: time.Now()})
+	}
+	return files
+}
+
+func TestWrite_MatchesLength(t *testing.T) {
+	files := testFiles(t)
+	for _, format := range []string{Zip, Tar} {
+		var buf bytes.Buffer
+		if err := Write(context.Background(), &buf, format, files); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		want, ok := Length(format, files)
+		if !ok || want != int64(buf.Len()) {
+			t.Errorf("%s: Length = %d, %v, archive is %d bytes", format, want, ok, buf.Len())
+		}
+
+		read := map[string]int64{}
+		if format == Zip {
+			zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, f := range zr.File {
+				read[f.Name] = int64(f.UncompressedSize64)
+			}
+		} else {
+			tr := tar.NewReader(&buf)
+			for {
+				h, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				read[h.Name] = h.Size
+			}
+		}
+		for _, f := range files {
+			if size, ok := read[f.Name]; !ok || size != f.Size {
+				t.Errorf("%s: %s missing or wrong size in archive", format, f.Name)
+			}
+		}
+	}
+}
+
+func TestWrite_StopsWhenCancelled(t *testing.T) {
+	files := testFiles(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := Write(ctx, io.Discard, Zip, files); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the archive to stop, got %v", err)
+	}
+}
+
+func TestWrite_FileShrank(t *testing.T) {
+	files := testFiles(t)
+	for i := range files {
+		files[i].Size += 10
+	}
+	if err := Write(context.Background(), io.Discard, Tar, files); err == nil {
+		t.Fatal("expected a file shorter than listed to fail the archive")
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hasmikatom/torrent/category"
+	"github.com/hasmikatom/torrent/export"
+)
+
+// getTorrentArchive streams a torrent's files as a ?format=zip (the
+// default) or tar archive. Repeated ?path= picks files or folders inside
+// the torrent; without it every file goes in. Files that aren't completely
+// downloaded are left out and counted in X-Skipped-Files.
+func getTorrentArchive(gc *gin.Context) {
+	format := gc.DefaultQuery("format", export.Zip)
+	if !export.Valid(format) {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": "format must be zip or tar"})
+		return
+	}
+
+	t, ok := fetchContent(gc)
+	if !ok {
+		return
+	}
+
+	picked := gc.QueryArray("path")
+	var files []export.File
+	skipped := 0
+	for _, f := range t.Files {
+		if len(picked) > 0 && !slices.ContainsFunc(picked, func(p string) bool { return category.Within(filepath.Clean(p), f.Name) }) {
+			continue
+		}
+		if f.BytesCompleted < f.Length {
+			skipped++
+			continue
+		}
+
+		full, status, err := locateFile(t, f)
+		if err != nil {
+			gc.JSON(status, gin.H{"error": err.Error(), "path": f.Name})
+			return
+		}
+		info, err := os.Stat(full)
+		if err != nil {
+			gc.JSON(http.StatusNotFound, gin.H{"error": "File not found on disk", "path": f.Name})
+			return
+		}
+		files = append(files, export.File{Name: filepath.ToSlash(f.Name), Path: full, Size: info.Size(), ModTime: info.ModTime()})
+	}
+	if len(files) == 0 {
+		gc.JSON(http.StatusConflict, gin.H{"error": "No completely downloaded files to export"})
+		return
+	}
+
+	header := gc.Writer.Header()
+	header.Set("Content-Type", export.ContentType(format))
+	header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": t.Name + "." + format}))
+	header.Set("X-Skipped-Files", strconv.Itoa(skipped))
+	if n, ok := export.Length(format, files); ok {
+		header.Set("Content-Length", strconv.FormatInt(n, 10))
+	}
+	gc.Status(http.StatusOK)
+
+	// The request's context ends when the client disconnects
+	err := export.Write(gc.Request.Context(), gc.Writer, format, files)
+	switch {
+	case errors.Is(err, context.Canceled):
+		log.Printf("Export of torrent %d cancelled by the client", t.ID)
+	case err != nil:
+		log.Printf("Failed to export torrent %d: %v", t.ID, err)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hasmikatom/torrent/browse"
+	"github.com/hasmikatom/torrent/category"
+)
+
+// BrowseRoot is a category root at the top of the library browser
+type BrowseRoot struct {
+	Category string `json:"category"`
+	browse.Item
+}
+
+// browseRoots returns the roots of every category role may download into
+func browseRoots(role string) []string {
+	var roots []string
+	for _, cat := range category.Load().Categories {
+		if cat.Allows(role) {
+			roots = append(roots, cat.Pool()...)
+		}
+	}
+	return roots
+}
+
+// partSuffix is what the daemon appends to files it hasn't finished
+const partSuffix = ".part"
+
+// ownedPaths indexes where torrents keep data: their downloads, every file
+// in them including partial ones, and, in link mode, the library files
+// linked from them. Library files stay owned after their torrent is
+// removed, since the library copy is meant to outlive it.
+func ownedPaths() (*browse.Index, error) {
+	torrents, err := client.GetTorrents(nil, []string{"id", "name", "hashString", "downloadDir", "percentDone", "files"})
+	if err != nil {
+		return nil, err
+	}
+
+	var owned, downloading []browse.Owned
+	for _, t := range torrents {
+		data := filepath.Join(t.DownloadDir, t.Name)
+		owned = append(owned,
+			browse.Owned{Path: data, TorrentID: t.ID, Name: t.Name},
+			browse.Owned{Path: data + partSuffix, TorrentID: t.ID, Name: t.Name},
+		)
+		for _, f := range t.Files {
+			file := filepath.Join(t.DownloadDir, f.Name)
+			owned = append(owned,
+				browse.Owned{Path: file, TorrentID: t.ID, Name: t.Name},
+				browse.Owned{Path: file + partSuffix, TorrentID: t.ID, Name: t.Name},
+			)
+		}
+		if t.PercentDone < 1 && t.DownloadDir != "" {
+			downloading = append(downloading, browse.Owned{Path: t.DownloadDir, TorrentID: t.ID, Name: t.Name})
+		}
+	}
+	for _, e := range libraryLinker.Entries(0, "") {
+		for _, link := range e.Links {
+			owned = append(owned, browse.Owned{Path: link.Target, TorrentID: e.TorrentID, Name: e.Name})
+		}
+	}
+	return browse.NewIndex(owned, downloading), nil
+}
+
+// respondBrowseError writes the response for a path that can't be browsed
+func respondBrowseError(gc *gin.Context, err error) {
+	switch {
+	case errors.Is(err, browse.ErrOutside):
+		gc.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, os.ErrNotExist):
+		gc.JSON(http.StatusNotFound, gin.H{"error": "Path not found"})
+	default:
+		gc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+}
+
+// browseLibrary lists a folder inside the category roots the caller may
+// download into, saying which torrent each entry belongs to. Without
+// ?path= it lists the roots themselves.
+func browseLibrary(gc *gin.Context) {
+	user := currentUser(gc)
+	index, err := ownedPaths()
+	if err != nil {
+		gc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	path := gc.Query("path")
+	if path == "" {
+		roots := make([]BrowseRoot, 0)
+		for _, cat := range category.Load().Categories {
+			if !cat.Allows(user.Role) {
+				continue
+			}
+			for _, root := range cat.Pool() {
+				item, err := browse.Stat(root, usageCache.Size)
+				if err != nil {
+					continue
+				}
+				index.Describe(&item)
+				roots = append(roots, BrowseRoot{Category: cat.ID, Item: item})
+			}
+		}
+		gc.JSON(http.StatusOK, gin.H{"roots": roots})
+		return
+	}
+
+	root, path, err := browse.Resolve(browseRoots(user.Role), path)
+	if err != nil {
+		respondBrowseError(gc, err)
+		return
+	}
+	item, err := browse.Stat(path, usageCache.Size)
+	if err != nil {
+		respondBrowseError(gc, err)
+		return
+	}
+	index.Describe(&item)
+
+	response := gin.H{"root": root, "item": item}
+	if cat, ok := category.Load().ForPath(path); ok {
+		response["category"] = cat.ID
+	}
+	if item.Dir {
+		items, err := browse.List(path, index, usageCache.Size)
+		if err != nil {
+			gc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		response["items"] = items
+	}
+	gc.JSON(http.StatusOK, response)
+}
+
+// deleteLibraryItem removes a file or folder in a category root that no
+// torrent has data at or below. Roots themselves can't be removed.
+func deleteLibraryItem(gc *gin.Context) {
+	root, path, err := browse.Resolve(browseRoots(currentUser(gc).Role), gc.Query("path"))
+	if err != nil {
+		respondBrowseError(gc, err)
+		return
+	}
+	if path == filepath.Clean(root) {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": "A category root can't be deleted"})
+		return
+	}
+
+	item, err := browse.Stat(path, usageCache.Size)
+	if err != nil {
+		respondBrowseError(gc, err)
+		return
+	}
+	index, err := ownedPaths()
+	if err != nil {
+		gc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	index.Describe(&item)
+	if item.Tracked() {
+		gc.JSON(http.StatusConflict, gin.H{"error": "Path belongs to a torrent", "item": item})
+		return
+	}
+
+	if err := os.RemoveAll(path); err != nil {
+		gc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("Deleted untracked %s from the library (%d bytes)", path, item.Size)
+	gc.JSON(http.StatusOK, gin.H{"message": "Deleted", "item": item})
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hasmikatom/torrent/category"
+)
+
+// getCategories lists the categories the caller may download into
+func getCategories(gc *gin.Context) {
+	user := currentUser(gc)
+	gc.JSON(http.StatusOK, category.Load().AllowedFor(user.Role))
+}
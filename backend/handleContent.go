@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hasmikatom/torrent/category"
+	"github.com/hasmikatom/torrent/share"
+	"github.com/hasmikatom/torrent/transmission"
+)
+
+// contentFields are the torrent-get fields needed to serve a torrent's files
+var contentFields = []string{"id", "name", "hashString", "downloadDir", "files"}
+
+// mediaTypes covers extensions the system MIME table often lacks
+var mediaTypes = map[string]string{
+	".mkv":  "video/x-matroska",
+	".mka":  "audio/x-matroska",
+	".avi":  "video/x-msvideo",
+	".m4v":  "video/x-m4v",
+	".ts":   "video/mp2t",
+	".flac": "audio/flac",
+	".srt":  "application/x-subrip",
+	".ass":  "text/x-ssa",
+	".nfo":  "text/plain; charset=utf-8",
+}
+
+// ShareRequest asks for a link to one of a torrent's files
+type ShareRequest struct {
+	Path string `json:"path"`
+	// Minutes is how long the link lasts, 0 for the configured default
+	Minutes int `json:"minutes"`
+}
+
+// contentType names the media type of a file by its extension. Unknown
+// types are left empty so http.ServeContent sniffs them.
+func contentType(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if t, ok := mediaTypes[ext]; ok {
+		return t
+	}
+	return mime.TypeByExtension(ext)
+}
+
+// torrentFile finds one complete file of a torrent by its path inside the
+// torrent and returns where it is on disk. Only the torrent's own files can
+// be reached, and a symlink may not lead out of the download directory.
+func torrentFile(t transmission.Torrent, path string) (string, int, error) {
+	want := filepath.ToSlash(filepath.Clean(path))
+	for _, f := range t.Files {
+		if filepath.ToSlash(filepath.Clean(f.Name)) == want {
+			return locateFile(t, f)
+		}
+	}
+	return "", http.StatusNotFound, errors.New("File not found in torrent")
+}
+
+// locateFile returns where a complete file of a torrent is on disk
+func locateFile(t transmission.Torrent, f transmission.File) (string, int, error) {
+	if f.BytesCompleted < f.Length {
+		return "", http.StatusConflict, errors.New("File is not completely downloaded")
+	}
+
+	full := filepath.Join(t.DownloadDir, f.Name)
+	real, err := filepath.EvalSymlinks(full)
+	if err != nil {
+		return "", http.StatusNotFound, errors.New("File not found on disk")
+	}
+	realDir, err := filepath.EvalSymlinks(t.DownloadDir)
+	if err != nil || !category.Within(realDir, real) {
+		return "", http.StatusForbidden, errors.New("File is outside the torrent's download directory")
+	}
+	return full, http.StatusOK, nil
+}
+
+// serveFile writes a file with Range, conditional request and content type
+// handling. It downloads as an attachment unless inline is set.
+func serveFile(gc *gin.Context, full string, inline bool) {
+	f, err := os.Open(full)
+	if err != nil {
+		gc.JSON(http.StatusNotFound, gin.H{"error": "File not found on disk"})
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		gc.JSON(http.StatusNotFound, gin.H{"error": "File not found on disk"})
+		return
+	}
+
+	name := filepath.Base(full)
+	disposition := "attachment"
+	if inline {
+		disposition = "inline"
+	}
+	header := gc.Writer.Header()
+	header.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": name}))
+	header.Set("ETag", fmt.Sprintf(`"%x-%x"`, info.Size(), info.ModTime().UnixNano()))
+	if t := contentType(name); t != "" {
+		header.Set("Content-Type", t)
+	}
+	http.ServeContent(gc.Writer, gc.Request, name, info.ModTime(), f)
+}
+
+// getTorrentContent serves one file of a torrent, picked by its ?path=
+// inside the torrent as listed by GET /torrents/:id/files
+func getTorrentContent(gc *gin.Context) {
+	t, ok := fetchContent(gc)
+	if !ok {
+		return
+	}
+
+	full, status, err := torrentFile(t, gc.Query("path"))
+	if err != nil {
+		gc.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	serveFile(gc, full, gc.Query("inline") == "true")
+}
+
+// shareTorrentFile signs a link to one file of a torrent that works without
+// a session until it expires
+func shareTorrentFile(gc *gin.Context) {
+	var req ShareRequest
+	if err := gc.ShouldBindJSON(&req); err != nil || req.Path == "" {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": "path is required"})
+		return
+	}
+
+	t, ok := fetchContent(gc)
+	if !ok {
+		return
+	}
+	if _, status, err := torrentFile(t, req.Path); err != nil {
+		gc.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	expires := time.Now().Add(share.LoadConfig().TTL(req.Minutes))
+	token := shareSigner.Sign(share.Link{
+		TorrentID: t.ID,
+		Hash:      t.HashString,
+		Path:      req.Path,
+		Expires:   expires.Unix(),
+	})
+	log.Printf("User %s shared %s of torrent %d until %s", currentUser(gc).Email, req.Path, t.ID, expires.Format(time.RFC3339))
+
+	gc.JSON(http.StatusOK, gin.H{
+		"url":       "/api/share/" + token,
+		"token":     token,
+		"expiresAt": expires,
+	})
+}
+
+// getSharedFile serves the file a signed share link points at. It needs no
+// session; the link only works while the torrent it was made for is still
+// there.
+func getSharedFile(gc *gin.Context) {
+	link, err := shareSigner.Verify(gc.Param("token"), time.Now())
+	if err != nil {
+		status := http.StatusForbidden
+		if errors.Is(err, share.ErrExpired) {
+			status = http.StatusGone
+		}
+		gc.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	torrents, err := client.GetTorrents([]int{link.TorrentID}, contentFields)
+	if err != nil {
+		gc.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get torrent info: %v", err)})
+		return
+	}
+	if len(torrents) == 0 || !strings.EqualFold(torrents[0].HashString, link.Hash) {
+		gc.JSON(http.StatusGone, gin.H{"error": "The shared torrent no longer exists"})
+		return
+	}
+
+	full, status, err := torrentFile(torrents[0], link.Path)
+	if err != nil {
+		gc.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	serveFile(gc, full, gc.Query("inline") == "true")
+}
+
+// fetchContent fetches the torrent named by :id with its files, writing the
+// error response itself
+func fetchContent(gc *gin.Context) (transmission.Torrent, bool) {
+	id, err := strconv.Atoi(gc.Param("id"))
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": "Invalid torrent id"})
+		return transmission.Torrent{}, false
+	}
+
+	torrents, err := client.GetTorrents([]int{id}, contentFields)
+	if err != nil {
+		gc.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get torrent info: %v", err)})
+		return transmission.Torrent{}, false
+	}
+	if len(torrents) == 0 {
+		gc.JSON(http.StatusNotFound, gin.H{"error": "Torrent not found"})
+		return transmission.Torrent{}, false
+	}
+	return torrents[0], true
+}
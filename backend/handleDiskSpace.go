@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hasmikatom/torrent/disk"
+	"github.com/hasmikatom/torrent/transmission"
+)
+
+// freeSpace returns the bytes available at a download directory. The disk
+// is looked at directly when it is mounted here too, otherwise the daemon is
+// asked.
+func freeSpace(dir string) (uint64, error) {
+	if p, ok := disk.Existing(dir); ok && p != "/" {
+		if info, err := getDiskUsage(p); err == nil {
+			return info.Available, nil
+		}
+	}
+
+	result, err := client.SendRequest("free-space", map[string]interface{}{"path": dir})
+	if err != nil {
+		return 0, err
+	}
+	if result.Result != "success" {
+		return 0, errors.New(result.Result)
+	}
+	size, ok := GetInt64(result.Arguments, "size-bytes")
+	if !ok || size < 0 {
+		return 0, fmt.Errorf("daemon reported no free space for %s", dir)
+	}
+	return uint64(size), nil
+}
+
+// listSpaceTorrents returns every torrent with the fields the space guard needs
+func listSpaceTorrents() ([]transmission.Torrent, error) {
+	return client.GetTorrents(nil, disk.Fields)
+}
+
+// startQueuedTorrent starts a torrent that waited for disk space
+func startQueuedTorrent(item disk.Queued) error {
+	if err := mountChecker.Ready(item.Dir); err != nil {
+		return err
+	}
+	if err := startTorrent(item.TorrentID); err != nil {
+		return err
+	}
+	quotaLedger.Start(item.Hash, 0, time.Now())
+	return nil
+}
+
+// stopTorrent sends torrent-stop for a single torrent
+func stopTorrent(id int) error {
+	result, err := client.SendRequest("torrent-stop", map[string]interface{}{"ids": []int{id}})
+	if err != nil {
+		return err
+	}
+	if result.Result != "success" {
+		return errors.New(result.Result)
+	}
+	return nil
+}
+
+// checkSpace returns a *disk.InsufficientSpaceError when size bytes don't fit
+// in dir. When free space can't be found out the torrent is let through, so
+// a daemon that doesn't answer doesn't block every download.
+func checkSpace(dir string, size int64, hash string) error {
+	err := spaceGuard.Check(dir, size, hash)
+	var full *disk.InsufficientSpaceError
+	if err != nil && !errors.As(err, &full) {
+		log.Printf("Warning: %v, not checking disk space", err)
+		return nil
+	}
+	return err
+}
+
+// respondSpaceError writes a 507 for disk space errors and reports whether it did
+func respondSpaceError(gc *gin.Context, err error) bool {
+	var full *disk.InsufficientSpaceError
+	if !errors.As(err, &full) {
+		return false
+	}
+
+	gc.JSON(http.StatusInsufficientStorage, gin.H{
+		"error":     full.Error(),
+		"path":      full.Path,
+		"free":      full.Free,
+		"pending":   full.Pending,
+		"reserve":   full.Reserve,
+		"available": full.Available(),
+		"requested": full.Requested,
+	})
+	return true
+}
+
+// listSpaceQueue returns the torrents waiting for disk space, oldest first
+func listSpaceQueue(gc *gin.Context) {
+	gc.JSON(http.StatusOK, gin.H{
+		"onFull": spaceGuard.Config().OnFull,
+		"queue":  spaceQueue.Items(),
+	})
+}
+
+// listPlacements returns the root of its category's pool each torrent was
+// put on
+func listPlacements(gc *gin.Context) {
+	gc.JSON(http.StatusOK, gin.H{"placements": rootPlacer.Placements()})
+}
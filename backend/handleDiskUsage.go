@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hasmikatom/torrent/category"
+	"github.com/hasmikatom/torrent/usage"
+)
+
+// CategoryUsage is a category's usage with its share of the disk it is on
+type CategoryUsage struct {
+	usage.Category
+	DiskTotal     uint64  `json:"diskTotal,omitempty"`
+	PercentOfDisk float64 `json:"percentOfDisk,omitempty"`
+}
+
+// usageRoots are the category roots the usage cache scans, every root of
+// a pool on its own
+func usageRoots() []usage.Root {
+	var roots []usage.Root
+	for _, cat := range category.Load().Categories {
+		for _, root := range cat.Pool() {
+			roots = append(roots, usage.Root{ID: cat.ID, Path: root})
+		}
+	}
+	return roots
+}
+
+// getUsageBreakdown returns the last scan of the category roots the caller
+// may download into, filtered by ?category= and cut to ?depth= levels of
+// subfolders. It answers 202 while the first scan is still running.
+func getUsageBreakdown(gc *gin.Context) {
+	depth := usageCache.Config().MaxDepth()
+	if v := gc.Query("depth"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			gc.JSON(http.StatusBadRequest, gin.H{"error": "depth must be a non-negative number"})
+			return
+		}
+		depth = min(depth, n)
+	}
+
+	report, ok, scanning := usageCache.Report()
+	if !ok {
+		gc.JSON(http.StatusAccepted, gin.H{"scanning": true, "message": "Disk usage is still being scanned"})
+		return
+	}
+
+	user := currentUser(gc)
+	want := gc.Query("category")
+	categories := make([]CategoryUsage, 0, len(report.Categories))
+	for _, c := range report.Categories {
+		cat, known := category.Load().Get(c.ID)
+		if !known || !cat.Allows(user.Role) || (want != "" && c.ID != want) {
+			continue
+		}
+
+		c.Node = c.Node.Trim(depth)
+		u := CategoryUsage{Category: c}
+		if info, err := getDiskUsage(c.Path); err == nil && info.Total > 0 {
+			u.DiskTotal = info.Total
+			u.PercentOfDisk = float64(c.Bytes) / float64(info.Total) * 100
+		}
+		categories = append(categories, u)
+	}
+
+	gc.JSON(http.StatusOK, gin.H{
+		"categories": categories,
+		"scannedAt":  report.ScannedAt,
+		"durationMs": report.DurationMs,
+		"scanning":   scanning,
+		"maxDepth":   usageCache.Config().MaxDepth(),
+	})
+}
+
+// refreshUsage starts a new scan without waiting for it
+func refreshUsage(gc *gin.Context) {
+	if !usageCache.Refresh() {
+		gc.JSON(http.StatusAccepted, gin.H{"message": "A scan is already running"})
+		return
+	}
+	gc.JSON(http.StatusAccepted, gin.H{"message": "Scan started"})
+}
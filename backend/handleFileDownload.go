@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/base64"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -9,16 +10,21 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/hasmikatom/torrent/category"
 	"github.com/hasmikatom/torrent/scraper"
 )
 
+// torrentFilesDir is where .torrent files fetched from RuTracker are saved
+// before they are added
+const torrentFilesDir = "/mediastorage/torrent-files"
+
 type Request struct {
 	URL       string `json:"url"`
 	MediaType string `json:"mediaType"`
 }
 
 func handleFileDownload(gc *gin.Context) {
-	torrentFileSaveLocation := "/mediastorage/torrent-files"
+	torrentFileSaveLocation := torrentFilesDir
 
 	var req Request
 
@@ -32,8 +38,10 @@ func handleFileDownload(gc *gin.Context) {
 		return
 	}
 
+	user := currentUser(gc)
+
 	// Validate mediaType to prevent path traversal
-	downloadDir, err := GetDownloadDir(req.MediaType)
+	cat, err := GetCategory(req.MediaType, user.Role)
 	if err != nil {
 		gc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -72,32 +80,27 @@ func handleFileDownload(gc *gin.Context) {
 	base64Data := base64.StdEncoding.EncodeToString(torrentData)
 
 	args := map[string]interface{}{
-		"download-dir": downloadDir,
-		"metainfo":     base64Data,
+		"metainfo": base64Data,
 	}
-	result, err := client.SendRequest("torrent-add", args)
+	added, err := addTorrentForUser(user, cat, formFields(gc), args)
 	if err != nil {
+		if respondQuotaError(gc, err) || respondSpaceError(gc, err) || respondMountError(gc, err) {
+			return
+		}
+		log.Printf("Failed to add torrent: %v", err)
 		gc.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add torrent"})
 		return
 	}
 
-	if result.Result != "success" {
-		log.Println("arguments ==> ", result.Arguments)
-		gc.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add torrent"})
-		return
+	message := "Download started"
+	if added.Queued {
+		message = "Download queued until there is enough disk space"
 	}
-
-	if torrentAdded, ok := result.Arguments["torrent-added"].(map[string]interface{}); ok {
-		if id, ok := torrentAdded["id"].(float64); ok {
-			gc.JSON(http.StatusOK, gin.H{
-				"message":   "Download started",
-				"torrentId": int(id),
-			})
-			return
-		}
-	}
-
-	gc.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get torrent ID"})
+	gc.JSON(http.StatusOK, gin.H{
+		"message":   message,
+		"torrentId": added.ID,
+		"queued":    added.Queued,
+	})
 }
 
 type BatchFileDownloadRequest struct {
@@ -106,12 +109,14 @@ type BatchFileDownloadRequest struct {
 }
 
 type BatchFileDownloadResponse struct {
-	TorrentIds []int    `json:"torrentIds"`
-	Errors     []string `json:"errors,omitempty"`
+	TorrentIds []int `json:"torrentIds"`
+	// Queued are the torrents among TorrentIds waiting for disk space
+	Queued []int    `json:"queued,omitempty"`
+	Errors []string `json:"errors,omitempty"`
 }
 
 func handleBatchFileDownload(gc *gin.Context) {
-	torrentFileSaveLocation := "/mediastorage/torrent-files"
+	torrentFileSaveLocation := torrentFilesDir
 
 	var req BatchFileDownloadRequest
 	if err := gc.ShouldBindJSON(&req); err != nil {
@@ -129,8 +134,10 @@ func handleBatchFileDownload(gc *gin.Context) {
 		return
 	}
 
+	user := currentUser(gc)
+
 	// Validate contentType to prevent path traversal
-	downloadDir, err := GetDownloadDir(req.ContentType)
+	cat, err := GetCategory(req.ContentType, user.Role)
 	if err != nil {
 		gc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -152,6 +159,7 @@ func handleBatchFileDownload(gc *gin.Context) {
 	}
 
 	var torrentIds []int
+	var queued []int
 	var errors []string
 
 	for _, fileURL := range req.URLs {
@@ -177,30 +185,24 @@ func handleBatchFileDownload(gc *gin.Context) {
 		base64Data := base64.StdEncoding.EncodeToString(torrentData)
 
 		args := map[string]interface{}{
-			"download-dir": downloadDir,
-			"metainfo":     base64Data,
+			"metainfo": base64Data,
 		}
 
-		result, err := client.SendRequest("torrent-add", args)
+		added, err := addTorrentForUser(user, cat, category.Fields{}, args)
 		if err != nil {
-			errors = append(errors, "Failed to add torrent")
-			continue
-		}
-
-		if result.Result != "success" {
-			errors = append(errors, "Failed to add torrent: unsuccessful result")
+			errors = append(errors, fmt.Sprintf("Failed to add torrent: %v", err))
 			continue
 		}
 
-		if torrentAdded, ok := result.Arguments["torrent-added"].(map[string]interface{}); ok {
-			if id, ok := torrentAdded["id"].(float64); ok {
-				torrentIds = append(torrentIds, int(id))
-			}
+		torrentIds = append(torrentIds, added.ID)
+		if added.Queued {
+			queued = append(queued, added.ID)
 		}
 	}
 
 	response := BatchFileDownloadResponse{
 		TorrentIds: torrentIds,
+		Queued:     queued,
 		Errors:     errors,
 	}
 
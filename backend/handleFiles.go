@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hasmikatom/torrent/naming"
+	"github.com/hasmikatom/torrent/transmission"
+)
+
+// TorrentFile is one file of a torrent as listed by GET /torrents/:id/files
+type TorrentFile struct {
+	Path           string  `json:"path"`
+	Length         int64   `json:"length"`
+	BytesCompleted int64   `json:"bytesCompleted"`
+	PercentDone    float64 `json:"percentDone"`
+}
+
+// FileRename renames the last component of Path to Name
+type FileRename struct {
+	Path string `json:"path"`
+	Name string `json:"name"`
+}
+
+// FileRenameRequest is the request for renaming files inside a torrent
+type FileRenameRequest struct {
+	Renames []FileRename `json:"renames"`
+}
+
+// FileRenameResult reports what happened to one rename of a batch
+type FileRenameResult struct {
+	Path    string `json:"path"`
+	Name    string `json:"name"`
+	NewPath string `json:"newPath,omitempty"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// torrentFiles fetches a torrent's files, writing the error response itself
+func torrentFiles(gc *gin.Context) (transmission.Torrent, bool) {
+	torrentId, err := strconv.Atoi(gc.Param("id"))
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": "Invalid torrent id"})
+		return transmission.Torrent{}, false
+	}
+
+	torrents, err := client.GetTorrents([]int{torrentId}, []string{"id", "name", "files"})
+	if err != nil {
+		gc.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get torrent info: %v", err)})
+		return transmission.Torrent{}, false
+	}
+	if len(torrents) == 0 {
+		gc.JSON(http.StatusNotFound, gin.H{"error": "Torrent not found"})
+		return transmission.Torrent{}, false
+	}
+	return torrents[0], true
+}
+
+// listTorrentFiles returns a torrent's files and the folders they're in
+func listTorrentFiles(gc *gin.Context) {
+	t, ok := torrentFiles(gc)
+	if !ok {
+		return
+	}
+
+	files := make([]TorrentFile, 0, len(t.Files))
+	paths := make([]string, 0, len(t.Files))
+	for _, f := range t.Files {
+		percent := 0.0
+		if f.Length > 0 {
+			percent = float64(f.BytesCompleted) / float64(f.Length)
+		}
+		files = append(files, TorrentFile{
+			Path:           f.Name,
+			Length:         f.Length,
+			BytesCompleted: f.BytesCompleted,
+			PercentDone:    percent,
+		})
+		paths = append(paths, f.Name)
+	}
+
+	gc.JSON(http.StatusOK, gin.H{
+		"id":      t.ID,
+		"name":    t.Name,
+		"files":   files,
+		"folders": naming.Folders(paths),
+	})
+}
+
+// renameFilesInTorrent renames files and folders inside a torrent. Renames run
+// in order, each seeing the paths left by the ones before it, and one
+// failing doesn't stop the rest.
+func renameFilesInTorrent(gc *gin.Context) {
+	var req FileRenameRequest
+	if err := gc.ShouldBindJSON(&req); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if len(req.Renames) == 0 {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": "At least one rename is required"})
+		return
+	}
+
+	t, ok := torrentFiles(gc)
+	if !ok {
+		return
+	}
+
+	paths := make([]string, 0, len(t.Files))
+	for _, f := range t.Files {
+		paths = append(paths, f.Name)
+	}
+
+	results := make([]FileRenameResult, 0, len(req.Renames))
+	failed := 0
+	for _, r := range req.Renames {
+		result := FileRenameResult{Path: r.Path, Name: r.Name}
+
+		newPaths, newPath, err := checkFileRename(paths, r)
+		if err == nil {
+			err = renamePath(t.ID, r.Path, r.Name)
+		}
+		if err != nil {
+			result.Error = err.Error()
+			failed++
+		} else {
+			result.Success = true
+			result.NewPath = newPath
+			paths = newPaths
+		}
+		results = append(results, result)
+	}
+
+	status := http.StatusOK
+	if failed == len(results) {
+		status = http.StatusBadRequest
+	}
+	gc.JSON(status, gin.H{
+		"results": results,
+		"renamed": len(results) - failed,
+		"failed":  failed,
+	})
+}
+
+// checkFileRename validates one rename against the torrent's current paths
+// and returns the paths as they will be afterwards
+func checkFileRename(paths []string, r FileRename) ([]string, string, error) {
+	if err := naming.ValidatePath(r.Path); err != nil {
+		return nil, "", err
+	}
+	if err := naming.ValidateName(r.Name); err != nil {
+		return nil, "", err
+	}
+	if _, ok := naming.Lookup(paths, r.Path); !ok {
+		return nil, "", fmt.Errorf("%q is not in the torrent", r.Path)
+	}
+
+	newPaths, newPath := naming.ApplyRename(paths, r.Path, r.Name)
+	if newPath == r.Path {
+		return nil, "", fmt.Errorf("%q already has that name", r.Path)
+	}
+	if _, exists := naming.Lookup(paths, newPath); exists {
+		return nil, "", fmt.Errorf("%q already exists", newPath)
+	}
+	return newPaths, newPath, nil
+}
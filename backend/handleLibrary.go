@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hasmikatom/torrent/category"
+	"github.com/hasmikatom/torrent/events"
+	"github.com/hasmikatom/torrent/library"
+	"github.com/hasmikatom/torrent/watcher"
+)
+
+// placeTorrent returns the directory a new torrent of size bytes downloads
+// to. The torrent is put on a root of the category's pool first. In link
+// mode the directory is the category's staging folder, and the linker is
+// told where the files belong once complete; otherwise it is the library
+// folder.
+func placeTorrent(cat category.Category, fields category.Fields, entry library.Entry, size int64) (string, bool, error) {
+	cat = cat.In(rootPlacer.Place(entry.Hash, cat, size))
+
+	config := library.LoadConfig()
+	if !config.Covers(cat.ID) {
+		dir, err := GetDownloadDir(cat, fields)
+		return dir, false, err
+	}
+
+	// Catch a template that escapes the root now rather than at completion
+	if _, err := cat.Dir(fields); err != nil {
+		return "", false, err
+	}
+	dir := config.StagingDir(cat.ID)
+	if err := os.MkdirAll(dir, 0775); err != nil {
+		log.Printf("Failed to create staging dir %s: %v", dir, err)
+	}
+
+	entry.Category = cat.ID
+	entry.Fields = fields
+	libraryLinker.Track(entry)
+	return dir, true, nil
+}
+
+// libraryDir renders the library folder of a staged torrent on the root
+// it was placed on
+func libraryDir(id, hash string, fields category.Fields) (string, error) {
+	cat, ok := category.Load().Get(id)
+	if !ok {
+		return "", fmt.Errorf("category %s no longer exists", id)
+	}
+	return GetDownloadDir(cat.In(rootPlacer.Place(hash, cat, 0)), fields)
+}
+
+// torrentCategoryID is categoryID that also knows staging folders, for
+// work that runs on a torrent's own files
+func torrentCategoryID(dir string) (string, bool) {
+	if id, ok := categoryID(dir); ok {
+		return id, true
+	}
+	return library.LoadConfig().CategoryOf(dir)
+}
+
+// listLibraryLinks returns staged torrents and their library files newest
+// first, filtered by ?torrentId= and ?status=
+func listLibraryLinks(gc *gin.Context) {
+	torrentID := 0
+	if v := gc.Query("torrentId"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			gc.JSON(http.StatusBadRequest, gin.H{"error": "Invalid torrent ID"})
+			return
+		}
+		torrentID = id
+	}
+
+	gc.JSON(http.StatusOK, gin.H{
+		"enabled": library.LoadConfig().Enabled,
+		"entries": libraryLinker.Entries(torrentID, gc.Query("status")),
+	})
+}
+
+// cleanupLibrary removes staging data no torrent needs any more. It is a
+// dry run unless ?dryRun=false is passed.
+func cleanupLibrary(gc *gin.Context) {
+	torrents, err := client.GetTorrents(nil, watcher.Fields)
+	if err != nil {
+		gc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	current := make([]events.Torrent, len(torrents))
+	for i, t := range torrents {
+		current[i] = watcher.TorrentOf(t)
+	}
+
+	gc.JSON(http.StatusOK, libraryLinker.Cleanup(current, gc.Query("dryRun") != "false"))
+}
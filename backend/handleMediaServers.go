@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MediaServerStatus is a configured Jellyfin or Emby server without its key
+type MediaServerStatus struct {
+	ID         string   `json:"id"`
+	Type       string   `json:"type"`
+	URL        string   `json:"url"`
+	Categories []string `json:"categories"`
+	Reachable  bool     `json:"reachable"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// getMediaServerStatus reports whether each Jellyfin or Emby server is
+// reachable, and the most recent library refreshes
+func getMediaServerStatus(gc *gin.Context) {
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	servers := make([]MediaServerStatus, 0)
+	for _, s := range mediaServerRefresher.Servers() {
+		status := MediaServerStatus{ID: s.ID, Type: s.Type, URL: s.URL, Categories: s.Categories, Reachable: true}
+		if status.Categories == nil {
+			status.Categories = []string{}
+		}
+		if err := mediaServerRefresher.Ping(ctx, s); err != nil {
+			status.Reachable = false
+			status.Error = err.Error()
+		}
+		servers = append(servers, status)
+	}
+
+	gc.JSON(http.StatusOK, gin.H{
+		"servers":   servers,
+		"refreshes": mediaServerRefresher.History(),
+	})
+}
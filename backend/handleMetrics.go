@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hasmikatom/torrent/metrics"
+)
+
+// defaultHistorySpan is what GET /metrics/history covers without ?range=
+const defaultHistorySpan = 24 * time.Hour
+
+// sampleMetrics reads filesystem usage and the daemon's transfer rates. A
+// daemon that doesn't answer only leaves the rates out.
+func sampleMetrics() (metrics.Sample, error) {
+	s := metrics.Sample{At: time.Now(), Mounts: make(map[string]metrics.MountUsage)}
+
+	storages, storageErr := listStorage()
+	for _, info := range storages {
+		s.Mounts[info.Path] = metrics.MountUsage{Total: info.Total, Used: info.Used, Available: info.Available}
+	}
+
+	result, err := client.SendRequest("session-stats", map[string]interface{}{})
+	if err == nil && result.Result != "success" {
+		err = errors.New(result.Result)
+	}
+	if err == nil {
+		s.DownloadRate, _ = GetInt64(result.Arguments, "downloadSpeed")
+		s.UploadRate, _ = GetInt64(result.Arguments, "uploadSpeed")
+		s.Active, _ = GetInt(result.Arguments, "activeTorrentCount")
+	}
+
+	if storageErr != nil && err != nil {
+		return s, storageErr
+	}
+	if err != nil {
+		log.Printf("Warning: failed to get session stats: %v, recording disk usage only", err)
+	}
+	return s, nil
+}
+
+// getMetricsHistory returns recorded usage and rates. The range is ?from=
+// and ?to= (RFC 3339) or the last ?range= (e.g. 6h, 7d, default 24h), and
+// ?step= asks for a coarser resolution. Predictions say when each mount
+// fills at the rate it grew over the range.
+func getMetricsHistory(gc *gin.Context) {
+	to := time.Now()
+	if v := gc.Query("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			gc.JSON(http.StatusBadRequest, gin.H{"error": "to must be an RFC 3339 time"})
+			return
+		}
+		to = t
+	}
+
+	span := defaultHistorySpan
+	if v := gc.Query("range"); v != "" {
+		d, err := metrics.ParseSpan(v)
+		if err != nil {
+			gc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		span = d
+	}
+	from := to.Add(-span)
+	if v := gc.Query("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			gc.JSON(http.StatusBadRequest, gin.H{"error": "from must be an RFC 3339 time"})
+			return
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return
+	}
+
+	var step time.Duration
+	if v := gc.Query("step"); v != "" {
+		d, err := metrics.ParseSpan(v)
+		if err != nil {
+			gc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		step = d
+	}
+
+	gc.JSON(http.StatusOK, metricsRecorder.Query(from, to, step))
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hasmikatom/torrent/category"
+	"github.com/hasmikatom/torrent/disk"
+)
+
+// MountReport is a checked mount with the categories downloading into it
+type MountReport struct {
+	disk.MountStatus
+	Categories []string `json:"categories,omitempty"`
+}
+
+// checkMounts checks every expected mount now
+func checkMounts() []MountReport {
+	statuses := mountChecker.Check()
+	reports := make([]MountReport, 0, len(statuses))
+	for _, s := range statuses {
+		r := MountReport{MountStatus: s}
+		for _, cat := range category.Load().Categories {
+			if slices.ContainsFunc(cat.Pool(), func(root string) bool { return category.Within(s.Path, root) }) {
+				r.Categories = append(r.Categories, cat.ID)
+			}
+		}
+		reports = append(reports, r)
+	}
+	return reports
+}
+
+// respondMountError writes a 503 for blocked mounts and reports whether it did
+func respondMountError(gc *gin.Context, err error) bool {
+	var blocked *disk.MountError
+	if !errors.As(err, &blocked) {
+		return false
+	}
+
+	gc.JSON(http.StatusServiceUnavailable, gin.H{
+		"error":   blocked.Error(),
+		"mount":   blocked.Mount,
+		"problem": blocked.Problem,
+	})
+	return true
+}
+
+// getHealth reports "degraded" while downloads into any expected mount are
+// blocked, from the checker's latest periodic check. The server itself is
+// up either way. Which mounts fail is only shown to admins, by listMounts.
+func getHealth(gc *gin.Context) {
+	if !mountChecker.Healthy() {
+		gc.JSON(http.StatusOK, gin.H{"status": "degraded", "mountsOk": false})
+		return
+	}
+	gc.JSON(http.StatusOK, gin.H{"status": "ok", "mountsOk": true})
+}
+
+// listMounts checks every expected mount now and reports each with the
+// categories downloading into it
+func listMounts(gc *gin.Context) {
+	gc.JSON(http.StatusOK, gin.H{"mounts": checkMounts()})
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hasmikatom/torrent/category"
+	"github.com/hasmikatom/torrent/events"
+	"github.com/hasmikatom/torrent/notify"
+)
+
+// NotificationTarget is a saved target as shown to its owner. Tokens are
+// never sent back; HasToken says whether one is saved.
+type NotificationTarget struct {
+	notify.Target
+	HasToken bool `json:"hasToken"`
+}
+
+// NotificationTargetsRequest replaces the caller's targets
+type NotificationTargetsRequest struct {
+	Targets []notify.Target `json:"targets"`
+}
+
+func notificationTargetViews(targets []notify.Target) []NotificationTarget {
+	views := make([]NotificationTarget, 0, len(targets))
+	for _, t := range targets {
+		view := NotificationTarget{Target: t, HasToken: t.Token != ""}
+		view.Token = ""
+		views = append(views, view)
+	}
+	return views
+}
+
+// getNotificationTargets returns the caller's targets and what can be chosen
+func getNotificationTargets(gc *gin.Context) {
+	user := currentUser(gc)
+
+	gc.JSON(http.StatusOK, gin.H{
+		"targets":       notificationTargetViews(notificationPrefs.Targets(user.ID)),
+		"types":         notify.Types,
+		"events":        events.Types,
+		"defaultEvents": notify.DefaultEvents,
+		"emailEnabled":  notify.LoadConfig().SMTP.Configured(),
+	})
+}
+
+// setNotificationTargets replaces the caller's targets. Email targets
+// without a to address go to the caller's own email.
+func setNotificationTargets(gc *gin.Context) {
+	user := currentUser(gc)
+
+	var req NotificationTargetsRequest
+	if err := gc.ShouldBindJSON(&req); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	for i := range req.Targets {
+		if req.Targets[i].Type == notify.TypeSMTP && req.Targets[i].To == "" {
+			req.Targets[i].To = user.Email
+		}
+	}
+
+	saved, err := notificationPrefs.SetTargets(user.ID, req.Targets)
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"targets": notificationTargetViews(saved)})
+}
+
+// testNotificationTarget sends a sample message to one of the caller's targets
+func testNotificationTarget(gc *gin.Context) {
+	user := currentUser(gc)
+
+	target, ok := notificationPrefs.Target(user.ID, gc.Param("id"))
+	if !ok {
+		gc.JSON(http.StatusNotFound, gin.H{"error": "Notification target not found"})
+		return
+	}
+
+	if err := notifier.Test(gc.Request.Context(), target); err != nil {
+		gc.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// categoryName names the category a download directory belongs to, or ""
+func categoryName(dir string) string {
+	id, ok := torrentCategoryID(dir)
+	if !ok {
+		return ""
+	}
+	if cat, ok := category.Load().Get(id); ok {
+		return cat.Name
+	}
+	return ""
+}
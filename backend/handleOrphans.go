@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hasmikatom/torrent/browse"
+	"github.com/hasmikatom/torrent/category"
+	"github.com/hasmikatom/torrent/library"
+	"github.com/hasmikatom/torrent/quota"
+	"github.com/hasmikatom/torrent/trash"
+)
+
+// orphanMinAge is how long something must have been left untouched before
+// it counts as an orphan, so a download being added isn't caught
+const orphanMinAge = time.Hour
+
+// orphanReportTTL is how long a scan is reused before the roots are walked
+// again
+const orphanReportTTL = 10 * time.Minute
+
+var (
+	// orphanMu serializes scans, so requests arriving together share a walk
+	orphanMu     sync.Mutex
+	orphanReport *browse.OrphanReport
+)
+
+// ReclaimRequest picks which orphans to remove; empty means all of them
+type ReclaimRequest struct {
+	Paths []string `json:"paths"`
+}
+
+// findOrphans returns the last scan for data no torrent has while it is
+// recent, or scans again when it isn't or fresh asks. The index of what
+// torrents own is read anew every time.
+func findOrphans(fresh bool) (browse.OrphanReport, *browse.Index, error) {
+	index, err := ownedPaths()
+	if err != nil {
+		return browse.OrphanReport{}, nil, err
+	}
+
+	orphanMu.Lock()
+	defer orphanMu.Unlock()
+	if fresh || orphanReport == nil || time.Since(orphanReport.ScannedAt) > orphanReportTTL {
+		report := scanOrphans(index)
+		orphanReport = &report
+	}
+	return *orphanReport, index, nil
+}
+
+// forgetOrphans drops the last scan after data was removed
+func forgetOrphans() {
+	orphanMu.Lock()
+	orphanReport = nil
+	orphanMu.Unlock()
+}
+
+// scanOrphans walks every category root and the torrent file folder
+func scanOrphans(index *browse.Index) browse.OrphanReport {
+	var roots []string
+	for _, cat := range category.Load().Categories {
+		for _, root := range cat.Pool() {
+			if !slices.Contains(roots, root) {
+				roots = append(roots, root)
+			}
+		}
+	}
+	roots = append(roots, torrentFilesDir)
+
+	// Link mode staging has its own cleanup, and the trash its retention
+	var skip []string
+	if config := library.LoadConfig(); config.Enabled {
+		skip = append(skip, config.Staging)
+	}
+	for _, root := range roots {
+		if dir, ok := trashBin.Locate(root); ok && !slices.Contains(skip, dir) {
+			skip = append(skip, dir)
+		}
+	}
+
+	scan := browse.OrphanScan{Roots: roots, Skip: skip, MinAge: orphanMinAge}
+	return browse.FindOrphans(scan, index, time.Now())
+}
+
+// discardOrphan moves an orphan into the trash so a wrong verdict can be
+// undone. It is removed when the trash is off or its filesystem has none,
+// like the data of deleted torrents.
+func discardOrphan(u quota.User) func(browse.Orphan) error {
+	return func(o browse.Orphan) error {
+		if !trashBin.Enabled() {
+			return os.RemoveAll(o.Path)
+		}
+		_, err := trashBin.Move(trash.Entry{Original: o.Path, DeletedBy: u.ID, Reason: "orphan"})
+		if errors.Is(err, trash.ErrUnavailable) {
+			log.Printf("Removing orphan %s outright: %v", o.Path, err)
+			return os.RemoveAll(o.Path)
+		}
+		return err
+	}
+}
+
+// listOrphans reports files and folders in the category roots and the
+// torrent file folder that no torrent in the daemon has data at or below.
+// A recent scan is reused unless ?refresh=true is passed.
+func listOrphans(gc *gin.Context) {
+	report, _, err := findOrphans(gc.Query("refresh") == "true")
+	if err != nil {
+		gc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	gc.JSON(http.StatusOK, report)
+}
+
+// reclaimOrphans moves the orphans of the last scan into the trash, or only
+// those whose paths the body picks, leaving out what a torrent has data at
+// since. It is a dry run unless ?dryRun=false is passed.
+func reclaimOrphans(gc *gin.Context) {
+	var req ReclaimRequest
+	if gc.Request.ContentLength > 0 {
+		if err := gc.ShouldBindJSON(&req); err != nil {
+			gc.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+	}
+
+	report, index, err := findOrphans(gc.Query("refresh") == "true")
+	if err != nil {
+		gc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	dryRun := gc.Query("dryRun") != "false"
+	result := browse.Reclaim(report, index, req.Paths, dryRun, discardOrphan(currentUser(gc)))
+	if !dryRun {
+		forgetOrphans()
+		log.Printf("Reclaimed %d orphans (%d bytes)", len(result.Orphans), result.Bytes)
+	}
+	gc.JSON(http.StatusOK, result)
+}
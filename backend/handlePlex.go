@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hasmikatom/torrent/category"
+	"github.com/hasmikatom/torrent/plex"
+)
+
+// getPlexStatus reports whether Plex is configured and reachable, and the
+// most recent library refreshes
+func getPlexStatus(gc *gin.Context) {
+	config := plex.LoadConfig()
+	if !config.Enabled() {
+		gc.JSON(http.StatusOK, gin.H{
+			"enabled":   false,
+			"refreshes": []plex.Refresh{},
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(gc.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	status := gin.H{
+		"enabled":   true,
+		"url":       config.URL,
+		"sections":  config.Sections,
+		"reachable": true,
+		"refreshes": plexRefresher.History(),
+	}
+	if err := plexRefresher.Ping(ctx); err != nil {
+		status["reachable"] = false
+		status["error"] = err.Error()
+	}
+
+	gc.JSON(http.StatusOK, status)
+}
+
+// categoryID returns the id of the category a download directory belongs to
+func categoryID(dir string) (string, bool) {
+	cat, ok := category.Load().ForPath(dir)
+	return cat.ID, ok
+}
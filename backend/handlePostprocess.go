@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hasmikatom/torrent/watcher"
+)
+
+// listPostprocessJobs returns post-processing jobs newest first, filtered
+// by ?torrentId= and ?status=
+func listPostprocessJobs(gc *gin.Context) {
+	torrentID := 0
+	if v := gc.Query("torrentId"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			gc.JSON(http.StatusBadRequest, gin.H{"error": "Invalid torrent ID"})
+			return
+		}
+		torrentID = id
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"jobs": postprocessor.Jobs(torrentID, gc.Query("status"))})
+}
+
+// getPostprocessJob returns one job with its per-archive results
+func getPostprocessJob(gc *gin.Context) {
+	job, ok := postprocessor.Job(gc.Param("id"))
+	if !ok {
+		gc.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	gc.JSON(http.StatusOK, job)
+}
+
+// extractTorrent queues a finished torrent for extraction, e.g. to retry a
+// failed job after freeing space
+func extractTorrent(gc *gin.Context) {
+	torrentId, err := strconv.Atoi(gc.Param("id"))
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"error": "Invalid torrent ID"})
+		return
+	}
+
+	torrents, err := client.GetTorrents([]int{torrentId}, watcher.Fields)
+	if err != nil {
+		gc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(torrents) == 0 {
+		gc.JSON(http.StatusNotFound, gin.H{"error": "Torrent not found"})
+		return
+	}
+	if torrents[0].PercentDone < 1 {
+		gc.JSON(http.StatusConflict, gin.H{"error": "Torrent has not finished downloading"})
+		return
+	}
+
+	job, err := postprocessor.Enqueue(watcher.TorrentOf(torrents[0]))
+	if err != nil {
+		gc.JSON(http.StatusConflict, gin.H{"error": err.Error(), "job": job})
+		return
+	}
+
+	gc.JSON(http.StatusAccepted, job)
+}
@@ -7,10 +7,19 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/hasmikatom/torrent/category"
+	"github.com/hasmikatom/torrent/classify"
+	"github.com/hasmikatom/torrent/disk"
+	"github.com/hasmikatom/torrent/library"
+	"github.com/hasmikatom/torrent/naming"
+	"github.com/hasmikatom/torrent/quota"
+	"github.com/hasmikatom/torrent/release"
 	"github.com/hasmikatom/torrent/scraper"
+	"github.com/hasmikatom/torrent/transmission"
 )
 
 // PrepareResponse is the response for prepare endpoints
@@ -18,6 +27,7 @@ type PrepareResponse struct {
 	ID    int    `json:"id"`
 	Name  string `json:"name"`
 	Ready bool   `json:"ready"`
+	NameDetails
 }
 
 // PrepareStatusResponse is the response for status polling
@@ -26,18 +36,62 @@ type PrepareStatusResponse struct {
 	Name                    string  `json:"name"`
 	Ready                   bool    `json:"ready"`
 	MetadataPercentComplete float64 `json:"metadataPercentComplete"`
+	NameDetails
+}
+
+// NameDetails is what the backend makes of a torrent's name
+type NameDetails struct {
+	Parsed *release.Info `json:"parsed,omitempty"`
+	// Suggestion is the content type the classifier would pick
+	Suggestion *classify.Suggestion `json:"suggestion,omitempty"`
+	// SuggestedName follows Plex conventions, e.g. "Show Name/Season 02/Show Name - S02E05"
+	SuggestedName string `json:"suggestedName,omitempty"`
+}
+
+// describeName parses a torrent name and suggests a content type and a
+// name for the prepare responses. Magnets without a display name are named
+// after their hash until the metadata arrives; with nothing to parse, only
+// the tracker category the UI passed along counts.
+func describeName(name, hash, trackerCategory string) NameDetails {
+	if name == "" || strings.EqualFold(name, hash) {
+		return NameDetails{Suggestion: classify.Suggest(trackerCategory, "", release.Info{})}
+	}
+	info := release.Parse(name)
+	return NameDetails{
+		Parsed:        &info,
+		Suggestion:    classify.Suggest(trackerCategory, name, info),
+		SuggestedName: naming.Suggest(info),
+	}
+}
+
+// trackerCategoryAt returns the tracker category sent for the i-th item of a batch
+func trackerCategoryAt(categories []string, i int) string {
+	if i < len(categories) {
+		return categories[i]
+	}
+	return ""
 }
 
 // FinalizeRequest is the request for finalize endpoint
 type FinalizeRequest struct {
 	Torrents    []TorrentFinalize `json:"torrents"`
 	ContentType string            `json:"contentType"`
+	// RenameFiles is the default for torrents that don't set their own
+	RenameFiles bool `json:"renameFiles,omitempty"`
 }
 
-// TorrentFinalize contains the torrent ID and optional new name
+// TorrentFinalize contains the torrent ID, optional new name and optional
+// path template fields; missing fields are guessed from the torrent name.
+// ContentType overrides the request's for this torrent; "auto" (or no
+// content type anywhere) lets the classifier pick, helped by TrackerCategory.
+// RenameFiles renames the torrent's files to Plex conventions.
 type TorrentFinalize struct {
-	ID      int    `json:"id"`
-	NewName string `json:"newName,omitempty"`
+	ID              int    `json:"id"`
+	NewName         string `json:"newName,omitempty"`
+	ContentType     string `json:"contentType,omitempty"`
+	TrackerCategory string `json:"trackerCategory,omitempty"`
+	RenameFiles     *bool  `json:"renameFiles,omitempty"`
+	category.Fields
 }
 
 // CancelRequest is the request for cancel endpoint
@@ -48,11 +102,15 @@ type CancelRequest struct {
 // BatchPrepareRequest is the request for batch prepare
 type BatchPrepareRequest struct {
 	MagnetLinks []string `json:"magnetLinks"`
+	// TrackerCategories optionally gives the tracker category of each link
+	TrackerCategories []string `json:"trackerCategories,omitempty"`
 }
 
 // BatchFilePrepareRequest is the request for batch file prepare
 type BatchFilePrepareRequest struct {
 	URLs []string `json:"urls"`
+	// TrackerCategories optionally gives the tracker category of each URL
+	TrackerCategories []string `json:"trackerCategories,omitempty"`
 }
 
 // BatchPrepareResponse is the response for batch prepare
@@ -92,55 +150,74 @@ func handlePrepareDownload(gc *gin.Context) {
 	// Add torrent paused
 	args := map[string]interface{}{
 		"filename": filename,
-		"paused":   true,
 	}
 
-	result, err := client.SendRequest("torrent-add", args)
+	added, err := prepareTorrentForUser(currentUser(gc), args)
 	if err != nil {
+		if respondQuotaError(gc, err) {
+			return
+		}
 		gc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	if result.Result != "success" {
-		gc.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add torrent"})
-		return
-	}
+	// For magnet links, metadata may not be ready yet
+	// For torrent files, metadata is always ready
+	ready := torrentFile != nil || added.Name != ""
+
+	details := describeName(added.Name, added.Hash, gc.PostForm("trackerCategory"))
+	gc.JSON(http.StatusOK, PrepareResponse{
+		ID:          added.ID,
+		Name:        added.Name,
+		Ready:       ready,
+		NameDetails: details,
+	})
+}
 
-	// Check for torrent-added or torrent-duplicate
-	var torrentInfo map[string]interface{}
-	if added, ok := result.Arguments["torrent-added"].(map[string]interface{}); ok {
-		torrentInfo = added
-	} else if duplicate, ok := result.Arguments["torrent-duplicate"].(map[string]interface{}); ok {
-		torrentInfo = duplicate
+// prepareTorrentForUser adds a torrent paused for the prepare/finalize flow
+// and records the user as its owner. As soon as the size is known it is
+// checked against the user's quota, and torrents that don't fit are removed.
+func prepareTorrentForUser(u quota.User, args map[string]interface{}) (addedTorrent, error) {
+	if err := checkQuota(u, 0, 1); err != nil {
+		return addedTorrent{}, err
 	}
 
-	if torrentInfo == nil {
-		gc.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get torrent info"})
-		return
+	args["paused"] = true
+	added, err := addTorrent(args)
+	if err != nil {
+		return addedTorrent{}, err
 	}
 
-	id, idOk := GetInt(torrentInfo, "id")
-	name, nameOk := GetString(torrentInfo, "name")
+	if !added.Duplicate {
+		quotaLedger.Track(quota.Entry{
+			Hash:      added.Hash,
+			TorrentID: added.ID,
+			UserID:    u.ID,
+			Name:      added.Name,
+		})
+	}
 
-	if !idOk {
-		gc.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get torrent ID"})
-		return
+	t, err := fetchTorrent(added.ID, []string{"id", "totalSize", "sizeWhenDone"})
+	if err != nil {
+		return added, nil
 	}
 
-	// For magnet links, metadata may not be ready yet
-	// For torrent files, metadata is always ready
-	ready := torrentFile != nil || nameOk
+	if size := torrentSize(t); size > 0 {
+		if err := checkQuota(u, size, 1); err != nil {
+			if !added.Duplicate {
+				removeTorrent(added.ID)
+				quotaLedger.Forget(added.Hash)
+			}
+			return addedTorrent{}, err
+		}
+	}
 
-	gc.JSON(http.StatusOK, PrepareResponse{
-		ID:    id,
-		Name:  name,
-		Ready: ready,
-	})
+	return added, nil
 }
 
 // handleFilePrepareDownload handles RuTracker file prepare
 func handleFilePrepareDownload(gc *gin.Context) {
-	torrentFileSaveLocation := "/mediastorage/torrent-files"
+	torrentFileSaveLocation := torrentFilesDir
 
 	url := gc.PostForm("url")
 	if url == "" {
@@ -184,45 +261,24 @@ func handleFilePrepareDownload(gc *gin.Context) {
 	// Add torrent paused
 	args := map[string]interface{}{
 		"metainfo": base64Data,
-		"paused":   true,
 	}
 
-	result, err := client.SendRequest("torrent-add", args)
+	added, err := prepareTorrentForUser(currentUser(gc), args)
 	if err != nil {
+		if respondQuotaError(gc, err) {
+			return
+		}
 		gc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	if result.Result != "success" {
-		gc.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add torrent"})
-		return
-	}
-
-	var torrentInfo map[string]interface{}
-	if added, ok := result.Arguments["torrent-added"].(map[string]interface{}); ok {
-		torrentInfo = added
-	} else if duplicate, ok := result.Arguments["torrent-duplicate"].(map[string]interface{}); ok {
-		torrentInfo = duplicate
-	}
-
-	if torrentInfo == nil {
-		gc.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get torrent info"})
-		return
-	}
-
-	id, idOk := GetInt(torrentInfo, "id")
-	name, _ := GetString(torrentInfo, "name")
-
-	if !idOk {
-		gc.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get torrent ID"})
-		return
-	}
-
 	// For torrent files, metadata is always ready
+	details := describeName(added.Name, added.Hash, gc.PostForm("trackerCategory"))
 	gc.JSON(http.StatusOK, PrepareResponse{
-		ID:    id,
-		Name:  name,
-		Ready: true,
+		ID:          added.ID,
+		Name:        added.Name,
+		Ready:       true,
+		NameDetails: details,
 	})
 }
 
@@ -239,50 +295,27 @@ func handleBatchPrepareDownload(gc *gin.Context) {
 		return
 	}
 
+	user := currentUser(gc)
 	var torrents []PrepareResponse
 	var errors []string
 
-	for _, magnetLink := range req.MagnetLinks {
+	for i, magnetLink := range req.MagnetLinks {
 		args := map[string]interface{}{
 			"filename": magnetLink,
-			"paused":   true,
 		}
 
-		result, err := client.SendRequest("torrent-add", args)
+		added, err := prepareTorrentForUser(user, args)
 		if err != nil {
 			errors = append(errors, fmt.Sprintf("Failed to add torrent: %v", err))
 			continue
 		}
 
-		if result.Result != "success" {
-			errors = append(errors, "Failed to add torrent: unsuccessful result")
-			continue
-		}
-
-		var torrentInfo map[string]interface{}
-		if added, ok := result.Arguments["torrent-added"].(map[string]interface{}); ok {
-			torrentInfo = added
-		} else if duplicate, ok := result.Arguments["torrent-duplicate"].(map[string]interface{}); ok {
-			torrentInfo = duplicate
-		}
-
-		if torrentInfo == nil {
-			errors = append(errors, "Failed to get torrent info")
-			continue
-		}
-
-		id, idOk := GetInt(torrentInfo, "id")
-		name, nameOk := GetString(torrentInfo, "name")
-
-		if !idOk {
-			errors = append(errors, "Failed to get torrent ID")
-			continue
-		}
-
+		details := describeName(added.Name, added.Hash, trackerCategoryAt(req.TrackerCategories, i))
 		torrents = append(torrents, PrepareResponse{
-			ID:    id,
-			Name:  name,
-			Ready: nameOk,
+			ID:          added.ID,
+			Name:        added.Name,
+			Ready:       added.Name != "",
+			NameDetails: details,
 		})
 	}
 
@@ -294,7 +327,7 @@ func handleBatchPrepareDownload(gc *gin.Context) {
 
 // handleBatchFilePrepareDownload handles batch RuTracker file prepare
 func handleBatchFilePrepareDownload(gc *gin.Context) {
-	torrentFileSaveLocation := "/mediastorage/torrent-files"
+	torrentFileSaveLocation := torrentFilesDir
 
 	var req BatchFilePrepareRequest
 	if err := gc.ShouldBindJSON(&req); err != nil {
@@ -322,10 +355,11 @@ func handleBatchFilePrepareDownload(gc *gin.Context) {
 		return
 	}
 
+	user := currentUser(gc)
 	var torrents []PrepareResponse
 	var errors []string
 
-	for _, fileURL := range req.URLs {
+	for i, fileURL := range req.URLs {
 		filename, err := downloadFile(ctx, fileURL, torrentFileSaveLocation)
 		if err != nil {
 			log.Printf("Error downloading file %s: %v", fileURL, err)
@@ -348,44 +382,20 @@ func handleBatchFilePrepareDownload(gc *gin.Context) {
 
 		args := map[string]interface{}{
 			"metainfo": base64Data,
-			"paused":   true,
 		}
 
-		result, err := client.SendRequest("torrent-add", args)
+		added, err := prepareTorrentForUser(user, args)
 		if err != nil {
 			errors = append(errors, fmt.Sprintf("Failed to add torrent: %v", err))
 			continue
 		}
 
-		if result.Result != "success" {
-			errors = append(errors, "Failed to add torrent: unsuccessful result")
-			continue
-		}
-
-		var torrentInfo map[string]interface{}
-		if added, ok := result.Arguments["torrent-added"].(map[string]interface{}); ok {
-			torrentInfo = added
-		} else if duplicate, ok := result.Arguments["torrent-duplicate"].(map[string]interface{}); ok {
-			torrentInfo = duplicate
-		}
-
-		if torrentInfo == nil {
-			errors = append(errors, "Failed to get torrent info")
-			continue
-		}
-
-		id, idOk := GetInt(torrentInfo, "id")
-		name, _ := GetString(torrentInfo, "name")
-
-		if !idOk {
-			errors = append(errors, "Failed to get torrent ID")
-			continue
-		}
-
+		details := describeName(added.Name, added.Hash, trackerCategoryAt(req.TrackerCategories, i))
 		torrents = append(torrents, PrepareResponse{
-			ID:    id,
-			Name:  name,
-			Ready: true,
+			ID:          added.ID,
+			Name:        added.Name,
+			Ready:       true,
+			NameDetails: details,
 		})
 	}
 
@@ -406,6 +416,7 @@ func handlePrepareStatus(gc *gin.Context) {
 		"fields": []string{
 			"id",
 			"name",
+			"hashString",
 			"metadataPercentComplete",
 		},
 	}
@@ -420,15 +431,18 @@ func handlePrepareStatus(gc *gin.Context) {
 		if torrent, ok := torrents[0].(map[string]interface{}); ok {
 			id, _ := GetInt(torrent, "id")
 			name, _ := GetString(torrent, "name")
+			hash, _ := GetString(torrent, "hashString")
 			metadataPercent, _ := GetFloat64(torrent, "metadataPercentComplete")
 
 			ready := metadataPercent >= 1.0
+			details := describeName(name, hash, gc.Query("trackerCategory"))
 
 			gc.JSON(http.StatusOK, PrepareStatusResponse{
 				ID:                      id,
 				Name:                    name,
 				Ready:                   ready,
 				MetadataPercentComplete: metadataPercent,
+				NameDetails:             details,
 			})
 			return
 		}
@@ -450,36 +464,98 @@ func handleFinalizeDownload(gc *gin.Context) {
 		return
 	}
 
-	if req.ContentType == "" {
-		gc.JSON(http.StatusBadRequest, gin.H{"error": "contentType is required"})
-		return
+	user := currentUser(gc)
+
+	// Check an explicit request-wide content type up front
+	if req.ContentType != "" && req.ContentType != autoContentType {
+		if _, err := GetCategory(req.ContentType, user.Role); err != nil {
+			gc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 	}
 
-	downloadDir, err := GetDownloadDir(req.ContentType)
+	limits, usage, err := quotaState(user)
 	if err != nil {
-		gc.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		gc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	var torrentIds []int
+	var queued []int
 	var errors []string
+	contentTypes := make(map[int]string)
 
 	for _, t := range req.Torrents {
-		// First, set the download directory
-		setLocationArgs := map[string]interface{}{
-			"ids":      []int{t.ID},
-			"location": downloadDir,
-			"move":     false,
+		// Check the quota now that the size is known
+		info, err := fetchTorrent(t.ID, []string{"id", "hashString", "name", "status", "totalSize", "sizeWhenDone"})
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("Failed to get torrent %d: %v", t.ID, err))
+			continue
+		}
+
+		size := torrentSize(info)
+		starting := 1
+		if info.Status != transmission.StatusStopped {
+			starting = 0
+		}
+		if err := quota.Check(limits, usage, size, starting); err != nil {
+			errors = append(errors, fmt.Sprintf("Torrent %d not started: %v", t.ID, err))
+			continue
+		}
+
+		nameForFields := info.Name
+		if t.NewName != "" {
+			nameForFields = t.NewName
+		}
+
+		cat, err := finalizeCategory(t, req.ContentType, nameForFields, user.Role)
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("Torrent %d not started: %v", t.ID, err))
+			continue
 		}
 
-		_, err := client.SendRequest("torrent-set-location", setLocationArgs)
+		newName := t.NewName
+		renameFiles := req.RenameFiles
+		if t.RenameFiles != nil {
+			renameFiles = *t.RenameFiles
+		}
+
+		// First, set the download directory
+		downloadDir, staged, err := placeTorrent(cat, t.Fields.Merge(category.GuessFields(nameForFields)), library.Entry{
+			Hash:        info.HashString,
+			TorrentID:   t.ID,
+			Name:        info.Name,
+			NewName:     newName,
+			RenameFiles: renameFiles,
+		}, size)
 		if err != nil {
+			errors = append(errors, fmt.Sprintf("Failed to place torrent %d: %v", t.ID, err))
+			continue
+		}
+		if err := mountChecker.Ready(downloadDir); err != nil {
+			errors = append(errors, fmt.Sprintf("Torrent %d not started: %v", t.ID, err))
+			continue
+		}
+
+		if err := setTorrentLocation(t.ID, downloadDir); err != nil {
 			errors = append(errors, fmt.Sprintf("Failed to set location for torrent %d: %v", t.ID, err))
 			continue
 		}
 
+		// A staged torrent keeps its names; the library copy gets the new ones
+		if staged {
+			newName, renameFiles = "", false
+		}
+		if renameFiles {
+			info := release.Parse(nameForFields)
+			// A single file torrent's name is its file, which renameTorrentFiles already handled
+			if hasFolder := renameTorrentFiles(t.ID, info); hasFolder && newName == "" {
+				newName = naming.FolderName(info)
+			}
+		}
+
 		// Rename if new name provided
-		if t.NewName != "" {
+		if newName != "" {
 			// Get current name first
 			getArgs := map[string]interface{}{
 				"ids":    []int{t.ID},
@@ -499,11 +575,11 @@ func handleFinalizeDownload(gc *gin.Context) {
 				}
 			}
 
-			if currentName != "" && currentName != t.NewName {
+			if currentName != "" && currentName != newName {
 				renameArgs := map[string]interface{}{
 					"ids":  []int{t.ID},
 					"path": currentName,
-					"name": t.NewName,
+					"name": newName,
 				}
 
 				renameResult, err := client.SendRequest("torrent-rename-path", renameArgs)
@@ -516,6 +592,36 @@ func handleFinalizeDownload(gc *gin.Context) {
 			}
 		}
 
+		applySeedingPolicy(t.ID, cat)
+
+		entry := quota.Entry{
+			Hash:      info.HashString,
+			TorrentID: t.ID,
+			UserID:    user.ID,
+			Name:      info.Name,
+		}
+
+		// Hold it back if its disk can't take it
+		if err := checkSpace(downloadDir, size, info.HashString); err != nil {
+			if !spaceGuard.Config().Queue() {
+				errors = append(errors, fmt.Sprintf("Torrent %d not started: %v", t.ID, err))
+				continue
+			}
+			quotaLedger.Track(entry)
+			spaceQueue.Add(disk.Queued{
+				TorrentID: t.ID,
+				Hash:      info.HashString,
+				Name:      info.Name,
+				Dir:       downloadDir,
+				Size:      size,
+				UserID:    user.ID,
+				Reason:    err.Error(),
+			})
+			queued = append(queued, t.ID)
+			contentTypes[t.ID] = cat.ID
+			continue
+		}
+
 		// Start the torrent
 		startArgs := map[string]interface{}{
 			"ids": []int{t.ID},
@@ -532,16 +638,50 @@ func handleFinalizeDownload(gc *gin.Context) {
 			continue
 		}
 
+		quotaLedger.Track(entry)
+		quotaLedger.Start(info.HashString, size, time.Now())
+		// A torrent that was already running counted when it was started
+		if starting > 0 {
+			usage.ActiveTorrents += starting
+			usage.BytesToday += size
+			usage.BytesThisMonth += size
+		}
+
 		torrentIds = append(torrentIds, t.ID)
+		contentTypes[t.ID] = cat.ID
 	}
 
 	gc.JSON(http.StatusOK, gin.H{
-		"message":    "Torrents started",
-		"torrentIds": torrentIds,
-		"errors":     errors,
+		"message":      "Torrents started",
+		"torrentIds":   torrentIds,
+		"queued":       queued,
+		"contentTypes": contentTypes,
+		"errors":       errors,
 	})
 }
 
+// autoContentType asks finalize to classify each torrent itself
+const autoContentType = "auto"
+
+// finalizeCategory picks the category for one torrent of a finalize request:
+// its own content type, else the request's, else the classifier's suggestion
+// if it is confident enough
+func finalizeCategory(t TorrentFinalize, requested, name, role string) (category.Category, error) {
+	contentType := t.ContentType
+	if contentType == "" {
+		contentType = requested
+	}
+	if contentType != "" && contentType != autoContentType {
+		return GetCategory(contentType, role)
+	}
+
+	suggestion := classify.Suggest(t.TrackerCategory, name, release.Parse(name))
+	if suggestion == nil || suggestion.Confidence < classify.LoadConfig().MinConfidence {
+		return category.Category{}, fmt.Errorf("could not tell its content type, please pick one")
+	}
+	return GetCategory(suggestion.ContentType, role)
+}
+
 // handleCancelDownload removes paused torrents
 func handleCancelDownload(gc *gin.Context) {
 	var req CancelRequest
@@ -555,21 +695,34 @@ func handleCancelDownload(gc *gin.Context) {
 		return
 	}
 
-	args := map[string]interface{}{
-		"ids":               req.IDs,
-		"delete-local-data": true,
-	}
+	response := gin.H{"message": "Torrents cancelled"}
+	if trashBin.Enabled() {
+		trashed, erased, errs, err := trashTorrents(req.IDs, currentUser(gc), "cancelled")
+		if err != nil {
+			gc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		response["trash"], response["deleted"], response["errors"] = trashed, erased, errs
+	} else {
+		args := map[string]interface{}{
+			"ids":               req.IDs,
+			"delete-local-data": true,
+		}
 
-	result, err := client.SendRequest("torrent-remove", args)
-	if err != nil {
-		gc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
+		result, err := client.SendRequest("torrent-remove", args)
+		if err != nil {
+			gc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 
-	if result.Result != "success" {
-		gc.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove torrents"})
-		return
+		if result.Result != "success" {
+			gc.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove torrents"})
+			return
+		}
 	}
 
-	gc.JSON(http.StatusOK, gin.H{"message": "Torrents cancelled"})
+	quotaLedger.ForgetUnstarted(req.IDs)
+	spaceQueue.Remove(req.IDs)
+
+	gc.JSON(http.StatusOK, response)
 }
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hasmikatom/torrent/category"
+	"github.com/hasmikatom/torrent/seeding"
+	"github.com/hasmikatom/torrent/transmission"
+)
+
+// listSeedingTorrents returns every torrent with the fields seeding rules use
+func listSeedingTorrents() ([]transmission.Torrent, error) {
+	return client.GetTorrents(nil, seeding.Fields)
+}
+
+// removeSeededTorrents removes torrents that have seeded enough, keeping
+// their data
+func removeSeededTorrents(ids []int) error {
+	args := map[string]interface{}{
+		"ids":               ids,
+		"delete-local-data": false,
+	}
+	result, err := client.SendRequest("torrent-remove", args)
+	if err != nil {
+		return err
+	}
+	if result.Result != "success" {
+		return errors.New(result.Result)
+	}
+	return nil
+}
+
+// torrentCategory returns the category a download directory, library or
+// staging, belongs to
+func torrentCategory(dir string) (category.Category, bool) {
+	id, ok := torrentCategoryID(dir)
+	if !ok {
+		return category.Category{}, false
+	}
+	return category.Load().Get(id)
+}
+
+// previewSeeding lists the torrents whose seeding policy is satisfied, i.e.
+// what the enforcer would remove on its next run
+func previewSeeding(gc *gin.Context) {
+	candidates, err := seedingEnforcer.Preview()
+	if err != nil {
+		gc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	gc.JSON(http.StatusOK, gin.H{
+		"remove":   seeding.LoadConfig().Remove,
+		"torrents": candidates,
+	})
+}
+
+// listSeedingRemovals returns recent removals by the enforcer
+func listSeedingRemovals(gc *gin.Context) {
+	gc.JSON(http.StatusOK, gin.H{"removals": seedingEnforcer.History()})
+}
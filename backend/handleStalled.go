@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hasmikatom/torrent/quota"
+)
+
+// reannounceTorrent asks a torrent's trackers for peers right away
+func reannounceTorrent(id int) error {
+	result, err := client.SendRequest("torrent-reannounce", map[string]interface{}{"ids": []int{id}})
+	if err != nil {
+		return err
+	}
+	if result.Result != "success" {
+		return errors.New(result.Result)
+	}
+	return nil
+}
+
+// removeStalledTorrent removes a dead torrent along with what it
+// downloaded, which goes to the trash when it is on
+func removeStalledTorrent(id int) error {
+	if trashBin.Enabled() {
+		_, _, errs, err := trashTorrents([]int{id}, quota.User{}, "stalled")
+		if err != nil {
+			return err
+		}
+		for _, e := range errs {
+			log.Printf("Stalled torrent %d: %s", id, e)
+		}
+		return nil
+	}
+
+	args := map[string]interface{}{
+		"ids":               []int{id},
+		"delete-local-data": true,
+	}
+	result, err := client.SendRequest("torrent-remove", args)
+	if err != nil {
+		return err
+	}
+	if result.Result != "success" {
+		return errors.New(result.Result)
+	}
+	return nil
+}
+
+// markStalled reports a torrent the watcher considers stalled as such
+func markStalled(status *TorrentStatus, hash string) {
+	if hash == "" {
+		return
+	}
+	s, ok := torrentWatcher.Stalled(hash)
+	if !ok {
+		return
+	}
+	status.Status = "Stalled"
+	status.StallReason = s.Reason
+	status.StallDetail = s.Detail
+	since := s.Since.Unix()
+	status.StalledSince = &since
+}
+
+// listStallActions returns what was recently done about stalled torrents
+func listStallActions(gc *gin.Context) {
+	gc.JSON(http.StatusOK, gin.H{"actions": stallHandler.History()})
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hasmikatom/torrent/quota"
+	"github.com/hasmikatom/torrent/transmission"
+	"github.com/hasmikatom/torrent/trash"
+)
+
+// trashTorrents removes torrents from the daemon but keeps their data, which
+// is moved into the trash. Data that can't be found, or is on a filesystem
+// without a trash, is deleted with its torrent as before, and those
+// torrents are returned as erased. Data that fails to move after the
+// torrents are gone is left where it was and reported in the errors.
+func trashTorrents(ids []int, u quota.User, reason string) ([]trash.Entry, []int, []string, error) {
+	torrents, err := client.GetTorrents(ids, []string{"id", "name", "hashString", "downloadDir"})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	incomplete, _ := incompleteDir()
+
+	var pending []trash.Entry
+	var erased []int
+	for _, t := range torrents {
+		path, ok := torrentData(t, incomplete)
+		if !ok {
+			log.Printf("No data found for torrent %d, letting the daemon delete what it has", t.ID)
+			erased = append(erased, t.ID)
+			continue
+		}
+		if _, err := trashBin.Dir(path); err != nil {
+			log.Printf("Deleting the data of torrent %d outright: %v", t.ID, err)
+			erased = append(erased, t.ID)
+			continue
+		}
+		owner, _ := quotaLedger.Owner(t.HashString)
+		pending = append(pending, trash.Entry{
+			Original:  path,
+			Owner:     owner,
+			DeletedBy: u.ID,
+			TorrentID: t.ID,
+			Hash:      t.HashString,
+			Reason:    reason,
+		})
+	}
+
+	var kept []int
+	for _, id := range ids {
+		if !slices.Contains(erased, id) {
+			kept = append(kept, id)
+		}
+	}
+	if err := removeTorrents(erased, true); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := removeTorrents(kept, false); err != nil {
+		return nil, erased, nil, err
+	}
+
+	trashed := []trash.Entry{}
+	var errs []string
+	for _, e := range pending {
+		moved, err := trashBin.Move(e)
+		if err != nil {
+			log.Printf("Failed to move %s to the trash: %v", e.Original, err)
+			errs = append(errs, fmt.Sprintf("Torrent %d removed, but its data was left at %s: %v", e.TorrentID, e.Original, err))
+			continue
+		}
+		log.Printf("Moved %s of torrent %d to the trash", e.Original, e.TorrentID)
+		trashed = append(trashed, moved)
+	}
+	return trashed, erased, errs, nil
+}
+
+// torrentData returns where a torrent's data is on disk: in its download
+// folder or the daemon's incomplete folder, under its name or, for a single
+// file still downloading, with .part added
+func torrentData(t transmission.Torrent, incomplete string) (string, bool) {
+	if t.Name == "" {
+		return "", false
+	}
+	for _, dir := range []string{t.DownloadDir, incomplete} {
+		if dir == "" {
+			continue
+		}
+		path := filepath.Join(dir, t.Name)
+		for _, p := range []string{path, path + partSuffix} {
+			if _, err := os.Lstat(p); err == nil {
+				return p, true
+			}
+		}
+	}
+	return "", false
+}
+
+// incompleteDir returns the folder the daemon keeps unfinished downloads
+// in, when it uses one
+func incompleteDir() (string, bool) {
+	result, err := client.SendRequest("session-get", map[string]interface{}{
+		"fields": []string{"incomplete-dir", "incomplete-dir-enabled"},
+	})
+	if err != nil || result.Result != "success" {
+		return "", false
+	}
+	enabled, _ := result.Arguments["incomplete-dir-enabled"].(bool)
+	dir, _ := GetString(result.Arguments, "incomplete-dir")
+	return dir, enabled && dir != ""
+}
+
+// removeTorrents sends one torrent-remove for ids, if there are any
+func removeTorrents(ids []int, deleteData bool) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	result, err := client.SendRequest("torrent-remove", map[string]interface{}{
+		"ids":               ids,
+		"delete-local-data": deleteData,
+	})
+	if err == nil && result.Result != "success" {
+		err = errors.New(result.Result)
+	}
+	return err
+}
+
+// mayUseTrashEntry reports whether u may see or restore a trashed item: its
+// owner, whoever deleted it, or an admin
+func mayUseTrashEntry(u quota.User, e trash.Entry) bool {
+	return u.Role == "admin" || (u.ID != "" && (e.Owner == u.ID || e.DeletedBy == u.ID))
+}
+
+// listTrash returns what is in the trash, newest first. Users only see
+// items they added or deleted.
+func listTrash(gc *gin.Context) {
+	user := currentUser(gc)
+	entries := []trash.Entry{}
+	for _, e := range trashBin.Entries() {
+		if mayUseTrashEntry(user, e) {
+			entries = append(entries, e)
+		}
+	}
+	gc.JSON(http.StatusOK, gin.H{
+		"enabled":       trashBin.Enabled(),
+		"retentionDays": int(trash.LoadConfig().Retention().Hours() / 24),
+		"entries":       entries,
+	})
+}
+
+// restoreTrash moves a trashed item back to its original path. The torrent
+// isn't added again; adding it with the same download folder picks the
+// data up after a verify.
+func restoreTrash(gc *gin.Context) {
+	e, ok := trashBin.Get(gc.Param("id"))
+	if !ok || !mayUseTrashEntry(currentUser(gc), e) {
+		gc.JSON(http.StatusNotFound, gin.H{"error": trash.ErrNotFound.Error()})
+		return
+	}
+
+	restored, err := trashBin.Restore(e.ID)
+	switch {
+	case errors.Is(err, trash.ErrNotFound):
+		gc.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, trash.ErrExists):
+		gc.JSON(http.StatusConflict, gin.H{"error": err.Error(), "path": e.Original})
+	case err != nil:
+		gc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Restored %s from the trash", restored.Original)
+		gc.JSON(http.StatusOK, gin.H{"message": "Restored", "entry": restored})
+	}
+}
+
+// purgeTrashEntry erases one trashed item for good
+func purgeTrashEntry(gc *gin.Context) {
+	e, err := trashBin.Purge(gc.Param("id"))
+	if errors.Is(err, trash.ErrNotFound) {
+		gc.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		gc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("Purged %s from the trash", e.Original)
+	gc.JSON(http.StatusOK, gin.H{"message": "Purged", "entry": e})
+}
+
+// purgeTrash empties the trash, or with ?expired=true only what is past its
+// retention
+func purgeTrash(gc *gin.Context) {
+	if gc.Query("expired") == "true" {
+		gc.JSON(http.StatusOK, gin.H{"purged": trashBin.PurgeExpired()})
+		return
+	}
+
+	purged := []trash.Entry{}
+	var errs []string
+	for _, e := range trashBin.Entries() {
+		if _, err := trashBin.Purge(e.ID); err != nil {
+			errs = append(errs, fmt.Sprintf("Failed to purge %s: %v", e.Original, err))
+			continue
+		}
+		purged = append(purged, e)
+	}
+	log.Printf("Emptied the trash, %d items purged", len(purged))
+	gc.JSON(http.StatusOK, gin.H{"purged": purged, "errors": errs})
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hasmikatom/torrent/webhook"
+)
+
+// WebhookInfo is a configured webhook without its secret
+type WebhookInfo struct {
+	ID          string   `json:"id"`
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	MaxAttempts int      `json:"maxAttempts"`
+	HasSecret   bool     `json:"hasSecret"`
+}
+
+// listWebhooks returns the configured webhooks
+func listWebhooks(gc *gin.Context) {
+	hooks := make([]WebhookInfo, 0)
+	for _, h := range webhook.LoadConfig().Webhooks {
+		events := h.Events
+		if events == nil {
+			events = []string{}
+		}
+		hooks = append(hooks, WebhookInfo{
+			ID:          h.ID,
+			URL:         h.URL,
+			Events:      events,
+			MaxAttempts: h.MaxAttempts,
+			HasSecret:   h.Secret != "",
+		})
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"webhooks": hooks})
+}
+
+// listWebhookDeliveries returns the delivery log, newest first, filtered by
+// ?webhook= and ?status= and capped by ?limit= (default 100)
+func listWebhookDeliveries(gc *gin.Context) {
+	limit := 100
+	if v := gc.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			gc.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a non-negative number"})
+			return
+		}
+		limit = n
+	}
+
+	status := gc.Query("status")
+	switch status {
+	case "", webhook.StatusPending, webhook.StatusDelivered, webhook.StatusFailed:
+	default:
+		gc.JSON(http.StatusBadRequest, gin.H{"error": "status must be pending, delivered or failed"})
+		return
+	}
+
+	gc.JSON(http.StatusOK, gin.H{"deliveries": webhookLog.List(gc.Query("webhook"), status, limit)})
+}
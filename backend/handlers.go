@@ -13,6 +13,7 @@ import (
 	"github.com/chromedp/cdproto/browser"
 	"github.com/chromedp/chromedp"
 	"github.com/gin-gonic/gin"
+	"github.com/hasmikatom/torrent/category"
 	"github.com/hasmikatom/torrent/scraper"
 )
 
@@ -26,8 +27,10 @@ func handleDownload(c *gin.Context) {
 		return
 	}
 
+	user := currentUser(c)
+
 	// Validate mediaType to prevent path traversal
-	downloadDir, err := GetDownloadDir(mediaType)
+	cat, err := GetCategory(mediaType, user.Role)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -52,32 +55,27 @@ func handleDownload(c *gin.Context) {
 	}
 
 	args := map[string]interface{}{
-		"filename":     filename,
-		"download-dir": downloadDir,
+		"filename": filename,
 	}
 
-	result, err := client.SendRequest("torrent-add", args)
+	added, err := addTorrentForUser(user, cat, formFields(c), args)
 	if err != nil {
+		if respondQuotaError(c, err) || respondSpaceError(c, err) || respondMountError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	if result.Result != "success" {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add torrent"})
-		return
-	}
-
-	if torrentAdded, ok := result.Arguments["torrent-added"].(map[string]interface{}); ok {
-		if id, ok := torrentAdded["id"].(float64); ok {
-			c.JSON(http.StatusOK, gin.H{
-				"message":   "Download started",
-				"torrentId": int(id),
-			})
-			return
-		}
+	message := "Download started"
+	if added.Queued {
+		message = "Download queued until there is enough disk space"
 	}
-
-	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get torrent ID"})
+	c.JSON(http.StatusOK, gin.H{
+		"message":   message,
+		"torrentId": added.ID,
+		"queued":    added.Queued,
+	})
 }
 
 type BatchDownloadRequest struct {
@@ -86,8 +84,10 @@ type BatchDownloadRequest struct {
 }
 
 type BatchDownloadResponse struct {
-	TorrentIds []int    `json:"torrentIds"`
-	Errors     []string `json:"errors,omitempty"`
+	TorrentIds []int `json:"torrentIds"`
+	// Queued are the torrents among TorrentIds waiting for disk space
+	Queued []int    `json:"queued,omitempty"`
+	Errors []string `json:"errors,omitempty"`
 }
 
 func handleBatchDownload(c *gin.Context) {
@@ -107,42 +107,39 @@ func handleBatchDownload(c *gin.Context) {
 		return
 	}
 
+	user := currentUser(c)
+
 	// Validate contentType to prevent path traversal
-	downloadDir, err := GetDownloadDir(req.ContentType)
+	cat, err := GetCategory(req.ContentType, user.Role)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	var torrentIds []int
+	var queued []int
 	var errors []string
 
 	for _, magnetLink := range req.MagnetLinks {
 		args := map[string]interface{}{
-			"filename":     magnetLink,
-			"download-dir": downloadDir,
+			"filename": magnetLink,
 		}
 
-		result, err := client.SendRequest("torrent-add", args)
+		added, err := addTorrentForUser(user, cat, category.Fields{}, args)
 		if err != nil {
 			errors = append(errors, fmt.Sprintf("Failed to add torrent: %v", err))
 			continue
 		}
 
-		if result.Result != "success" {
-			errors = append(errors, "Failed to add torrent: unsuccessful result")
-			continue
-		}
-
-		if torrentAdded, ok := result.Arguments["torrent-added"].(map[string]interface{}); ok {
-			if id, ok := torrentAdded["id"].(float64); ok {
-				torrentIds = append(torrentIds, int(id))
-			}
+		torrentIds = append(torrentIds, added.ID)
+		if added.Queued {
+			queued = append(queued, added.ID)
 		}
 	}
 
 	response := BatchDownloadResponse{
 		TorrentIds: torrentIds,
+		Queued:     queued,
 		Errors:     errors,
 	}
 
@@ -166,6 +163,7 @@ func getTorrentStatus(c *gin.Context) {
 			"status",
 			"error",
 			"errorString",
+			"hashString",
 		},
 	}
 
@@ -182,6 +180,8 @@ func getTorrentStatus(c *gin.Context) {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse torrent data"})
 				return
 			}
+			hash, _ := GetString(torrent, "hashString")
+			markStalled(&status, hash)
 			c.JSON(http.StatusOK, status)
 			return
 		}
@@ -206,6 +206,7 @@ func listTorrents(c *gin.Context) {
 			"status",
 			"error",
 			"errorString",
+			"hashString",
 		},
 	}
 
@@ -219,6 +220,8 @@ func listTorrents(c *gin.Context) {
 		for _, t := range torrents {
 			if torrent, ok := t.(map[string]interface{}); ok {
 				if status, ok := ParseTorrentStatus(torrent); ok {
+					hash, _ := GetString(torrent, "hashString")
+					markStalled(&status, hash)
 					statuses = append(statuses, status)
 				}
 			}
@@ -297,6 +300,21 @@ func deleteTorrent(c *gin.Context) {
 
 	deleteData := c.Query("deleteData") == "true"
 
+	// Deleted data goes to the trash rather than being erased
+	if deleteData && trashBin.Enabled() {
+		trashed, erased, errs, err := trashTorrents([]int{torrentId}, currentUser(c), "deleted")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		message := "Torrent removed, data moved to trash"
+		if len(erased) > 0 {
+			message = "Torrent removed and its data deleted"
+		}
+		c.JSON(http.StatusOK, gin.H{"message": message, "trash": trashed, "deleted": erased, "errors": errs})
+		return
+	}
+
 	args := map[string]interface{}{
 		"ids":               []int{torrentId},
 		"delete-local-data": deleteData,
@@ -324,19 +342,52 @@ type StorageInfo struct {
 	Total     uint64 `json:"total"`
 	Used      uint64 `json:"used"`
 	Available uint64 `json:"available"`
+	// Problem is set when downloads into an expected mount are blocked
+	Problem    string   `json:"problem,omitempty"`
+	Categories []string `json:"categories,omitempty"`
 }
 
 func getStorageInfo(c *gin.Context) {
 	log.Printf("Storage info: running in docker=%v, hasHostFS=%v", isRunningInDocker(), hasHostFSMount())
 
-	mounts, err := getMounts()
+	storages, err := listStorage()
 	if err != nil {
 		log.Printf("Failed to get mounts: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read mount information"})
 		return
 	}
 
-	log.Printf("Found %d mounts after filtering", len(mounts))
+	// Expected mounts that are missing get an entry of their own
+	for _, r := range checkMounts() {
+		found := false
+		for i := range storages {
+			if storages[i].Path == r.Path {
+				storages[i].Problem = r.Problem
+				storages[i].Categories = r.Categories
+				found = true
+			}
+		}
+		if !found && r.Problem != "" {
+			storages = append(storages, StorageInfo{
+				Name:       r.Path,
+				Path:       r.Path,
+				Device:     r.Device,
+				Problem:    r.Problem,
+				Categories: r.Categories,
+			})
+		}
+	}
+
+	log.Printf("Returning %d storage entries", len(storages))
+	c.JSON(http.StatusOK, storages)
+}
+
+// listStorage returns the usage of every real filesystem
+func listStorage() ([]StorageInfo, error) {
+	mounts, err := getMounts()
+	if err != nil {
+		return nil, err
+	}
 
 	storages := make([]StorageInfo, 0)
 
@@ -370,8 +421,7 @@ func getStorageInfo(c *gin.Context) {
 		storages = append(storages, info)
 	}
 
-	log.Printf("Returning %d storage entries", len(storages))
-	c.JSON(http.StatusOK, storages)
+	return storages, nil
 }
 
 func scrapePirateBay(c *gin.Context) {
@@ -0,0 +1,69 @@
+// Package jellyfin tells Jellyfin and Emby servers about finished downloads
+// through their /Library/Media/Updated API, so new files show up without
+// waiting for a scheduled library scan.
+package jellyfin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/hasmikatom/torrent/category"
+	"github.com/hasmikatom/torrent/refresh"
+)
+
+// Client talks to one Jellyfin or Emby server
+type Client struct {
+	Server category.MediaServer
+	HTTP   *http.Client
+}
+
+// MediaUpdated reports a new or changed path to the server
+func (c *Client) MediaUpdated(ctx context.Context, path string) error {
+	body, err := json.Marshal(map[string]any{
+		"Updates": []map[string]string{{"Path": path, "UpdateType": "Created"}},
+	})
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodPost, "/Library/Media/Updated", body)
+}
+
+// Ping checks that the server is reachable and accepts the API key
+func (c *Client) Ping(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, "/System/Info", nil)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL()+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	// Both servers accept the Emby header; the key stays out of the URL
+	req.Header.Set("X-Emby-Token", c.Server.APIKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &refresh.StatusError{Server: "media server", Code: resp.StatusCode, Status: resp.Status}
+	}
+	return nil
+}
+
+// baseURL is the API root. Emby serves its API below /emby.
+func (c *Client) baseURL() string {
+	base := strings.TrimRight(c.Server.URL, "/")
+	if c.Server.Type == category.ServerEmby && !strings.HasSuffix(base, "/emby") {
+		base += "/emby"
+	}
+	return base
+}
@@ -0,0 +1,191 @@
+package jellyfin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hasmikatom/torrent/category"
+	"github.com/hasmikatom/torrent/events"
+	"github.com/hasmikatom/torrent/refresh"
+)
+
+// fakeServer records /Library/Media/Updated calls and answers with scripted
+// status codes
+type fakeServer struct {
+	mu      sync.Mutex
+	codes   []int
+	updates []string
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Emby-Token") != "key" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.URL.Path {
+	case "/System/Info", "/emby/System/Info":
+		return
+	case "/Library/Media/Updated", "/emby/Library/Media/Updated":
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var body struct {
+		Updates []struct{ Path, UpdateType string }
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+	for _, u := range body.Updates {
+		f.updates = append(f.updates, r.URL.Path+" "+u.Path+" "+u.UpdateType)
+	}
+	if len(f.codes) > 0 {
+		w.WriteHeader(f.codes[0])
+		f.codes = f.codes[1:]
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *fakeServer) list() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	list := append([]string(nil), f.updates...)
+	sort.Strings(list)
+	return list
+}
+
+func server(t *testing.T, f *fakeServer, s category.MediaServer) category.MediaServer {
+	t.Helper()
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	s.URL = srv.URL
+	if s.APIKey == "" {
+		s.APIKey = "key"
+	}
+	if s.MaxAttempts == 0 {
+		s.MaxAttempts = 3
+	}
+	return s
+}
+
+func categoryOf(dir string) (string, bool) {
+	switch dir {
+	case "/mediastorage/Movies":
+		return "Movies", true
+	case "/mediastorage/Music":
+		return "Music", true
+	}
+	return "", false
+}
+
+var testOptions = refresh.Options{Backoff: time.Millisecond, MaxBackoff: time.Millisecond, Timeout: time.Second}
+
+func completed(dir, name string) events.Event {
+	return events.New(events.Completed, events.Torrent{ID: 1, Name: name, DownloadDir: dir}, time.Now())
+}
+
+func TestRefresh(t *testing.T) {
+	tests := []struct {
+		name         string
+		server       category.MediaServer
+		codes        []int
+		wantStatus   string
+		wantAttempts int
+		wantUpdates  []string
+	}{
+		{
+			name:         "jellyfin with a path mapping",
+			server:       category.MediaServer{ID: "jf", Type: category.ServerJellyfin, PathMappings: []category.PathMapping{{From: "/mediastorage", To: "/media"}}},
+			wantStatus:   refresh.StatusDone,
+			wantAttempts: 1,
+			wantUpdates:  []string{"/Library/Media/Updated /media/Movies Created"},
+		},
+		{
+			name:         "emby uses its api prefix",
+			server:       category.MediaServer{ID: "emby", Type: category.ServerEmby},
+			wantStatus:   refresh.StatusDone,
+			wantAttempts: 1,
+			wantUpdates:  []string{"/emby/Library/Media/Updated /mediastorage/Movies Created"},
+		},
+		{
+			name:         "server errors are retried",
+			server:       category.MediaServer{ID: "jf", Type: category.ServerJellyfin},
+			codes:        []int{502, 204},
+			wantStatus:   refresh.StatusDone,
+			wantAttempts: 2,
+			wantUpdates:  []string{"/Library/Media/Updated /mediastorage/Movies Created", "/Library/Media/Updated /mediastorage/Movies Created"},
+		},
+		{
+			name:         "bad key is not retried",
+			server:       category.MediaServer{ID: "jf", Type: category.ServerJellyfin, APIKey: "wrong"},
+			wantStatus:   refresh.StatusFailed,
+			wantAttempts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeServer{codes: tt.codes}
+			s := server(t, f, tt.server)
+			r := NewRefresher([]category.MediaServer{s}, categoryOf, testOptions)
+
+			got := r.Refresh(context.Background(), s, "Movies", completed("/mediastorage/Movies", "Film.2020.mkv"))
+			if got.Status != tt.wantStatus || got.Attempts != tt.wantAttempts {
+				t.Fatalf("got %s after %d attempts (%s), want %s after %d", got.Status, got.Attempts, got.Error, tt.wantStatus, tt.wantAttempts)
+			}
+			if updates := f.list(); !reflect.DeepEqual(updates, tt.wantUpdates) {
+				t.Errorf("updates = %q, want %q", updates, tt.wantUpdates)
+			}
+		})
+	}
+}
+
+func TestRun_RoutesByCategory(t *testing.T) {
+	all, movies := &fakeServer{}, &fakeServer{}
+	r := NewRefresher([]category.MediaServer{
+		server(t, all, category.MediaServer{ID: "all", Type: category.ServerJellyfin}),
+		server(t, movies, category.MediaServer{ID: "movies", Type: category.ServerEmby, Categories: []string{"Movies"}}),
+	}, categoryOf, testOptions)
+
+	ch := make(chan events.Event, 4)
+	ch <- events.New(events.Added, events.Torrent{ID: 1, DownloadDir: "/mediastorage/Movies"}, time.Now())
+	ch <- completed("/mediastorage/Movies", "Film.2020.mkv")
+	ch <- completed("/mediastorage/Music", "Album")
+	ch <- completed("/somewhere/else", "Other")
+	close(ch)
+	r.Run(context.Background(), ch)
+
+	if got := all.list(); len(got) != 2 {
+		t.Errorf("catch-all server got %q", got)
+	}
+	if got := movies.list(); len(got) != 1 {
+		t.Errorf("movies-only server got %q", got)
+	}
+	if got := len(r.History()); got != 3 {
+		t.Errorf("expected 3 refreshes in history, got %d", got)
+	}
+}
+
+func TestPing(t *testing.T) {
+	f := &fakeServer{}
+	good := server(t, f, category.MediaServer{ID: "emby", Type: category.ServerEmby})
+	bad := server(t, f, category.MediaServer{ID: "jf", Type: category.ServerJellyfin, APIKey: "wrong"})
+	r := NewRefresher([]category.MediaServer{good, bad}, categoryOf, testOptions)
+
+	if err := r.Ping(context.Background(), good); err != nil {
+		t.Errorf("expected ping to succeed, got %v", err)
+	}
+	if err := r.Ping(context.Background(), bad); err == nil {
+		t.Error("expected a bad key to fail")
+	}
+}
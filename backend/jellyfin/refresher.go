@@ -0,0 +1,119 @@
+package jellyfin
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hasmikatom/torrent/category"
+	"github.com/hasmikatom/torrent/events"
+	"github.com/hasmikatom/torrent/refresh"
+)
+
+// Refresh is one completed torrent reported to one server
+type Refresh struct {
+	EventID   string `json:"eventId"`
+	ServerID  string `json:"serverId"`
+	TorrentID int    `json:"torrentId"`
+	Name      string `json:"name"`
+	Category  string `json:"category"`
+	// Path is the folder as the server sees it
+	Path string `json:"path"`
+	refresh.State
+}
+
+// Refresher reports the folder of every completed torrent to the servers
+// that cover its category
+type Refresher struct {
+	servers []category.MediaServer
+	client  *http.Client
+	opts    refresh.Options
+	// categoryOf returns the category id a download directory belongs to
+	categoryOf func(dir string) (string, bool)
+
+	history *refresh.History[Refresh]
+	wg      sync.WaitGroup
+}
+
+// NewRefresher returns a refresher for the configured servers
+func NewRefresher(servers []category.MediaServer, categoryOf func(dir string) (string, bool), opts refresh.Options) *Refresher {
+	return &Refresher{
+		servers:    servers,
+		client:     &http.Client{Timeout: opts.Timeout},
+		opts:       opts,
+		categoryOf: categoryOf,
+		history: refresh.NewHistory(func(a, b Refresh) bool {
+			return a.EventID == b.EventID && a.ServerID == b.ServerID
+		}),
+	}
+}
+
+// Servers returns the configured servers
+func (r *Refresher) Servers() []category.MediaServer {
+	return r.servers
+}
+
+// Run refreshes completed, extracted and linked torrents until the channel
+// closes or ctx is cancelled, then waits for refreshes in flight
+func (r *Refresher) Run(ctx context.Context, ch <-chan events.Event) {
+	defer r.wg.Wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			if !refresh.Triggers(e) {
+				continue
+			}
+			id, ok := r.categoryOf(e.Torrent.DownloadDir)
+			if !ok {
+				continue
+			}
+			for _, s := range r.servers {
+				if !s.Serves(id) {
+					continue
+				}
+				r.wg.Add(1)
+				go func(s category.MediaServer) {
+					defer r.wg.Done()
+					r.Refresh(ctx, s, id, e)
+				}(s)
+			}
+		}
+	}
+}
+
+// Refresh reports a completed torrent's folder to one server, retrying
+// failures that may go away, and returns the final state
+func (r *Refresher) Refresh(ctx context.Context, s category.MediaServer, categoryID string, e events.Event) Refresh {
+	ref := Refresh{
+		EventID:   e.ID,
+		ServerID:  s.ID,
+		TorrentID: e.Torrent.ID,
+		Name:      e.Torrent.Name,
+		Category:  categoryID,
+		Path:      category.MapPath(s.PathMappings, e.Torrent.Folder()),
+		State:     refresh.Pending(time.Now()),
+	}
+	r.history.Record(ref)
+
+	client := &Client{Server: s, HTTP: r.client}
+	update := func() error { return client.MediaUpdated(ctx, ref.Path) }
+	refresh.Retry(ctx, r.opts, s.MaxAttempts, &ref.State, update, func() { r.history.Record(ref) })
+	return ref
+}
+
+// Ping checks one server
+func (r *Refresher) Ping(ctx context.Context, s category.MediaServer) error {
+	return (&Client{Server: s, HTTP: r.client}).Ping(ctx)
+}
+
+// History returns recent refreshes, newest first
+func (r *Refresher) History() []Refresh {
+	return r.history.List()
+}
@@ -0,0 +1,146 @@
+package library
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/hasmikatom/torrent/events"
+)
+
+// Orphan is something Cleanup found that nothing needs any more
+type Orphan struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+	// Bytes is what removing it frees; staging files that are still linked
+	// into the library free nothing
+	Bytes   int64  `json:"bytes"`
+	Removed bool   `json:"removed"`
+	Error   string `json:"error,omitempty"`
+}
+
+// CleanupReport lists what Cleanup found and, unless it was a dry run, did
+type CleanupReport struct {
+	DryRun  bool     `json:"dryRun"`
+	Orphans []Orphan `json:"orphans"`
+	Bytes   int64    `json:"bytes"`
+	// Forgotten counts tracked torrents dropped because they were removed
+	Forgotten int `json:"forgotten"`
+}
+
+// Cleanup tidies up after torrents that were removed from the daemon, given
+// the torrents it still has. It removes:
+//   - the staging data of removed torrents; their library copy stays
+//   - staging folders no torrent points at
+//   - links whose library file was deleted, from the tracked torrent
+//
+// With dryRun it only reports what it would do.
+func (l *Linker) Cleanup(torrents []events.Torrent, dryRun bool) CleanupReport {
+	report := CleanupReport{DryRun: dryRun, Orphans: []Orphan{}}
+	active := map[string]bool{}
+	inUse := map[string]bool{}
+	for _, t := range torrents {
+		active[t.Hash] = true
+		inUse[filepath.Join(t.DownloadDir, t.Name)] = true
+	}
+
+	reported := map[string]bool{}
+	add := func(p, reason string) {
+		if reported[p] {
+			return
+		}
+		reported[p] = true
+		o := Orphan{Path: p, Reason: reason, Bytes: freedBytes(p)}
+		if !dryRun {
+			if err := l.removeStaged(p); err != nil {
+				o.Error = err.Error()
+			} else {
+				o.Removed = true
+			}
+		}
+		if o.Error == "" {
+			report.Bytes += o.Bytes
+		}
+		report.Orphans = append(report.Orphans, o)
+	}
+
+	l.mu.Lock()
+	kept := make([]Entry, 0, len(l.entries))
+	for _, e := range l.entries {
+		if !active[e.Hash] {
+			report.Forgotten++
+			if e.Staging != "" && e.Name != "" {
+				p := filepath.Join(e.Staging, e.Name)
+				if _, err := os.Lstat(p); err == nil && !inUse[p] {
+					reason := "torrent was removed before it was linked"
+					if len(e.Links) > 0 {
+						reason = "torrent was removed, the library copy stays"
+					}
+					add(p, reason)
+				}
+			}
+			continue
+		}
+
+		links := make([]Link, 0, len(e.Links))
+		for _, link := range e.Links {
+			if _, err := os.Lstat(link.Target); err != nil {
+				report.Orphans = append(report.Orphans, Orphan{Path: link.Target, Reason: "library file was deleted", Removed: !dryRun})
+				continue
+			}
+			links = append(links, link)
+		}
+		e.Links = links
+		kept = append(kept, e)
+	}
+	if !dryRun {
+		l.entries = kept
+		l.save()
+	}
+	l.mu.Unlock()
+
+	// Anything else in staging belongs to no torrent
+	if l.config.Staging != "" {
+		categories, _ := os.ReadDir(l.config.Staging)
+		for _, c := range categories {
+			if !c.IsDir() {
+				continue
+			}
+			dir := filepath.Join(l.config.Staging, c.Name())
+			items, _ := os.ReadDir(dir)
+			for _, item := range items {
+				p := filepath.Join(dir, item.Name())
+				if !inUse[p] {
+					add(p, "not part of any torrent")
+				}
+			}
+		}
+	}
+	return report
+}
+
+// removeStaged deletes a torrent's staging data, refusing anything that is
+// not below a category's staging folder
+func (l *Linker) removeStaged(p string) error {
+	id, ok := l.config.CategoryOf(p)
+	if !ok || filepath.Clean(p) == l.config.StagingDir(id) {
+		return fmt.Errorf("%s is not inside a staging folder", p)
+	}
+	return os.RemoveAll(p)
+}
+
+// freedBytes adds up the files below p that have no other name
+func freedBytes(p string) int64 {
+	var total int64
+	filepath.WalkDir(p, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.Mode().IsRegular() && linkCount(info) <= 1 {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total
+}
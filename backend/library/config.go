@@ -0,0 +1,88 @@
+package library
+
+import (
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/hasmikatom/torrent/category"
+	"github.com/hasmikatom/torrent/configfile"
+)
+
+// Config is the contents of config/library.json
+type Config struct {
+	// Enabled turns link mode on
+	Enabled bool `json:"enabled"`
+	// Staging is where torrents download to, one folder per category. It
+	// should be on the same filesystem as the libraries so files can be
+	// hardlinked rather than copied.
+	Staging string `json:"staging"`
+	// Categories limits link mode to these category ids; empty means all
+	Categories []string `json:"categories,omitempty"`
+}
+
+var (
+	libraryConfig     *Config
+	libraryConfigOnce sync.Once
+)
+
+// LoadConfig reads config/library.json once. Without it, or with an
+// unusable staging path, torrents download straight into the libraries.
+func LoadConfig() *Config {
+	libraryConfigOnce.Do(func() {
+		var config Config
+		path, err := configfile.Load("library.json", &config)
+		if err != nil {
+			log.Printf("Warning: %v, link mode is off", err)
+			libraryConfig = &Config{}
+			return
+		}
+		log.Printf("Loaded library config from: %s", path)
+
+		if config.Enabled {
+			if err := category.ValidateRoot(config.Staging); err != nil {
+				log.Printf("Warning: link mode is off, staging: %v", err)
+				config.Enabled = false
+			}
+		}
+		libraryConfig = &config
+	})
+
+	return libraryConfig
+}
+
+// Covers reports whether a category's torrents go through staging
+func (c *Config) Covers(categoryID string) bool {
+	if !c.Enabled {
+		return false
+	}
+	if len(c.Categories) == 0 {
+		return true
+	}
+	for _, id := range c.Categories {
+		if id == categoryID {
+			return true
+		}
+	}
+	return false
+}
+
+// StagingDir is the folder a category's torrents download to
+func (c *Config) StagingDir(categoryID string) string {
+	return filepath.Join(c.Staging, categoryID)
+}
+
+// CategoryOf returns the category id of a staging folder, or false when dir
+// is not inside staging
+func (c *Config) CategoryOf(dir string) (string, bool) {
+	if c.Staging == "" || !category.Within(c.Staging, dir) {
+		return "", false
+	}
+	rel, err := filepath.Rel(c.Staging, filepath.Clean(dir))
+	if err != nil || rel == "." {
+		return "", false
+	}
+	id, _, _ := strings.Cut(rel, string(filepath.Separator))
+	return id, true
+}
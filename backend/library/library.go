@@ -0,0 +1,364 @@
+// Package library implements link mode: torrents download into a staging
+// area and, once complete, their files are hardlinked (or copied when the
+// library is on another filesystem) into the category library under Plex
+// style names. Transmission keeps seeding the untouched staging files, and
+// removing the torrent leaves the library copy alone.
+package library
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hasmikatom/torrent/category"
+	"github.com/hasmikatom/torrent/events"
+	"github.com/hasmikatom/torrent/naming"
+	"github.com/hasmikatom/torrent/release"
+	"github.com/hasmikatom/torrent/store"
+	"github.com/hasmikatom/torrent/transmission"
+)
+
+// Entry states
+const (
+	// StatusPending means the torrent is still downloading
+	StatusPending = "pending"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+)
+
+// Link is one library file and the staging file it was made from
+type Link struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Method string `json:"method"`
+	Size   int64  `json:"size"`
+}
+
+// Entry is a staged torrent and where its files go in the library
+type Entry struct {
+	Hash      string `json:"hash"`
+	TorrentID int    `json:"torrentId"`
+	// Name and Staging are the torrent's name and download dir
+	Name     string          `json:"name"`
+	Staging  string          `json:"staging,omitempty"`
+	Category string          `json:"category"`
+	Fields   category.Fields `json:"fields"`
+	// NewName replaces the torrent's top-level folder name in the library
+	NewName string `json:"newName,omitempty"`
+	// RenameFiles gives videos and subtitles Plex style names in the library
+	RenameFiles bool `json:"renameFiles,omitempty"`
+
+	// Dir is the library folder the files were linked into
+	Dir    string `json:"dir,omitempty"`
+	Status string `json:"status"`
+	Links  []Link `json:"links"`
+	Error  string `json:"error,omitempty"`
+
+	CreatedAt time.Time  `json:"createdAt"`
+	LinkedAt  *time.Time `json:"linkedAt,omitempty"`
+}
+
+// Linker links completed staged torrents into their library
+type Linker struct {
+	config *Config
+	bus    *events.Bus
+	// dirOf renders a torrent's library folder in its category from path
+	// template fields
+	dirOf func(categoryID, hash string, f category.Fields) (string, error)
+
+	file *store.JSONFile
+
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// NewLinker loads the tracked torrents from dataDir
+func NewLinker(config *Config, dataDir string, bus *events.Bus, dirOf func(categoryID, hash string, f category.Fields) (string, error)) (*Linker, error) {
+	l := &Linker{
+		config: config,
+		bus:    bus,
+		dirOf:  dirOf,
+		file:   store.NewJSONFile(dataDir, "library-links.json"),
+	}
+	if err := l.file.Load(&l.entries); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Track remembers where a staged torrent belongs, replacing what was known
+// about the same torrent
+func (l *Linker) Track(e Entry) {
+	e.Status = StatusPending
+	e.Links = []Link{}
+	e.CreatedAt = time.Now()
+	l.record(e)
+}
+
+// Run links tracked torrents as they complete, and again after their
+// archives were extracted, until the channel closes or ctx is cancelled
+func (l *Linker) Run(ctx context.Context, ch <-chan events.Event) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			if e.Type != events.Completed && e.Type != events.Extracted {
+				continue
+			}
+			if _, ok := l.Entry(e.Torrent.Hash); !ok {
+				continue
+			}
+			if entry, err := l.Link(ctx, e.Torrent); err != nil {
+				log.Printf("Failed to link torrent %d into the library: %v", e.Torrent.ID, err)
+			} else if entry.Status == StatusFailed {
+				log.Printf("Failed to link torrent %d into the library: %s", e.Torrent.ID, entry.Error)
+			}
+		}
+	}
+}
+
+// Link links every file of a tracked torrent into its library folder.
+// Files linked by an earlier run are kept, so it can be rerun after
+// extraction or a failure. A torrent.linked event is published when new
+// library files appeared.
+func (l *Linker) Link(ctx context.Context, t events.Torrent) (Entry, error) {
+	entry, ok := l.Entry(t.Hash)
+	if !ok {
+		return Entry{}, fmt.Errorf("torrent %d is not staged for the library", t.ID)
+	}
+	entry.TorrentID = t.ID
+	entry.Name = t.Name
+	entry.Staging = t.DownloadDir
+
+	dir, err := l.dirOf(entry.Category, entry.Hash, entry.Fields)
+	if err != nil {
+		return l.fail(entry, err.Error()), nil
+	}
+	entry.Dir = dir
+
+	links, top, err := Plan(entry, dir)
+	if err != nil {
+		return l.fail(entry, err.Error()), nil
+	}
+
+	added, failures := 0, 0
+	for _, link := range links {
+		if ctx.Err() != nil {
+			return l.fail(entry, "cancelled"), nil
+		}
+		method, err := linkFile(link.Source, link.Target, previousMethod(entry.Links, link.Target) == MethodCopy)
+		if err != nil {
+			failures++
+			entry.Error = err.Error()
+			log.Printf("Failed to link %s into the library: %v", link.Source, err)
+			continue
+		}
+		if method != MethodExisting {
+			added++
+		}
+		if m := previousMethod(entry.Links, link.Target); method == MethodExisting && m != "" {
+			method = m
+		}
+		link.Method = method
+		entry.Links = mergeLink(entry.Links, link)
+	}
+
+	now := time.Now()
+	entry.LinkedAt = &now
+	if failures > 0 {
+		entry.Status = StatusFailed
+		entry.Error = fmt.Sprintf("%d of %d files failed to link, last error: %s", failures, len(links), entry.Error)
+	} else {
+		entry.Status = StatusDone
+		entry.Error = ""
+	}
+	l.record(entry)
+
+	if added > 0 && l.bus != nil {
+		linked := t
+		linked.DownloadDir, linked.Name = dir, top
+		l.bus.Publish(events.New(events.Linked, linked, now))
+	}
+	return entry, nil
+}
+
+func (l *Linker) fail(entry Entry, reason string) Entry {
+	entry.Status = StatusFailed
+	entry.Error = reason
+	l.record(entry)
+	return entry
+}
+
+// Plan works out the library path of every file of a staged torrent. The
+// top-level folder becomes the entry's NewName, or with RenameFiles the Plex
+// style movie folder name; file names follow naming.PlanFiles. It also
+// returns the name of the torrent's top-level item in the library.
+func Plan(entry Entry, dir string) ([]Link, string, error) {
+	root := filepath.Join(entry.Staging, entry.Name)
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, "", fmt.Errorf("torrent data not found: %v", err)
+	}
+
+	var files []transmission.File
+	if info.IsDir() {
+		err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || !d.Type().IsRegular() || partial(p) {
+				return nil
+			}
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(entry.Staging, p)
+			rel = filepath.ToSlash(rel)
+			files = append(files, transmission.File{Name: rel, Length: fi.Size()})
+			return nil
+		})
+		if err != nil {
+			return nil, "", err
+		}
+	} else {
+		files = []transmission.File{{Name: entry.Name, Length: info.Size()}}
+	}
+
+	name := entry.Name
+	if entry.NewName != "" {
+		name = entry.NewName
+	}
+	rel := release.Parse(name)
+
+	renames := map[string]string{}
+	if entry.RenameFiles {
+		for _, r := range naming.PlanFiles(rel, files) {
+			renames[r.Path] = r.Name
+		}
+	}
+
+	top := entry.Name
+	if info.IsDir() {
+		folder := category.SanitizeSegment(entry.NewName)
+		if folder == "" && entry.RenameFiles {
+			folder = naming.FolderName(rel)
+		}
+		if folder != "" {
+			top = folder
+		}
+	} else if newName, ok := renames[entry.Name]; ok {
+		top = newName
+	}
+
+	links := make([]Link, 0, len(files))
+	for _, f := range files {
+		target := f.Name
+		if newName, ok := renames[f.Name]; ok {
+			target = path.Join(path.Dir(f.Name), newName)
+		}
+		if info.IsDir() {
+			_, rest, _ := strings.Cut(target, "/")
+			target = path.Join(top, rest)
+		}
+		target = filepath.Join(dir, filepath.FromSlash(target))
+		if !category.Within(dir, target) || target == dir {
+			return nil, "", fmt.Errorf("file %q would land outside %s", f.Name, dir)
+		}
+		links = append(links, Link{
+			Source: filepath.Join(entry.Staging, filepath.FromSlash(f.Name)),
+			Target: target,
+			Size:   f.Length,
+		})
+	}
+	return links, top, nil
+}
+
+// partial reports files still being written by extraction or a copy
+func partial(p string) bool {
+	return strings.HasSuffix(p, ".extracting") || strings.HasSuffix(p, ".linking") || strings.HasSuffix(p, ".part")
+}
+
+func previousMethod(links []Link, target string) string {
+	for _, l := range links {
+		if l.Target == target {
+			return l.Method
+		}
+	}
+	return ""
+}
+
+func mergeLink(links []Link, link Link) []Link {
+	for i := range links {
+		if links[i].Target == link.Target {
+			links[i] = link
+			return links
+		}
+	}
+	return append(links, link)
+}
+
+// Entry returns what is known about a torrent by hash
+func (l *Linker) Entry(hash string) (Entry, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, e := range l.entries {
+		if e.Hash == hash {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Entries returns tracked torrents newest first, optionally only one
+// torrent (torrentID > 0) or those in one status
+func (l *Linker) Entries(torrentID int, status string) []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	list := make([]Entry, 0)
+	for i := len(l.entries) - 1; i >= 0; i-- {
+		e := l.entries[i]
+		if (torrentID > 0 && e.TorrentID != torrentID) || (status != "" && e.Status != status) {
+			continue
+		}
+		list = append(list, e)
+	}
+	return list
+}
+
+func (l *Linker) record(e Entry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	replaced := false
+	for i := range l.entries {
+		if l.entries[i].Hash == e.Hash {
+			l.entries[i] = e
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		l.entries = append(l.entries, e)
+	}
+	l.save()
+}
+
+func (l *Linker) save() {
+	if err := l.file.Save(l.entries); err != nil {
+		log.Printf("Failed to save library links: %v", err)
+	}
+}
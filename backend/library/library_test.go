@@ -0,0 +1,257 @@
+package library
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hasmikatom/torrent/category"
+	"github.com/hasmikatom/torrent/events"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func sameFile(t *testing.T, a, b string) bool {
+	t.Helper()
+	ai, err := os.Stat(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bi, err := os.Stat(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return os.SameFile(ai, bi)
+}
+
+func TestConfig_CategoryOf(t *testing.T) {
+	c := &Config{Enabled: true, Staging: "/mediastorage/.staging"}
+	cases := map[string]string{
+		"/mediastorage/.staging/Movies":           "Movies",
+		"/mediastorage/.staging/Movies/Some.Film": "Movies",
+		"/mediastorage/.staging":                  "",
+		"/mediastorage/Movies":                    "",
+	}
+	for dir, want := range cases {
+		id, ok := c.CategoryOf(dir)
+		if id != want || ok != (want != "") {
+			t.Errorf("CategoryOf(%q) = %q, %v", dir, id, ok)
+		}
+	}
+}
+
+func TestLinkFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.mkv")
+	writeFile(t, src, "movie")
+
+	dst := filepath.Join(dir, "library", "Movie (2020)", "Movie (2020).mkv")
+	if method, err := linkFile(src, dst, false); err != nil || method != MethodHardlink {
+		t.Fatalf("linkFile = %q, %v", method, err)
+	}
+	if !sameFile(t, src, dst) {
+		t.Fatal("expected a hardlink")
+	}
+	if method, err := linkFile(src, dst, false); err != nil || method != MethodExisting {
+		t.Fatalf("second linkFile = %q, %v", method, err)
+	}
+
+	other := filepath.Join(dir, "other.mkv")
+	writeFile(t, other, "a different file")
+	if _, err := linkFile(other, dst, false); err == nil {
+		t.Fatal("expected an existing library file to be left alone")
+	}
+
+	// Another release of the same size at the target is a collision
+	release := filepath.Join(dir, "release.mkv")
+	writeFile(t, release, "MOVIE")
+	if _, err := linkFile(release, dst, false); err == nil {
+		t.Fatal("expected a different file of the same size to collide")
+	}
+
+	// unless an earlier run copied it there
+	copied := filepath.Join(dir, "copied.mkv")
+	info, _ := os.Stat(release)
+	if err := copyFile(release, copied, info); err != nil {
+		t.Fatal(err)
+	}
+	if method, err := linkFile(release, copied, true); err != nil || method != MethodExisting {
+		t.Fatalf("linkFile over an earlier copy = %q, %v", method, err)
+	}
+	if _, err := linkFile(release, copied, false); err == nil {
+		t.Fatal("expected a copy no run made to collide")
+	}
+}
+
+func TestCopyFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.mkv")
+	writeFile(t, src, "movie")
+	info, _ := os.Stat(src)
+
+	dst := filepath.Join(dir, "copy.mkv")
+	if err := copyFile(src, dst, info); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(dst); string(b) != "movie" || sameFile(t, src, dst) {
+		t.Fatal("expected an independent copy")
+	}
+	if _, err := os.Stat(dst + ".linking"); err == nil {
+		t.Fatal("temp file left behind")
+	}
+}
+
+func newLinker(t *testing.T, staging, libraryRoot string) (*Linker, <-chan events.Event) {
+	t.Helper()
+	bus := events.NewBus()
+	ch := bus.Subscribe("test", 10)
+	cat := category.Category{ID: "Movies", Root: libraryRoot, PathTemplate: "{title} ({year})"}
+	l, err := NewLinker(&Config{Enabled: true, Staging: staging}, t.TempDir(), bus, func(id, hash string, f category.Fields) (string, error) {
+		return cat.Dir(f)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l, ch
+}
+
+func TestLink(t *testing.T) {
+	root := t.TempDir()
+	staging := filepath.Join(root, ".staging")
+	movies := filepath.Join(root, "Movies")
+	downloadDir := filepath.Join(staging, "Movies")
+	name := "Some.Movie.2020.1080p.BluRay.x264-GRP"
+	writeFile(t, filepath.Join(downloadDir, name, "some.movie.2020.1080p.mkv"), "video")
+	writeFile(t, filepath.Join(downloadDir, name, "some.movie.2020.1080p.en.srt"), "subs")
+	writeFile(t, filepath.Join(downloadDir, name, "Sample", "sample.mkv"), "s")
+
+	l, ch := newLinker(t, staging, movies)
+	torrent := events.Torrent{ID: 7, Hash: "abc", Name: name, DownloadDir: downloadDir}
+	if _, err := l.Link(context.Background(), torrent); err == nil {
+		t.Fatal("expected an untracked torrent to be refused")
+	}
+
+	l.Track(Entry{Hash: "abc", TorrentID: 7, Category: "Movies", Fields: category.GuessFields(name), RenameFiles: true})
+	entry, err := l.Link(context.Background(), torrent)
+	if err != nil || entry.Status != StatusDone || len(entry.Links) != 3 {
+		t.Fatalf("unexpected entry %+v, %v", entry, err)
+	}
+
+	lib := filepath.Join(movies, "Some Movie (2020)", "Some Movie (2020)")
+	for src, dst := range map[string]string{
+		"some.movie.2020.1080p.mkv":    "Some Movie (2020).mkv",
+		"some.movie.2020.1080p.en.srt": "Some Movie (2020).en.srt",
+		"Sample/sample.mkv":            "Sample/sample.mkv",
+	} {
+		if !sameFile(t, filepath.Join(downloadDir, name, src), filepath.Join(lib, dst)) {
+			t.Errorf("%s is not linked to %s", src, dst)
+		}
+	}
+
+	e := <-ch
+	if e.Type != events.Linked || e.Torrent.DownloadDir != filepath.Join(movies, "Some Movie (2020)") || e.Torrent.Name != "Some Movie (2020)" {
+		t.Fatalf("unexpected event %+v", e)
+	}
+
+	// Relinking after extraction only adds what is new
+	writeFile(t, filepath.Join(downloadDir, name, "extras.nfo"), "nfo")
+	if entry, _ = l.Link(context.Background(), torrent); entry.Status != StatusDone || len(entry.Links) != 4 {
+		t.Fatalf("unexpected entry %+v", entry)
+	}
+	if entry.Links[0].Method != MethodHardlink {
+		t.Fatalf("expected the earlier method to be kept, got %q", entry.Links[0].Method)
+	}
+
+	// Removing the staging data leaves the library copy
+	os.RemoveAll(filepath.Join(downloadDir, name))
+	if b, err := os.ReadFile(filepath.Join(lib, "Some Movie (2020).mkv")); err != nil || string(b) != "video" {
+		t.Fatal("library copy did not survive")
+	}
+}
+
+func TestLink_SingleFile(t *testing.T) {
+	root := t.TempDir()
+	staging := filepath.Join(root, ".staging")
+	downloadDir := filepath.Join(staging, "Movies")
+	name := "Other.Film.1999.720p.WEB.mkv"
+	writeFile(t, filepath.Join(downloadDir, name), "video")
+
+	l, ch := newLinker(t, staging, filepath.Join(root, "Movies"))
+	l.Track(Entry{Hash: "def", Category: "Movies", Fields: category.GuessFields(name), RenameFiles: true})
+	entry, err := l.Link(context.Background(), events.Torrent{ID: 8, Hash: "def", Name: name, DownloadDir: downloadDir})
+	if err != nil || entry.Status != StatusDone {
+		t.Fatalf("unexpected entry %+v, %v", entry, err)
+	}
+	want := filepath.Join(root, "Movies", "Other Film (1999)", "Other Film (1999).mkv")
+	if entry.Links[0].Target != want {
+		t.Fatalf("linked to %s, want %s", entry.Links[0].Target, want)
+	}
+	if e := <-ch; e.Torrent.Name != "Other Film (1999).mkv" {
+		t.Fatalf("unexpected event %+v", e)
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	root := t.TempDir()
+	staging := filepath.Join(root, ".staging")
+	downloadDir := filepath.Join(staging, "Movies")
+	l, _ := newLinker(t, staging, filepath.Join(root, "Movies"))
+
+	// A removed torrent that was linked, one still seeding whose library file
+	// was deleted, and a folder nobody knows about
+	writeFile(t, filepath.Join(downloadDir, "Gone.2001", "gone.mkv"), "gone")
+	writeFile(t, filepath.Join(downloadDir, "Seeding.2002", "seeding.mkv"), "seeding")
+	writeFile(t, filepath.Join(downloadDir, "Stray", "stray.mkv"), "stray")
+	gone := events.Torrent{ID: 1, Hash: "gone", Name: "Gone.2001", DownloadDir: downloadDir}
+	seeding := events.Torrent{ID: 2, Hash: "seeding", Name: "Seeding.2002", DownloadDir: downloadDir}
+	for _, tr := range []events.Torrent{gone, seeding} {
+		l.Track(Entry{Hash: tr.Hash, Category: "Movies", Fields: category.GuessFields(tr.Name)})
+		if entry, _ := l.Link(context.Background(), tr); entry.Status != StatusDone {
+			t.Fatalf("unexpected entry %+v", entry)
+		}
+	}
+	seedingEntry, _ := l.Entry("seeding")
+	os.Remove(seedingEntry.Links[0].Target)
+
+	report := l.Cleanup([]events.Torrent{seeding}, true)
+	if len(report.Orphans) != 3 || report.Forgotten != 1 || report.Bytes != int64(len("stray")) {
+		t.Fatalf("unexpected dry run report %+v", report)
+	}
+	if _, err := os.Stat(filepath.Join(downloadDir, "Gone.2001")); err != nil {
+		t.Fatal("dry run removed data")
+	}
+
+	report = l.Cleanup([]events.Torrent{seeding}, false)
+	for _, o := range report.Orphans {
+		if !o.Removed || o.Error != "" {
+			t.Fatalf("unexpected orphan %+v", o)
+		}
+	}
+	for _, p := range []string{"Gone.2001", "Stray"} {
+		if _, err := os.Stat(filepath.Join(downloadDir, p)); err == nil {
+			t.Fatalf("%s was not removed", p)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(downloadDir, "Seeding.2002")); err != nil {
+		t.Fatal("a seeding torrent's data was removed")
+	}
+	if _, ok := l.Entry("gone"); ok {
+		t.Fatal("removed torrent is still tracked")
+	}
+	if e, _ := l.Entry("seeding"); len(e.Links) != 0 {
+		t.Fatalf("deleted library file is still linked: %+v", e.Links)
+	}
+	goneLibrary := filepath.Join(root, "Movies", "Gone (2001)", "Gone.2001", "gone.mkv")
+	if b, err := os.ReadFile(goneLibrary); err != nil || string(b) != "gone" {
+		t.Fatal("library copy of a removed torrent did not survive")
+	}
+}
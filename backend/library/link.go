@@ -0,0 +1,93 @@
+package library
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Ways a library file was created
+const (
+	MethodHardlink = "hardlink"
+	MethodCopy     = "copy"
+	// MethodExisting means the target was already there, e.g. from an
+	// earlier run
+	MethodExisting = "existing"
+)
+
+// linkFile makes dst the same file as src: a hardlink when both are on one
+// filesystem, otherwise a copy. A dst that already is src is left alone, as
+// is the copy an earlier run made when copied says so and it still has
+// src's size and modification time. Anything else in the way is a
+// collision, so library files are never overwritten.
+func linkFile(src, dst string, copied bool) (string, error) {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return "", err
+	}
+	if dstInfo, err := os.Stat(dst); err == nil {
+		if os.SameFile(srcInfo, dstInfo) {
+			return MethodExisting, nil
+		}
+		if copied && dstInfo.Size() == srcInfo.Size() && dstInfo.ModTime().Equal(srcInfo.ModTime()) {
+			return MethodExisting, nil
+		}
+		return "", fmt.Errorf("%s already exists and is a different file", dst)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0775); err != nil {
+		return "", err
+	}
+
+	err = os.Link(src, dst)
+	if err == nil {
+		return MethodHardlink, nil
+	}
+	// Linking across filesystems fails with EXDEV; some network and FUSE
+	// filesystems refuse hardlinks altogether
+	if !errors.Is(err, syscall.EXDEV) && !errors.Is(err, syscall.EPERM) && !errors.Is(err, syscall.ENOTSUP) {
+		return "", err
+	}
+	if err := copyFile(src, dst, srcInfo); err != nil {
+		return "", err
+	}
+	return MethodCopy, nil
+}
+
+// copyFile copies through a temp file next to dst so a failed copy never
+// looks like a finished one
+func copyFile(src, dst string, info os.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := dst + ".linking"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	os.Chtimes(tmp, info.ModTime(), info.ModTime())
+	return os.Rename(tmp, dst)
+}
+
+// linkCount is how many names a file has; 0 when unknown
+func linkCount(info os.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Nlink)
+	}
+	return 0
+}
@@ -12,14 +12,53 @@ import (
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/hasmikatom/torrent/category"
+	"github.com/hasmikatom/torrent/classify"
+	"github.com/hasmikatom/torrent/disk"
+	"github.com/hasmikatom/torrent/events"
+	"github.com/hasmikatom/torrent/jellyfin"
+	"github.com/hasmikatom/torrent/library"
+	"github.com/hasmikatom/torrent/metrics"
 	"github.com/hasmikatom/torrent/middleware"
+	"github.com/hasmikatom/torrent/notify"
+	"github.com/hasmikatom/torrent/plex"
+	"github.com/hasmikatom/torrent/postprocess"
+	"github.com/hasmikatom/torrent/quota"
+	"github.com/hasmikatom/torrent/refresh"
 	"github.com/hasmikatom/torrent/scraper"
+	"github.com/hasmikatom/torrent/seeding"
+	"github.com/hasmikatom/torrent/share"
+	"github.com/hasmikatom/torrent/stall"
 	"github.com/hasmikatom/torrent/transmission"
+	"github.com/hasmikatom/torrent/trash"
+	"github.com/hasmikatom/torrent/usage"
+	"github.com/hasmikatom/torrent/watcher"
+	"github.com/hasmikatom/torrent/webhook"
 	"github.com/joho/godotenv"
 )
 
 var c *Config
 var client *transmission.TransmissionRPC
+var quotaLedger *quota.Ledger
+var eventBus *events.Bus
+var torrentWatcher *watcher.Watcher
+var webhookLog *webhook.Log
+var notificationPrefs *notify.Preferences
+var notifier *notify.Service
+var plexRefresher *plex.Refresher
+var mediaServerRefresher *jellyfin.Refresher
+var postprocessor *postprocess.Processor
+var libraryLinker *library.Linker
+var seedingEnforcer *seeding.Enforcer
+var stallHandler *stall.Handler
+var spaceGuard *disk.Guard
+var spaceQueue *disk.Queue
+var mountChecker *disk.MountChecker
+var rootPlacer *disk.Placer
+var usageCache *usage.Cache
+var metricsRecorder *metrics.Recorder
+var shareSigner *share.Signer
+var trashBin *trash.Bin
 
 func init() {
 	godotenv.Load()
@@ -35,6 +74,71 @@ func init() {
 		},
 	}
 
+	var err error
+	quotaLedger, err = quota.OpenLedger(c.DataDir)
+	if err != nil {
+		log.Fatalf("Failed to load quota ledger: %v", err)
+	}
+	quota.LoadConfig()
+	category.Load()
+	classify.LoadConfig()
+	webhook.LoadConfig()
+
+	eventBus = events.NewBus()
+	torrentWatcher, err = watcher.New(func(fields []string) ([]transmission.Torrent, error) {
+		return client.GetTorrents(nil, fields)
+	}, eventBus, c.DataDir, stall.LoadConfig().Apply(watcher.DefaultOptions))
+	if err != nil {
+		log.Fatalf("Failed to load torrent watcher state: %v", err)
+	}
+	webhookLog, err = webhook.OpenLog(c.DataDir)
+	if err != nil {
+		log.Fatalf("Failed to load webhook delivery log: %v", err)
+	}
+	notificationPrefs, err = notify.OpenPreferences(c.DataDir)
+	if err != nil {
+		log.Fatalf("Failed to load notification targets: %v", err)
+	}
+	notifier = notify.NewService(notify.LoadConfig(), notificationPrefs, quotaLedger.Owner, categoryName)
+	plexRefresher = plex.NewRefresher(plex.LoadConfig(), categoryID, refresh.DefaultOptions)
+	mediaServerRefresher = jellyfin.NewRefresher(category.Load().MediaServers, categoryID, refresh.DefaultOptions)
+	postprocessor, err = postprocess.NewProcessor(postprocess.LoadConfig(), c.DataDir, eventBus, torrentCategoryID)
+	if err != nil {
+		log.Fatalf("Failed to load post-processing jobs: %v", err)
+	}
+	libraryLinker, err = library.NewLinker(library.LoadConfig(), c.DataDir, eventBus, libraryDir)
+	if err != nil {
+		log.Fatalf("Failed to load library links: %v", err)
+	}
+	stallHandler = stall.NewHandler(stall.LoadConfig(), torrentWatcher.Stalled, reannounceTorrent, removeStalledTorrent)
+	seedingEnforcer = seeding.NewEnforcer(seeding.LoadConfig(), listSeedingTorrents, removeSeededTorrents, torrentCategory)
+	mountChecker = disk.NewMountChecker(disk.LoadConfig())
+	// Checked before serving, so a disk missing at boot is logged and
+	// /health is degraded from the first request
+	checkMounts()
+	usageCache = usage.NewCache(usage.LoadConfig(), usageRoots)
+	metricsRecorder, err = metrics.NewRecorder(metrics.LoadConfig(), c.DataDir, sampleMetrics)
+	if err != nil {
+		log.Fatalf("Failed to load metrics history: %v", err)
+	}
+	spaceGuard = disk.NewGuard(disk.LoadConfig(), freeSpace, listSpaceTorrents)
+	spaceQueue, err = disk.NewQueue(spaceGuard, c.DataDir, eventBus, startQueuedTorrent, stopTorrent)
+	if err != nil {
+		log.Fatalf("Failed to load disk space queue: %v", err)
+	}
+	rootPlacer, err = disk.NewPlacer(spaceGuard, c.DataDir, mountChecker.Ready)
+	if err != nil {
+		log.Fatalf("Failed to load root placements: %v", err)
+	}
+	shareSigner, err = share.LoadSigner(share.LoadConfig(), c.DataDir)
+	if err != nil {
+		log.Fatalf("Failed to load the share link key: %v", err)
+	}
+	trashBin, err = trash.NewBin(trash.LoadConfig(), c.DataDir)
+	if err != nil {
+		log.Fatalf("Failed to load the trash: %v", err)
+	}
+
 	if err := scraper.GetPool().Init(); err != nil {
 		log.Printf("Warning: Failed to initialize browser pool: %v", err)
 	}
@@ -53,9 +157,29 @@ func main() {
 
 	r.Use(cors.New(config))
 
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "ok"})
-	})
+	// Background work stops when the server shuts down
+	background, stopBackground := context.WithCancel(context.Background())
+	go torrentWatcher.Run(background)
+	dispatcher := webhook.NewDispatcher(webhook.LoadConfig().Webhooks, webhookLog, webhook.DefaultOptions)
+	go dispatcher.Run(background, eventBus.Subscribe("webhooks", 100))
+	go notifier.Run(background, eventBus.Subscribe("notifications", 100))
+	go plexRefresher.Run(background, eventBus.Subscribe("plex", 100))
+	go mediaServerRefresher.Run(background, eventBus.Subscribe("mediaservers", 100))
+	go postprocessor.Run(background, eventBus.Subscribe("postprocess", 100))
+	go libraryLinker.Run(background, eventBus.Subscribe("library", 100))
+	go seedingEnforcer.Run(background)
+	go stallHandler.Run(background, eventBus.Subscribe("stalled", 100))
+	go spaceQueue.Run(background, eventBus.Subscribe("space", 100))
+	go rootPlacer.Run(background, eventBus.Subscribe("placements", 100))
+	go mountChecker.Run(background)
+	go usageCache.Run(background)
+	go metricsRecorder.Run(background)
+	go trashBin.Run(background)
+
+	r.GET("/health", getHealth)
+	// Share links carry their own signature instead of a session
+	r.GET("/share/:token", getSharedFile)
+	r.HEAD("/share/:token", getSharedFile)
 
 	api := r.Group("/", middleware.RequireUser())
 	{
@@ -75,7 +199,31 @@ func main() {
 		api.GET("/torrents", listTorrents)
 		api.DELETE("/torrents/:id", deleteTorrent)
 		api.PUT("/torrents/:id/rename", renameTorrent)
+		api.GET("/torrents/:id/files", listTorrentFiles)
+		api.GET("/torrents/:id/content", getTorrentContent)
+		api.HEAD("/torrents/:id/content", getTorrentContent)
+		api.POST("/torrents/:id/share", shareTorrentFile)
+		api.GET("/torrents/:id/archive", getTorrentArchive)
+		api.PUT("/torrents/:id/files/rename", renameFilesInTorrent)
+		api.POST("/torrents/:id/extract", extractTorrent)
+		api.GET("/postprocess/jobs", listPostprocessJobs)
+		api.GET("/postprocess/jobs/:id", getPostprocessJob)
+		api.GET("/library/links", listLibraryLinks)
+		api.GET("/library/browse", browseLibrary)
 		api.GET("/storage", getStorageInfo)
+		api.GET("/storage/queue", listSpaceQueue)
+		api.GET("/storage/placements", listPlacements)
+		api.GET("/trash", listTrash)
+		api.POST("/trash/:id/restore", restoreTrash)
+		api.GET("/storage/usage", getUsageBreakdown)
+		api.GET("/metrics/history", getMetricsHistory)
+		api.GET("/quota/usage", getQuotaUsage)
+		api.GET("/categories", getCategories)
+		api.GET("/plex/status", getPlexStatus)
+		api.GET("/mediaservers/status", getMediaServerStatus)
+		api.GET("/notifications/targets", getNotificationTargets)
+		api.PUT("/notifications/targets", setNotificationTargets)
+		api.POST("/notifications/targets/:id/test", testNotificationTarget)
 
 		api.POST("/scrape/piratebay/:name", scrapePirateBay)
 		api.POST("/scrape/rutracker/:name", scrapeRuTracker)
@@ -84,6 +232,23 @@ func main() {
 		api.GET("/scrape/sources", getScraperSources)
 	}
 
+	admin := api.Group("/", middleware.RequireAdmin())
+	{
+		admin.GET("/webhooks", listWebhooks)
+		admin.GET("/webhooks/deliveries", listWebhookDeliveries)
+		admin.POST("/library/cleanup", cleanupLibrary)
+		admin.DELETE("/library/browse", deleteLibraryItem)
+		admin.GET("/seeding/preview", previewSeeding)
+		admin.GET("/seeding/removals", listSeedingRemovals)
+		admin.GET("/stalled/actions", listStallActions)
+		admin.POST("/storage/usage/refresh", refreshUsage)
+		admin.GET("/storage/mounts", listMounts)
+		admin.GET("/storage/orphans", listOrphans)
+		admin.POST("/storage/orphans/reclaim", reclaimOrphans)
+		admin.DELETE("/trash/:id", purgeTrashEntry)
+		admin.DELETE("/trash", purgeTrash)
+	}
+
 	// Create server with graceful shutdown
 	srv := &http.Server{
 		Addr:    ":" + c.AppPort,
@@ -106,6 +271,8 @@ func main() {
 
 	log.Println("Shutting down server...")
 
+	stopBackground()
+
 	// Shutdown browser pool
 	scraper.GetPool().Shutdown()
 
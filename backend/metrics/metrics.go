@@ -0,0 +1,191 @@
+// Package metrics records how storage and bandwidth change over time. Samples
+// are kept at full resolution for a day and averaged into coarser steps for
+// longer, so a year of history stays small.
+package metrics
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MountUsage is the space on one filesystem when a point was recorded
+type MountUsage struct {
+	Total     uint64 `json:"total"`
+	Used      uint64 `json:"used"`
+	Available uint64 `json:"available"`
+}
+
+// Sample is one reading of the system
+type Sample struct {
+	At time.Time
+	// DownloadRate and UploadRate are in bytes per second
+	DownloadRate int64
+	UploadRate   int64
+	Active       int
+	Mounts       map[string]MountUsage
+}
+
+// Point is a sample, or the average of the samples in one step. Mount usage
+// is the latest reading in the step rather than an average.
+type Point struct {
+	At           time.Time             `json:"at"`
+	DownloadRate float64               `json:"downloadRate"`
+	UploadRate   float64               `json:"uploadRate"`
+	Active       float64               `json:"active"`
+	Mounts       map[string]MountUsage `json:"mounts,omitempty"`
+	// Samples is how many samples the point averages
+	Samples int `json:"samples"`
+}
+
+// add folds a sample into the point's averages
+func (p *Point) add(s Sample) {
+	n := float64(p.Samples)
+	p.DownloadRate = (p.DownloadRate*n + float64(s.DownloadRate)) / (n + 1)
+	p.UploadRate = (p.UploadRate*n + float64(s.UploadRate)) / (n + 1)
+	p.Active = (p.Active*n + float64(s.Active)) / (n + 1)
+	p.Mounts = s.Mounts
+	p.Samples++
+}
+
+// Tier is one resolution of history
+type Tier struct {
+	Step time.Duration `json:"step"`
+	Keep time.Duration `json:"keep"`
+}
+
+// Tiers after the first, full resolution one
+var coarseTiers = []Tier{
+	{Step: 15 * time.Minute, Keep: 30 * 24 * time.Hour},
+	{Step: 3 * time.Hour, Keep: 2 * 365 * 24 * time.Hour},
+}
+
+// series is the history at one tier, oldest first
+type series struct {
+	Tier   Tier    `json:"tier"`
+	Points []Point `json:"points"`
+}
+
+// record adds a sample and drops points that are too old
+func (s *series) record(sample Sample) {
+	bucket := sample.At.Truncate(s.Tier.Step)
+	if n := len(s.Points); n > 0 && s.Points[n-1].At.Equal(bucket) {
+		s.Points[n-1].add(sample)
+	} else {
+		p := Point{At: bucket}
+		p.add(sample)
+		s.Points = append(s.Points, p)
+	}
+
+	cutoff := sample.At.Add(-s.Tier.Keep)
+	drop := 0
+	for drop < len(s.Points) && s.Points[drop].At.Before(cutoff) {
+		drop++
+	}
+	if drop > 0 {
+		s.Points = append([]Point{}, s.Points[drop:]...)
+	}
+}
+
+// between returns the points from from to to, inclusive
+func (s *series) between(from, to time.Time) []Point {
+	points := []Point{}
+	for _, p := range s.Points {
+		if !p.At.Before(from) && !p.At.After(to) {
+			points = append(points, p)
+		}
+	}
+	return points
+}
+
+// Prediction is where a mount's usage is heading
+type Prediction struct {
+	Mount     string `json:"mount"`
+	Used      uint64 `json:"used"`
+	Available uint64 `json:"available"`
+	// GrowthPerDay is the trend of used bytes over the range, negative when
+	// the mount is emptying
+	GrowthPerDay float64 `json:"growthPerDay"`
+	// FullAt is when the mount fills at that rate, unset when it doesn't grow
+	FullAt *time.Time `json:"fullAt,omitempty"`
+}
+
+// maxForecast is how far ahead Predict says when a mount fills
+const maxForecast = 100 * 365 * 24 * time.Hour
+
+// Predict fits a line through each mount's usage over points and says when
+// the mount would fill. Mounts with fewer than two readings are left out.
+func Predict(points []Point) []Prediction {
+	type reading struct {
+		at   time.Time
+		used float64
+	}
+	readings := make(map[string][]reading)
+	var order []string
+	for _, p := range points {
+		for name, m := range p.Mounts {
+			if _, ok := readings[name]; !ok {
+				order = append(order, name)
+			}
+			readings[name] = append(readings[name], reading{p.At, float64(m.Used)})
+		}
+	}
+
+	var predictions []Prediction
+	for _, name := range order {
+		rs := readings[name]
+		if len(rs) < 2 {
+			continue
+		}
+
+		// Least squares over seconds since the first reading
+		var sx, sy, sxx, sxy float64
+		for _, r := range rs {
+			x := r.at.Sub(rs[0].at).Seconds()
+			sx += x
+			sy += r.used
+			sxx += x * x
+			sxy += x * r.used
+		}
+		n := float64(len(rs))
+		denom := n*sxx - sx*sx
+		if denom == 0 {
+			continue
+		}
+		slope := (n*sxy - sx*sy) / denom
+
+		last := points[len(points)-1]
+		for i := len(points) - 1; i >= 0; i-- {
+			if _, ok := points[i].Mounts[name]; ok {
+				last = points[i]
+				break
+			}
+		}
+		m := last.Mounts[name]
+		pred := Prediction{Mount: name, Used: m.Used, Available: m.Available, GrowthPerDay: slope * 86400}
+		// Growth so slow it wouldn't fill the mount within a century is no growth
+		if secs := float64(m.Available) / slope; slope > 0 && secs < maxForecast.Seconds() {
+			full := last.At.Add(time.Duration(secs * float64(time.Second)))
+			pred.FullAt = &full
+		}
+		predictions = append(predictions, pred)
+	}
+	return predictions
+}
+
+// ParseSpan parses a duration such as "90m", "24h" or "7d"
+func ParseSpan(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid span %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid span %q", s)
+	}
+	return d, nil
+}
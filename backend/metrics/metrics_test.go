@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func sample(at time.Time, used uint64, rate int64) Sample {
+	return Sample{
+		At:           at,
+		DownloadRate: rate,
+		Active:       1,
+		Mounts:       map[string]MountUsage{"/mediastorage": {Total: 1000, Used: used, Available: 1000 - used}},
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	dir := t.TempDir()
+	config := &Config{IntervalSeconds: 300}
+	r, err := NewRecorder(config, dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	// Two days of a sample every 5 minutes, the disk filling by 100 bytes a day
+	var now time.Time
+	for i := 0; i < 2*24*12; i++ {
+		now = start.Add(time.Duration(i) * 5 * time.Minute)
+		r.Record(sample(now, 200+uint64(i*100/(24*12)), int64(i%3)*100))
+	}
+	r.now = func() time.Time { return now }
+
+	recent := r.Query(now.Add(-time.Hour), now, 0)
+	if recent.Step != 300 || len(recent.Points) != 13 {
+		t.Fatalf("expected 5 minute points for the last hour, got step %d, %d points", recent.Step, len(recent.Points))
+	}
+
+	week := r.Query(now.Add(-7*24*time.Hour), now, 0)
+	if week.Step != 15*60 || len(week.Points) != 2*24*4 {
+		t.Fatalf("expected 15 minute points, got step %d, %d points", week.Step, len(week.Points))
+	}
+	if p := week.Points[0]; p.Samples != 3 || p.DownloadRate != 100 {
+		t.Fatalf("unexpected averaged point %+v", p)
+	}
+
+	coarse := r.Query(now.Add(-time.Hour), now, 2*time.Hour)
+	if coarse.Step != 3*60*60 {
+		t.Fatalf("expected the 3 hour tier for a 2 hour step, got %d", coarse.Step)
+	}
+
+	if len(week.Predictions) != 1 {
+		t.Fatalf("unexpected predictions %+v", week.Predictions)
+	}
+	p := week.Predictions[0]
+	if p.GrowthPerDay < 95 || p.GrowthPerDay > 105 || p.FullAt == nil {
+		t.Fatalf("unexpected prediction %+v", p)
+	}
+	if days := p.FullAt.Sub(now).Hours() / 24; days < 6 || days > 7 {
+		t.Fatalf("expected the disk to fill in about 6 days, got %.1f", days)
+	}
+
+	r.save()
+	reloaded, err := NewRecorder(config, dir, nil)
+	if err != nil || len(reloaded.series[0].Points) != 24*12+1 {
+		t.Fatalf("expected a day of 5 minute points to be saved, got %d, %v", len(reloaded.series[0].Points), err)
+	}
+}
+
+func TestPredict_Shrinking(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	points := []Point{
+		{At: start, Mounts: map[string]MountUsage{"/a": {Used: 500, Available: 500}}},
+		{At: start.Add(24 * time.Hour), Mounts: map[string]MountUsage{"/a": {Used: 400, Available: 600}}},
+		{At: start.Add(48 * time.Hour), Mounts: map[string]MountUsage{"/b": {Used: 1}}},
+	}
+	preds := Predict(points)
+	if len(preds) != 1 || preds[0].GrowthPerDay != -100 || preds[0].FullAt != nil || preds[0].Used != 400 {
+		t.Fatalf("unexpected predictions %+v", preds)
+	}
+}
+
+func TestParseSpan(t *testing.T) {
+	cases := map[string]time.Duration{"7d": 7 * 24 * time.Hour, "90m": 90 * time.Minute}
+	for s, want := range cases {
+		if got, err := ParseSpan(s); err != nil || got != want {
+			t.Errorf("ParseSpan(%q) = %v, %v", s, got, err)
+		}
+	}
+	for _, s := range []string{"", "0d", "-1h", "week"} {
+		if _, err := ParseSpan(s); err == nil {
+			t.Errorf("ParseSpan(%q) should fail", s)
+		}
+	}
+}
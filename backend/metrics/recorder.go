@@ -0,0 +1,183 @@
+package metrics
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hasmikatom/torrent/configfile"
+	"github.com/hasmikatom/torrent/store"
+)
+
+// defaultInterval is how often samples are taken when the config doesn't say
+const defaultInterval = time.Minute
+
+// saveEvery is how many samples are taken between writes of the history
+const saveEvery = 5
+
+// Config is the contents of config/metrics.json
+type Config struct {
+	// IntervalSeconds is how often a sample is taken, 0 for every minute
+	IntervalSeconds int `json:"intervalSeconds,omitempty"`
+	// Disabled stops sampling; history already recorded can still be read
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+var (
+	metricsConfig     *Config
+	metricsConfigOnce sync.Once
+)
+
+// LoadConfig reads config/metrics.json once
+func LoadConfig() *Config {
+	metricsConfigOnce.Do(func() {
+		var config Config
+		path, err := configfile.Load("metrics.json", &config)
+		if err != nil {
+			log.Printf("Warning: %v, sampling metrics every minute", err)
+			metricsConfig = &Config{}
+			return
+		}
+		log.Printf("Loaded metrics config from: %s", path)
+		metricsConfig = &config
+	})
+
+	return metricsConfig
+}
+
+// Interval is how often a sample is taken
+func (c *Config) Interval() time.Duration {
+	if c.IntervalSeconds <= 0 {
+		return defaultInterval
+	}
+	return time.Duration(c.IntervalSeconds) * time.Second
+}
+
+// Tiers are the resolutions history is kept at, finest first
+func (c *Config) Tiers() []Tier {
+	return append([]Tier{{Step: c.Interval(), Keep: 24 * time.Hour}}, coarseTiers...)
+}
+
+// Range is the answer to a history query
+type Range struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// Step is the resolution of the points, in seconds
+	Step        int64        `json:"step"`
+	Points      []Point      `json:"points"`
+	Predictions []Prediction `json:"predictions,omitempty"`
+}
+
+// Recorder samples the system at an interval and keeps the history
+type Recorder struct {
+	config *Config
+	// sample reads the system now
+	sample func() (Sample, error)
+	file   *store.JSONFile
+	now    func() time.Time
+
+	mu      sync.Mutex
+	series  []series
+	pending int
+}
+
+// NewRecorder loads the history from dataDir
+func NewRecorder(config *Config, dataDir string, sample func() (Sample, error)) (*Recorder, error) {
+	r := &Recorder{config: config, sample: sample, file: store.NewJSONFile(dataDir, "metrics.json"), now: time.Now}
+
+	var saved []series
+	if err := r.file.Load(&saved); err != nil {
+		return nil, err
+	}
+	// Keep what was saved at resolutions that still exist
+	for _, t := range config.Tiers() {
+		s := series{Tier: t}
+		for _, old := range saved {
+			if old.Tier.Step == t.Step {
+				s.Points = old.Points
+			}
+		}
+		r.series = append(r.series, s)
+	}
+	return r, nil
+}
+
+// Run takes a sample every interval until ctx is cancelled, then saves
+func (r *Recorder) Run(ctx context.Context) {
+	if r.config.Disabled {
+		return
+	}
+
+	ticker := time.NewTicker(r.config.Interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.save()
+			return
+		case <-ticker.C:
+			s, err := r.sample()
+			if err != nil {
+				log.Printf("Failed to sample metrics: %v", err)
+				continue
+			}
+			r.Record(s)
+		}
+	}
+}
+
+// Record adds a sample to every tier
+func (r *Recorder) Record(s Sample) {
+	r.mu.Lock()
+	for i := range r.series {
+		r.series[i].record(s)
+	}
+	r.pending++
+	due := r.pending >= saveEvery
+	r.mu.Unlock()
+
+	if due {
+		r.save()
+	}
+}
+
+// Query returns the points between from and to at the finest resolution
+// that still covers from and is no finer than step
+func (r *Recorder) Query(from, to time.Time, step time.Duration) Range {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	chosen := r.series[len(r.series)-1]
+	for _, s := range r.series {
+		if s.Tier.Step >= step && !from.Before(now.Add(-s.Tier.Keep)) {
+			chosen = s
+			break
+		}
+	}
+
+	points := chosen.between(from, to)
+	return Range{
+		From:        from,
+		To:          to,
+		Step:        int64(chosen.Tier.Step.Seconds()),
+		Points:      points,
+		Predictions: Predict(points),
+	}
+}
+
+func (r *Recorder) save() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.pending == 0 {
+		return
+	}
+	if err := r.file.Save(r.series); err != nil {
+		log.Printf("Failed to save metrics history: %v", err)
+		return
+	}
+	r.pending = 0
+}
@@ -20,3 +20,15 @@ func RequireUser() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// RequireAdmin rejects callers whose role isn't admin. It must run after
+// RequireUser.
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("userRole") != "admin" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin role required"})
+			return
+		}
+		c.Next()
+	}
+}
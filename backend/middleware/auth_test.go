@@ -48,3 +48,22 @@ func TestRequireUser_PopulatesContextFromHeaders(t *testing.T) {
 		t.Fatalf("expected %s, got %s", expected, w.Body.String())
 	}
 }
+
+func TestRequireAdmin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequireUser(), RequireAdmin())
+	r.GET("/admin", func(c *gin.Context) { c.Status(200) })
+
+	for role, want := range map[string]int{"admin": 200, "user": 403, "": 403} {
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		req.Header.Set("X-User-Id", "abc")
+		req.Header.Set("X-User-Email", "a@x.com")
+		req.Header.Set("X-User-Role", role)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("role %q: expected %d, got %d", role, want, w.Code)
+		}
+	}
+}
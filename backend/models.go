@@ -10,6 +10,7 @@ type Config struct {
 	ThepiratebayURL      string
 	RutrackerUsername    string
 	RutrackerPassword    string
+	DataDir              string
 }
 
 type TorrentStatus struct {
@@ -22,4 +23,9 @@ type TorrentStatus struct {
 	Status       string  `json:"status"`
 	Error        int     `json:"error"`
 	ErrorString  string  `json:"errorString"`
+	// StallReason, StallDetail and StalledSince (unix seconds) are set
+	// when Status is "Stalled"
+	StallReason  string `json:"stallReason,omitempty"`
+	StallDetail  string `json:"stallDetail,omitempty"`
+	StalledSince *int64 `json:"stalledSince,omitempty"`
 }
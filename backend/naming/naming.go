@@ -0,0 +1,197 @@
+// Package naming proposes names that follow Plex's conventions for movies
+// and TV shows: "Movie Title (2021)/Movie Title (2021).mkv" and
+// "Show Name/Season 02/Show Name - S02E05.mkv".
+package naming
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hasmikatom/torrent/category"
+	"github.com/hasmikatom/torrent/release"
+	"github.com/hasmikatom/torrent/transmission"
+)
+
+var (
+	videoExts    = map[string]bool{".mkv": true, ".mp4": true, ".avi": true, ".m4v": true, ".ts": true, ".wmv": true, ".mov": true, ".mpg": true}
+	subtitleExts = map[string]bool{".srt": true, ".ass": true, ".ssa": true, ".sub": true, ".idx": true, ".vtt": true}
+	// languageTag is the lower-case "en" or "eng" in "Movie.en.srt", optionally
+	// followed by "forced"; upper-case scene tags like ".WEB" don't count
+	languageTag = regexp.MustCompile(`\.([a-z]{2,3}(?:\.forced)?)$`)
+	sample      = regexp.MustCompile(`(?i)\bsample\b`)
+)
+
+// Rename renames the last component of Path to Name, as torrent-rename-path does
+type Rename struct {
+	Path string `json:"path"`
+	Name string `json:"name"`
+}
+
+// MovieName is "Title (Year)", or just the title when the year isn't known
+func MovieName(info release.Info) string {
+	title := info.PreferredTitle()
+	if title == "" {
+		return ""
+	}
+	if info.Year > 0 {
+		title = fmt.Sprintf("%s (%d)", title, info.Year)
+	}
+	return category.SanitizeSegment(title)
+}
+
+// EpisodeName is "Show Name - S02E05", or "Show Name - S02E05-E06" for a
+// file holding several episodes. It needs exactly one season.
+func EpisodeName(show string, season int, episodes []int) string {
+	if show == "" || season <= 0 || len(episodes) == 0 {
+		return ""
+	}
+	name := fmt.Sprintf("%s - S%02dE%02d", show, season, episodes[0])
+	if last := episodes[len(episodes)-1]; len(episodes) > 1 {
+		name += fmt.Sprintf("-E%02d", last)
+	}
+	return category.SanitizeSegment(name)
+}
+
+// Suggest proposes a Plex style name for a release: "Movie Title (2021)"
+// for movies, "Show Name/Season 02/Show Name - S02E05" for a single episode
+// (or a double one) and "Show Name/Season 02" for a season pack. It returns
+// "" when the release doesn't look like either.
+func Suggest(info release.Info) string {
+	show := category.SanitizeSegment(info.PreferredTitle())
+	if show == "" {
+		return ""
+	}
+	if !info.IsEpisodic() {
+		if info.Year == 0 && info.Resolution == "" && info.Source == "" {
+			return ""
+		}
+		return MovieName(info)
+	}
+	if len(info.Seasons) != 1 {
+		return show
+	}
+
+	seasonDir := fmt.Sprintf("Season %02d", info.Seasons[0])
+	if len(info.Episodes) > 2 {
+		return path.Join(show, seasonDir)
+	}
+	if episode := EpisodeName(show, info.Seasons[0], info.Episodes); episode != "" {
+		return path.Join(show, seasonDir, episode)
+	}
+	return path.Join(show, seasonDir)
+}
+
+// FolderName is the name the torrent's top-level folder should get, or ""
+// to keep it. Movies get "Title (Year)"; show folders are left alone because
+// the category's path template already places them.
+func FolderName(info release.Info) string {
+	if info.IsEpisodic() {
+		return ""
+	}
+	return MovieName(info)
+}
+
+// PlanFiles works out file renames for a torrent whose release is described
+// by info, from the torrent's files as Transmission lists them.
+// Episodes are renamed "Show Name - S02E05.ext" using the season from the
+// torrent name when the file name lacks one; a movie's main video (the
+// largest one) becomes "Title (Year).ext". Subtitles follow their video and
+// keep their language tag. Samples and files that can't be placed are left
+// alone, as is anything whose new name would clash with another.
+func PlanFiles(info release.Info, files []transmission.File) []Rename {
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.Name
+	}
+
+	var renames []Rename
+	taken := map[string]bool{}
+	plan := func(file, name string) {
+		dir := path.Dir(file)
+		if name == "" || name == path.Base(file) || taken[path.Join(dir, name)] {
+			return
+		}
+		taken[path.Join(dir, name)] = true
+		renames = append(renames, Rename{Path: file, Name: name})
+	}
+
+	if info.IsEpisodic() {
+		show := category.SanitizeSegment(info.PreferredTitle())
+		for _, file := range sortedCopy(paths) {
+			ext, kind := fileKind(file)
+			if kind == "" || sample.MatchString(file) {
+				continue
+			}
+			stem, lang := splitName(file, ext, kind)
+			fileInfo := release.Parse(stem)
+			season := 0
+			switch {
+			case len(fileInfo.Seasons) == 1:
+				season = fileInfo.Seasons[0]
+			case len(fileInfo.Seasons) == 0 && len(info.Seasons) == 1:
+				season = info.Seasons[0]
+			}
+			if base := EpisodeName(show, season, fileInfo.Episodes); base != "" {
+				plan(file, base+lang+ext)
+			}
+		}
+		return renames
+	}
+
+	movie := MovieName(info)
+	if movie == "" {
+		return nil
+	}
+	main, mainSize := "", int64(-1)
+	for _, f := range files {
+		if _, kind := fileKind(f.Name); kind == "video" && !sample.MatchString(f.Name) && f.Length > mainSize {
+			main, mainSize = f.Name, f.Length
+		}
+	}
+	if main == "" {
+		return nil
+	}
+
+	plan(main, movie+path.Ext(main))
+	for _, file := range sortedCopy(paths) {
+		if ext, kind := fileKind(file); kind == "subtitle" && path.Dir(file) == path.Dir(main) {
+			_, lang := splitName(file, ext, kind)
+			plan(file, movie+lang+ext)
+		}
+	}
+	return renames
+}
+
+// fileKind returns the lower-cased extension and "video", "subtitle" or ""
+func fileKind(file string) (string, string) {
+	ext := strings.ToLower(path.Ext(file))
+	switch {
+	case videoExts[ext]:
+		return ext, "video"
+	case subtitleExts[ext]:
+		return ext, "subtitle"
+	}
+	return ext, ""
+}
+
+// splitName returns the file name without extension and, for subtitles,
+// the ".en" style language tag that should survive the rename
+func splitName(file, ext, kind string) (string, string) {
+	stem := strings.TrimSuffix(path.Base(file), path.Ext(file))
+	if kind != "subtitle" {
+		return stem, ""
+	}
+	if m := languageTag.FindStringSubmatchIndex(stem); m != nil {
+		return stem[:m[0]], "." + stem[m[2]:m[3]]
+	}
+	return stem, ""
+}
+
+func sortedCopy(files []string) []string {
+	sorted := append([]string(nil), files...)
+	sort.Strings(sorted)
+	return sorted
+}
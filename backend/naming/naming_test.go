@@ -0,0 +1,143 @@
+package naming
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hasmikatom/torrent/release"
+	"github.com/hasmikatom/torrent/transmission"
+)
+
+func TestSuggest(t *testing.T) {
+	cases := []struct {
+		name string
+		want string
+	}{
+		{"Movie.Title.2021.1080p.BluRay.x264-GRP", "Movie Title (2021)"},
+		{"Show.Name.S02E05.1080p.WEB-DL.x265-GRP", "Show Name/Season 02/Show Name - S02E05"},
+		{"Show.Name.S02E05E06.720p.HDTV", "Show Name/Season 02/Show Name - S02E05-E06"},
+		{"Show Name S03 Complete 720p", "Show Name/Season 03"},
+		{"Show.Name.S01-S04.1080p.BluRay", "Show Name"},
+		{"Во все тяжкие / Breaking Bad / Сезон: 2 / Серии: 1-13 из 13 [2009, BDRip 1080p]", "Breaking Bad/Season 02"},
+		{"Брат / Brat [1997, Россия, BDRip 720p]", "Brat (1997)"},
+		{"AC/DC: Live?", ""},
+		{"random words", ""},
+	}
+	for _, tc := range cases {
+		if got := Suggest(release.Parse(tc.name)); got != tc.want {
+			t.Errorf("Suggest(%q) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestPlanFiles_SeasonPack(t *testing.T) {
+	info := release.Parse("Show.Name.S02.1080p.WEB-DL.x265-GRP")
+	files := []transmission.File{
+		{Name: "Show.Name.S02.1080p.WEB-DL.x265-GRP/Show.Name.S02E02.1080p.WEB-DL.x265-GRP.mkv", Length: 100},
+		{Name: "Show.Name.S02.1080p.WEB-DL.x265-GRP/Show.Name.S02E01.1080p.WEB-DL.x265-GRP.mkv", Length: 100},
+		{Name: "Show.Name.S02.1080p.WEB-DL.x265-GRP/Subs/Show.Name.S02E01.en.srt", Length: 1},
+		{Name: "Show.Name.S02.1080p.WEB-DL.x265-GRP/Episode 3.mkv", Length: 100},
+		{Name: "Show.Name.S02.1080p.WEB-DL.x265-GRP/Show.Name.S02E01.sample.mkv", Length: 1},
+		{Name: "Show.Name.S02.1080p.WEB-DL.x265-GRP/info.nfo", Length: 1},
+		{Name: "Show.Name.S02.1080p.WEB-DL.x265-GRP/Extras.mkv", Length: 50},
+	}
+
+	want := []Rename{
+		{Path: "Show.Name.S02.1080p.WEB-DL.x265-GRP/Episode 3.mkv", Name: "Show Name - S02E03.mkv"},
+		{Path: "Show.Name.S02.1080p.WEB-DL.x265-GRP/Show.Name.S02E01.1080p.WEB-DL.x265-GRP.mkv", Name: "Show Name - S02E01.mkv"},
+		{Path: "Show.Name.S02.1080p.WEB-DL.x265-GRP/Show.Name.S02E02.1080p.WEB-DL.x265-GRP.mkv", Name: "Show Name - S02E02.mkv"},
+		{Path: "Show.Name.S02.1080p.WEB-DL.x265-GRP/Subs/Show.Name.S02E01.en.srt", Name: "Show Name - S02E01.en.srt"},
+	}
+	if got := PlanFiles(info, files); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestPlanFiles_Movie(t *testing.T) {
+	info := release.Parse("Movie.Title.2021.1080p.BluRay.x264-GRP")
+	files := []transmission.File{
+		{Name: "Movie.Title.2021.1080p.BluRay.x264-GRP/movie.title.2021.1080p.bluray.x264-grp.mkv", Length: 1000},
+		{Name: "Movie.Title.2021.1080p.BluRay.x264-GRP/movie.title.2021.1080p.bluray.x264-grp.eng.srt", Length: 1},
+		{Name: "Movie.Title.2021.1080p.BluRay.x264-GRP/movie.title.2021.1080p.bluray.x264-grp.WEB.srt", Length: 1},
+		{Name: "Movie.Title.2021.1080p.BluRay.x264-GRP/Sample/sample.mkv", Length: 10},
+	}
+
+	want := []Rename{
+		{Path: files[0].Name, Name: "Movie Title (2021).mkv"},
+		{Path: files[2].Name, Name: "Movie Title (2021).srt"},
+		{Path: files[1].Name, Name: "Movie Title (2021).eng.srt"},
+	}
+	if got := PlanFiles(info, files); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got  %+v\nwant %+v", got, want)
+	}
+	if got := FolderName(info); got != "Movie Title (2021)" {
+		t.Fatalf("FolderName = %q", got)
+	}
+}
+
+func TestPlanFiles_SkipsClashes(t *testing.T) {
+	info := release.Parse("Show.S01.720p")
+	files := []transmission.File{
+		{Name: "Show.S01.720p/a.S01E01.mkv"},
+		{Name: "Show.S01.720p/b.S01E01.mkv"},
+	}
+	if got := PlanFiles(info, files); len(got) != 1 {
+		t.Fatalf("expected the second file to be left alone, got %+v", got)
+	}
+}
+
+func TestValidatePath(t *testing.T) {
+	cases := []struct {
+		path string
+		ok   bool
+	}{
+		{"Show/Season 01/Show - S01E01.mkv", true},
+		{"file.mkv", true},
+		{"", false},
+		{"/etc/passwd", false},
+		{"Show/../../etc", false},
+		{"Show//file.mkv", false},
+		{"Show/./file.mkv", false},
+		{`Show\file.mkv`, false},
+		{"Show/file\x00.mkv", false},
+		{"Show/ file.mkv", false},
+		{"Show/" + strings.Repeat("a", 256), false},
+	}
+	for _, tc := range cases {
+		if err := ValidatePath(tc.path); (err == nil) != tc.ok {
+			t.Errorf("ValidatePath(%q) = %v, want ok=%v", tc.path, err, tc.ok)
+		}
+	}
+}
+
+func TestRenameHelpers(t *testing.T) {
+	files := []string{
+		"Top/Season 1/a.mkv",
+		"Top/Season 1/b.mkv",
+		"Top/Subs/a.srt",
+		"Top/readme.txt",
+	}
+
+	if got := Folders(files); !reflect.DeepEqual(got, []string{"Top", "Top/Season 1", "Top/Subs"}) {
+		t.Fatalf("Folders = %v", got)
+	}
+	if isFolder, ok := Lookup(files, "Top/Season 1"); !ok || !isFolder {
+		t.Fatalf("expected Top/Season 1 to be a folder")
+	}
+	if isFolder, ok := Lookup(files, "Top/readme.txt"); !ok || isFolder {
+		t.Fatalf("expected Top/readme.txt to be a file")
+	}
+	if _, ok := Lookup(files, "Top/Season"); ok {
+		t.Fatalf("a name prefix is not a folder")
+	}
+
+	renamed, newPath := ApplyRename(files, "Top/Season 1", "Season 01")
+	if newPath != "Top/Season 01" {
+		t.Fatalf("new path = %q", newPath)
+	}
+	want := []string{"Top/Season 01/a.mkv", "Top/Season 01/b.mkv", "Top/Subs/a.srt", "Top/readme.txt"}
+	if !reflect.DeepEqual(renamed, want) {
+		t.Fatalf("ApplyRename = %v", renamed)
+	}
+}
@@ -0,0 +1,103 @@
+package naming
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxComponent is the longest file name most filesystems accept, in bytes
+const maxComponent = 255
+
+// ValidateName checks that name can replace the last component of a path:
+// a single non-empty component without separators, control characters or
+// dot-only names
+func ValidateName(name string) error {
+	switch {
+	case name == "":
+		return errors.New("name is empty")
+	case name == "." || name == "..":
+		return fmt.Errorf("name %q is not allowed", name)
+	case strings.ContainsAny(name, `/\`):
+		return fmt.Errorf("name %q contains a path separator", name)
+	case len(name) > maxComponent:
+		return fmt.Errorf("name is longer than %d bytes", maxComponent)
+	case !utf8.ValidString(name):
+		return errors.New("name is not valid UTF-8")
+	case strings.TrimSpace(name) != name:
+		return fmt.Errorf("name %q starts or ends with whitespace", name)
+	}
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f {
+			return fmt.Errorf("name %q contains control characters", name)
+		}
+	}
+	return nil
+}
+
+// ValidatePath checks that p is a relative path inside a torrent, every
+// component of which is a valid name
+func ValidatePath(p string) error {
+	if p == "" {
+		return errors.New("path is empty")
+	}
+	if strings.HasPrefix(p, "/") {
+		return fmt.Errorf("path %q must be relative", p)
+	}
+	for _, component := range strings.Split(p, "/") {
+		if err := ValidateName(component); err != nil {
+			return fmt.Errorf("path %q: %v", p, err)
+		}
+	}
+	return nil
+}
+
+// Folders returns every folder that appears in a torrent's file paths
+func Folders(files []string) []string {
+	seen := map[string]bool{}
+	for _, f := range files {
+		for dir := path.Dir(f); dir != "." && !seen[dir]; dir = path.Dir(dir) {
+			seen[dir] = true
+		}
+	}
+	folders := make([]string, 0, len(seen))
+	for dir := range seen {
+		folders = append(folders, dir)
+	}
+	sort.Strings(folders)
+	return folders
+}
+
+// Lookup reports whether p is a file or a folder of the torrent
+func Lookup(files []string, p string) (isFolder bool, ok bool) {
+	for _, f := range files {
+		if f == p {
+			return false, true
+		}
+		if strings.HasPrefix(f, p+"/") {
+			isFolder = true
+		}
+	}
+	return isFolder, isFolder
+}
+
+// ApplyRename returns files as they are after renaming the last component
+// of p to name, along with the new path
+func ApplyRename(files []string, p, name string) ([]string, string) {
+	renamed := path.Join(path.Dir(p), name)
+	out := make([]string, len(files))
+	for i, f := range files {
+		switch {
+		case f == p:
+			out[i] = renamed
+		case strings.HasPrefix(f, p+"/"):
+			out[i] = renamed + strings.TrimPrefix(f, p)
+		default:
+			out[i] = f
+		}
+	}
+	return out, renamed
+}
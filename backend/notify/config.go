@@ -0,0 +1,133 @@
+package notify
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/hasmikatom/torrent/configfile"
+	"github.com/hasmikatom/torrent/events"
+)
+
+// SMTPConfig is the relay email targets are sent through. Users only choose
+// the address; the relay and its credentials belong to the server.
+type SMTPConfig struct {
+	Host string `json:"host"`
+	Port int    `json:"port"`
+	// TLS connects with implicit TLS (port 465); otherwise STARTTLS is used
+	// when the server offers it
+	TLS      bool   `json:"tls,omitempty"`
+	Username string `json:"username,omitempty"`
+	// Password may be given inline or read from the variable named by PasswordEnv
+	Password    string `json:"password,omitempty"`
+	PasswordEnv string `json:"passwordEnv,omitempty"`
+	From        string `json:"from"`
+}
+
+// Configured reports whether email targets can be used
+func (s SMTPConfig) Configured() bool {
+	return s.Host != "" && s.From != ""
+}
+
+// TemplateText is the title and body of a message as Go text/template
+// sources. They can use .Event, .ID, .Name, .Category, .Size, .Bytes,
+// .Duration and .Reason.
+type TemplateText struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// Config is the contents of config/notifications.json
+type Config struct {
+	SMTP SMTPConfig `json:"smtp"`
+	// Templates override the built-in text per event type
+	Templates map[events.Type]TemplateText `json:"templates,omitempty"`
+
+	templates map[events.Type]*compiledTemplate
+}
+
+var (
+	notifyConfig     *Config
+	notifyConfigOnce sync.Once
+)
+
+// LoadConfig reads config/notifications.json once. Without it push targets
+// still work with the built-in templates, but email is unavailable.
+func LoadConfig() *Config {
+	notifyConfigOnce.Do(func() {
+		var config Config
+		path, err := configfile.Load("notifications.json", &config)
+		if err != nil {
+			log.Printf("Warning: %v, using default notification settings", err)
+			config = Config{}
+		} else {
+			log.Printf("Loaded notification config from: %s", path)
+		}
+
+		if config.SMTP.PasswordEnv != "" {
+			config.SMTP.Password = os.Getenv(config.SMTP.PasswordEnv)
+		}
+		if config.SMTP.Port == 0 {
+			config.SMTP.Port = 587
+		}
+		if config.SMTP.Host != "" && !config.SMTP.Configured() {
+			log.Printf("Warning: smtp needs both host and from, email notifications disabled")
+		}
+		config.compile()
+		notifyConfig = &config
+	})
+
+	return notifyConfig
+}
+
+// compile parses the built-in templates and the configured overrides,
+// keeping the built-in one for any override that doesn't parse
+func (c *Config) compile() {
+	c.templates = make(map[events.Type]*compiledTemplate)
+	for t, text := range defaultTemplates {
+		compiled, err := compileTemplate(text)
+		if err != nil {
+			panic(fmt.Sprintf("built-in %s template: %v", t, err))
+		}
+		c.templates[t] = compiled
+	}
+
+	for t, text := range c.Templates {
+		if !validEventFilter(string(t)) || strings.HasSuffix(string(t), "*") {
+			log.Printf("Warning: skipping notification template for unknown event %q", t)
+			continue
+		}
+		compiled, err := compileTemplate(text)
+		if err != nil {
+			log.Printf("Warning: skipping notification template for %s: %v", t, err)
+			continue
+		}
+		c.templates[t] = compiled
+	}
+}
+
+type compiledTemplate struct {
+	title *template.Template
+	body  *template.Template
+}
+
+func compileTemplate(text TemplateText) (*compiledTemplate, error) {
+	title, err := template.New("title").Parse(text.Title)
+	if err != nil {
+		return nil, err
+	}
+	body, err := template.New("body").Parse(text.Body)
+	if err != nil {
+		return nil, err
+	}
+	compiled := &compiledTemplate{title: title, body: body}
+
+	// Unknown fields only fail when executed, so try it once up front
+	if _, err := compiled.render(sampleData); err != nil {
+		return nil, err
+	}
+	return compiled, nil
+}
@@ -0,0 +1,178 @@
+// Package notify sends torrent events to people: push services like ntfy,
+// Gotify and Telegram, or plain email. Every user keeps their own list of
+// targets and picks which events reach each one.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/hasmikatom/torrent/events"
+)
+
+// Target types
+const (
+	TypeNtfy     = "ntfy"
+	TypeGotify   = "gotify"
+	TypeSMTP     = "smtp"
+	TypeTelegram = "telegram"
+)
+
+// Types lists the supported target types
+var Types = []string{TypeNtfy, TypeGotify, TypeSMTP, TypeTelegram}
+
+// DefaultEvents are sent to targets that don't pick their own
+var DefaultEvents = []string{string(events.Completed), string(events.Errored)}
+
+// Message is a rendered notification
+type Message struct {
+	Event events.Type
+	Title string
+	Body  string
+}
+
+// Notifier sends messages to one target
+type Notifier interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// Target is somewhere a user wants to be notified
+type Target struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	// Events filters what is sent, like webhook filters; empty means DefaultEvents
+	Events   []string `json:"events,omitempty"`
+	Disabled bool     `json:"disabled,omitempty"`
+
+	// URL is the ntfy or Gotify server, or the Telegram Bot API base
+	URL string `json:"url,omitempty"`
+	// Topic is the ntfy topic
+	Topic string `json:"topic,omitempty"`
+	// Token is the ntfy access token, Gotify application token or Telegram bot token
+	Token string `json:"token,omitempty"`
+	// ChatID is the Telegram chat to post into
+	ChatID string `json:"chatId,omitempty"`
+	// To is the address emails go to
+	To string `json:"to,omitempty"`
+}
+
+const (
+	defaultNtfyURL     = "https://ntfy.sh"
+	defaultTelegramURL = "https://api.telegram.org"
+)
+
+var validTargetID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Wants reports whether the target is enabled for an event type
+func (t Target) Wants(e events.Type) bool {
+	if t.Disabled {
+		return false
+	}
+	if len(t.Events) == 0 {
+		return events.Matches(DefaultEvents, e)
+	}
+	return events.Matches(t.Events, e)
+}
+
+// Validate checks that a target has what its type needs
+func (t Target) Validate() error {
+	if !validTargetID.MatchString(t.ID) {
+		return fmt.Errorf("id %q must be 1-64 letters, digits, '-' or '_'", t.ID)
+	}
+	for _, e := range t.Events {
+		if !validEventFilter(e) {
+			return fmt.Errorf("unknown event %q", e)
+		}
+	}
+
+	switch t.Type {
+	case TypeNtfy:
+		if t.Topic == "" || strings.ContainsAny(t.Topic, "/?#") {
+			return fmt.Errorf("ntfy targets need a topic without '/', '?' or '#'")
+		}
+		if t.URL != "" {
+			return validURL(t.URL)
+		}
+	case TypeGotify:
+		if t.Token == "" {
+			return fmt.Errorf("gotify targets need an application token")
+		}
+		return validURL(t.URL)
+	case TypeTelegram:
+		if t.Token == "" || t.ChatID == "" {
+			return fmt.Errorf("telegram targets need a bot token and chat id")
+		}
+		if t.URL != "" {
+			return validURL(t.URL)
+		}
+	case TypeSMTP:
+		if !strings.Contains(t.To, "@") || strings.ContainsAny(t.To, "\r\n") {
+			return fmt.Errorf("smtp targets need a valid to address")
+		}
+	default:
+		return fmt.Errorf("unknown type %q, expected one of %s", t.Type, strings.Join(Types, ", "))
+	}
+	return nil
+}
+
+func validEventFilter(f string) bool {
+	if strings.HasSuffix(f, "*") {
+		return true
+	}
+	for _, t := range events.Types {
+		if string(t) == f {
+			return true
+		}
+	}
+	return false
+}
+
+func validURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url %q must be an absolute http(s) URL", raw)
+	}
+	return nil
+}
+
+// New returns the notifier for a target. Email targets need the server's
+// SMTP settings.
+func New(t Target, smtp SMTPConfig, client *http.Client) (Notifier, error) {
+	switch t.Type {
+	case TypeNtfy:
+		return &ntfy{target: t, client: client}, nil
+	case TypeGotify:
+		return &gotify{target: t, client: client}, nil
+	case TypeTelegram:
+		return &telegram{target: t, client: client}, nil
+	case TypeSMTP:
+		if !smtp.Configured() {
+			return nil, fmt.Errorf("email notifications are not configured on this server")
+		}
+		return &email{target: t, config: smtp}, nil
+	}
+	return nil, fmt.Errorf("unknown notifier type %q", t.Type)
+}
+
+// post sends a request and turns non-2xx answers into errors
+func post(ctx context.Context, client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		if detail := strings.TrimSpace(string(body)); detail != "" {
+			return fmt.Errorf("%s answered %s: %s", req.URL.Host, resp.Status, detail)
+		}
+		return fmt.Errorf("%s answered %s", req.URL.Host, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,311 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hasmikatom/torrent/events"
+)
+
+// capture is a local stand-in for a push service that records the last request
+type capture struct {
+	mu     sync.Mutex
+	code   int
+	path   string
+	header http.Header
+	body   []byte
+	hits   int
+}
+
+func (c *capture) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.path, c.header, c.body = r.URL.Path, r.Header, body
+	c.hits++
+	if c.code != 0 {
+		w.WriteHeader(c.code)
+		w.Write([]byte(`{"ok":false,"description":"chat not found"}`))
+	}
+}
+
+func newCapture(t *testing.T) (*capture, string) {
+	c := &capture{}
+	srv := httptest.NewServer(c)
+	t.Cleanup(srv.Close)
+	return c, srv.URL
+}
+
+var message = Message{Event: events.Completed, Title: "Download complete", Body: "Ubuntu finished"}
+
+func send(t *testing.T, target Target, smtp SMTPConfig) error {
+	t.Helper()
+	if err := target.Validate(); err != nil {
+		t.Fatalf("invalid target: %v", err)
+	}
+	n, err := New(target, smtp, http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return n.Send(ctx, message)
+}
+
+func TestNtfy(t *testing.T) {
+	c, url := newCapture(t)
+	if err := send(t, Target{ID: "phone", Type: TypeNtfy, URL: url, Topic: "downloads", Token: "tk"}, SMTPConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	if c.path != "/downloads" || string(c.body) != "Ubuntu finished" {
+		t.Errorf("unexpected request %s %q", c.path, c.body)
+	}
+	if c.header.Get("Title") != "Download complete" || c.header.Get("Authorization") != "Bearer tk" {
+		t.Errorf("unexpected headers %v", c.header)
+	}
+}
+
+func TestGotify(t *testing.T) {
+	c, url := newCapture(t)
+	if err := send(t, Target{ID: "gotify", Type: TypeGotify, URL: url + "/", Token: "app"}, SMTPConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	var body struct {
+		Title, Message string
+		Priority       int
+	}
+	json.Unmarshal(c.body, &body)
+	if c.path != "/message" || c.header.Get("X-Gotify-Key") != "app" {
+		t.Errorf("unexpected request %s %v", c.path, c.header)
+	}
+	if body.Title != "Download complete" || body.Message != "Ubuntu finished" || body.Priority != 5 {
+		t.Errorf("unexpected body %s", c.body)
+	}
+}
+
+func TestTelegram(t *testing.T) {
+	c, url := newCapture(t)
+	target := Target{ID: "tg", Type: TypeTelegram, URL: url, Token: "123:secret", ChatID: "42"}
+	if err := send(t, target, SMTPConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	var body struct {
+		ChatID string `json:"chat_id"`
+		Text   string `json:"text"`
+	}
+	json.Unmarshal(c.body, &body)
+	if c.path != "/bot123:secret/sendMessage" || body.ChatID != "42" || body.Text != "Download complete\nUbuntu finished" {
+		t.Errorf("unexpected request %s %s", c.path, c.body)
+	}
+
+	c.code = http.StatusBadRequest
+	err := send(t, target, SMTPConfig{})
+	if err == nil || !strings.Contains(err.Error(), "chat not found") || strings.Contains(err.Error(), "secret") {
+		t.Errorf("expected the API error without the token, got %v", err)
+	}
+}
+
+// fakeSMTP accepts one message and hands its recipient and data back
+func fakeSMTP(t *testing.T) (string, int, <-chan [2]string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	got := make(chan [2]string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+
+		reply("220 fake ESMTP")
+		var rcpt string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"):
+				reply("250 fake")
+			case strings.HasPrefix(cmd, "MAIL FROM"):
+				reply("250 ok")
+			case strings.HasPrefix(cmd, "RCPT TO"):
+				rcpt = strings.TrimSpace(line)[len("RCPT TO:"):]
+				reply("250 ok")
+			case cmd == "DATA":
+				reply("354 go ahead")
+				var data strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil || l == ".\r\n" {
+						break
+					}
+					data.WriteString(l)
+				}
+				got <- [2]string{rcpt, data.String()}
+				reply("250 queued")
+			case cmd == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("502 unknown")
+			}
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return host, p, got
+}
+
+func TestEmail(t *testing.T) {
+	host, port, got := fakeSMTP(t)
+	smtp := SMTPConfig{Host: host, Port: port, From: "torrents@example.com"}
+
+	if err := send(t, Target{ID: "mail", Type: TypeSMTP, To: "me@example.com"}, smtp); err != nil {
+		t.Fatal(err)
+	}
+	mail := <-got
+	if mail[0] != "<me@example.com>" {
+		t.Errorf("recipient = %q", mail[0])
+	}
+	for _, want := range []string{"From: torrents@example.com", "To: me@example.com", "Subject: Download complete", "Ubuntu finished"} {
+		if !strings.Contains(mail[1], want) {
+			t.Errorf("message lacks %q:\n%s", want, mail[1])
+		}
+	}
+}
+
+func TestEmail_NotConfigured(t *testing.T) {
+	if _, err := New(Target{ID: "mail", Type: TypeSMTP, To: "me@example.com"}, SMTPConfig{}, http.DefaultClient); err == nil {
+		t.Fatal("expected an error without smtp settings")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		target Target
+		ok     bool
+	}{
+		{Target{ID: "a", Type: TypeNtfy, Topic: "t"}, true},
+		{Target{ID: "a", Type: TypeNtfy, Topic: "a/b"}, false},
+		{Target{ID: "a", Type: TypeGotify, Token: "x"}, false},
+		{Target{ID: "a", Type: TypeGotify, URL: "ftp://x", Token: "x"}, false},
+		{Target{ID: "a", Type: TypeTelegram, Token: "x"}, false},
+		{Target{ID: "a", Type: TypeSMTP, To: "me@example.com\r\nBcc: x"}, false},
+		{Target{ID: "a", Type: TypeNtfy, Topic: "t", Events: []string{"torrent.done"}}, false},
+		{Target{ID: "a", Type: TypeNtfy, Topic: "t", Events: []string{"torrent.*"}}, true},
+		{Target{ID: "a b", Type: TypeNtfy, Topic: "t"}, false},
+		{Target{ID: "a", Type: "pager"}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.target.Validate(); (err == nil) != tt.ok {
+			t.Errorf("Validate(%+v) = %v, want ok=%v", tt.target, err, tt.ok)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	config := &Config{Templates: map[events.Type]TemplateText{
+		events.Errored: {Title: "{{.Name}} broke", Body: "{{.Reason}}"},
+		events.Removed: {Title: "{{.Missing}}", Body: ""},
+	}}
+	config.compile()
+
+	added := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	done := added.Add(90 * time.Minute)
+	e := events.New(events.Completed, events.Torrent{ID: 1, Name: "Ubuntu", Size: 3 << 30, AddedAt: &added, DoneAt: &done}, done)
+
+	m, err := config.Render(Data(e, "Software"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Ubuntu (Software) finished in 1h 30m, 3.0 GiB"; m.Body != want {
+		t.Errorf("body = %q, want %q", m.Body, want)
+	}
+
+	e = events.New(events.Errored, events.Torrent{ID: 1, Name: "Ubuntu", Error: "No data found"}, done)
+	m, _ = config.Render(Data(e, ""))
+	if m.Title != "Ubuntu broke" || m.Body != "No data found" {
+		t.Errorf("override not used: %+v", m)
+	}
+
+	// A template using an unknown field is dropped for the built-in one
+	e = events.New(events.Removed, events.Torrent{ID: 1, Name: "Ubuntu"}, done)
+	if m, _ = config.Render(Data(e, "")); m.Title != "Download removed" {
+		t.Errorf("expected the built-in removed template, got %+v", m)
+	}
+}
+
+func TestService_NotifiesOwner(t *testing.T) {
+	c, url := newCapture(t)
+	prefs, err := OpenPreferences(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := prefs.SetTargets("alice", []Target{{ID: "phone", Type: TypeNtfy, URL: url, Topic: "alice"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := prefs.SetTargets("bob", []Target{{ID: "phone", Type: TypeNtfy, URL: url, Topic: "bob", Events: []string{"torrent.*"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config{}
+	config.compile()
+	owners := map[string]string{"aaa": "alice", "bbb": "bob"}
+	s := NewService(config, prefs, func(hash string) (string, bool) {
+		u, ok := owners[hash]
+		return u, ok
+	}, func(string) string { return "Movies" })
+
+	ch := make(chan events.Event, 4)
+	ch <- events.New(events.Added, events.Torrent{Hash: "aaa", Name: "A"}, time.Now())     // alice only wants the defaults
+	ch <- events.New(events.Completed, events.Torrent{Hash: "aaa", Name: "A"}, time.Now()) // sent to alice
+	ch <- events.New(events.Added, events.Torrent{Hash: "bbb", Name: "B"}, time.Now())     // sent to bob
+	ch <- events.New(events.Completed, events.Torrent{Hash: "ccc", Name: "C"}, time.Now()) // nobody owns it
+	close(ch)
+	s.Run(context.Background(), ch)
+
+	if c.hits != 2 {
+		t.Errorf("expected 2 notifications, got %d", c.hits)
+	}
+}
+
+func TestSetTargets_KeepsTokens(t *testing.T) {
+	prefs, err := OpenPreferences(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := prefs.SetTargets("alice", []Target{{ID: "g", Type: TypeGotify, URL: "https://g.example.com", Token: "secret"}}); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := prefs.SetTargets("alice", []Target{{ID: "g", Type: TypeGotify, URL: "https://g2.example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved[0].Token != "secret" || saved[0].URL != "https://g2.example.com" {
+		t.Errorf("unexpected target %+v", saved[0])
+	}
+
+	if _, err := prefs.SetTargets("alice", []Target{{ID: "n", Type: TypeNtfy, Topic: "t"}, {ID: "n", Type: TypeNtfy, Topic: "u"}}); err == nil {
+		t.Error("expected duplicate ids to be rejected")
+	}
+}
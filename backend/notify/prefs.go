@@ -0,0 +1,93 @@
+package notify
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hasmikatom/torrent/store"
+)
+
+// Preferences holds every user's notification targets, persisted as JSON
+// and keyed by the user id from the auth service
+type Preferences struct {
+	mu    sync.Mutex
+	file  *store.JSONFile
+	users map[string][]Target
+}
+
+// OpenPreferences loads saved targets from dataDir
+func OpenPreferences(dataDir string) (*Preferences, error) {
+	p := &Preferences{
+		file:  store.NewJSONFile(dataDir, "notification-targets.json"),
+		users: make(map[string][]Target),
+	}
+	if err := p.file.Load(&p.users); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Targets returns copies of a user's targets
+func (p *Preferences) Targets(userID string) []Target {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	targets := make([]Target, len(p.users[userID]))
+	copy(targets, p.users[userID])
+	return targets
+}
+
+// Target returns one of a user's targets
+func (p *Preferences) Target(userID, id string) (Target, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, t := range p.users[userID] {
+		if t.ID == id {
+			return t, true
+		}
+	}
+	return Target{}, false
+}
+
+// SetTargets replaces a user's targets. A target sent without a token keeps
+// the token saved for the same id and type, so clients never have to read
+// tokens back.
+func (p *Preferences) SetTargets(userID string, targets []Target) ([]Target, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	existing := make(map[string]Target)
+	for _, t := range p.users[userID] {
+		existing[t.ID] = t
+	}
+
+	seen := make(map[string]bool)
+	saved := make([]Target, 0, len(targets))
+	for _, t := range targets {
+		if old, ok := existing[t.ID]; ok && t.Token == "" && old.Type == t.Type {
+			t.Token = old.Token
+		}
+		if err := t.Validate(); err != nil {
+			return nil, fmt.Errorf("target %q: %v", t.ID, err)
+		}
+		if seen[t.ID] {
+			return nil, fmt.Errorf("target %q is listed twice", t.ID)
+		}
+		seen[t.ID] = true
+		saved = append(saved, t)
+	}
+
+	if len(saved) == 0 {
+		delete(p.users, userID)
+	} else {
+		p.users[userID] = saved
+	}
+	if err := p.file.Save(p.users); err != nil {
+		return nil, err
+	}
+
+	result := make([]Target, len(saved))
+	copy(result, saved)
+	return result, nil
+}
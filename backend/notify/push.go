@@ -0,0 +1,112 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hasmikatom/torrent/events"
+)
+
+// ntfy publishes to a topic on an ntfy server
+type ntfy struct {
+	target Target
+	client *http.Client
+}
+
+func (n *ntfy) Send(ctx context.Context, m Message) error {
+	base := n.target.URL
+	if base == "" {
+		base = defaultNtfyURL
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(base, "/")+"/"+url.PathEscape(n.target.Topic), strings.NewReader(m.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", m.Title)
+	req.Header.Set("Tags", ntfyTag(m.Event))
+	if n.target.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.target.Token)
+	}
+	return post(ctx, n.client, req)
+}
+
+// ntfyTag picks an emoji shortcode shown next to the title
+func ntfyTag(t events.Type) string {
+	switch t {
+	case events.Completed:
+		return "white_check_mark"
+	case events.Errored:
+		return "x"
+	case events.Stalled:
+		return "warning"
+	}
+	return "arrow_down"
+}
+
+// gotify posts a message with an application token
+type gotify struct {
+	target Target
+	client *http.Client
+}
+
+func (g *gotify) Send(ctx context.Context, m Message) error {
+	priority := 5
+	if m.Event == events.Errored || m.Event == events.Stalled {
+		priority = 8
+	}
+	body, err := json.Marshal(map[string]any{
+		"title":    m.Title,
+		"message":  m.Body,
+		"priority": priority,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(g.target.URL, "/")+"/message", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", g.target.Token)
+	return post(ctx, g.client, req)
+}
+
+// telegram sends through the Bot API
+type telegram struct {
+	target Target
+	client *http.Client
+}
+
+func (t *telegram) Send(ctx context.Context, m Message) error {
+	base := t.target.URL
+	if base == "" {
+		base = defaultTelegramURL
+	}
+	body, err := json.Marshal(map[string]any{
+		"chat_id":                  t.target.ChatID,
+		"text":                     m.Title + "\n" + m.Body,
+		"disable_web_page_preview": true,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(base, "/")+"/bot"+t.target.Token+"/sendMessage", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// The bot token is part of the URL, keep it out of errors and logs
+	if err := post(ctx, t.client, req); err != nil {
+		return errors.New(strings.ReplaceAll(err.Error(), t.target.Token, "<token>"))
+	}
+	return nil
+}
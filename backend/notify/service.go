@@ -0,0 +1,113 @@
+package notify
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hasmikatom/torrent/events"
+)
+
+// sendTimeout bounds a single notification
+const sendTimeout = 15 * time.Second
+
+// Service turns events into notifications for the user that owns the torrent
+type Service struct {
+	config *Config
+	prefs  *Preferences
+	// owner returns the user that added a torrent
+	owner func(hash string) (string, bool)
+	// category names the category a download directory belongs to
+	category func(dir string) string
+	client   *http.Client
+	wg       sync.WaitGroup
+}
+
+// NewService returns a service sending with config's templates to the
+// targets saved in prefs
+func NewService(config *Config, prefs *Preferences, owner func(hash string) (string, bool), category func(dir string) string) *Service {
+	return &Service{
+		config:   config,
+		prefs:    prefs,
+		owner:    owner,
+		category: category,
+		client:   &http.Client{Timeout: sendTimeout},
+	}
+}
+
+// Run sends notifications until the channel closes or ctx is cancelled,
+// then waits for sends in flight
+func (s *Service) Run(ctx context.Context, ch <-chan events.Event) {
+	defer s.wg.Wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			s.Notify(ctx, e)
+		}
+	}
+}
+
+// Notify sends an event to the targets of the torrent's owner that want it.
+// Sends run in the background; failures are logged.
+func (s *Service) Notify(ctx context.Context, e events.Event) {
+	userID, ok := s.owner(e.Torrent.Hash)
+	if !ok {
+		return
+	}
+
+	var targets []Target
+	for _, t := range s.prefs.Targets(userID) {
+		if t.Wants(e.Type) {
+			targets = append(targets, t)
+		}
+	}
+	if len(targets) == 0 {
+		return
+	}
+
+	m, err := s.config.Render(Data(e, s.category(e.Torrent.DownloadDir)))
+	if err != nil {
+		log.Printf("Failed to render %s notification for torrent %d: %v", e.Type, e.Torrent.ID, err)
+		return
+	}
+
+	for _, t := range targets {
+		s.wg.Add(1)
+		go func(t Target) {
+			defer s.wg.Done()
+			if err := s.Send(ctx, t, m); err != nil {
+				log.Printf("Failed to send %s notification to %s target %q of user %s: %v", e.Type, t.Type, t.ID, userID, err)
+			}
+		}(t)
+	}
+}
+
+// Send delivers one message to one target
+func (s *Service) Send(ctx context.Context, t Target, m Message) error {
+	n, err := New(t, s.config.SMTP, s.client)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+	return n.Send(ctx, m)
+}
+
+// Test sends a sample completion message to a target
+func (s *Service) Test(ctx context.Context, t Target) error {
+	m, err := s.config.Render(sampleData)
+	if err != nil {
+		return err
+	}
+	m.Title = "Test: " + m.Title
+	return s.Send(ctx, t, m)
+}
@@ -0,0 +1,144 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hasmikatom/torrent/configfile"
+	"github.com/hasmikatom/torrent/events"
+)
+
+// TemplateData is what message templates are executed with
+type TemplateData struct {
+	Event    events.Type
+	ID       int
+	Name     string
+	Category string
+	// Size is human readable, Bytes the exact count
+	Size  string
+	Bytes int64
+	// Duration is how long the torrent took to finish, or how long it has
+	// been running for other events
+	Duration string
+	Reason   string
+}
+
+var sampleData = TemplateData{
+	Event:    events.Completed,
+	ID:       1,
+	Name:     "Sample.Torrent.2024.1080p",
+	Category: "Movies",
+	Size:     "4.2 GiB",
+	Bytes:    4509715660,
+	Duration: "1h 5m",
+	Reason:   "sample",
+}
+
+var defaultTemplates = map[events.Type]TemplateText{
+	events.Added: {
+		Title: "Download started",
+		Body:  "{{.Name}}{{with .Category}} ({{.}}){{end}}{{with .Size}}, {{.}}{{end}}",
+	},
+	events.MetadataReady: {
+		Title: "Download metadata ready",
+		Body:  "{{.Name}}{{with .Size}} is {{.}}{{end}}",
+	},
+	events.Completed: {
+		Title: "Download complete",
+		Body:  "{{.Name}}{{with .Category}} ({{.}}){{end}} finished{{with .Duration}} in {{.}}{{end}}{{with .Size}}, {{.}}{{end}}",
+	},
+	events.Errored: {
+		Title: "Download failed",
+		Body:  "{{.Name}}{{with .Category}} ({{.}}){{end}}: {{.Reason}}",
+	},
+	events.Stalled: {
+		Title: "Download stalled",
+		Body:  "{{.Name}}{{with .Category}} ({{.}}){{end}}: {{.Reason}}",
+	},
+	events.Extracted: {
+		Title: "Download extracted",
+		Body:  "{{.Name}}{{with .Category}} ({{.}}){{end}} was unpacked",
+	},
+	events.Linked: {
+		Title: "Download added to library",
+		Body:  "{{.Name}}{{with .Category}} ({{.}}){{end}} is in the library",
+	},
+	events.Removed: {
+		Title: "Download removed",
+		Body:  "{{.Name}}{{with .Category}} ({{.}}){{end}}",
+	},
+}
+
+// Data builds template data for an event. category is the name of the
+// category the torrent is in, if any.
+func Data(e events.Event, category string) TemplateData {
+	d := TemplateData{
+		Event:    e.Type,
+		ID:       e.Torrent.ID,
+		Name:     e.Torrent.Name,
+		Category: category,
+		Bytes:    e.Torrent.Size,
+		Reason:   e.Reason,
+	}
+	if d.Reason == "" {
+		d.Reason = e.Torrent.Error
+	}
+	if d.Bytes > 0 {
+		d.Size = configfile.FormatByteSize(d.Bytes)
+	}
+	if e.Torrent.AddedAt != nil {
+		end := e.Time
+		if e.Torrent.DoneAt != nil {
+			end = *e.Torrent.DoneAt
+		}
+		if end.After(*e.Torrent.AddedAt) {
+			d.Duration = formatDuration(end.Sub(*e.Torrent.AddedAt))
+		}
+	}
+	return d
+}
+
+// Render builds the message for an event
+func (c *Config) Render(d TemplateData) (Message, error) {
+	t, ok := c.templates[d.Event]
+	if !ok {
+		return Message{}, fmt.Errorf("no template for %s", d.Event)
+	}
+	m, err := t.render(d)
+	if err != nil {
+		return Message{}, err
+	}
+	m.Event = d.Event
+	return m, nil
+}
+
+func (t *compiledTemplate) render(d TemplateData) (Message, error) {
+	var title, body strings.Builder
+	if err := t.title.Execute(&title, d); err != nil {
+		return Message{}, err
+	}
+	if err := t.body.Execute(&body, d); err != nil {
+		return Message{}, err
+	}
+	return Message{Title: strings.TrimSpace(title.String()), Body: strings.TrimSpace(body.String())}, nil
+}
+
+// formatDuration renders the two largest units, e.g. "2d 3h", "1h 5m" or "42s"
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	days := int(d / (24 * time.Hour))
+	hours := int(d/time.Hour) % 24
+	minutes := int(d/time.Minute) % 60
+	seconds := int(d/time.Second) % 60
+
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	case minutes > 0:
+		return fmt.Sprintf("%dm %ds", minutes, seconds)
+	}
+	return fmt.Sprintf("%ds", seconds)
+}
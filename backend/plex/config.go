@@ -0,0 +1,81 @@
+package plex
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/hasmikatom/torrent/category"
+	"github.com/hasmikatom/torrent/configfile"
+)
+
+// defaultMaxAttempts is how often a refresh is tried when the config doesn't say
+const defaultMaxAttempts = 5
+
+// Config is the contents of config/plex.json
+type Config struct {
+	// URL is the Plex server, e.g. http://plex:32400
+	URL string `json:"url"`
+	// Token may be given inline or read from the variable named by TokenEnv
+	Token    string `json:"token,omitempty"`
+	TokenEnv string `json:"tokenEnv,omitempty"`
+	// Sections maps category ids (content types) to Plex library section ids
+	Sections map[string][]int `json:"sections"`
+	// PathMappings translate download paths to the paths Plex sees
+	PathMappings []category.PathMapping `json:"pathMappings,omitempty"`
+	MaxAttempts  int                    `json:"maxAttempts,omitempty"`
+}
+
+var (
+	plexConfig     *Config
+	plexConfigOnce sync.Once
+)
+
+// LoadConfig reads config/plex.json once. Without a usable config the
+// integration is disabled.
+func LoadConfig() *Config {
+	plexConfigOnce.Do(func() {
+		var config Config
+		path, err := configfile.Load("plex.json", &config)
+		if err != nil {
+			log.Printf("Warning: %v, Plex refresh disabled", err)
+			plexConfig = &Config{}
+			return
+		}
+		log.Printf("Loaded Plex config from: %s", path)
+
+		if config.TokenEnv != "" {
+			config.Token = os.Getenv(config.TokenEnv)
+		}
+		if config.MaxAttempts <= 0 {
+			config.MaxAttempts = defaultMaxAttempts
+		}
+		if config.URL != "" {
+			if err := config.validate(); err != nil {
+				log.Printf("Warning: %v, Plex refresh disabled", err)
+				config = Config{}
+			}
+		}
+		plexConfig = &config
+	})
+
+	return plexConfig
+}
+
+// Enabled reports whether a Plex server is configured
+func (c *Config) Enabled() bool {
+	return c.URL != ""
+}
+
+func (c *Config) validate() error {
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("plex url %q must be an absolute http(s) URL", c.URL)
+	}
+	if c.Token == "" {
+		return fmt.Errorf("plex token is required")
+	}
+	return nil
+}
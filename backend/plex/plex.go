@@ -0,0 +1,52 @@
+// Package plex asks a Plex server to scan new downloads as soon as they
+// finish instead of waiting for its periodic library scan.
+package plex
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/hasmikatom/torrent/refresh"
+)
+
+// Client talks to the Plex HTTP API
+type Client struct {
+	URL   string
+	Token string
+	HTTP  *http.Client
+}
+
+// RefreshPath starts a partial scan of one folder in a library section
+func (c *Client) RefreshPath(ctx context.Context, section int, path string) error {
+	query := url.Values{"path": {path}}
+	return c.get(ctx, "/library/sections/"+strconv.Itoa(section)+"/refresh?"+query.Encode())
+}
+
+// Ping checks that the server is reachable and accepts the token
+func (c *Client) Ping(ctx context.Context) error {
+	return c.get(ctx, "/identity")
+}
+
+func (c *Client) get(ctx context.Context, path string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(c.URL, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Plex-Token", c.Token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		// url.Error includes the request URL, which is safe: the token is a header
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &refresh.StatusError{Server: "plex", Code: resp.StatusCode, Status: resp.Status}
+	}
+	return nil
+}
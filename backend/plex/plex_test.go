@@ -0,0 +1,168 @@
+package plex
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hasmikatom/torrent/category"
+	"github.com/hasmikatom/torrent/events"
+	"github.com/hasmikatom/torrent/refresh"
+)
+
+// fakePlex records refresh requests and answers with scripted status codes
+type fakePlex struct {
+	mu    sync.Mutex
+	codes []int
+	scans []string
+}
+
+func (f *fakePlex) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Plex-Token") != "token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.URL.Path == "/identity" {
+		return
+	}
+	f.scans = append(f.scans, r.URL.Path+" "+r.URL.Query().Get("path"))
+	if len(f.codes) > 0 {
+		w.WriteHeader(f.codes[0])
+		f.codes = f.codes[1:]
+	}
+}
+
+func newRefresher(t *testing.T, plex *fakePlex, token string) *Refresher {
+	t.Helper()
+	srv := httptest.NewServer(plex)
+	t.Cleanup(srv.Close)
+
+	config := &Config{
+		URL:          srv.URL,
+		Token:        token,
+		Sections:     map[string][]int{"Movies": {1}, "Series": {2, 5}},
+		PathMappings: []category.PathMapping{{From: "/mediastorage", To: "/data"}},
+		MaxAttempts:  3,
+	}
+	categoryOf := func(dir string) (string, bool) {
+		switch dir {
+		case "/mediastorage/Movies":
+			return "Movies", true
+		case "/mediastorage/Series/Show/Season 01":
+			return "Series", true
+		case "/mediastorage/Music":
+			return "Music", true
+		}
+		return "", false
+	}
+	return NewRefresher(config, categoryOf, refresh.Options{Backoff: time.Millisecond, MaxBackoff: time.Millisecond, Timeout: time.Second})
+}
+
+func completed(dir, name string) events.Event {
+	return events.New(events.Completed, events.Torrent{ID: 1, Name: name, DownloadDir: dir}, time.Now())
+}
+
+func TestRefresh(t *testing.T) {
+	tests := []struct {
+		name         string
+		event        events.Event
+		codes        []int
+		wantStatus   string
+		wantAttempts int
+		wantScans    []string
+	}{
+		{
+			name:         "movie",
+			event:        completed("/mediastorage/Movies", "Film.2020.mkv"),
+			wantStatus:   refresh.StatusDone,
+			wantAttempts: 1,
+			wantScans:    []string{"/library/sections/1/refresh /data/Movies"},
+		},
+		{
+			name:         "every mapped section, retrying only the one that failed",
+			event:        completed("/mediastorage/Series/Show/Season 01", "Show.S01E01.mkv"),
+			codes:        []int{200, 503, 200},
+			wantStatus:   refresh.StatusDone,
+			wantAttempts: 2,
+			wantScans: []string{
+				"/library/sections/2/refresh /data/Series/Show/Season 01",
+				"/library/sections/5/refresh /data/Series/Show/Season 01",
+				"/library/sections/5/refresh /data/Series/Show/Season 01",
+			},
+		},
+		{
+			name:         "unknown section is not retried",
+			event:        completed("/mediastorage/Movies", "Film.2020.mkv"),
+			codes:        []int{404},
+			wantStatus:   refresh.StatusFailed,
+			wantAttempts: 1,
+			wantScans:    []string{"/library/sections/1/refresh /data/Movies"},
+		},
+		{
+			name:         "gives up after max attempts",
+			event:        completed("/mediastorage/Movies", "Film.2020.mkv"),
+			codes:        []int{500, 500, 500},
+			wantStatus:   refresh.StatusFailed,
+			wantAttempts: 3,
+			wantScans: []string{
+				"/library/sections/1/refresh /data/Movies",
+				"/library/sections/1/refresh /data/Movies",
+				"/library/sections/1/refresh /data/Movies",
+			},
+		},
+		{
+			name:       "category without a section",
+			event:      completed("/mediastorage/Music", "Album"),
+			wantStatus: refresh.StatusSkipped,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plex := &fakePlex{codes: tt.codes}
+			r := newRefresher(t, plex, "token")
+
+			got := r.Refresh(context.Background(), tt.event)
+			if got.Status != tt.wantStatus || got.Attempts != tt.wantAttempts {
+				t.Fatalf("got %s after %d attempts (%s), want %s after %d", got.Status, got.Attempts, got.Error, tt.wantStatus, tt.wantAttempts)
+			}
+			if !reflect.DeepEqual(plex.scans, tt.wantScans) {
+				t.Errorf("scans = %q, want %q", plex.scans, tt.wantScans)
+			}
+			if history := r.History(); len(history) != 1 || history[0].Status != tt.wantStatus {
+				t.Errorf("unexpected history %+v", history)
+			}
+		})
+	}
+}
+
+func TestRun_OnlyCompleted(t *testing.T) {
+	plex := &fakePlex{}
+	r := newRefresher(t, plex, "token")
+
+	ch := make(chan events.Event, 2)
+	ch <- events.New(events.Added, events.Torrent{ID: 1, DownloadDir: "/mediastorage/Movies"}, time.Now())
+	ch <- completed("/mediastorage/Movies", "Film.2020.mkv")
+	close(ch)
+	r.Run(context.Background(), ch)
+
+	if len(plex.scans) != 1 {
+		t.Fatalf("expected one scan, got %q", plex.scans)
+	}
+}
+
+func TestPing(t *testing.T) {
+	if err := newRefresher(t, &fakePlex{}, "token").Ping(context.Background()); err != nil {
+		t.Errorf("expected ping to succeed, got %v", err)
+	}
+	if err := newRefresher(t, &fakePlex{}, "wrong").Ping(context.Background()); err == nil {
+		t.Error("expected a bad token to fail")
+	}
+}
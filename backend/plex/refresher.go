@@ -0,0 +1,132 @@
+package plex
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hasmikatom/torrent/category"
+	"github.com/hasmikatom/torrent/events"
+	"github.com/hasmikatom/torrent/refresh"
+)
+
+// Refresh is one completed torrent and the scan it triggered
+type Refresh struct {
+	EventID   string `json:"eventId"`
+	TorrentID int    `json:"torrentId"`
+	Name      string `json:"name"`
+	Category  string `json:"category,omitempty"`
+	// Path is the folder as Plex sees it
+	Path     string `json:"path,omitempty"`
+	Sections []int  `json:"sections,omitempty"`
+	refresh.State
+}
+
+// Refresher scans the folder of every completed torrent in the Plex
+// sections mapped to its category
+type Refresher struct {
+	config *Config
+	client *Client
+	opts   refresh.Options
+	// categoryOf returns the category id a download directory belongs to
+	categoryOf func(dir string) (string, bool)
+
+	history *refresh.History[Refresh]
+	wg      sync.WaitGroup
+}
+
+// NewRefresher returns a refresher for the configured server
+func NewRefresher(config *Config, categoryOf func(dir string) (string, bool), opts refresh.Options) *Refresher {
+	return &Refresher{
+		config:     config,
+		client:     &Client{URL: config.URL, Token: config.Token, HTTP: &http.Client{Timeout: opts.Timeout}},
+		opts:       opts,
+		categoryOf: categoryOf,
+		history:    refresh.NewHistory(func(a, b Refresh) bool { return a.EventID == b.EventID }),
+	}
+}
+
+// Run refreshes completed, extracted and linked torrents until the channel
+// closes or ctx is cancelled, then waits for refreshes in flight
+func (r *Refresher) Run(ctx context.Context, ch <-chan events.Event) {
+	defer r.wg.Wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			if !refresh.Triggers(e) || !r.config.Enabled() {
+				continue
+			}
+			r.wg.Add(1)
+			go func() {
+				defer r.wg.Done()
+				r.Refresh(ctx, e)
+			}()
+		}
+	}
+}
+
+// Refresh scans a completed torrent's folder, retrying failures that may
+// go away, and returns the final state
+func (r *Refresher) Refresh(ctx context.Context, e events.Event) Refresh {
+	ref := Refresh{
+		EventID:   e.ID,
+		TorrentID: e.Torrent.ID,
+		Name:      e.Torrent.Name,
+		State:     refresh.Pending(time.Now()),
+	}
+
+	id, ok := r.categoryOf(e.Torrent.DownloadDir)
+	if ok {
+		ref.Category = id
+		ref.Sections = r.config.Sections[id]
+	}
+	if len(ref.Sections) == 0 {
+		ref.Status = refresh.StatusSkipped
+		ref.Error = "no Plex section is mapped to the torrent's category"
+		r.history.Record(ref)
+		return ref
+	}
+	ref.Path = category.MapPath(r.config.PathMappings, e.Torrent.Folder())
+	r.history.Record(ref)
+
+	// Sections that already scanned aren't asked again on retry
+	remaining := ref.Sections
+	scan := func() error {
+		var failed []int
+		var lastErr, retryErr error
+		for _, section := range remaining {
+			if err := r.client.RefreshPath(ctx, section, ref.Path); err != nil {
+				failed = append(failed, section)
+				lastErr = err
+				if refresh.Retryable(err) {
+					retryErr = err
+				}
+			}
+		}
+		remaining = failed
+		// One failure that may go away is enough to try the rest again
+		if retryErr != nil {
+			return retryErr
+		}
+		return lastErr
+	}
+	refresh.Retry(ctx, r.opts, r.config.MaxAttempts, &ref.State, scan, func() { r.history.Record(ref) })
+	return ref
+}
+
+// Ping checks the configured server
+func (r *Refresher) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx)
+}
+
+// History returns recent refreshes, newest first
+func (r *Refresher) History() []Refresh {
+	return r.history.List()
+}
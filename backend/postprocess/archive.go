@@ -0,0 +1,267 @@
+package postprocess
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hasmikatom/torrent/category"
+	"github.com/nwaples/rardecode/v2"
+)
+
+// ArchiveResult is what extracting one archive did
+type ArchiveResult struct {
+	Path string `json:"path"`
+	// Volumes lists the files of a multi-volume RAR archive
+	Volumes []string `json:"volumes,omitempty"`
+	// Files were written, Skipped were already there with the same size
+	Files   int    `json:"files"`
+	Skipped int    `json:"skipped,omitempty"`
+	Bytes   int64  `json:"bytes"`
+	Error   string `json:"error,omitempty"`
+}
+
+// rarPart matches the volume number of "name.part01.rar" style archives
+var rarPart = regexp.MustCompile(`(?i)\.part(\d+)\.rar$`)
+
+// IsArchive reports whether a file name is a ZIP archive or the first
+// volume of a RAR archive. Later volumes (.part02.rar, .r00, ...) are read
+// through the first one.
+func IsArchive(name string) bool {
+	lower := strings.ToLower(name)
+	switch filepath.Ext(lower) {
+	case ".zip":
+		return true
+	case ".rar":
+		if m := rarPart.FindStringSubmatch(lower); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			return n == 1
+		}
+		return true
+	}
+	return false
+}
+
+// FindArchives returns the archives in a torrent's content, which is either
+// its folder or its single file
+func FindArchives(root string) ([]string, error) {
+	var archives []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() && IsArchive(d.Name()) {
+			archives = append(archives, p)
+		}
+		return nil
+	})
+	sort.Strings(archives)
+	return archives, err
+}
+
+// UnpackedSize is the total size of the files in an archive
+func UnpackedSize(path string) (int64, error) {
+	var total int64
+	if isZip(path) {
+		zr, err := zip.OpenReader(path)
+		if err != nil {
+			return 0, err
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			total += int64(f.UncompressedSize64)
+		}
+		return total, nil
+	}
+
+	files, err := rardecode.List(path)
+	if err != nil {
+		return 0, err
+	}
+	for _, f := range files {
+		if !f.IsDir {
+			total += f.UnPackedSize
+		}
+	}
+	return total, nil
+}
+
+// Extract unpacks an archive into the folder it is in. Files that already
+// exist with the right size are left alone, so a failed job can be rerun.
+func Extract(ctx context.Context, path string) ArchiveResult {
+	var res ArchiveResult
+	var err error
+	if isZip(path) {
+		err = extractZip(ctx, path, &res)
+	} else {
+		err = extractRar(ctx, path, &res)
+	}
+	res.Path = path
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
+
+func isZip(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".zip")
+}
+
+func extractZip(ctx context.Context, path string, res *ArchiveResult) error {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	dest := filepath.Dir(path)
+	for _, f := range zr.File {
+		if f.Flags&0x1 != 0 {
+			return fmt.Errorf("%s is password protected", f.Name)
+		}
+		target, err := entryPath(dest, f.Name)
+		if err != nil {
+			return err
+		}
+		mode := f.Mode()
+		if mode.IsDir() {
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+			continue
+		}
+		if !mode.IsRegular() {
+			continue
+		}
+
+		if err := writeEntry(ctx, res, target, int64(f.UncompressedSize64), f.Modified, f.Open); err != nil {
+			return fmt.Errorf("%s: %v", f.Name, err)
+		}
+	}
+	return nil
+}
+
+func extractRar(ctx context.Context, path string, res *ArchiveResult) error {
+	rc, err := rardecode.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		rc.Close()
+		if volumes := rc.Volumes(); len(volumes) > 1 {
+			res.Volumes = volumes
+		}
+	}()
+
+	dest := filepath.Dir(path)
+	for {
+		h, err := rc.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if h.Encrypted {
+			return fmt.Errorf("%s is password protected", h.Name)
+		}
+		target, err := entryPath(dest, h.Name)
+		if err != nil {
+			return err
+		}
+		if h.IsDir {
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+			continue
+		}
+		if h.LinkType != 0 {
+			continue
+		}
+
+		open := func() (io.ReadCloser, error) { return io.NopCloser(&rc.Reader), nil }
+		if err := writeEntry(ctx, res, target, h.UnPackedSize, h.ModificationTime, open); err != nil {
+			return fmt.Errorf("%s: %v", h.Name, err)
+		}
+	}
+}
+
+// entryPath resolves an archive member below dest, refusing names that
+// would escape it
+func entryPath(dest, name string) (string, error) {
+	name = strings.ReplaceAll(name, `\`, "/")
+	if name == "" || strings.HasPrefix(name, "/") {
+		return "", fmt.Errorf("unsafe path %q in archive", name)
+	}
+	target := filepath.Join(dest, filepath.FromSlash(name))
+	if target == dest || !category.Within(dest, target) {
+		return "", fmt.Errorf("unsafe path %q in archive", name)
+	}
+	return target, nil
+}
+
+// writeEntry writes one file through a temporary name so an interrupted
+// extraction never leaves a truncated file that looks finished
+func writeEntry(ctx context.Context, res *ArchiveResult, target string, size int64, modified time.Time, open func() (io.ReadCloser, error)) error {
+	if info, err := os.Stat(target); err == nil && info.Mode().IsRegular() && info.Size() == size {
+		res.Skipped++
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+
+	r, err := open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	tmp := target + ".extracting"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, &contextReader{ctx: ctx, r: r})
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if !modified.IsZero() {
+		os.Chtimes(tmp, modified, modified)
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	res.Files++
+	res.Bytes += n
+	return nil
+}
+
+// contextReader stops a copy once its context is cancelled
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
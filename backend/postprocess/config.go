@@ -0,0 +1,70 @@
+package postprocess
+
+import (
+	"log"
+	"sync"
+
+	"github.com/hasmikatom/torrent/configfile"
+)
+
+// defaultReserve is the free space kept after extraction when the config doesn't say
+const defaultReserve = configfile.ByteSize(1 << 30)
+
+// Config is the contents of config/postprocess.json
+type Config struct {
+	// Extract unpacks archives when torrents complete; on unless set to false
+	Extract *bool `json:"extract,omitempty"`
+	// Categories limits extraction to these category ids; empty means all
+	Categories []string `json:"categories,omitempty"`
+	// ReserveSpace is left free on the disk after extracting; jobs that
+	// would eat into it fail instead
+	ReserveSpace *configfile.ByteSize `json:"reserveSpace,omitempty"`
+}
+
+var (
+	postprocessConfig     *Config
+	postprocessConfigOnce sync.Once
+)
+
+// LoadConfig reads config/postprocess.json once. Without it archives are
+// extracted in every category, keeping 1 GiB free.
+func LoadConfig() *Config {
+	postprocessConfigOnce.Do(func() {
+		var config Config
+		path, err := configfile.Load("postprocess.json", &config)
+		if err != nil {
+			log.Printf("Warning: %v, using default post-processing settings", err)
+		} else {
+			log.Printf("Loaded post-processing config from: %s", path)
+		}
+		postprocessConfig = &config
+	})
+
+	return postprocessConfig
+}
+
+// ExtractEnabled reports whether completed torrents are extracted
+func (c *Config) ExtractEnabled() bool {
+	return c.Extract == nil || *c.Extract
+}
+
+// Covers reports whether a category's torrents are post-processed
+func (c *Config) Covers(categoryID string) bool {
+	if len(c.Categories) == 0 {
+		return true
+	}
+	for _, id := range c.Categories {
+		if id == categoryID {
+			return true
+		}
+	}
+	return false
+}
+
+// Reserve is the free space to keep in bytes
+func (c *Config) Reserve() int64 {
+	if c.ReserveSpace == nil {
+		return int64(defaultReserve)
+	}
+	return int64(*c.ReserveSpace)
+}
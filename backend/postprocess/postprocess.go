@@ -0,0 +1,331 @@
+// Package postprocess runs jobs on torrents once they complete. For now
+// that means extracting ZIP and RAR archives next to the originals, which
+// stay in place so the torrent keeps seeding.
+package postprocess
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hasmikatom/torrent/configfile"
+	"github.com/hasmikatom/torrent/disk"
+	"github.com/hasmikatom/torrent/events"
+	"github.com/hasmikatom/torrent/store"
+)
+
+// Job states
+const (
+	StatusQueued  = "queued"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+	// StatusSkipped means the torrent had no archives
+	StatusSkipped = "skipped"
+)
+
+// maxJobs bounds the job history; the oldest jobs go first
+const maxJobs = 200
+
+// queueSize is how many jobs can wait for the worker
+const queueSize = 100
+
+// Job is the post-processing of one torrent
+type Job struct {
+	ID        string `json:"id"`
+	TorrentID int    `json:"torrentId"`
+	Hash      string `json:"hash"`
+	Name      string `json:"name"`
+	// Path is the torrent's folder or single file
+	Path     string          `json:"path"`
+	Status   string          `json:"status"`
+	Archives []ArchiveResult `json:"archives"`
+	// RequiredBytes is what the archives unpack to, AvailableBytes the free
+	// space found before extracting
+	RequiredBytes  int64  `json:"requiredBytes,omitempty"`
+	AvailableBytes int64  `json:"availableBytes,omitempty"`
+	Error          string `json:"error,omitempty"`
+
+	CreatedAt  time.Time  `json:"createdAt"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+
+	torrent events.Torrent
+}
+
+// Processor queues completed torrents and extracts them one at a time
+type Processor struct {
+	config *Config
+	bus    *events.Bus
+	// categoryOf returns the category id a download directory belongs to
+	categoryOf func(dir string) (string, bool)
+	// free reports the available bytes on the disk holding a path
+	free func(path string) (uint64, error)
+
+	queue chan string
+	file  *store.JSONFile
+
+	mu   sync.Mutex
+	jobs []Job
+}
+
+// NewProcessor loads the job history from dataDir. Jobs that were queued
+// or running when the backend stopped are marked failed and can be rerun.
+func NewProcessor(config *Config, dataDir string, bus *events.Bus, categoryOf func(dir string) (string, bool)) (*Processor, error) {
+	p := &Processor{
+		config:     config,
+		bus:        bus,
+		categoryOf: categoryOf,
+		free:       disk.Free,
+		queue:      make(chan string, queueSize),
+		file:       store.NewJSONFile(dataDir, "postprocess-jobs.json"),
+	}
+	if err := p.file.Load(&p.jobs); err != nil {
+		return nil, err
+	}
+
+	interrupted := false
+	for i := range p.jobs {
+		if p.jobs[i].Status == StatusQueued || p.jobs[i].Status == StatusRunning {
+			p.jobs[i].Status = StatusFailed
+			p.jobs[i].Error = "interrupted by restart"
+			interrupted = true
+		}
+	}
+	if interrupted {
+		p.save()
+	}
+	return p, nil
+}
+
+// Run queues completed torrents until the channel closes or ctx is
+// cancelled, working through the queue in the background
+func (p *Processor) Run(ctx context.Context, ch <-chan events.Event) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		p.work(ctx)
+	}()
+	defer wg.Wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			if e.Type != events.Completed || !p.config.ExtractEnabled() {
+				continue
+			}
+			if id, ok := p.categoryOf(e.Torrent.DownloadDir); !ok || !p.config.Covers(id) {
+				continue
+			}
+			if _, err := p.Enqueue(e.Torrent); err != nil {
+				log.Printf("Failed to queue post-processing for torrent %d: %v", e.Torrent.ID, err)
+			}
+		}
+	}
+}
+
+func (p *Processor) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-p.queue:
+			job, ok := p.Job(id)
+			if !ok {
+				continue
+			}
+			p.Process(ctx, job)
+		}
+	}
+}
+
+// Enqueue adds a job for a torrent unless one is already waiting or running
+func (p *Processor) Enqueue(t events.Torrent) (Job, error) {
+	p.mu.Lock()
+	for _, j := range p.jobs {
+		if j.Hash == t.Hash && (j.Status == StatusQueued || j.Status == StatusRunning) {
+			p.mu.Unlock()
+			return j, fmt.Errorf("torrent %d is already being post-processed", t.ID)
+		}
+	}
+
+	job := Job{
+		ID:        events.NewID(),
+		TorrentID: t.ID,
+		Hash:      t.Hash,
+		Name:      t.Name,
+		Path:      filepath.Join(t.DownloadDir, t.Name),
+		Status:    StatusQueued,
+		Archives:  []ArchiveResult{},
+		CreatedAt: time.Now(),
+		torrent:   t,
+	}
+	p.recordLocked(job)
+	p.mu.Unlock()
+
+	select {
+	case p.queue <- job.ID:
+		return job, nil
+	default:
+		job.Status = StatusFailed
+		job.Error = "post-processing queue is full"
+		p.record(job)
+		return job, fmt.Errorf("post-processing queue is full")
+	}
+}
+
+// Process extracts every archive of a job's torrent and returns the
+// finished job
+func (p *Processor) Process(ctx context.Context, job Job) Job {
+	now := time.Now()
+	job.Status = StatusRunning
+	job.StartedAt = &now
+	p.record(job)
+
+	job = p.extract(ctx, job)
+
+	finished := time.Now()
+	job.FinishedAt = &finished
+	p.record(job)
+
+	if job.Status == StatusDone && p.bus != nil {
+		extracted := 0
+		for _, a := range job.Archives {
+			extracted += a.Files
+		}
+		if extracted > 0 {
+			p.bus.Publish(events.New(events.Extracted, job.torrent, finished))
+		}
+	}
+	return job
+}
+
+func (p *Processor) extract(ctx context.Context, job Job) Job {
+	if _, err := os.Stat(job.Path); err != nil {
+		return failed(job, fmt.Sprintf("torrent data not found: %v", err))
+	}
+
+	archives, err := FindArchives(job.Path)
+	if err != nil {
+		return failed(job, fmt.Sprintf("failed to look for archives: %v", err))
+	}
+	if len(archives) == 0 {
+		job.Status = StatusSkipped
+		return job
+	}
+
+	job.RequiredBytes = 0
+	for _, a := range archives {
+		size, err := UnpackedSize(a)
+		if err != nil {
+			return failed(job, fmt.Sprintf("failed to read %s: %v", filepath.Base(a), err))
+		}
+		job.RequiredBytes += size
+	}
+
+	free, err := p.free(filepath.Dir(archives[0]))
+	if err != nil {
+		return failed(job, fmt.Sprintf("failed to check free space: %v", err))
+	}
+	job.AvailableBytes = int64(free)
+	if job.AvailableBytes-p.config.Reserve() < job.RequiredBytes {
+		return failed(job, fmt.Sprintf("not enough disk space: archives unpack to %s, %s free with %s kept in reserve",
+			configfile.FormatByteSize(job.RequiredBytes), configfile.FormatByteSize(job.AvailableBytes), configfile.FormatByteSize(p.config.Reserve())))
+	}
+
+	job.Archives = make([]ArchiveResult, 0, len(archives))
+	failures := 0
+	for _, a := range archives {
+		res := Extract(ctx, a)
+		if res.Error != "" {
+			failures++
+			log.Printf("Failed to extract %s for torrent %d: %s", a, job.TorrentID, res.Error)
+		}
+		job.Archives = append(job.Archives, res)
+		p.record(job)
+
+		if ctx.Err() != nil {
+			return failed(job, "cancelled")
+		}
+	}
+
+	if failures > 0 {
+		return failed(job, fmt.Sprintf("%d of %d archives failed to extract", failures, len(archives)))
+	}
+	job.Status = StatusDone
+	return job
+}
+
+func failed(job Job, reason string) Job {
+	job.Status = StatusFailed
+	job.Error = reason
+	return job
+}
+
+// Job returns a job by id
+func (p *Processor) Job(id string) (Job, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, j := range p.jobs {
+		if j.ID == id {
+			return j, true
+		}
+	}
+	return Job{}, false
+}
+
+// Jobs returns jobs newest first, optionally only those of one torrent
+// (torrentID > 0) or in one status
+func (p *Processor) Jobs(torrentID int, status string) []Job {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	list := make([]Job, 0)
+	for i := len(p.jobs) - 1; i >= 0; i-- {
+		j := p.jobs[i]
+		if (torrentID > 0 && j.TorrentID != torrentID) || (status != "" && j.Status != status) {
+			continue
+		}
+		list = append(list, j)
+	}
+	return list
+}
+
+func (p *Processor) record(job Job) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.recordLocked(job)
+}
+
+func (p *Processor) recordLocked(job Job) {
+	for i := range p.jobs {
+		if p.jobs[i].ID == job.ID {
+			p.jobs[i] = job
+			p.save()
+			return
+		}
+	}
+
+	p.jobs = append(p.jobs, job)
+	if len(p.jobs) > maxJobs {
+		p.jobs = p.jobs[len(p.jobs)-maxJobs:]
+	}
+	p.save()
+}
+
+func (p *Processor) save() {
+	if err := p.file.Save(p.jobs); err != nil {
+		log.Printf("Failed to save post-processing jobs: %v", err)
+	}
+}
@@ -0,0 +1,337 @@
+package postprocess
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hasmikatom/torrent/configfile"
+	"github.com/hasmikatom/torrent/events"
+)
+
+// vint encodes a RAR5 variable length integer
+func vint(n uint64) []byte {
+	var b []byte
+	for n >= 0x80 {
+		b = append(b, byte(n)|0x80)
+		n >>= 7
+	}
+	return append(b, byte(n))
+}
+
+// rarBlock builds a RAR5 block header followed by its data
+func rarBlock(htype, flags uint64, fields, data []byte) []byte {
+	body := append(vint(htype), vint(flags)...)
+	if flags&0x0002 != 0 {
+		body = append(body, vint(uint64(len(data)))...)
+	}
+	body = append(body, fields...)
+	header := append(vint(uint64(len(body))), body...)
+
+	var out bytes.Buffer
+	binary.Write(&out, binary.LittleEndian, crc32.ChecksumIEEE(header))
+	out.Write(header)
+	out.Write(data)
+	return out.Bytes()
+}
+
+// writeRar writes a stored (uncompressed) RAR5 archive holding one file,
+// split into volumes name.part1.rar, name.part2.rar... of chunk bytes each
+// when chunk is smaller than the content
+func writeRar(t *testing.T, dir, base, member string, content []byte, chunk int) {
+	t.Helper()
+	var parts [][]byte
+	for rest := content; ; rest = rest[min(chunk, len(rest)):] {
+		parts = append(parts, rest[:min(chunk, len(rest))])
+		if len(rest) <= chunk {
+			break
+		}
+	}
+
+	sum := make([]byte, 4)
+	binary.LittleEndian.PutUint32(sum, crc32.ChecksumIEEE(content))
+	for i, part := range parts {
+		multi := len(parts) > 1
+		var buf bytes.Buffer
+		buf.Write([]byte{0x52, 0x61, 0x72, 0x21, 0x1A, 0x07, 0x01, 0x00})
+
+		arcFlags := uint64(0)
+		if multi {
+			arcFlags |= 0x0001
+		}
+		arcFields := vint(arcFlags)
+		if i > 0 {
+			arcFields = append(vint(arcFlags|0x0002), vint(uint64(i))...)
+		}
+		buf.Write(rarBlock(1, 0, arcFields, nil))
+
+		blockFlags := uint64(0x0002)
+		if i > 0 {
+			blockFlags |= 0x0008
+		}
+		if i < len(parts)-1 {
+			blockFlags |= 0x0010
+		}
+		var file []byte
+		file = append(file, vint(0x0004)...) // CRC32 present
+		file = append(file, vint(uint64(len(content)))...)
+		file = append(file, vint(0o644)...)
+		file = append(file, sum...)
+		file = append(file, vint(0)...) // stored
+		file = append(file, vint(1)...) // unix
+		file = append(file, vint(uint64(len(member)))...)
+		file = append(file, member...)
+		buf.Write(rarBlock(2, blockFlags, file, part))
+
+		endFlags := uint64(0)
+		if i < len(parts)-1 {
+			endFlags = 1
+		}
+		buf.Write(rarBlock(5, 0, vint(endFlags), nil))
+
+		name := base + ".rar"
+		if multi {
+			name = fmt.Sprintf("%s.part%d.rar", base, i+1)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func writeZip(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestIsArchive(t *testing.T) {
+	cases := map[string]bool{
+		"movie.zip":            true,
+		"movie.rar":            true,
+		"Movie.2020.part1.rar": true,
+		"movie.part01.rar":     true,
+		"movie.part02.rar":     false,
+		"movie.part10.rar":     false,
+		"movie.r00":            false,
+		"movie.mkv":            false,
+		"MOVIE.RAR":            true,
+	}
+	for name, want := range cases {
+		if got := IsArchive(name); got != want {
+			t.Errorf("IsArchive(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestExtract_MultiVolumeRar(t *testing.T) {
+	dir := t.TempDir()
+	content := []byte(strings.Repeat("movie data ", 100))
+	writeRar(t, dir, "Movie.2020.1080p", "Movie.2020.1080p.mkv", content, 300)
+
+	archives, err := FindArchives(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archives) != 1 || filepath.Base(archives[0]) != "Movie.2020.1080p.part1.rar" {
+		t.Fatalf("expected only the first volume, got %q", archives)
+	}
+
+	size, err := UnpackedSize(archives[0])
+	if err != nil || size != int64(len(content)) {
+		t.Fatalf("UnpackedSize = %d, %v", size, err)
+	}
+
+	res := Extract(context.Background(), archives[0])
+	if res.Error != "" || res.Files != 1 || res.Bytes != int64(len(content)) || len(res.Volumes) != 4 {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	if got := readFile(t, filepath.Join(dir, "Movie.2020.1080p.mkv")); got != string(content) {
+		t.Fatalf("extracted content differs")
+	}
+
+	// A rerun leaves the extracted file alone
+	if res := Extract(context.Background(), archives[0]); res.Files != 0 || res.Skipped != 1 {
+		t.Fatalf("expected the file to be skipped, got %+v", res)
+	}
+}
+
+func TestExtract_Zip(t *testing.T) {
+	dir := t.TempDir()
+	writeZip(t, filepath.Join(dir, "album.zip"), map[string]string{
+		"Album/01 - Intro.flac": "intro",
+		"Album/02 - Song.flac":  "song",
+	})
+
+	res := Extract(context.Background(), filepath.Join(dir, "album.zip"))
+	if res.Error != "" || res.Files != 2 {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	if got := readFile(t, filepath.Join(dir, "Album", "02 - Song.flac")); got != "song" {
+		t.Fatalf("unexpected content %q", got)
+	}
+}
+
+func TestExtract_RefusesEscapingPaths(t *testing.T) {
+	dir := t.TempDir()
+	inner := filepath.Join(dir, "torrent")
+	os.Mkdir(inner, 0o755)
+	writeZip(t, filepath.Join(inner, "evil.zip"), map[string]string{"../../escaped.txt": "x"})
+
+	res := Extract(context.Background(), filepath.Join(inner, "evil.zip"))
+	if res.Error == "" || !strings.Contains(res.Error, "unsafe path") {
+		t.Fatalf("expected an unsafe path error, got %+v", res)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escaped.txt")); err == nil {
+		t.Fatal("file escaped the torrent folder")
+	}
+}
+
+func newProcessor(t *testing.T, free uint64) (*Processor, <-chan events.Event) {
+	t.Helper()
+	bus := events.NewBus()
+	ch := bus.Subscribe("test", 10)
+	reserve := configfile.ByteSize(100)
+	p, err := NewProcessor(&Config{ReserveSpace: &reserve}, t.TempDir(), bus, func(string) (string, bool) { return "Movies", true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.free = func(string) (uint64, error) { return free, nil }
+	return p, ch
+}
+
+func TestProcess(t *testing.T) {
+	downloads := t.TempDir()
+	folder := filepath.Join(downloads, "Movie.2020.1080p")
+	os.Mkdir(folder, 0o755)
+	content := []byte(strings.Repeat("x", 1000))
+	writeRar(t, folder, "movie", "movie.mkv", content, 400)
+	torrent := events.Torrent{ID: 3, Hash: "abc", Name: "Movie.2020.1080p", DownloadDir: downloads}
+
+	t.Run("not enough space", func(t *testing.T) {
+		p, ch := newProcessor(t, 1050)
+		job, err := p.Enqueue(torrent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		job = p.Process(context.Background(), job)
+		if job.Status != StatusFailed || !strings.Contains(job.Error, "not enough disk space") || job.RequiredBytes != 1000 {
+			t.Fatalf("unexpected job %+v", job)
+		}
+		if len(ch) != 0 {
+			t.Fatal("no event expected for a failed job")
+		}
+	})
+
+	t.Run("extracts and announces", func(t *testing.T) {
+		p, ch := newProcessor(t, 1<<20)
+		job, err := p.Enqueue(torrent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := p.Enqueue(torrent); err == nil {
+			t.Fatal("expected a second job for the same torrent to be refused")
+		}
+
+		job = p.Process(context.Background(), job)
+		if job.Status != StatusDone || len(job.Archives) != 1 || job.Archives[0].Files != 1 {
+			t.Fatalf("unexpected job %+v", job)
+		}
+		if e := <-ch; e.Type != events.Extracted || e.Torrent.ID != 3 {
+			t.Fatalf("unexpected event %+v", e)
+		}
+		if jobs := p.Jobs(3, StatusDone); len(jobs) != 1 || jobs[0].FinishedAt == nil {
+			t.Fatalf("unexpected jobs %+v", jobs)
+		}
+	})
+
+	t.Run("nothing to extract", func(t *testing.T) {
+		p, _ := newProcessor(t, 1<<20)
+		plain := filepath.Join(downloads, "plain.mkv")
+		os.WriteFile(plain, []byte("x"), 0o644)
+		job, _ := p.Enqueue(events.Torrent{ID: 4, Hash: "def", Name: "plain.mkv", DownloadDir: downloads})
+		if job = p.Process(context.Background(), job); job.Status != StatusSkipped {
+			t.Fatalf("unexpected job %+v", job)
+		}
+	})
+}
+
+func TestNewProcessor_FailsInterruptedJobs(t *testing.T) {
+	dir := t.TempDir()
+	p, err := NewProcessor(&Config{}, dir, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, _ := p.Enqueue(events.Torrent{ID: 1, Hash: "abc", Name: "x", DownloadDir: dir})
+
+	p, err = NewProcessor(&Config{}, dir, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := p.Job(job.ID); got.Status != StatusFailed || got.Error != "interrupted by restart" {
+		t.Fatalf("unexpected job %+v", got)
+	}
+}
+
+func TestRun_QueuesCompleted(t *testing.T) {
+	downloads := t.TempDir()
+	writeZip(t, filepath.Join(downloads, "pack.zip"), map[string]string{"a.txt": "a"})
+	p, ch := newProcessor(t, 1<<20)
+
+	in := make(chan events.Event, 2)
+	in <- events.New(events.Added, events.Torrent{ID: 1, Hash: "a", Name: "pack.zip", DownloadDir: downloads}, time.Now())
+	in <- events.New(events.Completed, events.Torrent{ID: 1, Hash: "a", Name: "pack.zip", DownloadDir: downloads}, time.Now())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.Run(ctx, in)
+		close(done)
+	}()
+
+	select {
+	case e := <-ch:
+		if e.Type != events.Extracted {
+			t.Fatalf("unexpected event %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("torrent was not extracted")
+	}
+	cancel()
+	<-done
+
+	if got := readFile(t, filepath.Join(downloads, "a.txt")); got != "a" {
+		t.Fatalf("unexpected content %q", got)
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hasmikatom/torrent/category"
+	"github.com/hasmikatom/torrent/disk"
+	"github.com/hasmikatom/torrent/library"
+	"github.com/hasmikatom/torrent/quota"
+	"github.com/hasmikatom/torrent/transmission"
+)
+
+// addedTorrent is the part of a torrent-add reply the handlers care about
+type addedTorrent struct {
+	ID        int
+	Name      string
+	Hash      string
+	Duplicate bool
+	// Queued is set when the torrent waits for disk space instead of starting
+	Queued bool
+}
+
+// addTorrent sends torrent-add and returns the added (or already existing) torrent
+func addTorrent(args map[string]interface{}) (addedTorrent, error) {
+	result, err := client.SendRequest("torrent-add", args)
+	if err != nil {
+		return addedTorrent{}, err
+	}
+
+	if result.Result != "success" {
+		return addedTorrent{}, errors.New("Failed to add torrent")
+	}
+
+	var torrentInfo map[string]interface{}
+	duplicate := false
+	if added, ok := result.Arguments["torrent-added"].(map[string]interface{}); ok {
+		torrentInfo = added
+	} else if dup, ok := result.Arguments["torrent-duplicate"].(map[string]interface{}); ok {
+		torrentInfo = dup
+		duplicate = true
+	}
+
+	if torrentInfo == nil {
+		return addedTorrent{}, errors.New("Failed to get torrent info")
+	}
+
+	id, ok := GetInt(torrentInfo, "id")
+	if !ok {
+		return addedTorrent{}, errors.New("Failed to get torrent ID")
+	}
+
+	name, _ := GetString(torrentInfo, "name")
+	hash, _ := GetString(torrentInfo, "hashString")
+
+	return addedTorrent{
+		ID:        id,
+		Name:      name,
+		Hash:      hash,
+		Duplicate: duplicate,
+	}, nil
+}
+
+// currentUser returns the caller as identified by middleware.RequireUser
+func currentUser(gc *gin.Context) quota.User {
+	return quota.User{
+		ID:    gc.GetString("userId"),
+		Email: gc.GetString("userEmail"),
+		Role:  gc.GetString("userRole"),
+	}
+}
+
+// torrentSize returns the bytes a torrent will download, or 0 if its
+// metadata is not known yet
+func torrentSize(t transmission.Torrent) int64 {
+	if t.SizeWhenDone > 0 {
+		return t.SizeWhenDone
+	}
+	return t.TotalSize
+}
+
+// quotaState refreshes the user's torrents from the daemon and returns their
+// limits and current usage. Sizes of magnets whose metadata arrived since the
+// last check are filled in here, and torrents that turn out to be over the
+// single torrent size limit are stopped.
+func quotaState(u quota.User) (quota.Limits, quota.Usage, error) {
+	limits := quota.LoadConfig().LimitsFor(u)
+	now := time.Now()
+
+	entries := quotaLedger.Owned(u.ID)
+	if len(entries) == 0 {
+		return limits, quota.Usage{}, nil
+	}
+
+	hashes := make([]string, 0, len(entries))
+	known := make(map[string]quota.Entry, len(entries))
+	for _, e := range entries {
+		hashes = append(hashes, e.Hash)
+		known[strings.ToLower(e.Hash)] = e
+	}
+
+	torrents, err := client.GetTorrents(hashes, []string{"id", "hashString", "status", "totalSize", "sizeWhenDone"})
+	if err != nil {
+		return limits, quota.Usage{}, fmt.Errorf("failed to get torrents: %v", err)
+	}
+
+	live := make(map[string]bool, len(torrents))
+	active := make(map[string]bool, len(torrents))
+	for _, t := range torrents {
+		key := strings.ToLower(t.HashString)
+		live[key] = true
+		if t.Status != transmission.StatusStopped {
+			active[key] = true
+		}
+
+		size := torrentSize(t)
+		if size <= 0 {
+			continue
+		}
+
+		e := known[key]
+		if e.StartedAt != nil && e.Bytes == 0 && limits.MaxTorrentSize > 0 && size > limits.MaxTorrentSize {
+			log.Printf("Stopping torrent %d: %d bytes is over %s's size limit", t.ID, size, u.Email)
+			if _, err := client.SendRequest("torrent-stop", map[string]interface{}{"ids": []int{t.ID}}); err == nil {
+				delete(active, key)
+			}
+		}
+		quotaLedger.SetBytes(t.HashString, size)
+	}
+
+	quotaLedger.Prune(u.ID, live, now)
+
+	return limits, quota.UsageOf(quotaLedger.Owned(u.ID), active, now), nil
+}
+
+// checkQuota verifies that the user may start `starting` more torrents of size bytes
+func checkQuota(u quota.User, size int64, starting int) error {
+	limits, usage, err := quotaState(u)
+	if err != nil {
+		return err
+	}
+	return quota.Check(limits, usage, size, starting)
+}
+
+// respondQuotaError writes a 403 for quota errors and reports whether it did
+func respondQuotaError(gc *gin.Context, err error) bool {
+	var exceeded *quota.ExceededError
+	if !errors.As(err, &exceeded) {
+		return false
+	}
+
+	gc.JSON(http.StatusForbidden, gin.H{
+		"error":     exceeded.Error(),
+		"quota":     exceeded.Quota,
+		"limit":     exceeded.Limit,
+		"current":   exceeded.Current,
+		"requested": exceeded.Requested,
+	})
+	return true
+}
+
+// fetchTorrent returns a single torrent with the given fields
+func fetchTorrent(id int, fields []string) (transmission.Torrent, error) {
+	torrents, err := client.GetTorrents([]int{id}, fields)
+	if err != nil {
+		return transmission.Torrent{}, err
+	}
+	if len(torrents) == 0 {
+		return transmission.Torrent{}, fmt.Errorf("torrent %d not found", id)
+	}
+	return torrents[0], nil
+}
+
+// removeTorrent removes a torrent together with whatever it downloaded
+func removeTorrent(id int) {
+	args := map[string]interface{}{
+		"ids":               []int{id},
+		"delete-local-data": true,
+	}
+	if _, err := client.SendRequest("torrent-remove", args); err != nil {
+		log.Printf("Failed to remove torrent %d: %v", id, err)
+	}
+}
+
+// addTorrentForUser adds and starts a torrent in a category on behalf of a
+// user. The torrent is added paused so its size can be checked against the
+// quota and free disk space and its directory worked out from its name before
+// it starts; magnets without metadata yet are only checked for the active
+// count, and for space once their metadata arrives.
+func addTorrentForUser(u quota.User, cat category.Category, fields category.Fields, args map[string]interface{}) (addedTorrent, error) {
+	if err := rootPlacer.Ready(cat); err != nil {
+		return addedTorrent{}, err
+	}
+	if err := checkQuota(u, 0, 1); err != nil {
+		return addedTorrent{}, err
+	}
+
+	args["paused"] = true
+	args["download-dir"] = cat.Root
+	added, err := addTorrent(args)
+	if err != nil {
+		return addedTorrent{}, err
+	}
+
+	if added.Duplicate {
+		return addedTorrent{}, errors.New("Torrent already exists")
+	}
+
+	quotaLedger.Track(quota.Entry{
+		Hash:      added.Hash,
+		TorrentID: added.ID,
+		UserID:    u.ID,
+		Name:      added.Name,
+	})
+
+	var size int64
+	name := added.Name
+	if t, err := fetchTorrent(added.ID, []string{"id", "name", "totalSize", "sizeWhenDone"}); err == nil {
+		size = torrentSize(t)
+		name = t.Name
+	}
+
+	if size > 0 {
+		if err := checkQuota(u, size, 1); err != nil {
+			removeTorrent(added.ID)
+			quotaLedger.Forget(added.Hash)
+			return addedTorrent{}, err
+		}
+	}
+
+	// A magnet without a display name is named after its hash, which says nothing
+	if name != "" && !strings.EqualFold(name, added.Hash) {
+		fields = fields.Merge(category.GuessFields(name))
+	}
+	dir, staged, err := placeTorrent(cat, fields, library.Entry{Hash: added.Hash, TorrentID: added.ID, Name: name}, size)
+	if err != nil {
+		removeTorrent(added.ID)
+		quotaLedger.Forget(added.Hash)
+		return addedTorrent{}, err
+	}
+	// Staging can live on another disk than the category, and the pool's
+	// roots on other disks than the primary one
+	if root, ok := cat.RootOf(dir); !ok || root != cat.Root {
+		if err := mountChecker.Ready(dir); err != nil {
+			removeTorrent(added.ID)
+			quotaLedger.Forget(added.Hash)
+			return addedTorrent{}, err
+		}
+	}
+	if dir != cat.Root || staged {
+		if err := setTorrentLocation(added.ID, dir); err != nil {
+			log.Printf("Failed to set location for torrent %d: %v", added.ID, err)
+		}
+	}
+	applySeedingPolicy(added.ID, cat)
+
+	if err := checkSpace(dir, size, added.Hash); err != nil {
+		if !spaceGuard.Config().Queue() {
+			removeTorrent(added.ID)
+			quotaLedger.Forget(added.Hash)
+			return addedTorrent{}, err
+		}
+		spaceQueue.Add(disk.Queued{
+			TorrentID: added.ID,
+			Hash:      added.Hash,
+			Name:      name,
+			Dir:       dir,
+			Size:      size,
+			UserID:    u.ID,
+			Reason:    err.Error(),
+		})
+		added.Queued = true
+		return added, nil
+	}
+
+	if err := startTorrent(added.ID); err != nil {
+		removeTorrent(added.ID)
+		quotaLedger.Forget(added.Hash)
+		return addedTorrent{}, err
+	}
+	quotaLedger.Start(added.Hash, size, time.Now())
+
+	return added, nil
+}
+
+// setTorrentLocation points a torrent at a new directory without moving data
+func setTorrentLocation(id int, dir string) error {
+	args := map[string]interface{}{
+		"ids":      []int{id},
+		"location": dir,
+		"move":     false,
+	}
+	_, err := client.SendRequest("torrent-set-location", args)
+	return err
+}
+
+// startTorrent sends torrent-start for a single torrent
+func startTorrent(id int) error {
+	result, err := client.SendRequest("torrent-start", map[string]interface{}{"ids": []int{id}})
+	if err != nil {
+		return err
+	}
+	if result.Result != "success" {
+		return errors.New(result.Result)
+	}
+	return nil
+}
+
+// getQuotaUsage returns the caller's limits and usage. Admins may pass
+// ?userId= to look at someone else.
+func getQuotaUsage(gc *gin.Context) {
+	u := currentUser(gc)
+	if other := gc.Query("userId"); other != "" && other != u.ID {
+		if u.Role != "admin" {
+			gc.JSON(http.StatusForbidden, gin.H{"error": "Only admins can view other users' usage"})
+			return
+		}
+		u = quota.User{ID: other, Email: gc.Query("email"), Role: gc.Query("role")}
+	}
+
+	limits, usage, err := quotaState(u)
+	if err != nil {
+		gc.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	gc.JSON(http.StatusOK, gin.H{
+		"userId": u.ID,
+		"limits": limits,
+		"usage":  usage,
+	})
+}
@@ -0,0 +1,97 @@
+package quota
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/hasmikatom/torrent/configfile"
+)
+
+// Limits are the effective quotas for one user. A zero value means unlimited.
+type Limits struct {
+	MaxActiveTorrents int   `json:"maxActiveTorrents"`
+	MaxBytesPerDay    int64 `json:"maxBytesPerDay"`
+	MaxBytesPerMonth  int64 `json:"maxBytesPerMonth"`
+	MaxTorrentSize    int64 `json:"maxTorrentSize"`
+}
+
+// LimitsConfig is one entry of quotas.json. Fields left out inherit from the
+// less specific level (default -> role -> user).
+type LimitsConfig struct {
+	MaxActiveTorrents *int                 `json:"maxActiveTorrents"`
+	MaxBytesPerDay    *configfile.ByteSize `json:"maxBytesPerDay"`
+	MaxBytesPerMonth  *configfile.ByteSize `json:"maxBytesPerMonth"`
+	MaxTorrentSize    *configfile.ByteSize `json:"maxTorrentSize"`
+}
+
+// Config is the contents of config/quotas.json
+type Config struct {
+	Default LimitsConfig            `json:"default"`
+	Roles   map[string]LimitsConfig `json:"roles"`
+	// Users is keyed by user id or email
+	Users map[string]LimitsConfig `json:"users"`
+}
+
+// User identifies who a quota applies to, as set by middleware.RequireUser
+type User struct {
+	ID    string `json:"id"`
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+var (
+	quotaConfig     *Config
+	quotaConfigOnce sync.Once
+)
+
+// LoadConfig reads config/quotas.json once. Without a config file nobody is limited.
+func LoadConfig() *Config {
+	quotaConfigOnce.Do(func() {
+		var config Config
+		path, err := configfile.Load("quotas.json", &config)
+		if err != nil {
+			log.Printf("Warning: %v, quotas disabled", err)
+			quotaConfig = &Config{}
+			return
+		}
+		log.Printf("Loaded quota config from: %s", path)
+		quotaConfig = &config
+	})
+
+	return quotaConfig
+}
+
+// LimitsFor resolves the limits for a user by layering the default, role and
+// user specific entries
+func (c *Config) LimitsFor(u User) Limits {
+	var limits Limits
+	apply(&limits, c.Default)
+
+	if rc, ok := c.Roles[u.Role]; ok {
+		apply(&limits, rc)
+	}
+
+	for key, uc := range c.Users {
+		if key == u.ID || (u.Email != "" && strings.EqualFold(key, u.Email)) {
+			apply(&limits, uc)
+		}
+	}
+
+	return limits
+}
+
+func apply(l *Limits, lc LimitsConfig) {
+	if lc.MaxActiveTorrents != nil {
+		l.MaxActiveTorrents = *lc.MaxActiveTorrents
+	}
+	if lc.MaxBytesPerDay != nil {
+		l.MaxBytesPerDay = int64(*lc.MaxBytesPerDay)
+	}
+	if lc.MaxBytesPerMonth != nil {
+		l.MaxBytesPerMonth = int64(*lc.MaxBytesPerMonth)
+	}
+	if lc.MaxTorrentSize != nil {
+		l.MaxTorrentSize = int64(*lc.MaxTorrentSize)
+	}
+}
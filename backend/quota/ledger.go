@@ -0,0 +1,196 @@
+package quota
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hasmikatom/torrent/store"
+)
+
+// Entry records who added a torrent and how many bytes it counts against their quota
+type Entry struct {
+	Hash      string     `json:"hash"`
+	TorrentID int        `json:"torrentId"`
+	UserID    string     `json:"userId"`
+	Name      string     `json:"name"`
+	Bytes     int64      `json:"bytes"`
+	AddedAt   time.Time  `json:"addedAt"`
+	StartedAt *time.Time `json:"startedAt,omitempty"`
+}
+
+// Ledger keeps torrent ownership and byte accounting across restarts
+type Ledger struct {
+	mu      sync.Mutex
+	file    *store.JSONFile
+	entries map[string]*Entry
+}
+
+// OpenLedger loads the ledger from dataDir, starting empty if there is none yet
+func OpenLedger(dataDir string) (*Ledger, error) {
+	l := &Ledger{
+		file:    store.NewJSONFile(dataDir, "quota-ledger.json"),
+		entries: make(map[string]*Entry),
+	}
+
+	var entries []*Entry
+	if err := l.file.Load(&entries); err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		l.entries[strings.ToLower(e.Hash)] = e
+	}
+
+	return l, nil
+}
+
+// Track records a torrent for a user. A torrent that is already owned keeps
+// its original owner, so re-adding a duplicate can't steal or double count it.
+func (l *Ledger) Track(e Entry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := strings.ToLower(e.Hash)
+	if existing, ok := l.entries[key]; ok {
+		existing.TorrentID = e.TorrentID
+		if e.Name != "" {
+			existing.Name = e.Name
+		}
+	} else {
+		if e.AddedAt.IsZero() {
+			e.AddedAt = time.Now()
+		}
+		l.entries[key] = &e
+	}
+	l.save()
+}
+
+// Start marks a torrent as started, from which point its bytes count towards
+// the daily and monthly totals
+func (l *Ledger) Start(hash string, bytes int64, at time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e, ok := l.entries[strings.ToLower(hash)]
+	if !ok {
+		return
+	}
+	if bytes > 0 {
+		e.Bytes = bytes
+	}
+	if e.StartedAt == nil {
+		e.StartedAt = &at
+	}
+	l.save()
+}
+
+// SetBytes updates the size of a torrent once its metadata is known
+func (l *Ledger) SetBytes(hash string, bytes int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if e, ok := l.entries[strings.ToLower(hash)]; ok && e.Bytes != bytes {
+		e.Bytes = bytes
+		l.save()
+	}
+}
+
+// Forget drops a torrent entirely
+func (l *Ledger) Forget(hash string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.entries, strings.ToLower(hash))
+	l.save()
+}
+
+// ForgetUnstarted drops prepared torrents that were cancelled before they
+// ever started, so they don't count against anyone
+func (l *Ledger) ForgetUnstarted(torrentIDs []int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ids := make(map[int]bool, len(torrentIDs))
+	for _, id := range torrentIDs {
+		ids[id] = true
+	}
+
+	for key, e := range l.entries {
+		if e.StartedAt == nil && ids[e.TorrentID] {
+			delete(l.entries, key)
+		}
+	}
+	l.save()
+}
+
+// Owner returns the user that added a torrent
+func (l *Ledger) Owner(hash string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if e, ok := l.entries[strings.ToLower(hash)]; ok {
+		return e.UserID, true
+	}
+	return "", false
+}
+
+// Owned returns copies of all entries belonging to a user
+func (l *Ledger) Owned(userID string) []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var owned []Entry
+	for _, e := range l.entries {
+		if e.UserID == userID {
+			owned = append(owned, *e)
+		}
+	}
+	return owned
+}
+
+// Prune removes a user's entries for torrents the daemon no longer has once
+// they can no longer affect a quota window: unstarted ones after a day,
+// started ones once their month is over
+func (l *Ledger) Prune(userID string, live map[string]bool, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	monthStart := startOfMonth(now)
+	changed := false
+	for key, e := range l.entries {
+		if e.UserID != userID || live[key] {
+			continue
+		}
+		stale := e.StartedAt == nil && now.Sub(e.AddedAt) > 24*time.Hour
+		expired := e.StartedAt != nil && e.StartedAt.Before(monthStart)
+		if stale || expired {
+			delete(l.entries, key)
+			changed = true
+		}
+	}
+	if changed {
+		l.save()
+	}
+}
+
+// save must be called with l.mu held
+func (l *Ledger) save() {
+	entries := make([]*Entry, 0, len(l.entries))
+	for _, e := range l.entries {
+		entries = append(entries, e)
+	}
+	if err := l.file.Save(entries); err != nil {
+		log.Printf("Failed to save quota ledger: %v", err)
+	}
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+func startOfMonth(t time.Time) time.Time {
+	y, m, _ := t.Date()
+	return time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,113 @@
+package quota
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hasmikatom/torrent/configfile"
+)
+
+// Usage is what a user currently counts against their limits
+type Usage struct {
+	ActiveTorrents int   `json:"activeTorrents"`
+	BytesToday     int64 `json:"bytesToday"`
+	BytesThisMonth int64 `json:"bytesThisMonth"`
+}
+
+// ExceededError is returned when an action would push a user over a limit
+type ExceededError struct {
+	Quota   string `json:"quota"`
+	Limit   int64  `json:"limit"`
+	Current int64  `json:"current"`
+	// Requested is how much the rejected action would have added
+	Requested int64 `json:"requested"`
+}
+
+func (e *ExceededError) Error() string {
+	switch e.Quota {
+	case "maxActiveTorrents":
+		return fmt.Sprintf("quota exceeded: %d of %d active torrents already in use", e.Current, e.Limit)
+	case "maxTorrentSize":
+		return fmt.Sprintf("quota exceeded: torrent is %s, the maximum allowed size is %s",
+			configfile.FormatByteSize(e.Requested), configfile.FormatByteSize(e.Limit))
+	case "maxBytesPerDay":
+		return fmt.Sprintf("quota exceeded: adding %s would exceed the daily limit of %s (%s used today)",
+			configfile.FormatByteSize(e.Requested), configfile.FormatByteSize(e.Limit), configfile.FormatByteSize(e.Current))
+	case "maxBytesPerMonth":
+		return fmt.Sprintf("quota exceeded: adding %s would exceed the monthly limit of %s (%s used this month)",
+			configfile.FormatByteSize(e.Requested), configfile.FormatByteSize(e.Limit), configfile.FormatByteSize(e.Current))
+	}
+	return "quota exceeded: " + e.Quota
+}
+
+// UsageOf sums a user's entries. active says which torrent hashes the daemon
+// currently reports as not stopped.
+func UsageOf(entries []Entry, active map[string]bool, now time.Time) Usage {
+	var u Usage
+	dayStart := startOfDay(now)
+	monthStart := startOfMonth(now)
+
+	for _, e := range entries {
+		if active[strings.ToLower(e.Hash)] {
+			u.ActiveTorrents++
+		}
+		if e.StartedAt == nil {
+			continue
+		}
+		if !e.StartedAt.Before(monthStart) {
+			u.BytesThisMonth += e.Bytes
+		}
+		if !e.StartedAt.Before(dayStart) {
+			u.BytesToday += e.Bytes
+		}
+	}
+
+	return u
+}
+
+// Check reports whether starting `starting` more torrents totalling size bytes
+// fits in the limits. A size of 0 means the size is not known yet, in which
+// case only the active torrent count is checked.
+func Check(limits Limits, usage Usage, size int64, starting int) error {
+	if limits.MaxActiveTorrents > 0 && starting > 0 && usage.ActiveTorrents+starting > limits.MaxActiveTorrents {
+		return &ExceededError{
+			Quota:     "maxActiveTorrents",
+			Limit:     int64(limits.MaxActiveTorrents),
+			Current:   int64(usage.ActiveTorrents),
+			Requested: int64(starting),
+		}
+	}
+
+	if size <= 0 {
+		return nil
+	}
+
+	if limits.MaxTorrentSize > 0 && size > limits.MaxTorrentSize {
+		return &ExceededError{
+			Quota:     "maxTorrentSize",
+			Limit:     limits.MaxTorrentSize,
+			Requested: size,
+		}
+	}
+
+	if limits.MaxBytesPerDay > 0 && usage.BytesToday+size > limits.MaxBytesPerDay {
+		return &ExceededError{
+			Quota:     "maxBytesPerDay",
+			Limit:     limits.MaxBytesPerDay,
+			Current:   usage.BytesToday,
+			Requested: size,
+		}
+	}
+
+	if limits.MaxBytesPerMonth > 0 && usage.BytesThisMonth+size > limits.MaxBytesPerMonth {
+		return &ExceededError{
+			Quota:     "maxBytesPerMonth",
+			Limit:     limits.MaxBytesPerMonth,
+			Current:   usage.BytesThisMonth,
+			Requested: size,
+		}
+	}
+
+	return nil
+}
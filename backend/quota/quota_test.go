@@ -0,0 +1,141 @@
+package quota
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLimitsFor_LayersDefaultRoleAndUser(t *testing.T) {
+	var config Config
+	raw := `{
+		"default": {"maxActiveTorrents": 5, "maxTorrentSize": "50GB", "maxBytesPerDay": "100GB"},
+		"roles": {"admin": {"maxActiveTorrents": 0, "maxTorrentSize": 0}},
+		"users": {"friend@x.com": {"maxBytesPerDay": "10GB"}, "abc": {"maxActiveTorrents": 1}}
+	}`
+	if err := json.Unmarshal([]byte(raw), &config); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	user := config.LimitsFor(User{ID: "u1", Email: "someone@x.com", Role: "user"})
+	if user.MaxActiveTorrents != 5 || user.MaxTorrentSize != 50e9 || user.MaxBytesPerDay != 100e9 {
+		t.Fatalf("unexpected default limits: %+v", user)
+	}
+
+	admin := config.LimitsFor(User{ID: "u2", Role: "admin"})
+	if admin.MaxActiveTorrents != 0 || admin.MaxTorrentSize != 0 || admin.MaxBytesPerDay != 100e9 {
+		t.Fatalf("role should override only the fields it sets: %+v", admin)
+	}
+
+	friend := config.LimitsFor(User{ID: "u3", Email: "Friend@X.com", Role: "user"})
+	if friend.MaxBytesPerDay != 10e9 || friend.MaxActiveTorrents != 5 {
+		t.Fatalf("email override not applied: %+v", friend)
+	}
+
+	byID := config.LimitsFor(User{ID: "abc", Role: "user"})
+	if byID.MaxActiveTorrents != 1 {
+		t.Fatalf("id override not applied: %+v", byID)
+	}
+}
+
+func TestUsageOf_CountsStartedBytesPerWindow(t *testing.T) {
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	today := now.Add(-time.Hour)
+	earlierThisMonth := now.AddDate(0, 0, -5)
+	lastMonth := now.AddDate(0, -1, 0)
+
+	entries := []Entry{
+		{Hash: "AA", Bytes: 100, StartedAt: &today},
+		{Hash: "bb", Bytes: 200, StartedAt: &earlierThisMonth},
+		{Hash: "cc", Bytes: 400, StartedAt: &lastMonth},
+		{Hash: "dd", Bytes: 800}, // prepared, never started
+	}
+	active := map[string]bool{"aa": true, "dd": true}
+
+	u := UsageOf(entries, active, now)
+	if u.ActiveTorrents != 2 {
+		t.Fatalf("expected 2 active, got %d", u.ActiveTorrents)
+	}
+	if u.BytesToday != 100 {
+		t.Fatalf("expected 100 bytes today, got %d", u.BytesToday)
+	}
+	if u.BytesThisMonth != 300 {
+		t.Fatalf("expected 300 bytes this month, got %d", u.BytesThisMonth)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	limits := Limits{MaxActiveTorrents: 2, MaxTorrentSize: 1000, MaxBytesPerDay: 1500, MaxBytesPerMonth: 3000}
+
+	cases := []struct {
+		name     string
+		usage    Usage
+		size     int64
+		starting int
+		quota    string
+	}{
+		{"fits", Usage{ActiveTorrents: 1, BytesToday: 100, BytesThisMonth: 100}, 500, 1, ""},
+		{"too many active", Usage{ActiveTorrents: 2}, 0, 1, "maxActiveTorrents"},
+		{"already active torrent ignores count", Usage{ActiveTorrents: 2}, 500, 0, ""},
+		{"unknown size only checks count", Usage{BytesToday: 1500}, 0, 1, ""},
+		{"too large", Usage{}, 1001, 1, "maxTorrentSize"},
+		{"daily", Usage{BytesToday: 1000, BytesThisMonth: 1000}, 600, 1, "maxBytesPerDay"},
+		{"monthly", Usage{BytesToday: 0, BytesThisMonth: 2600}, 600, 1, "maxBytesPerMonth"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Check(limits, tc.usage, tc.size, tc.starting)
+			if tc.quota == "" {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+			var exceeded *ExceededError
+			if !errors.As(err, &exceeded) {
+				t.Fatalf("expected ExceededError, got %v", err)
+			}
+			if exceeded.Quota != tc.quota {
+				t.Fatalf("expected %s, got %s (%v)", tc.quota, exceeded.Quota, err)
+			}
+		})
+	}
+
+	if err := Check(Limits{}, Usage{ActiveTorrents: 100, BytesToday: 1 << 50}, 1<<40, 1); err != nil {
+		t.Fatalf("zero limits should mean unlimited, got %v", err)
+	}
+}
+
+func TestLedger_PersistsAndKeepsOriginalOwner(t *testing.T) {
+	dir := t.TempDir()
+
+	l, err := OpenLedger(dir)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	l.Track(Entry{Hash: "abc", TorrentID: 1, UserID: "alice"})
+	l.Track(Entry{Hash: "ABC", TorrentID: 1, UserID: "bob"})
+	l.Start("abc", 42, time.Now())
+	l.Track(Entry{Hash: "def", TorrentID: 2, UserID: "alice"})
+	l.ForgetUnstarted([]int{1, 2})
+
+	reopened, err := OpenLedger(dir)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+
+	owner, ok := reopened.Owner("abc")
+	if !ok || owner != "alice" {
+		t.Fatalf("expected alice to keep ownership, got %q", owner)
+	}
+	if _, ok := reopened.Owner("def"); ok {
+		t.Fatalf("cancelled unstarted torrent should be forgotten")
+	}
+
+	owned := reopened.Owned("alice")
+	if len(owned) != 1 || owned[0].Bytes != 42 || owned[0].StartedAt == nil {
+		t.Fatalf("unexpected entries after reload: %+v", owned)
+	}
+}
@@ -0,0 +1,170 @@
+// Package refresh holds what the media server refreshers share: retrying a
+// request with growing waits in between, and a short history of what was
+// asked of each server.
+package refresh
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hasmikatom/torrent/events"
+)
+
+// Refresh states
+const (
+	StatusPending = "pending"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+	StatusSkipped = "skipped"
+)
+
+// maxHistory bounds how many refreshes a History keeps
+const maxHistory = 100
+
+// Options tune retries
+type Options struct {
+	// Backoff is the wait before the first retry; it doubles for each one after
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	Timeout    time.Duration
+}
+
+// DefaultOptions retry after 10s, 20s, 40s... up to 5 minutes apart
+var DefaultOptions = Options{Backoff: 10 * time.Second, MaxBackoff: 5 * time.Minute, Timeout: 30 * time.Second}
+
+// State is where one refresh stands
+type State struct {
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error,omitempty"`
+
+	RequestedAt   time.Time  `json:"requestedAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+	NextAttemptAt *time.Time `json:"nextAttemptAt,omitempty"`
+}
+
+// Pending is the state of a refresh requested at now
+func Pending(now time.Time) State {
+	return State{Status: StatusPending, RequestedAt: now, UpdatedAt: now}
+}
+
+// Triggers reports whether an event may have put new files in the library:
+// a torrent completed, its archives were extracted or it was linked
+func Triggers(e events.Event) bool {
+	return e.Type == events.Completed || e.Type == events.Extracted || e.Type == events.Linked
+}
+
+// Retry calls attempt until it succeeds, fails in a way that won't go away,
+// has been tried maxAttempts times or ctx is cancelled. It waits
+// opts.Backoff before the first retry, doubling up to opts.MaxBackoff, and
+// calls record after every change to s.
+func Retry(ctx context.Context, opts Options, maxAttempts int, s *State, attempt func() error, record func()) {
+	wait := opts.Backoff
+	for {
+		s.Attempts++
+		err := attempt()
+		s.UpdatedAt = time.Now()
+		s.NextAttemptAt = nil
+
+		if err == nil {
+			s.Status = StatusDone
+			s.Error = ""
+			record()
+			return
+		}
+		s.Error = err.Error()
+
+		if !Retryable(err) || s.Attempts >= maxAttempts {
+			s.Status = StatusFailed
+			record()
+			return
+		}
+
+		next := s.UpdatedAt.Add(wait)
+		s.NextAttemptAt = &next
+		record()
+
+		select {
+		case <-ctx.Done():
+			s.Status = StatusFailed
+			s.Error = "cancelled while waiting to retry"
+			s.NextAttemptAt = nil
+			record()
+			return
+		case <-time.After(wait):
+		}
+
+		wait *= 2
+		if opts.MaxBackoff > 0 && wait > opts.MaxBackoff {
+			wait = opts.MaxBackoff
+		}
+	}
+}
+
+// StatusError is a non-2xx answer from a media server
+type StatusError struct {
+	// Server names the kind of server in the message
+	Server string
+	Code   int
+	Status string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s answered %s", e.Server, e.Status)
+}
+
+// Retryable reports whether a failed request may succeed later. A bad
+// token or API key (401) or an unknown section or endpoint (404) won't.
+func Retryable(err error) bool {
+	if se, ok := err.(*StatusError); ok {
+		return se.Code == http.StatusTooManyRequests || se.Code >= 500
+	}
+	return true
+}
+
+// History keeps the latest refreshes, replacing an entry when the same
+// refresh is recorded again
+type History[T any] struct {
+	// same tells whether two entries are the same refresh
+	same func(a, b T) bool
+
+	mu   sync.Mutex
+	list []T
+}
+
+// NewHistory returns an empty history
+func NewHistory[T any](same func(a, b T) bool) *History[T] {
+	return &History[T]{same: same}
+}
+
+// Record adds or updates an entry
+func (h *History[T]) Record(entry T) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i := range h.list {
+		if h.same(h.list[i], entry) {
+			h.list[i] = entry
+			return
+		}
+	}
+	h.list = append(h.list, entry)
+	if len(h.list) > maxHistory {
+		h.list = h.list[len(h.list)-maxHistory:]
+	}
+}
+
+// List returns the entries, newest first
+func (h *History[T]) List() []T {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	list := make([]T, 0, len(h.list))
+	for i := len(h.list) - 1; i >= 0; i-- {
+		list = append(list, h.list[i])
+	}
+	return list
+}
@@ -0,0 +1,92 @@
+package refresh
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+var testOptions = Options{Backoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+func TestRetry(t *testing.T) {
+	unavailable := &StatusError{Server: "test", Code: http.StatusServiceUnavailable, Status: "503 Service Unavailable"}
+	unauthorized := &StatusError{Server: "test", Code: http.StatusUnauthorized, Status: "401 Unauthorized"}
+
+	tests := []struct {
+		name         string
+		errs         []error
+		wantStatus   string
+		wantAttempts int
+	}{
+		{"first try", nil, StatusDone, 1},
+		{"server error then success", []error{unavailable}, StatusDone, 2},
+		{"network error then success", []error{errors.New("connection refused")}, StatusDone, 2},
+		{"bad key is not retried", []error{unauthorized}, StatusFailed, 1},
+		{"gives up after max attempts", []error{unavailable, unavailable, unavailable, unavailable}, StatusFailed, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := tt.errs
+			s := Pending(time.Now())
+			records := 0
+			Retry(context.Background(), testOptions, 3, &s, func() error {
+				if len(errs) == 0 {
+					return nil
+				}
+				err := errs[0]
+				errs = errs[1:]
+				return err
+			}, func() { records++ })
+
+			if s.Status != tt.wantStatus || s.Attempts != tt.wantAttempts {
+				t.Fatalf("got %s after %d attempts (%s), want %s after %d", s.Status, s.Attempts, s.Error, tt.wantStatus, tt.wantAttempts)
+			}
+			if records != tt.wantAttempts {
+				t.Errorf("expected a record per attempt, got %d", records)
+			}
+			if s.NextAttemptAt != nil {
+				t.Errorf("finished refresh still has a next attempt at %v", s.NextAttemptAt)
+			}
+		})
+	}
+}
+
+func TestRetry_CancelledWhileWaiting(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := Pending(time.Now())
+	Retry(ctx, Options{Backoff: time.Hour}, 3, &s, func() error {
+		cancel()
+		return errors.New("connection refused")
+	}, func() {})
+
+	if s.Status != StatusFailed || s.Attempts != 1 || s.NextAttemptAt != nil {
+		t.Fatalf("unexpected state %+v", s)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	type entry struct {
+		ID     int
+		Status string
+	}
+	h := NewHistory(func(a, b entry) bool { return a.ID == b.ID })
+
+	for id := 1; id <= maxHistory+5; id++ {
+		h.Record(entry{ID: id, Status: StatusPending})
+	}
+	h.Record(entry{ID: maxHistory + 5, Status: StatusDone})
+
+	list := h.List()
+	if len(list) != maxHistory {
+		t.Fatalf("expected %d entries, got %d", maxHistory, len(list))
+	}
+	if list[0] != (entry{ID: maxHistory + 5, Status: StatusDone}) {
+		t.Errorf("newest entry should be updated in place, got %+v", list[0])
+	}
+	if list[len(list)-1].ID != 6 {
+		t.Errorf("oldest entries should be dropped, last is %+v", list[len(list)-1])
+	}
+}
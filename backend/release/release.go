@@ -0,0 +1,483 @@
+// Package release parses torrent release names such as
+// "Show.Name.S02E05.1080p.WEB-DL.x265-GRP" or RuTracker style titles like
+// "Во все тяжкие / Breaking Bad / Сезон: 1 / Серии: 1-7 из 7 [2008, BDRip 1080p] MVO"
+// into their title, year, season/episode and quality parts.
+package release
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Info is everything that could be recognised in a release name.
+// Fields that weren't found are left empty.
+type Info struct {
+	Title      string   `json:"title"`
+	AltTitles  []string `json:"altTitles,omitempty"`
+	Year       int      `json:"year,omitempty"`
+	Seasons    []int    `json:"seasons,omitempty"`
+	Episodes   []int    `json:"episodes,omitempty"`
+	Resolution string   `json:"resolution,omitempty"`
+	Source     string   `json:"source,omitempty"`
+	Codec      string   `json:"codec,omitempty"`
+	Audio      string   `json:"audio,omitempty"`
+	HDR        string   `json:"hdr,omitempty"`
+	Languages  []string `json:"languages,omitempty"`
+	Group      string   `json:"group,omitempty"`
+}
+
+// IsEpisodic reports whether the release looks like part of a series
+func (i Info) IsEpisodic() bool {
+	return len(i.Seasons) > 0 || len(i.Episodes) > 0
+}
+
+// PreferredTitle returns the first title written in Latin script, falling
+// back to Title. RuTracker lists the Russian title first and the original
+// one after it, and media servers match the original one more reliably.
+func (i Info) PreferredTitle() string {
+	for _, t := range append([]string{i.Title}, i.AltTitles...) {
+		if isLatin(t) {
+			return t
+		}
+	}
+	return i.Title
+}
+
+func isLatin(s string) bool {
+	letters := 0
+	for _, r := range s {
+		if unicode.IsLetter(r) {
+			if !unicode.In(r, unicode.Latin) {
+				return false
+			}
+			letters++
+		}
+	}
+	return letters > 0
+}
+
+// maxRange caps how many numbers a range like "Серии: 1-9999" expands to
+const maxRange = 500
+
+var (
+	extension    = regexp.MustCompile(`(?i)\.(mkv|mp4|avi|m4v|ts|wmv|mov|flac|mp3|m4b|torrent)$`)
+	trailingTag  = regexp.MustCompile(`\s*\[(?i:rarbg|eztv[^\]]*|ettv|tgx|rartv)\]$`)
+	leadingGroup = regexp.MustCompile(`^\[([^\]]+)\]\s*`)
+	sceneGroup   = regexp.MustCompile(`-([A-Za-z0-9]+)$`)
+	dotBetween   = regexp.MustCompile(`(^|[^\d])(\d)\.(\d)($|[^\d])`)
+
+	yearRe = regexp.MustCompile(`\b(?:19|20)\d{2}\b`)
+
+	sxxexx        = regexp.MustCompile(`(?i)\bS(\d{1,2})((?:[ .-]?E\d{1,3})+)(?:-E?(\d{1,3}))?\b`)
+	episodeTokens = regexp.MustCompile(`(?i)E(\d{1,3})`)
+	seasonRange   = regexp.MustCompile(`(?i)\bS(\d{1,2})(?:\s?-\s?S|-)(\d{1,2})\b`)
+	seasonOnly    = regexp.MustCompile(`(?i)\bS(\d{1,2})\b`)
+	crossFormat   = regexp.MustCompile(`(?i)\b(\d{1,2})x(\d{2,3})\b`)
+	seasonWord    = regexp.MustCompile(`(?i)\bSeasons?\s?(\d{1,2})(?:\s?(?:-|to)\s?(\d{1,2}))?\b`)
+	episodeWord   = regexp.MustCompile(`(?i)\b(?:Episode|Ep)\.?\s?(\d{1,3})\b`)
+	animeEpisode  = regexp.MustCompile(`\s-\s(\d{1,4})(?:v\d)?(?:\s|$)`)
+
+	ruSeason       = regexp.MustCompile(`(?i)Сезон(?:ы)?\s*:?\s*(\d{1,2})(?:\s*-\s*(\d{1,2}))?`)
+	ruSeasonBefore = regexp.MustCompile(`(?i)(\d{1,2})(?:\s*-\s*(\d{1,2}))?\s*(?:-?й\s*)?сезон`)
+	ruEpisodes     = regexp.MustCompile(`(?i)Сери(?:и|я)\s*:?\s*(\d{1,4})(?:\s*-\s*(\d{1,4}))?(?:\s*\(?\s*(?:из|of)\s*(\d{1,4}))?`)
+
+	resolutionRe = regexp.MustCompile(`(?i)\b(360|480|540|576|720|1080|1440|2160|4320)[pi]\b`)
+	dimensionsRe = regexp.MustCompile(`\b\d{3,4}x(480|576|720|1080|1440|2160)\b`)
+	uhdRe        = regexp.MustCompile(`(?i)\b(4K|UHD)\b`)
+
+	channelsRe = regexp.MustCompile(`(?:^|[^\d.])([1257]\.[01])(?:$|[^\d])`)
+)
+
+type tag struct {
+	pattern *regexp.Regexp
+	value   string
+}
+
+func tags(pairs ...string) []tag {
+	list := make([]tag, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		list = append(list, tag{regexp.MustCompile(`(?i)(?:^|[^\p{L}\d])(?:` + pairs[i] + `)(?:$|[^\p{L}\d])`), pairs[i+1]})
+	}
+	return list
+}
+
+// Each list is checked in order and the first match wins, so more specific
+// spellings come before the general ones
+var (
+	sources = tags(
+		`(?:BD|Blu-?Ray|UHD)[ .-]?Remux|Remux`, "Remux",
+		`BDRip|BRRip|BD-?Rip`, "BDRip",
+		`Blu-?Ray|BDMV|BD25|BD50`, "BluRay",
+		`WEB-?DL|WEB-DLRip|WEBDL`, "WEB-DL",
+		`WEB-?Rip`, "WEBRip",
+		`HDTV-?Rip`, "HDTVRip",
+		`HDTV`, "HDTV",
+		`WEB`, "WEB-DL",
+		`DVD-?Rip`, "DVDRip",
+		`DVD[59]|DVD`, "DVD",
+		`HD-?Rip`, "HDRip",
+		`SAT-?Rip`, "SATRip",
+		`VHS-?Rip`, "VHSRip",
+		`CAM-?Rip|CAM|HDCAM`, "CAM",
+		`TELESYNC|HDTS|TS`, "TS",
+	)
+	codecs = tags(
+		`x265`, "x265",
+		`x264`, "x264",
+		`HEVC|H[ .]?265`, "H.265",
+		`AVC|H[ .]?264`, "H.264",
+		`XviD`, "XviD",
+		`DivX`, "DivX",
+		`AV1`, "AV1",
+		`VP9`, "VP9",
+		`MPEG-?2`, "MPEG-2",
+	)
+	audios = tags(
+		`DTS-?HD[ .]?MA`, "DTS-HD MA",
+		`DTS-?HD`, "DTS-HD",
+		`DTS-?X`, "DTS:X",
+		`TrueHD`, "TrueHD",
+		`DTS`, "DTS",
+		`DDP(?:[257]\.[01])?|DD\+|E-?AC-?3`, "DD+",
+		`DD(?:[257]\.[01])?|AC-?3|Dolby Digital`, "DD",
+		`AAC(?:[257]\.[01])?`, "AAC",
+		`FLAC`, "FLAC",
+		`ALAC`, "ALAC",
+		`L?PCM`, "PCM",
+		`Opus`, "Opus",
+		`MP3`, "MP3",
+	)
+	atmos      = tags(`Atmos`, "Atmos")
+	dolbyVison = tags(`DV|DoVi|Dolby[ .]?Vision`, "DV")
+	hdrs       = tags(
+		`HDR10\+|HDR10Plus`, "HDR10+",
+		`HDR10`, "HDR10",
+		`HDR`, "HDR",
+	)
+	languages = tags(
+		`MULTi`, "multi",
+		`RUS|Russian|Dub|MVO|DVO|AVO|Русский`, "ru",
+		`ENG|English`, "en",
+		`UKR|Ukrainian`, "uk",
+		`TRUEFRENCH|FRENCH|VFF|VOSTFR`, "fr",
+		`GERMAN`, "de",
+		`iTALiAN|ITA`, "it",
+		`SPANiSH|ESP|Castellano`, "es",
+		`JAPANESE|JAP|JPN`, "ja",
+		`KOREAN|KOR`, "ko",
+	)
+)
+
+// notGroups are words that end in "-Word" in a release name without being
+// the release group
+var notGroups = map[string]bool{
+	"DL": true, "RIP": true, "RAY": true, "HD": true, "MA": true, "X": true,
+	"AC3": true, "DTS": true, "SUB": true, "SUBS": true, "DUB": true,
+}
+
+// Parse splits a release name into its parts
+func Parse(name string) Info {
+	var info Info
+
+	s := strings.TrimSpace(name)
+	s = extension.ReplaceAllString(s, "")
+	s = trailingTag.ReplaceAllString(s, "")
+
+	if m := leadingGroup.FindStringSubmatch(s); m != nil && !strings.ContainsAny(m[1], " ,") {
+		info.Group = m[1]
+		s = s[len(m[0]):]
+	}
+
+	s = normalize(s)
+
+	if info.Group == "" {
+		if m := sceneGroup.FindStringSubmatchIndex(s); m != nil {
+			group := s[m[2]:m[3]]
+			if !notGroups[strings.ToUpper(group)] && !isTag(group) {
+				info.Group = group
+				s = s[:m[0]]
+			}
+		}
+	}
+
+	// cut is where the title ends: the first thing that isn't part of it
+	cut := len(s)
+	mark := func(i int) {
+		if i >= 0 && i < cut {
+			cut = i
+		}
+	}
+
+	seasons, episodes := parseEpisodes(s, mark)
+	info.Seasons = seasons
+	info.Episodes = episodes
+
+	if year, at := findYear(s); year > 0 {
+		info.Year = year
+		mark(at)
+	}
+
+	info.Resolution = findResolution(s, mark)
+	info.Source = findTag(s, sources, mark)
+	info.Codec = findTag(s, codecs, mark)
+	info.Audio = findAudio(s, mark)
+	info.HDR = findHDR(s, mark)
+	info.Languages = findLanguages(s, cut)
+
+	info.Title, info.AltTitles = splitTitles(s, cut)
+
+	return info
+}
+
+// normalize turns dot and underscore separated scene names into spaces,
+// keeping the dot in channel layouts like "5.1"
+func normalize(s string) string {
+	if strings.Count(s, " ") >= strings.Count(s, ".")+strings.Count(s, "_") {
+		return s
+	}
+	s = dotBetween.ReplaceAllString(s, "$1$2\x00$3$4")
+	s = strings.NewReplacer(".", " ", "_", " ").Replace(s)
+	s = strings.ReplaceAll(s, "\x00", ".")
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func isTag(word string) bool {
+	for _, list := range [][]tag{sources, codecs, audios, hdrs} {
+		for _, t := range list {
+			if t.pattern.MatchString(word) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func parseEpisodes(s string, mark func(int)) ([]int, []int) {
+	seasons := map[int]bool{}
+	episodes := map[int]bool{}
+
+	if m := sxxexx.FindStringSubmatchIndex(s); m != nil {
+		mark(m[0])
+		season := atoi(s[m[2]:m[3]])
+		seasons[season] = true
+		var eps []int
+		for _, e := range episodeTokens.FindAllStringSubmatch(s[m[4]:m[5]], -1) {
+			eps = append(eps, atoi(e[1]))
+		}
+		if m[6] >= 0 && len(eps) > 0 {
+			addRange(episodes, eps[len(eps)-1], atoi(s[m[6]:m[7]]))
+		}
+		if len(eps) == 2 && eps[1] > eps[0]+1 && strings.Contains(s[m[4]:m[5]], "-") {
+			addRange(episodes, eps[0], eps[1])
+		}
+		for _, e := range eps {
+			episodes[e] = true
+		}
+	} else if m := seasonRange.FindStringSubmatchIndex(s); m != nil {
+		mark(m[0])
+		addRange(seasons, atoi(s[m[2]:m[3]]), atoi(s[m[4]:m[5]]))
+	} else if m := crossFormat.FindStringSubmatchIndex(s); m != nil && !looksLikeDimensions(s, m) {
+		mark(m[0])
+		seasons[atoi(s[m[2]:m[3]])] = true
+		episodes[atoi(s[m[4]:m[5]])] = true
+	} else if m := seasonOnly.FindStringSubmatchIndex(s); m != nil {
+		mark(m[0])
+		seasons[atoi(s[m[2]:m[3]])] = true
+	}
+
+	if m := seasonWord.FindStringSubmatchIndex(s); m != nil {
+		mark(m[0])
+		from := atoi(s[m[2]:m[3]])
+		to := from
+		if m[4] >= 0 {
+			to = atoi(s[m[4]:m[5]])
+		}
+		addRange(seasons, from, to)
+	}
+	if m := episodeWord.FindStringSubmatchIndex(s); m != nil {
+		mark(m[0])
+		episodes[atoi(s[m[2]:m[3]])] = true
+	}
+
+	if m := ruSeason.FindStringSubmatchIndex(s); m != nil {
+		mark(m[0])
+		from := atoi(s[m[2]:m[3]])
+		to := from
+		if m[4] >= 0 {
+			to = atoi(s[m[4]:m[5]])
+		}
+		addRange(seasons, from, to)
+	} else if m := ruSeasonBefore.FindStringSubmatchIndex(s); m != nil {
+		mark(m[0])
+		from := atoi(s[m[2]:m[3]])
+		to := from
+		if m[4] >= 0 {
+			to = atoi(s[m[4]:m[5]])
+		}
+		addRange(seasons, from, to)
+	}
+	if m := ruEpisodes.FindStringSubmatchIndex(s); m != nil {
+		mark(m[0])
+		from := atoi(s[m[2]:m[3]])
+		to := from
+		if m[4] >= 0 {
+			to = atoi(s[m[4]:m[5]])
+		}
+		addRange(episodes, from, to)
+	}
+
+	if len(episodes) == 0 {
+		if m := animeEpisode.FindStringSubmatchIndex(s); m != nil {
+			mark(m[0])
+			episodes[atoi(s[m[2]:m[3]])] = true
+		}
+	}
+
+	return sortedKeys(seasons), sortedKeys(episodes)
+}
+
+// looksLikeDimensions rejects "1920x1080" style matches of the 1x02 pattern
+func looksLikeDimensions(s string, m []int) bool {
+	return m[0] > 0 && s[m[0]-1] >= '0' && s[m[0]-1] <= '9'
+}
+
+// findYear returns the last plausible year that isn't at the very start of
+// the name, so "1917 2019" and "2001 A Space Odyssey 1968" keep their titles
+func findYear(s string) (int, int) {
+	year, at := 0, -1
+	for _, m := range yearRe.FindAllStringIndex(s, -1) {
+		if m[0] == 0 {
+			continue
+		}
+		year, at = atoi(s[m[0]:m[1]]), m[0]
+	}
+	if at > 0 && (s[at-1] == '(' || s[at-1] == '[') {
+		at--
+	}
+	return year, at
+}
+
+func findResolution(s string, mark func(int)) string {
+	if m := resolutionRe.FindStringSubmatchIndex(s); m != nil {
+		mark(m[0])
+		return s[m[2]:m[3]] + "p"
+	}
+	if m := dimensionsRe.FindStringSubmatchIndex(s); m != nil {
+		mark(m[0])
+		return s[m[2]:m[3]] + "p"
+	}
+	if m := uhdRe.FindStringIndex(s); m != nil {
+		mark(m[0])
+		return "2160p"
+	}
+	return ""
+}
+
+func findTag(s string, list []tag, mark func(int)) string {
+	for _, t := range list {
+		if m := t.pattern.FindStringIndex(s); m != nil {
+			mark(m[0])
+			return t.value
+		}
+	}
+	return ""
+}
+
+func findAudio(s string, mark func(int)) string {
+	audio := findTag(s, audios, mark)
+	if findTag(s, atmos, mark) != "" {
+		audio = strings.TrimSpace(audio + " Atmos")
+	}
+	if audio == "" {
+		return ""
+	}
+	if m := channelsRe.FindStringSubmatch(s); m != nil {
+		audio += " " + m[1]
+	}
+	return audio
+}
+
+func findHDR(s string, mark func(int)) string {
+	var parts []string
+	// "DV" is also a common word fragment, so only trust it next to other tags
+	if dv := findTag(s, dolbyVison, func(int) {}); dv != "" && (resolutionRe.MatchString(s) || findTag(s, hdrs, func(int) {}) != "") {
+		findTag(s, dolbyVison, mark)
+		parts = append(parts, dv)
+	}
+	if hdr := findTag(s, hdrs, mark); hdr != "" {
+		parts = append(parts, hdr)
+	}
+	return strings.Join(parts, " ")
+}
+
+// findLanguages only looks after the title so words like "Eng" in a title
+// don't count
+func findLanguages(s string, cut int) []string {
+	tail := s[cut:]
+	var found []string
+	seen := map[string]bool{}
+	for _, t := range languages {
+		if t.pattern.MatchString(tail) && !seen[t.value] {
+			seen[t.value] = true
+			found = append(found, t.value)
+		}
+	}
+	return found
+}
+
+// splitTitles takes the text before cut and splits RuTracker's
+// "Русское / Original / Сезон: 1" lists into the title and alternatives
+func splitTitles(s string, cut int) (string, []string) {
+	head := s[:cut]
+	if i := strings.IndexAny(head, "(["); i > 0 {
+		head = head[:i]
+	}
+
+	var titles []string
+	for _, part := range strings.Split(head, " / ") {
+		part = strings.Trim(part, " -–:/,.|")
+		if part != "" {
+			titles = append(titles, part)
+		}
+	}
+
+	if len(titles) == 0 {
+		return strings.Trim(s[:cut], " -–:/,.([|"), nil
+	}
+	if len(titles) == 1 {
+		return titles[0], nil
+	}
+	return titles[0], titles[1:]
+}
+
+func addRange(set map[int]bool, from, to int) {
+	if to < from {
+		from, to = to, from
+	}
+	if to-from > maxRange {
+		to = from + maxRange
+	}
+	for n := from; n <= to; n++ {
+		set[n] = true
+	}
+}
+
+func sortedKeys(set map[int]bool) []int {
+	if len(set) == 0 {
+		return nil
+	}
+	keys := make([]int, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
@@ -0,0 +1,217 @@
+package release
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		name string
+		want Info
+	}{
+		// Scene movies
+		{"Movie.Title.2021.1080p.BluRay.x264-SPARKS", Info{
+			Title: "Movie Title", Year: 2021, Resolution: "1080p", Source: "BluRay", Codec: "x264", Group: "SPARKS",
+		}},
+		{"Blade.Runner.2049.2017.2160p.UHD.BluRay.REMUX.HDR.HEVC.Atmos-EPSiLON", Info{
+			Title: "Blade Runner 2049", Year: 2017, Resolution: "2160p", Source: "Remux", Codec: "H.265", Audio: "Atmos", HDR: "HDR", Group: "EPSiLON",
+		}},
+		{"2001.A.Space.Odyssey.1968.1080p.BluRay.DTS-HD.MA.5.1.x264-GRP", Info{
+			Title: "2001 A Space Odyssey", Year: 1968, Resolution: "1080p", Source: "BluRay", Codec: "x264", Audio: "DTS-HD MA 5.1", Group: "GRP",
+		}},
+		{"1917.2019.720p.WEB-DL.DD5.1.H.264-FGT", Info{
+			Title: "1917", Year: 2019, Resolution: "720p", Source: "WEB-DL", Codec: "H.264", Audio: "DD 5.1", Group: "FGT",
+		}},
+		{"Dune.Part.Two.2024.2160p.WEB-DL.DDP5.1.Atmos.DV.HDR10.H.265-FLUX", Info{
+			Title: "Dune Part Two", Year: 2024, Resolution: "2160p", Source: "WEB-DL", Codec: "H.265", Audio: "DD+ Atmos 5.1", HDR: "DV HDR10", Group: "FLUX",
+		}},
+		{"The.Matrix.1999.REMASTERED.1080p.BluRay.TrueHD.7.1.Atmos.x265-GRP", Info{
+			Title: "The Matrix", Year: 1999, Resolution: "1080p", Source: "BluRay", Codec: "x265", Audio: "TrueHD Atmos 7.1", Group: "GRP",
+		}},
+		{"Oppenheimer.2023.IMAX.2160p.WEB-DL.DDP5.1.HDR10+.HEVC-GRP", Info{
+			Title: "Oppenheimer", Year: 2023, Resolution: "2160p", Source: "WEB-DL", Codec: "H.265", Audio: "DD+ 5.1", HDR: "HDR10+", Group: "GRP",
+		}},
+		{"Old.Movie.1985.DVDRip.XviD.AC3-NoGrp", Info{
+			Title: "Old Movie", Year: 1985, Source: "DVDRip", Codec: "XviD", Audio: "DD", Group: "NoGrp",
+		}},
+		{"New.Release.2024.CAM.x264-BAD", Info{
+			Title: "New Release", Year: 2024, Source: "CAM", Codec: "x264", Group: "BAD",
+		}},
+		{"Some.Film.2022.HDRip.XviD.AAC-EVO", Info{
+			Title: "Some Film", Year: 2022, Source: "HDRip", Codec: "XviD", Audio: "AAC", Group: "EVO",
+		}},
+		{"Film_Name_2015_720p_WEBRip_x264", Info{
+			Title: "Film Name", Year: 2015, Resolution: "720p", Source: "WEBRip", Codec: "x264",
+		}},
+		{"Movie Title (2020) 1080p BluRay x265 10bit AAC 5.1", Info{
+			Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "BluRay", Codec: "x265", Audio: "AAC 5.1",
+		}},
+		{"Movie Title (2020) [1080p] [WEBRip] [5.1] [YTS.MX]", Info{
+			Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "WEBRip",
+		}},
+		{"Amelie.2001.FRENCH.1080p.BluRay.x264-GRP", Info{
+			Title: "Amelie", Year: 2001, Resolution: "1080p", Source: "BluRay", Codec: "x264", Languages: []string{"fr"}, Group: "GRP",
+		}},
+		{"Das.Boot.1981.GERMAN.DL.1080p.BluRay.x264-GRP", Info{
+			Title: "Das Boot", Year: 1981, Resolution: "1080p", Source: "BluRay", Codec: "x264", Languages: []string{"de"}, Group: "GRP",
+		}},
+		{"Movie.2019.MULTi.1080p.WEB.H264-GRP", Info{
+			Title: "Movie", Year: 2019, Resolution: "1080p", Source: "WEB-DL", Codec: "H.264", Languages: []string{"multi"}, Group: "GRP",
+		}},
+		{"Movie.Title.2018.1080p.BluRay.x264-GRP.mkv", Info{
+			Title: "Movie Title", Year: 2018, Resolution: "1080p", Source: "BluRay", Codec: "x264", Group: "GRP",
+		}},
+		{"Movie.Title.2018.1080p.WEBRip.x264-GRP[rarbg]", Info{
+			Title: "Movie Title", Year: 2018, Resolution: "1080p", Source: "WEBRip", Codec: "x264", Group: "GRP",
+		}},
+		{"Movie.Title.2016.1920x1080.BDRip.x264", Info{
+			Title: "Movie Title", Year: 2016, Resolution: "1080p", Source: "BDRip", Codec: "x264",
+		}},
+		{"Movie.Title.2016.4K.HDR.WEB-DL", Info{
+			Title: "Movie Title", Year: 2016, Resolution: "2160p", Source: "WEB-DL", HDR: "HDR",
+		}},
+		{"Mr. Robot", Info{Title: "Mr. Robot"}},
+
+		// Scene TV
+		{"Show.Name.S02E05.1080p.WEB-DL.x265-GRP", Info{
+			Title: "Show Name", Seasons: []int{2}, Episodes: []int{5}, Resolution: "1080p", Source: "WEB-DL", Codec: "x265", Group: "GRP",
+		}},
+		{"Show.Name.S01E01E02.720p.HDTV.x264-GRP", Info{
+			Title: "Show Name", Seasons: []int{1}, Episodes: []int{1, 2}, Resolution: "720p", Source: "HDTV", Codec: "x264", Group: "GRP",
+		}},
+		{"Show.Name.S01E01-E04.1080p.WEB.h264-GRP", Info{
+			Title: "Show Name", Seasons: []int{1}, Episodes: []int{1, 2, 3, 4}, Resolution: "1080p", Source: "WEB-DL", Codec: "H.264", Group: "GRP",
+		}},
+		{"Show.Name.S03E10-12.720p.WEB.x264-GRP", Info{
+			Title: "Show Name", Seasons: []int{3}, Episodes: []int{10, 11, 12}, Resolution: "720p", Source: "WEB-DL", Codec: "x264", Group: "GRP",
+		}},
+		{"Show Name S03 Complete 720p", Info{
+			Title: "Show Name", Seasons: []int{3}, Resolution: "720p",
+		}},
+		{"Show.Name.S01-S04.1080p.BluRay.x264-GRP", Info{
+			Title: "Show Name", Seasons: []int{1, 2, 3, 4}, Resolution: "1080p", Source: "BluRay", Codec: "x264", Group: "GRP",
+		}},
+		{"Show Name Season 2 Complete 1080p WEB-DL", Info{
+			Title: "Show Name", Seasons: []int{2}, Resolution: "1080p", Source: "WEB-DL",
+		}},
+		{"Show Name Seasons 1-3 720p", Info{
+			Title: "Show Name", Seasons: []int{1, 2, 3}, Resolution: "720p",
+		}},
+		{"Show Name 3x07 HDTV XviD", Info{
+			Title: "Show Name", Seasons: []int{3}, Episodes: []int{7}, Source: "HDTV", Codec: "XviD",
+		}},
+		{"Show.Name.2019.S01E03.1080p.WEB.H264-GRP", Info{
+			Title: "Show Name", Year: 2019, Seasons: []int{1}, Episodes: []int{3}, Resolution: "1080p", Source: "WEB-DL", Codec: "H.264", Group: "GRP",
+		}},
+		{"Show Name (2019) S01E03 Episode Title 1080p", Info{
+			Title: "Show Name", Year: 2019, Seasons: []int{1}, Episodes: []int{3}, Resolution: "1080p",
+		}},
+		{"Show.Name.S05E01.2160p.DSNP.WEB-DL.DDP5.1.DV.HDR.H.265-GRP", Info{
+			Title: "Show Name", Seasons: []int{5}, Episodes: []int{1}, Resolution: "2160p", Source: "WEB-DL", Codec: "H.265", Audio: "DD+ 5.1", HDR: "DV HDR", Group: "GRP",
+		}},
+
+		// Anime
+		{"[SubsPlease] Frieren - 05 (1080p) [ABCD1234].mkv", Info{
+			Title: "Frieren", Episodes: []int{5}, Resolution: "1080p", Group: "SubsPlease",
+		}},
+		{"[Erai-raws] One Piece - 1100 [720p][Multiple Subtitle]", Info{
+			Title: "One Piece", Episodes: []int{1100}, Resolution: "720p", Group: "Erai-raws",
+		}},
+		{"[Group] Anime Title S2 - 03 [1080p HEVC]", Info{
+			Title: "Anime Title", Seasons: []int{2}, Episodes: []int{3}, Resolution: "1080p", Codec: "H.265", Group: "Group",
+		}},
+
+		// Music and audiobooks
+		{"Artist - Album (2019) [FLAC]", Info{
+			Title: "Artist - Album", Year: 2019, Audio: "FLAC",
+		}},
+		{"Artist - Album (1997) [MP3 320]", Info{
+			Title: "Artist - Album", Year: 1997, Audio: "MP3",
+		}},
+
+		// RuTracker
+		{"Во все тяжкие / Breaking Bad / Сезон: 1-5 / Серии: 1-62 из 62 (Винс Гиллиган) [2008, США, драма, BDRip 1080p] MVO + Original", Info{
+			Title: "Во все тяжкие", AltTitles: []string{"Breaking Bad"}, Year: 2008,
+			Seasons: seq(1, 5), Episodes: seq(1, 62), Resolution: "1080p", Source: "BDRip", Languages: []string{"ru"},
+		}},
+		{"Игра престолов / Game of Thrones / Сезон: 8 / Серии: 1-6 из 6 [2019, США, фэнтези, WEB-DL 2160p, HDR] Dub + Original + Sub (Rus, Eng)", Info{
+			Title: "Игра престолов", AltTitles: []string{"Game of Thrones"}, Year: 2019,
+			Seasons: []int{8}, Episodes: seq(1, 6), Resolution: "2160p", Source: "WEB-DL", HDR: "HDR", Languages: []string{"ru", "en"},
+		}},
+		{"Мандалорец / The Mandalorian / Сезон: 3 / Серии: 1-3 из 8 (Джон Фавро) [2023, США, WEB-DLRip] MVO (LostFilm)", Info{
+			Title: "Мандалорец", AltTitles: []string{"The Mandalorian"}, Year: 2023,
+			Seasons: []int{3}, Episodes: seq(1, 3), Source: "WEB-DL", Languages: []string{"ru"},
+		}},
+		{"Брат / Brat (Алексей Балабанов) [1997, Россия, драма, криминал, BDRip 720p]", Info{
+			Title: "Брат", AltTitles: []string{"Brat"}, Year: 1997, Resolution: "720p", Source: "BDRip",
+		}},
+		{"Интерстеллар / Interstellar (Кристофер Нолан / Christopher Nolan) [2014, США, фантастика, BDRemux 1080p] Dub + AVO + Original Eng", Info{
+			Title: "Интерстеллар", AltTitles: []string{"Interstellar"}, Year: 2014, Resolution: "1080p", Source: "Remux", Languages: []string{"ru", "en"},
+		}},
+		{"Москва слезам не верит (Владимир Меньшов) [1979, СССР, мелодрама, DVDRip]", Info{
+			Title: "Москва слезам не верит", Year: 1979, Source: "DVDRip",
+		}},
+		{"Дюна: Часть вторая / Dune: Part Two (Дени Вильнёв) [2024, США, фантастика, WEB-DL 2160p, HDR10, Dolby Vision] Dub + Original + Sub", Info{
+			Title: "Дюна: Часть вторая", AltTitles: []string{"Dune: Part Two"}, Year: 2024,
+			Resolution: "2160p", Source: "WEB-DL", HDR: "DV HDR10", Languages: []string{"ru"},
+		}},
+		{"Шерлок / Sherlock / Сезон 4 / Серия 2 [2017, Великобритания, HDTVRip] DVO", Info{
+			Title: "Шерлок", AltTitles: []string{"Sherlock"}, Year: 2017,
+			Seasons: []int{4}, Episodes: []int{2}, Source: "HDTVRip", Languages: []string{"ru"},
+		}},
+		{"Друзья / Friends / 1-10 сезон [1994-2004, США, комедия, BDRip 720p] MVO + Original", Info{
+			Title: "Друзья", AltTitles: []string{"Friends"}, Year: 2004,
+			Seasons: seq(1, 10), Resolution: "720p", Source: "BDRip", Languages: []string{"ru"},
+		}},
+		{"Метод / Сезон: 2 / Серии: 1-16 из 16 [2020, Россия, детектив, WEB-DL 1080p]", Info{
+			Title: "Метод", Year: 2020, Seasons: []int{2}, Episodes: seq(1, 16), Resolution: "1080p", Source: "WEB-DL",
+		}},
+		{"Король и Шут - Дискография (1996-2013) [FLAC]", Info{
+			Title: "Король и Шут - Дискография", Year: 2013, Audio: "FLAC",
+		}},
+		{"Сериал / Show (Режиссер) [2021, Украина, WEB-DL 1080p] Ukr + Rus", Info{
+			Title: "Сериал", AltTitles: []string{"Show"}, Year: 2021, Resolution: "1080p", Source: "WEB-DL", Languages: []string{"ru", "uk"},
+		}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Parse(tc.name)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Parse(%q)\n got  %+v\n want %+v", tc.name, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPreferredTitle(t *testing.T) {
+	cases := []struct {
+		name string
+		want string
+	}{
+		{"Во все тяжкие / Breaking Bad / Сезон: 1 [2008, BDRip]", "Breaking Bad"},
+		{"Москва слезам не верит [1979, DVDRip]", "Москва слезам не верит"},
+		{"Movie.Title.2021.1080p", "Movie Title"},
+	}
+	for _, tc := range cases {
+		if got := Parse(tc.name).PreferredTitle(); got != tc.want {
+			t.Errorf("PreferredTitle(%q) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestParse_CapsHugeRanges(t *testing.T) {
+	info := Parse("Show / Сезон: 1 / Серии: 1-9999 [2020, WEB-DL]")
+	if len(info.Episodes) != maxRange+1 {
+		t.Fatalf("expected %d episodes, got %d", maxRange+1, len(info.Episodes))
+	}
+}
+
+func seq(from, to int) []int {
+	var s []int
+	for n := from; n <= to; n++ {
+		s = append(s, n)
+	}
+	return s
+}
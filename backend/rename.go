@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/hasmikatom/torrent/naming"
+	"github.com/hasmikatom/torrent/release"
+)
+
+// renamePath renames one file or folder of a torrent. path is relative to
+// the download directory and name replaces its last component.
+func renamePath(id int, path, name string) error {
+	args := map[string]interface{}{
+		"ids":  []int{id},
+		"path": path,
+		"name": name,
+	}
+
+	result, err := client.SendRequest("torrent-rename-path", args)
+	if err != nil {
+		return err
+	}
+	if result.Result != "success" {
+		return errors.New(result.Result)
+	}
+	return nil
+}
+
+// renameTorrentFiles renames a torrent's video and subtitle files to Plex
+// conventions and reports whether the torrent has a top-level folder.
+// Renaming is not critical, so failures are only logged.
+func renameTorrentFiles(id int, info release.Info) bool {
+	t, err := fetchTorrent(id, []string{"id", "name", "files"})
+	if err != nil {
+		log.Printf("Failed to get files of torrent %d: %v", id, err)
+		return false
+	}
+
+	for _, r := range naming.PlanFiles(info, t.Files) {
+		if err := renamePath(id, r.Path, r.Name); err != nil {
+			log.Printf("Failed to rename %q in torrent %d: %v", r.Path, id, err)
+		}
+	}
+
+	for _, f := range t.Files {
+		if strings.Contains(f.Name, "/") {
+			return true
+		}
+	}
+	return false
+}
@@ -1,5 +1,10 @@
 package scraper
 
+import (
+	"github.com/hasmikatom/torrent/classify"
+	"github.com/hasmikatom/torrent/release"
+)
+
 type PirateBayTorrent struct {
 	ID             string `json:"id"`
 	Title          string `json:"title"`
@@ -12,6 +17,9 @@ type PirateBayTorrent struct {
 	DescriptionURL string `json:"description_url"`
 
 	Magnet string `json:"magnet"`
+
+	Parsed     release.Info         `json:"parsed"`
+	Suggestion *classify.Suggestion `json:"suggestion,omitempty"`
 }
 
 type RutrackerTorrent struct {
@@ -28,4 +36,7 @@ type RutrackerTorrent struct {
 	DownloadURL string `json:"download_url"`
 
 	Downloads string `json:"downloads"`
+
+	Parsed     release.Info         `json:"parsed"`
+	Suggestion *classify.Suggestion `json:"suggestion,omitempty"`
 }
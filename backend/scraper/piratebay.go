@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"github.com/chromedp/chromedp"
+	"github.com/hasmikatom/torrent/classify"
+	"github.com/hasmikatom/torrent/release"
 )
 
 func ScrapePirateBay(url string) ([]PirateBayTorrent, error) {
@@ -74,5 +76,10 @@ func ScrapePirateBayWithTimeout(url string, timeout time.Duration) ([]PirateBayT
 		return torrents, err
 	}
 
+	for i := range torrents {
+		torrents[i].Parsed = release.Parse(torrents[i].Title)
+		torrents[i].Suggestion = classify.Suggest(torrents[i].Category, torrents[i].Title, torrents[i].Parsed)
+	}
+
 	return torrents, nil
 }
@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"github.com/chromedp/chromedp"
+	"github.com/hasmikatom/torrent/classify"
+	"github.com/hasmikatom/torrent/release"
 )
 
 func ScrapeRuTracker(url string, torrentName string, creds RutrackerCredentials) ([]RutrackerTorrent, error) {
@@ -74,5 +76,10 @@ func ScrapeRuTrackerWithTimeout(url string, torrentName string, creds RutrackerC
 		return results, err
 	}
 
+	for i := range results {
+		results[i].Parsed = release.Parse(results[i].Title)
+		results[i].Suggestion = classify.Suggest(results[i].Category, results[i].Title, results[i].Parsed)
+	}
+
 	return results, nil
 }
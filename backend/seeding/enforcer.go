@@ -0,0 +1,162 @@
+package seeding
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hasmikatom/torrent/category"
+	"github.com/hasmikatom/torrent/transmission"
+)
+
+// maxRemovals bounds how many removals History reports
+const maxRemovals = 200
+
+// Candidate is a torrent whose seeding policy is satisfied
+type Candidate struct {
+	TorrentID int    `json:"torrentId"`
+	Hash      string `json:"hash"`
+	Name      string `json:"name"`
+	Category  string `json:"category,omitempty"`
+	Policy    Policy `json:"policy"`
+	Reason    string `json:"reason"`
+
+	Ratio          float64 `json:"ratio"`
+	Uploaded       int64   `json:"uploaded"`
+	SecondsSeeding int64   `json:"secondsSeeding"`
+
+	// Removed is set once the torrent was removed; Error when that failed
+	Removed   bool       `json:"removed"`
+	RemovedAt *time.Time `json:"removedAt,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// Enforcer periodically removes torrents that have seeded enough. Their
+// data stays on disk.
+type Enforcer struct {
+	config *Config
+	// list returns every torrent with Fields
+	list func() ([]transmission.Torrent, error)
+	// remove removes torrents without deleting their data
+	remove func(ids []int) error
+	// categoryOf returns the category a download directory belongs to
+	categoryOf func(dir string) (category.Category, bool)
+	now        func() time.Time
+
+	mu      sync.Mutex
+	history []Candidate
+}
+
+// NewEnforcer returns an enforcer for config
+func NewEnforcer(config *Config, list func() ([]transmission.Torrent, error), remove func(ids []int) error, categoryOf func(dir string) (category.Category, bool)) *Enforcer {
+	return &Enforcer{
+		config:     config,
+		list:       list,
+		remove:     remove,
+		categoryOf: categoryOf,
+		now:        time.Now,
+	}
+}
+
+// Run enforces the policies every interval until ctx is cancelled. It does
+// nothing unless removal is enabled.
+func (e *Enforcer) Run(ctx context.Context) {
+	if !e.config.Remove {
+		return
+	}
+
+	ticker := time.NewTicker(e.config.Interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := e.Enforce(); err != nil {
+				log.Printf("Failed to enforce seeding policies: %v", err)
+			}
+		}
+	}
+}
+
+// Preview lists the torrents the enforcer would remove now
+func (e *Enforcer) Preview() ([]Candidate, error) {
+	torrents, err := e.list()
+	if err != nil {
+		return nil, err
+	}
+
+	now := e.now()
+	candidates := make([]Candidate, 0)
+	for _, t := range torrents {
+		var cat category.Category
+		if e.categoryOf != nil {
+			cat, _ = e.categoryOf(t.DownloadDir)
+		}
+		p := e.config.Policy(cat.ID, cat.Seeding, t)
+		ok, reason := p.Satisfied(t, now)
+		if !ok {
+			continue
+		}
+		candidates = append(candidates, Candidate{
+			TorrentID:      t.ID,
+			Hash:           t.HashString,
+			Name:           t.Name,
+			Category:       cat.ID,
+			Policy:         p,
+			Reason:         reason,
+			Ratio:          t.UploadRatio,
+			Uploaded:       t.UploadedEver,
+			SecondsSeeding: t.SecondsSeeding,
+		})
+	}
+	return candidates, nil
+}
+
+// Enforce removes every torrent whose policy is satisfied, one at a time
+// so one failure doesn't hold back the rest, and returns what it did
+func (e *Enforcer) Enforce() ([]Candidate, error) {
+	candidates, err := e.Preview()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range candidates {
+		c := &candidates[i]
+		if err := e.remove([]int{c.TorrentID}); err != nil {
+			c.Error = err.Error()
+			log.Printf("Failed to remove torrent %d after seeding: %v", c.TorrentID, err)
+		} else {
+			now := e.now()
+			c.Removed = true
+			c.RemovedAt = &now
+			log.Printf("Removed torrent %d (%s) after seeding: %s", c.TorrentID, c.Name, c.Reason)
+		}
+		e.record(*c)
+	}
+	return candidates, nil
+}
+
+// History returns recent removals, newest first
+func (e *Enforcer) History() []Candidate {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	list := make([]Candidate, 0, len(e.history))
+	for i := len(e.history) - 1; i >= 0; i-- {
+		list = append(list, e.history[i])
+	}
+	return list
+}
+
+func (e *Enforcer) record(c Candidate) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.history = append(e.history, c)
+	if len(e.history) > maxRemovals {
+		e.history = e.history[len(e.history)-maxRemovals:]
+	}
+}
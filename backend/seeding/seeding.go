@@ -0,0 +1,255 @@
+// Package seeding decides how long torrents seed. Rules in
+// config/seeding.json pick a policy by category, tracker and whether the
+// torrent is private; the ratio and idle limits are handed to Transmission
+// when a torrent is added, and the Enforcer removes torrents (keeping their
+// data) once their policy is satisfied.
+package seeding
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hasmikatom/torrent/category"
+	"github.com/hasmikatom/torrent/configfile"
+	"github.com/hasmikatom/torrent/transmission"
+)
+
+// defaultInterval is how often the enforcer checks torrents
+const defaultInterval = 10 * time.Minute
+
+// Fields are the torrent-get fields rules and the enforcer look at
+var Fields = []string{
+	"id", "hashString", "name", "status", "downloadDir", "percentDone", "leftUntilDone",
+	"metadataPercentComplete", "uploadRatio", "uploadedEver", "secondsSeeding",
+	"activityDate", "doneDate", "isPrivate", "trackers",
+}
+
+// Rule applies a seeding policy to the torrents that match all of its
+// conditions. Conditions left empty match every torrent.
+type Rule struct {
+	ID string `json:"id"`
+	// Categories are category ids
+	Categories []string `json:"categories,omitempty"`
+	// Trackers are announce hosts; "t-ru.org" also matches "bt2.t-ru.org"
+	Trackers []string `json:"trackers,omitempty"`
+	// Private matches private (true) or public (false) torrents
+	Private *bool `json:"private,omitempty"`
+
+	category.SeedingPolicy
+}
+
+// Config is the contents of config/seeding.json
+type Config struct {
+	// Remove lets the enforcer remove torrents whose policy is satisfied;
+	// without it the enforcer only reports them
+	Remove bool `json:"remove"`
+	// IntervalMinutes is how often the enforcer runs, 10 by default
+	IntervalMinutes int `json:"intervalMinutes,omitempty"`
+	// Rules are tried in order and the first match wins. Limits the rule
+	// leaves unset come from the torrent's category.
+	Rules []Rule `json:"rules"`
+}
+
+var (
+	seedingConfig     *Config
+	seedingConfigOnce sync.Once
+)
+
+// LoadConfig reads config/seeding.json once. Without it only the
+// categories' seeding limits apply and nothing is removed.
+func LoadConfig() *Config {
+	seedingConfigOnce.Do(func() {
+		var config Config
+		path, err := configfile.Load("seeding.json", &config)
+		if err != nil {
+			log.Printf("Warning: %v, using category seeding limits only", err)
+			seedingConfig = &Config{}
+			return
+		}
+		log.Printf("Loaded seeding config from: %s", path)
+
+		config.Rules = validRules(config.Rules)
+		seedingConfig = &config
+	})
+
+	return seedingConfig
+}
+
+// validRules drops rules without an id or with negative limits, logging why
+func validRules(rules []Rule) []Rule {
+	seen := make(map[string]bool)
+	var valid []Rule
+	for _, r := range rules {
+		if err := r.validate(); err != nil {
+			log.Printf("Warning: skipping seeding rule %q: %v", r.ID, err)
+			continue
+		}
+		if seen[r.ID] {
+			log.Printf("Warning: skipping duplicate seeding rule %q", r.ID)
+			continue
+		}
+		seen[r.ID] = true
+		valid = append(valid, r)
+	}
+	return valid
+}
+
+func (r Rule) validate() error {
+	if r.ID == "" {
+		return fmt.Errorf("id is required")
+	}
+	if r.RatioLimit != nil && *r.RatioLimit < 0 {
+		return fmt.Errorf("ratioLimit cannot be negative")
+	}
+	if r.IdleLimitMinutes != nil && *r.IdleLimitMinutes < 0 {
+		return fmt.Errorf("idleLimitMinutes cannot be negative")
+	}
+	if r.SeedTimeLimitMinutes != nil && *r.SeedTimeLimitMinutes < 0 {
+		return fmt.Errorf("seedTimeLimitMinutes cannot be negative")
+	}
+	return nil
+}
+
+// Interval is how often the enforcer runs
+func (c *Config) Interval() time.Duration {
+	if c.IntervalMinutes <= 0 {
+		return defaultInterval
+	}
+	return time.Duration(c.IntervalMinutes) * time.Minute
+}
+
+// Policy is the seeding policy for one torrent and the rule it came from
+type Policy struct {
+	// Rule is the id of the matching rule, "" when only the category applies
+	Rule string `json:"rule,omitempty"`
+	category.SeedingPolicy
+}
+
+// Set reports whether the policy limits seeding at all
+func (p Policy) Set() bool {
+	return p.RatioLimit != nil || p.IdleLimitMinutes != nil || p.SeedTimeLimitMinutes != nil
+}
+
+// Policy resolves the policy of a torrent in a category (categoryID may be
+// "" when unknown) whose own category limits are base
+func (c *Config) Policy(categoryID string, base category.SeedingPolicy, t transmission.Torrent) Policy {
+	p := Policy{SeedingPolicy: base}
+	for _, r := range c.Rules {
+		if !r.Matches(categoryID, t) {
+			continue
+		}
+		p.Rule = r.ID
+		if r.RatioLimit != nil {
+			p.RatioLimit = r.RatioLimit
+		}
+		if r.IdleLimitMinutes != nil {
+			p.IdleLimitMinutes = r.IdleLimitMinutes
+		}
+		if r.SeedTimeLimitMinutes != nil {
+			p.SeedTimeLimitMinutes = r.SeedTimeLimitMinutes
+		}
+		break
+	}
+	return p
+}
+
+// Matches reports whether a torrent meets all of the rule's conditions
+func (r Rule) Matches(categoryID string, t transmission.Torrent) bool {
+	if len(r.Categories) > 0 && !contains(r.Categories, categoryID) {
+		return false
+	}
+	if r.Private != nil && *r.Private != t.IsPrivate {
+		return false
+	}
+	if len(r.Trackers) == 0 {
+		return true
+	}
+	for _, tr := range t.Trackers {
+		host := trackerHost(tr.Announce)
+		for _, want := range r.Trackers {
+			want = strings.ToLower(want)
+			if host == want || strings.HasSuffix(host, "."+want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func trackerHost(announce string) string {
+	u, err := url.Parse(announce)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Satisfied reports whether a finished torrent has seeded enough under the
+// policy: any one limit reached is enough, as with Transmission's own
+// limits. The reason says which.
+func (p Policy) Satisfied(t transmission.Torrent, now time.Time) (bool, string) {
+	if !Done(t) {
+		return false, ""
+	}
+	if p.RatioLimit != nil && t.UploadRatio >= *p.RatioLimit {
+		return true, fmt.Sprintf("ratio %.2f reached the %.2f limit", t.UploadRatio, *p.RatioLimit)
+	}
+	if p.SeedTimeLimitMinutes != nil {
+		seeded := time.Duration(t.SecondsSeeding) * time.Second
+		if limit := minutes(*p.SeedTimeLimitMinutes); seeded >= limit {
+			return true, fmt.Sprintf("seeded for %s, limit %s", seeded.Round(time.Minute), limit)
+		}
+	}
+	if p.IdleLimitMinutes != nil {
+		last := max(t.ActivityDate, t.DoneDate)
+		if last > 0 {
+			idle := now.Sub(time.Unix(last, 0))
+			if limit := minutes(*p.IdleLimitMinutes); idle >= limit {
+				return true, fmt.Sprintf("idle for %s, limit %s", idle.Round(time.Minute), limit)
+			}
+		}
+	}
+	return false, ""
+}
+
+// Done reports whether a torrent has all the data it wants
+func Done(t transmission.Torrent) bool {
+	return t.MetadataPercentComplete >= 1 && t.PercentDone >= 1 && t.LeftUntilDone == 0
+}
+
+func minutes(n int) time.Duration {
+	return time.Duration(n) * time.Minute
+}
+
+// TorrentSetArgs are the torrent-set arguments that hand the policy's ratio
+// and idle limits to Transmission, or nil when it sets neither
+func (p Policy) TorrentSetArgs(id int) map[string]interface{} {
+	args := map[string]interface{}{
+		"ids": []int{id},
+	}
+	if p.RatioLimit != nil {
+		args["seedRatioLimit"] = *p.RatioLimit
+		args["seedRatioMode"] = 1 // use the torrent's own limit
+	}
+	if p.IdleLimitMinutes != nil {
+		args["seedIdleLimit"] = *p.IdleLimitMinutes
+		args["seedIdleMode"] = 1
+	}
+	if len(args) == 1 {
+		return nil
+	}
+	return args
+}
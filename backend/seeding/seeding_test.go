@@ -0,0 +1,154 @@
+package seeding
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hasmikatom/torrent/category"
+	"github.com/hasmikatom/torrent/transmission"
+)
+
+func float(f float64) *float64 { return &f }
+func integer(n int) *int       { return &n }
+func boolean(b bool) *bool     { return &b }
+
+var testConfig = &Config{
+	Remove: true,
+	Rules: []Rule{
+		{ID: "rutracker", Trackers: []string{"t-ru.org"}, SeedingPolicy: category.SeedingPolicy{RatioLimit: float(1)}},
+		{ID: "public", Private: boolean(false), SeedingPolicy: category.SeedingPolicy{SeedTimeLimitMinutes: integer(24 * 60)}},
+	},
+}
+
+func torrent(announce string, private bool) transmission.Torrent {
+	return transmission.Torrent{
+		ID:                      1,
+		Name:                    "x",
+		PercentDone:             1,
+		MetadataPercentComplete: 1,
+		IsPrivate:               private,
+		Trackers:                []transmission.Tracker{{Announce: announce}},
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	base := category.SeedingPolicy{RatioLimit: float(2), IdleLimitMinutes: integer(60)}
+	cases := []struct {
+		name     string
+		torrent  transmission.Torrent
+		wantRule string
+		ratio    float64
+		seedTime bool
+	}{
+		{"tracker subdomain", torrent("http://bt2.t-ru.org/ann?pk=1", true), "rutracker", 1, false},
+		{"public tracker", torrent("udp://tracker.opentrackr.org:1337/announce", false), "public", 2, true},
+		{"private elsewhere keeps the category policy", torrent("https://tracker.example/announce", true), "", 2, false},
+		{"lookalike host", torrent("http://not-t-ru.org/ann", true), "", 2, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := testConfig.Policy("Movies", base, tc.torrent)
+			if p.Rule != tc.wantRule || *p.RatioLimit != tc.ratio || (p.SeedTimeLimitMinutes != nil) != tc.seedTime {
+				t.Fatalf("unexpected policy %+v", p)
+			}
+			if *p.IdleLimitMinutes != 60 {
+				t.Fatal("expected the category's idle limit to be kept")
+			}
+		})
+	}
+
+	cats := &Config{Rules: []Rule{{ID: "music", Categories: []string{"Music"}, SeedingPolicy: category.SeedingPolicy{RatioLimit: float(3)}}}}
+	if p := cats.Policy("Movies", category.SeedingPolicy{}, torrent("", false)); p.Rule != "" || p.Set() {
+		t.Fatalf("rule for another category applied: %+v", p)
+	}
+}
+
+func TestSatisfied(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	p := Policy{SeedingPolicy: category.SeedingPolicy{
+		RatioLimit:           float(1),
+		SeedTimeLimitMinutes: integer(60),
+		IdleLimitMinutes:     integer(30),
+	}}
+
+	active := torrent("", false)
+	active.ActivityDate = now.Unix()
+
+	cases := []struct {
+		name   string
+		modify func(*transmission.Torrent)
+		want   string
+	}{
+		{"nothing reached", func(*transmission.Torrent) {}, ""},
+		{"ratio", func(t *transmission.Torrent) { t.UploadRatio = 1.2 }, "ratio 1.20"},
+		{"seed time", func(t *transmission.Torrent) { t.SecondsSeeding = 3600 }, "seeded for 1h0m0s"},
+		{"idle", func(t *transmission.Torrent) { t.ActivityDate = now.Add(-45 * time.Minute).Unix() }, "idle for 45m0s"},
+		{"still downloading", func(t *transmission.Torrent) { t.UploadRatio, t.PercentDone, t.LeftUntilDone = 5, 0.5, 10 }, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tr := active
+			tc.modify(&tr)
+			ok, reason := p.Satisfied(tr, now)
+			if ok != (tc.want != "") || !strings.HasPrefix(reason, tc.want) {
+				t.Fatalf("Satisfied = %v, %q", ok, reason)
+			}
+		})
+	}
+
+	if ok, _ := (Policy{}).Satisfied(active, now); ok {
+		t.Fatal("a torrent without limits should seed forever")
+	}
+}
+
+func TestTorrentSetArgs(t *testing.T) {
+	if args := (Policy{SeedingPolicy: category.SeedingPolicy{SeedTimeLimitMinutes: integer(5)}}).TorrentSetArgs(3); args != nil {
+		t.Fatalf("seed time alone is not a Transmission limit, got %v", args)
+	}
+	args := Policy{SeedingPolicy: category.SeedingPolicy{RatioLimit: float(1.5), IdleLimitMinutes: integer(10)}}.TorrentSetArgs(3)
+	if args["seedRatioLimit"] != 1.5 || args["seedRatioMode"] != 1 || args["seedIdleLimit"] != 10 || args["seedIdleMode"] != 1 {
+		t.Fatalf("unexpected args %v", args)
+	}
+}
+
+func TestEnforcer(t *testing.T) {
+	done := torrent("http://bt.t-ru.org/ann", true)
+	done.ID, done.UploadRatio = 1, 1.5
+	failing := torrent("http://bt.t-ru.org/ann", true)
+	failing.ID, failing.UploadRatio = 2, 3
+	seeding := torrent("http://bt.t-ru.org/ann", true)
+	seeding.ID, seeding.UploadRatio = 3, 0.4
+
+	var removed []int
+	e := NewEnforcer(testConfig, func() ([]transmission.Torrent, error) {
+		return []transmission.Torrent{done, failing, seeding}, nil
+	}, func(ids []int) error {
+		if ids[0] == 2 {
+			return errors.New("daemon said no")
+		}
+		removed = append(removed, ids...)
+		return nil
+	}, func(string) (category.Category, bool) { return category.Category{ID: "Movies"}, true })
+
+	preview, err := e.Preview()
+	if err != nil || len(preview) != 2 || preview[0].Policy.Rule != "rutracker" || preview[0].Category != "Movies" {
+		t.Fatalf("unexpected preview %+v, %v", preview, err)
+	}
+	if len(removed) != 0 || len(e.History()) != 0 {
+		t.Fatal("preview removed torrents")
+	}
+
+	result, err := e.Enforce()
+	if err != nil || len(result) != 2 {
+		t.Fatalf("unexpected result %+v, %v", result, err)
+	}
+	if len(removed) != 1 || removed[0] != 1 {
+		t.Fatalf("removed %v", removed)
+	}
+	history := e.History()
+	if len(history) != 2 || history[0].TorrentID != 2 || history[0].Error == "" || !history[1].Removed {
+		t.Fatalf("unexpected history %+v", history)
+	}
+}
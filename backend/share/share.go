@@ -0,0 +1,169 @@
+// Package share signs short-lived links to a torrent's files, so a file can
+// be fetched without a session, e.g. from a laptop or a media player.
+package share
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hasmikatom/torrent/configfile"
+	"github.com/hasmikatom/torrent/store"
+)
+
+// Defaults when config/share.json leaves them out
+const (
+	defaultMinutes = 60
+	defaultMax     = 24 * 60
+)
+
+var (
+	// ErrInvalid says a token wasn't signed by this server or was altered
+	ErrInvalid = errors.New("invalid share link")
+	// ErrExpired says a token's time is up
+	ErrExpired = errors.New("share link has expired")
+)
+
+// Config is the contents of config/share.json
+type Config struct {
+	// DefaultMinutes is how long a link lasts when the request doesn't say
+	DefaultMinutes int `json:"defaultMinutes,omitempty"`
+	// MaxMinutes caps how long a link may last
+	MaxMinutes int `json:"maxMinutes,omitempty"`
+	// SecretEnv names an environment variable holding the signing key.
+	// Without it a key is generated once and kept in the data directory.
+	SecretEnv string `json:"secretEnv,omitempty"`
+}
+
+var (
+	shareConfig     *Config
+	shareConfigOnce sync.Once
+)
+
+// LoadConfig reads config/share.json once
+func LoadConfig() *Config {
+	shareConfigOnce.Do(func() {
+		var config Config
+		path, err := configfile.Load("share.json", &config)
+		if err != nil {
+			log.Printf("Warning: %v, share links last an hour", err)
+			shareConfig = &Config{}
+			return
+		}
+		log.Printf("Loaded share config from: %s", path)
+		shareConfig = &config
+	})
+
+	return shareConfig
+}
+
+// TTL is how long a link asked to last minutes lasts, 0 for the default
+func (c *Config) TTL(minutes int) time.Duration {
+	limit := c.MaxMinutes
+	if limit <= 0 {
+		limit = defaultMax
+	}
+	if minutes <= 0 {
+		minutes = c.DefaultMinutes
+	}
+	if minutes <= 0 {
+		minutes = defaultMinutes
+	}
+	return time.Duration(min(minutes, limit)) * time.Minute
+}
+
+// Link is what a token grants: one file of one torrent until Expires
+type Link struct {
+	TorrentID int    `json:"t"`
+	Hash      string `json:"h"`
+	Path      string `json:"p"`
+	// Expires is a Unix time
+	Expires int64 `json:"e"`
+}
+
+// Signer signs and checks tokens
+type Signer struct {
+	key []byte
+}
+
+// NewSigner returns a signer for key
+func NewSigner(key []byte) *Signer {
+	return &Signer{key: key}
+}
+
+// savedKey is the key kept in the data directory
+type savedKey struct {
+	Key []byte `json:"key"`
+}
+
+// LoadSigner returns a signer using the key from config's environment
+// variable, or the one kept in dataDir, generated on first use so links
+// survive a restart
+func LoadSigner(config *Config, dataDir string) (*Signer, error) {
+	if config.SecretEnv != "" {
+		if secret := os.Getenv(config.SecretEnv); secret != "" {
+			return NewSigner([]byte(secret)), nil
+		}
+		log.Printf("Warning: %s is not set, using the share key in the data directory", config.SecretEnv)
+	}
+
+	file := store.NewJSONFile(dataDir, "share-key.json")
+	var saved savedKey
+	if err := file.Load(&saved); err != nil {
+		return nil, err
+	}
+	if len(saved.Key) == 0 {
+		saved.Key = make([]byte, 32)
+		if _, err := rand.Read(saved.Key); err != nil {
+			return nil, err
+		}
+		if err := file.Save(saved); err != nil {
+			return nil, err
+		}
+	}
+	return NewSigner(saved.Key), nil
+}
+
+// Sign returns a URL-safe token for link
+func (s *Signer) Sign(link Link) string {
+	payload, _ := json.Marshal(link)
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + s.mac(encoded)
+}
+
+// Verify returns the link a token grants, ErrInvalid when it wasn't signed
+// by s and ErrExpired once it has run out at now
+func (s *Signer) Verify(token string, now time.Time) (Link, error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(s.mac(encoded))) {
+		return Link{}, ErrInvalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return Link{}, ErrInvalid
+	}
+	var link Link
+	if err := json.Unmarshal(payload, &link); err != nil {
+		return Link{}, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if now.Unix() >= link.Expires {
+		return Link{}, ErrExpired
+	}
+	return link, nil
+}
+
+func (s *Signer) mac(encoded string) string {
+	h := hmac.New(sha256.New, s.key)
+	h.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,84 @@
+package share
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSigner_Verify(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	s := NewSigner([]byte("secret"))
+	link := Link{TorrentID: 7, Hash: "abc", Path: "Film/Film.mkv", Expires: now.Add(time.Hour).Unix()}
+	token := s.Sign(link)
+
+	got, err := s.Verify(token, now)
+	if err != nil || got != link {
+		t.Fatalf("unexpected %+v, %v", got, err)
+	}
+	if _, err := s.Verify(token, now.Add(time.Hour)); !errors.Is(err, ErrExpired) {
+		t.Errorf("expected the link to expire, got %v", err)
+	}
+
+	// A token signed with another key, or altered, is refused
+	if _, err := NewSigner([]byte("other")).Verify(token, now); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected another key to be refused, got %v", err)
+	}
+	forged := Link{TorrentID: 7, Hash: "abc", Path: "../../etc/passwd", Expires: link.Expires}
+	payload, _, _ := strings.Cut(s.Sign(forged), ".")
+	_, sig, _ := strings.Cut(token, ".")
+	if _, err := s.Verify(payload+"."+sig, now); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected a swapped payload to be refused, got %v", err)
+	}
+	for _, bad := range []string{"", "nodot", "a.b"} {
+		if _, err := s.Verify(bad, now); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Verify(%q) = %v", bad, err)
+		}
+	}
+}
+
+func TestLoadSigner_KeepsKey(t *testing.T) {
+	dir := t.TempDir()
+	first, err := LoadSigner(&Config{}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := LoadSigner(&Config{}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	link := Link{TorrentID: 1, Expires: time.Now().Add(time.Minute).Unix()}
+	if _, err := second.Verify(first.Sign(link), time.Now()); err != nil {
+		t.Fatalf("expected links to survive a restart, got %v", err)
+	}
+
+	t.Setenv("SHARE_TEST_SECRET", "from-env")
+	env, err := LoadSigner(&Config{SecretEnv: "SHARE_TEST_SECRET"}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.Verify(first.Sign(link), time.Now()); err == nil {
+		t.Fatal("expected the environment key to replace the kept one")
+	}
+}
+
+func TestConfig_TTL(t *testing.T) {
+	cases := []struct {
+		config  Config
+		minutes int
+		want    time.Duration
+	}{
+		{Config{}, 0, time.Hour},
+		{Config{}, 10, 10 * time.Minute},
+		{Config{}, 100000, 24 * time.Hour},
+		{Config{DefaultMinutes: 5, MaxMinutes: 30}, 0, 5 * time.Minute},
+		{Config{DefaultMinutes: 5, MaxMinutes: 30}, 60, 30 * time.Minute},
+	}
+	for _, c := range cases {
+		if got := c.config.TTL(c.minutes); got != c.want {
+			t.Errorf("%+v.TTL(%d) = %s, want %s", c.config, c.minutes, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+// Package stall decides what happens to torrents the watcher reports as
+// stalled: a magnet that never gets metadata, a download without peers or
+// progress, or one whose tracker keeps failing.
+package stall
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hasmikatom/torrent/configfile"
+	"github.com/hasmikatom/torrent/events"
+	"github.com/hasmikatom/torrent/watcher"
+)
+
+// Actions
+const (
+	// ActionNotify only delivers the torrent.stalled event to webhooks and
+	// notification targets
+	ActionNotify = "notify"
+	// ActionReannounce asks the trackers for peers again
+	ActionReannounce = "reannounce"
+	// ActionRemove removes the torrent together with its data
+	ActionRemove = "remove"
+)
+
+// maxHistory bounds how many actions History reports
+const maxHistory = 200
+
+// Check is when a stall reason applies and what to do about it
+type Check struct {
+	Minutes int    `json:"minutes"`
+	Action  string `json:"action"`
+}
+
+// Config is the contents of config/stalled.json. Checks left out are off.
+type Config struct {
+	NoMetadata   *Check `json:"noMetadata,omitempty"`
+	NoProgress   *Check `json:"noProgress,omitempty"`
+	NoPeers      *Check `json:"noPeers,omitempty"`
+	TrackerError *Check `json:"trackerError,omitempty"`
+}
+
+var (
+	stallConfig     *Config
+	stallConfigOnce sync.Once
+)
+
+// LoadConfig reads config/stalled.json once. Without it downloads are
+// reported after 30 minutes without progress and nothing else is done.
+func LoadConfig() *Config {
+	stallConfigOnce.Do(func() {
+		var config Config
+		path, err := configfile.Load("stalled.json", &config)
+		if err != nil {
+			log.Printf("Warning: %v, using default stall detection", err)
+			stallConfig = &Config{NoProgress: &Check{Minutes: 30, Action: ActionNotify}}
+			return
+		}
+		log.Printf("Loaded stall config from: %s", path)
+
+		for name, c := range config.checks() {
+			if c == nil {
+				continue
+			}
+			if err := c.validate(); err != nil {
+				log.Printf("Warning: skipping stall check %s: %v", name, err)
+				*config.check(name) = nil
+			}
+		}
+		stallConfig = &config
+	})
+
+	return stallConfig
+}
+
+func (c *Config) checks() map[string]*Check {
+	return map[string]*Check{
+		watcher.StallNoMetadata:   c.NoMetadata,
+		watcher.StallNoProgress:   c.NoProgress,
+		watcher.StallNoPeers:      c.NoPeers,
+		watcher.StallTrackerError: c.TrackerError,
+	}
+}
+
+func (c *Config) check(reason string) **Check {
+	switch reason {
+	case watcher.StallNoMetadata:
+		return &c.NoMetadata
+	case watcher.StallNoProgress:
+		return &c.NoProgress
+	case watcher.StallNoPeers:
+		return &c.NoPeers
+	case watcher.StallTrackerError:
+		return &c.TrackerError
+	}
+	return nil
+}
+
+func (c *Check) validate() error {
+	if c.Minutes <= 0 {
+		return fmt.Errorf("minutes must be positive")
+	}
+	switch c.Action {
+	case "":
+		c.Action = ActionNotify
+	case ActionNotify, ActionReannounce, ActionRemove:
+	default:
+		return fmt.Errorf("unknown action %q", c.Action)
+	}
+	return nil
+}
+
+// Action returns the action for a stall reason, "" when the check is off
+func (c *Config) Action(reason string) string {
+	if p := c.check(reason); p != nil && *p != nil {
+		return (*p).Action
+	}
+	return ""
+}
+
+// Apply sets the watcher's stall durations from the config
+func (c *Config) Apply(opts watcher.Options) watcher.Options {
+	after := func(c *Check) time.Duration {
+		if c == nil {
+			return 0
+		}
+		return time.Duration(c.Minutes) * time.Minute
+	}
+	opts.StallAfter = after(c.NoProgress)
+	opts.NoMetadataAfter = after(c.NoMetadata)
+	opts.NoPeersAfter = after(c.NoPeers)
+	opts.TrackerErrorAfter = after(c.TrackerError)
+	return opts
+}
+
+// Action is something done about a stalled torrent
+type Action struct {
+	EventID   string    `json:"eventId"`
+	TorrentID int       `json:"torrentId"`
+	Name      string    `json:"name"`
+	Reason    string    `json:"reason"`
+	Detail    string    `json:"detail"`
+	Action    string    `json:"action"`
+	Error     string    `json:"error,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// Handler acts on torrent.stalled events
+type Handler struct {
+	config *Config
+	// stall returns why the watcher considers a torrent stalled
+	stall      func(hash string) (watcher.Stall, bool)
+	reannounce func(id int) error
+	// remove removes a torrent and its data
+	remove func(id int) error
+
+	mu      sync.Mutex
+	history []Action
+}
+
+// NewHandler returns a handler for config
+func NewHandler(config *Config, stall func(hash string) (watcher.Stall, bool), reannounce, remove func(id int) error) *Handler {
+	return &Handler{config: config, stall: stall, reannounce: reannounce, remove: remove}
+}
+
+// Run handles stalled events until the channel closes or ctx is cancelled
+func (h *Handler) Run(ctx context.Context, ch <-chan events.Event) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			if e.Type == events.Stalled {
+				h.Handle(e)
+			}
+		}
+	}
+}
+
+// Handle carries out the configured action for one stalled event
+func (h *Handler) Handle(e events.Event) Action {
+	a := Action{
+		EventID:   e.ID,
+		TorrentID: e.Torrent.ID,
+		Name:      e.Torrent.Name,
+		Detail:    e.Reason,
+		At:        time.Now(),
+	}
+	if s, ok := h.stall(e.Torrent.Hash); ok {
+		a.Reason = s.Reason
+		a.Detail = s.Detail
+	}
+	a.Action = h.config.Action(a.Reason)
+	if a.Action == "" {
+		a.Action = ActionNotify
+	}
+
+	var err error
+	switch a.Action {
+	case ActionReannounce:
+		err = h.reannounce(e.Torrent.ID)
+	case ActionRemove:
+		err = h.remove(e.Torrent.ID)
+	}
+	if err != nil {
+		a.Error = err.Error()
+		log.Printf("Failed to %s stalled torrent %d: %v", a.Action, e.Torrent.ID, err)
+	} else if a.Action != ActionNotify {
+		log.Printf("Stalled torrent %d (%s): %s, did %s", e.Torrent.ID, e.Torrent.Name, a.Detail, a.Action)
+	}
+
+	h.record(a)
+	return a
+}
+
+// History returns recent actions, newest first
+func (h *Handler) History() []Action {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	list := make([]Action, 0, len(h.history))
+	for i := len(h.history) - 1; i >= 0; i-- {
+		list = append(list, h.history[i])
+	}
+	return list
+}
+
+func (h *Handler) record(a Action) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.history = append(h.history, a)
+	if len(h.history) > maxHistory {
+		h.history = h.history[len(h.history)-maxHistory:]
+	}
+}
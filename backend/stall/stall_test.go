@@ -0,0 +1,99 @@
+package stall
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hasmikatom/torrent/events"
+	"github.com/hasmikatom/torrent/watcher"
+)
+
+func TestCheck_Validate(t *testing.T) {
+	cases := []struct {
+		check   Check
+		wantErr bool
+		action  string
+	}{
+		{Check{Minutes: 30}, false, ActionNotify},
+		{Check{Minutes: 30, Action: ActionRemove}, false, ActionRemove},
+		{Check{Minutes: 0, Action: ActionNotify}, true, ""},
+		{Check{Minutes: 30, Action: "delete"}, true, ""},
+	}
+	for _, tc := range cases {
+		c := tc.check
+		err := c.validate()
+		if (err != nil) != tc.wantErr || (!tc.wantErr && c.Action != tc.action) {
+			t.Errorf("validate(%+v) = %v, action %q", tc.check, err, c.Action)
+		}
+	}
+}
+
+func TestConfig_Apply(t *testing.T) {
+	c := &Config{
+		NoMetadata: &Check{Minutes: 60, Action: ActionRemove},
+		NoPeers:    &Check{Minutes: 20, Action: ActionReannounce},
+	}
+	opts := c.Apply(watcher.Options{Interval: time.Second, StallAfter: time.Hour})
+	if opts.Interval != time.Second || opts.StallAfter != 0 || opts.NoMetadataAfter != time.Hour || opts.NoPeersAfter != 20*time.Minute || opts.TrackerErrorAfter != 0 {
+		t.Fatalf("unexpected options %+v", opts)
+	}
+	if c.Action(watcher.StallNoPeers) != ActionReannounce || c.Action(watcher.StallTrackerError) != "" {
+		t.Fatal("unexpected actions")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	c := &Config{
+		NoMetadata:   &Check{Minutes: 60, Action: ActionRemove},
+		NoPeers:      &Check{Minutes: 20, Action: ActionReannounce},
+		TrackerError: &Check{Minutes: 20, Action: ActionNotify},
+	}
+	stalls := map[string]watcher.Stall{
+		"meta":    {Reason: watcher.StallNoMetadata, Detail: "no metadata since then"},
+		"peers":   {Reason: watcher.StallNoPeers, Detail: "no peers since then"},
+		"tracker": {Reason: watcher.StallTrackerError, Detail: "tracker errors since then"},
+		"broken":  {Reason: watcher.StallNoPeers, Detail: "no peers since then"},
+	}
+	var reannounced, removed []int
+	h := NewHandler(c, func(hash string) (watcher.Stall, bool) {
+		s, ok := stalls[hash]
+		return s, ok
+	}, func(id int) error {
+		if id == 4 {
+			return errors.New("daemon unreachable")
+		}
+		reannounced = append(reannounced, id)
+		return nil
+	}, func(id int) error {
+		removed = append(removed, id)
+		return nil
+	})
+
+	cases := []struct {
+		torrent events.Torrent
+		action  string
+		failed  bool
+	}{
+		{events.Torrent{ID: 1, Hash: "meta"}, ActionRemove, false},
+		{events.Torrent{ID: 2, Hash: "peers"}, ActionReannounce, false},
+		{events.Torrent{ID: 3, Hash: "tracker"}, ActionNotify, false},
+		{events.Torrent{ID: 4, Hash: "broken"}, ActionReannounce, true},
+		{events.Torrent{ID: 5, Hash: "recovered"}, ActionNotify, false},
+	}
+	for _, tc := range cases {
+		e := events.New(events.Stalled, tc.torrent, time.Now())
+		e.Reason = "from the event"
+		a := h.Handle(e)
+		if a.Action != tc.action || (a.Error != "") != tc.failed {
+			t.Errorf("torrent %d: unexpected action %+v", tc.torrent.ID, a)
+		}
+	}
+
+	if len(removed) != 1 || removed[0] != 1 || len(reannounced) != 1 || reannounced[0] != 2 {
+		t.Fatalf("removed %v, reannounced %v", removed, reannounced)
+	}
+	if history := h.History(); len(history) != 5 || history[0].TorrentID != 5 || history[0].Detail != "from the event" {
+		t.Fatalf("unexpected history %+v", history)
+	}
+}
@@ -0,0 +1,67 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// JSONFile persists a single JSON document on disk. Writes go to a temp file
+// first and are renamed into place so a crash never leaves a half-written file.
+type JSONFile struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewJSONFile returns a store for the given file name inside dir
+func NewJSONFile(dir, name string) *JSONFile {
+	return &JSONFile{path: filepath.Join(dir, name)}
+}
+
+// Path returns the location of the backing file
+func (f *JSONFile) Path() string {
+	return f.path
+}
+
+// Load decodes the file into v. A missing file is not an error and leaves v untouched.
+func (f *JSONFile) Load(v any) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", f.path, err)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("error decoding %s: %v", f.path, err)
+	}
+	return nil
+}
+
+// Save encodes v and atomically replaces the file
+func (f *JSONFile) Save(v any) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding %s: %v", f.path, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+		return fmt.Errorf("error creating data dir: %v", err)
+	}
+
+	tmp := f.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("error writing %s: %v", tmp, err)
+	}
+	return os.Rename(tmp, f.path)
+}
@@ -73,3 +73,35 @@ func (t *TransmissionRPC) doRequest(jsonData []byte) (*RPCResponse, error) {
 
 	return &result, nil
 }
+
+// GetTorrents runs torrent-get for the given ids (torrent ids or hash
+// strings, nil for all torrents) and decodes the result into typed torrents
+func (t *TransmissionRPC) GetTorrents(ids any, fields []string) ([]Torrent, error) {
+	args := map[string]any{
+		"fields": fields,
+	}
+	if ids != nil {
+		args["ids"] = ids
+	}
+
+	resp, err := t.SendRequest("torrent-get", args)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Result != "success" {
+		return nil, fmt.Errorf("torrent-get failed: %s", resp.Result)
+	}
+
+	raw, err := json.Marshal(resp.Arguments["torrents"])
+	if err != nil {
+		return nil, fmt.Errorf("error re-encoding torrents: %v", err)
+	}
+
+	var torrents []Torrent
+	if err := json.Unmarshal(raw, &torrents); err != nil {
+		return nil, fmt.Errorf("error decoding torrents: %v", err)
+	}
+
+	return torrents, nil
+}
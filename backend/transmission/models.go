@@ -21,3 +21,57 @@ type RPCResponse struct {
 	Arguments map[string]any `json:"arguments"`
 	Tag       int            `json:"tag"`
 }
+
+// Torrent is a typed view of the torrent-get fields the backend works with.
+// Only the fields that were requested are populated.
+type Torrent struct {
+	ID                      int       `json:"id"`
+	HashString              string    `json:"hashString"`
+	Name                    string    `json:"name"`
+	Status                  int       `json:"status"`
+	PercentDone             float64   `json:"percentDone"`
+	TotalSize               int64     `json:"totalSize"`
+	SizeWhenDone            int64     `json:"sizeWhenDone"`
+	MetadataPercentComplete float64   `json:"metadataPercentComplete"`
+	DownloadDir             string    `json:"downloadDir"`
+	Files                   []File    `json:"files"`
+	LeftUntilDone           int64     `json:"leftUntilDone"`
+	DownloadedEver          int64     `json:"downloadedEver"`
+	RateDownload            int64     `json:"rateDownload"`
+	PeersConnected          int       `json:"peersConnected"`
+	Error                   int       `json:"error"`
+	ErrorString             string    `json:"errorString"`
+	AddedDate               int64     `json:"addedDate"`
+	DoneDate                int64     `json:"doneDate"`
+	ActivityDate            int64     `json:"activityDate"`
+	UploadRatio             float64   `json:"uploadRatio"`
+	UploadedEver            int64     `json:"uploadedEver"`
+	SecondsSeeding          int64     `json:"secondsSeeding"`
+	IsPrivate               bool      `json:"isPrivate"`
+	Trackers                []Tracker `json:"trackers"`
+}
+
+// Tracker is one entry of a torrent's "trackers" field
+type Tracker struct {
+	Announce string `json:"announce"`
+	Tier     int    `json:"tier"`
+}
+
+// File is one entry of a torrent's "files" field. Name is the path
+// relative to the download directory, starting with the torrent's name.
+type File struct {
+	Name           string `json:"name"`
+	Length         int64  `json:"length"`
+	BytesCompleted int64  `json:"bytesCompleted"`
+}
+
+// Torrent status codes as reported by torrent-get
+const (
+	StatusStopped = iota
+	StatusCheckWait
+	StatusCheck
+	StatusDownloadWait
+	StatusDownload
+	StatusSeedWait
+	StatusSeed
+)
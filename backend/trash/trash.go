@@ -0,0 +1,323 @@
+// Package trash keeps deleted torrent data for a while instead of erasing
+// it, in a .trash folder at the top of the filesystem it was on, so a
+// misclick can be undone.
+package trash
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hasmikatom/torrent/configfile"
+	"github.com/hasmikatom/torrent/disk"
+	"github.com/hasmikatom/torrent/store"
+	"github.com/hasmikatom/torrent/usage"
+)
+
+// DirName is the folder trashed data is kept in on each filesystem
+const DirName = ".trash"
+
+// metaName is the file next to trashed data that describes it
+const metaName = "meta.json"
+
+// Defaults when config/trash.json leaves them out
+const (
+	defaultRetentionDays = 14
+	purgeInterval        = time.Hour
+)
+
+var (
+	// ErrNotFound says there is no trashed item with an id
+	ErrNotFound = errors.New("trashed item not found")
+	// ErrExists says something is back at a trashed item's original path
+	ErrExists = errors.New("original path is taken")
+	// ErrUnavailable says the filesystem holding a path has no trash
+	ErrUnavailable = errors.New("no trash on this filesystem")
+)
+
+// Config is the contents of config/trash.json
+type Config struct {
+	// Disabled deletes data straight away, as before trash existed
+	Disabled bool `json:"disabled,omitempty"`
+	// RetentionDays is how long trashed data is kept before it is purged
+	RetentionDays int `json:"retentionDays,omitempty"`
+}
+
+var (
+	trashConfig     *Config
+	trashConfigOnce sync.Once
+)
+
+// LoadConfig reads config/trash.json once
+func LoadConfig() *Config {
+	trashConfigOnce.Do(func() {
+		var config Config
+		path, err := configfile.Load("trash.json", &config)
+		if err != nil {
+			log.Printf("Warning: %v, keeping deleted data for %d days", err, defaultRetentionDays)
+			trashConfig = &Config{}
+			return
+		}
+		log.Printf("Loaded trash config from: %s", path)
+		trashConfig = &config
+	})
+
+	return trashConfig
+}
+
+// Retention is how long trashed data is kept
+func (c *Config) Retention() time.Duration {
+	days := c.RetentionDays
+	if days <= 0 {
+		days = defaultRetentionDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// Entry is one trashed file or folder
+type Entry struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Original is where the data was, Path where it is kept now
+	Original string `json:"original"`
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	// Owner is who added the torrent, DeletedBy who removed it
+	Owner     string    `json:"owner,omitempty"`
+	DeletedBy string    `json:"deletedBy,omitempty"`
+	TorrentID int       `json:"torrentId,omitempty"`
+	Hash      string    `json:"hash,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	DeletedAt time.Time `json:"deletedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// dir is the folder holding the entry's data and metadata
+func (e Entry) dir() string {
+	return filepath.Dir(filepath.Dir(e.Path))
+}
+
+// Bin moves data into the trash and keeps track of what is there
+type Bin struct {
+	config *Config
+	// mountOf returns the top of the filesystem holding a path
+	mountOf func(path string) (string, bool)
+	now     func() time.Time
+
+	file *store.JSONFile
+
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// NewBin loads the list of trashed items from dataDir
+func NewBin(config *Config, dataDir string) (*Bin, error) {
+	b := &Bin{config: config, mountOf: disk.MountPoint, now: time.Now, file: store.NewJSONFile(dataDir, "trash.json")}
+	if err := b.file.Load(&b.entries); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Enabled reports whether deleted data goes to the trash
+func (b *Bin) Enabled() bool {
+	return !b.config.Disabled
+}
+
+// Locate returns where the trash folder for path is, without creating it.
+// Data on the root filesystem isn't trashed, since it is rarely where media
+// lives and its top usually isn't writable.
+func (b *Bin) Locate(path string) (string, bool) {
+	mount, ok := b.mountOf(path)
+	if !ok || mount == "/" {
+		return "", false
+	}
+	return filepath.Join(mount, DirName), true
+}
+
+// Dir returns the trash folder on the filesystem holding path, creating
+// it. Its errors wrap ErrUnavailable.
+func (b *Bin) Dir(path string) (string, error) {
+	dir, ok := b.Locate(path)
+	if !ok {
+		return "", fmt.Errorf("%w: %s is on the root filesystem or an unknown one", ErrUnavailable, path)
+	}
+	if err := os.MkdirAll(dir, 0775); err != nil {
+		return "", fmt.Errorf("%w: can't create %s: %v", ErrUnavailable, dir, err)
+	}
+	return dir, nil
+}
+
+// Move moves the file or folder at e.Original into the trash on its
+// filesystem and remembers it. Data is only renamed, never copied, so it
+// stays on the same disk.
+func (b *Bin) Move(e Entry) (Entry, error) {
+	trashDir, err := b.Dir(e.Original)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	e.ID = newID(b.now())
+	e.Name = filepath.Base(e.Original)
+	e.DeletedAt = b.now()
+	e.ExpiresAt = e.DeletedAt.Add(b.config.Retention())
+	if node, err := usage.Scan(e.Original, 0, 0); err == nil {
+		e.Size = node.Bytes
+	}
+
+	dir := filepath.Join(trashDir, e.ID)
+	e.Path = filepath.Join(dir, "files", e.Name)
+	if err := os.MkdirAll(filepath.Dir(e.Path), 0775); err != nil {
+		return Entry{}, err
+	}
+	if err := os.Rename(e.Original, e.Path); err != nil {
+		os.RemoveAll(dir)
+		return Entry{}, err
+	}
+	// The metadata next to the data lets it be recovered by hand
+	if err := store.NewJSONFile(dir, metaName).Save(e); err != nil {
+		log.Printf("Failed to write trash metadata for %s: %v", e.Original, err)
+	}
+
+	b.mu.Lock()
+	b.entries = append(b.entries, e)
+	b.save()
+	b.mu.Unlock()
+	return e, nil
+}
+
+// Entries returns what is in the trash, most recently deleted first
+func (b *Bin) Entries() []Entry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	list := append([]Entry{}, b.entries...)
+	sort.Slice(list, func(i, j int) bool { return list[i].DeletedAt.After(list[j].DeletedAt) })
+	return list
+}
+
+// Get returns a trashed item by id
+func (b *Bin) Get(id string) (Entry, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, e := range b.entries {
+		if e.ID == id {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Restore moves a trashed item back to where it was. It returns ErrExists
+// rather than overwrite anything there now.
+func (b *Bin) Restore(id string) (Entry, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	i := b.indexLocked(id)
+	if i < 0 {
+		return Entry{}, ErrNotFound
+	}
+	e := b.entries[i]
+	if _, err := os.Lstat(e.Original); err == nil {
+		return Entry{}, ErrExists
+	}
+
+	if err := os.MkdirAll(filepath.Dir(e.Original), 0775); err != nil {
+		return Entry{}, err
+	}
+	if err := os.Rename(e.Path, e.Original); err != nil {
+		return Entry{}, err
+	}
+	if err := os.RemoveAll(e.dir()); err != nil {
+		log.Printf("Failed to remove trash folder %s: %v", e.dir(), err)
+	}
+
+	b.entries = append(b.entries[:i], b.entries[i+1:]...)
+	b.save()
+	return e, nil
+}
+
+// Purge erases a trashed item for good
+func (b *Bin) Purge(id string) (Entry, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	i := b.indexLocked(id)
+	if i < 0 {
+		return Entry{}, ErrNotFound
+	}
+	e := b.entries[i]
+	if err := os.RemoveAll(e.dir()); err != nil {
+		return Entry{}, err
+	}
+
+	b.entries = append(b.entries[:i], b.entries[i+1:]...)
+	b.save()
+	return e, nil
+}
+
+// PurgeExpired erases everything kept past its retention and returns it
+func (b *Bin) PurgeExpired() []Entry {
+	now := b.now()
+	purged := []Entry{}
+	for _, e := range b.Entries() {
+		if now.Before(e.ExpiresAt) {
+			continue
+		}
+		if _, err := b.Purge(e.ID); err != nil {
+			log.Printf("Failed to purge %s from the trash: %v", e.Original, err)
+			continue
+		}
+		purged = append(purged, e)
+	}
+	return purged
+}
+
+// Run purges expired items every hour until ctx is cancelled
+func (b *Bin) Run(ctx context.Context) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, e := range b.PurgeExpired() {
+			log.Printf("Purged %s from the trash after %s", e.Original, b.config.Retention())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (b *Bin) indexLocked(id string) int {
+	for i, e := range b.entries {
+		if e.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (b *Bin) save() {
+	if err := b.file.Save(b.entries); err != nil {
+		log.Printf("Failed to save the trash list: %v", err)
+	}
+}
+
+// newID names a trashed item by when it was deleted, with a random suffix
+func newID(at time.Time) string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return at.UTC().Format("20060102T150405") + "-" + hex.EncodeToString(suffix)
+}
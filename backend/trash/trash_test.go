@@ -0,0 +1,111 @@
+package trash
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testBin(t *testing.T, mount string) *Bin {
+	t.Helper()
+	b, err := NewBin(&Config{RetentionDays: 7}, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.mountOf = func(string) (string, bool) { return mount, true }
+	return b
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	os.MkdirAll(filepath.Dir(path), 0755)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBin_MoveAndRestore(t *testing.T) {
+	mount := t.TempDir()
+	original := filepath.Join(mount, "Movies", "Film (2020)")
+	writeFile(t, filepath.Join(original, "film.mkv"), "film")
+	b := testBin(t, mount)
+
+	e, err := b.Move(Entry{Original: original, Owner: "alice", TorrentID: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Size != 4 || e.Name != "Film (2020)" || !filepath.IsAbs(e.Path) {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+	if _, err := os.Stat(original); !os.IsNotExist(err) {
+		t.Fatal("data was not moved")
+	}
+	if _, err := os.Stat(filepath.Join(mount, DirName, e.ID, metaName)); err != nil {
+		t.Fatal("metadata was not written next to the data")
+	}
+	if got := e.ExpiresAt.Sub(e.DeletedAt); got != 7*24*time.Hour {
+		t.Fatalf("unexpected retention %s", got)
+	}
+
+	// Something new at the original path isn't overwritten
+	writeFile(t, filepath.Join(original, "other.mkv"), "other")
+	if _, err := b.Restore(e.ID); !errors.Is(err, ErrExists) {
+		t.Fatalf("expected ErrExists, got %v", err)
+	}
+	os.RemoveAll(original)
+
+	if _, err := b.Restore(e.ID); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(original, "film.mkv")); err != nil || string(data) != "film" {
+		t.Fatal("data was not restored")
+	}
+	if _, err := os.Stat(filepath.Join(mount, DirName, e.ID)); !os.IsNotExist(err) {
+		t.Fatal("trash folder was left behind")
+	}
+	if _, err := b.Restore(e.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestBin_PurgeExpired(t *testing.T) {
+	mount := t.TempDir()
+	b := testBin(t, mount)
+	now := time.Now()
+	b.now = func() time.Time { return now }
+
+	writeFile(t, filepath.Join(mount, "old.mkv"), "old")
+	old, err := b.Move(Entry{Original: filepath.Join(mount, "old.mkv")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(6 * 24 * time.Hour)
+	writeFile(t, filepath.Join(mount, "new.mkv"), "new")
+	if _, err := b.Move(Entry{Original: filepath.Join(mount, "new.mkv")}); err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(2 * 24 * time.Hour)
+	purged := b.PurgeExpired()
+	if len(purged) != 1 || purged[0].ID != old.ID {
+		t.Fatalf("expected only the old item purged, got %+v", purged)
+	}
+	if _, err := os.Stat(filepath.Join(mount, DirName, old.ID)); !os.IsNotExist(err) {
+		t.Fatal("purged data is still there")
+	}
+	if entries := b.Entries(); len(entries) != 1 || entries[0].Name != "new.mkv" {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+}
+
+func TestBin_RefusesRootFilesystem(t *testing.T) {
+	b := testBin(t, "/")
+	if _, err := b.Dir("/srv/file"); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected the root filesystem to have no trash, got %v", err)
+	}
+	if _, ok := b.Locate("/srv/file"); ok {
+		t.Fatal("expected no trash folder on the root filesystem")
+	}
+}
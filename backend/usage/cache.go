@@ -0,0 +1,217 @@
+package usage
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hasmikatom/torrent/configfile"
+)
+
+// Defaults when config/usage.json leaves them out
+const (
+	defaultInterval = 60 * time.Minute
+	defaultDepth    = 2
+	defaultTop      = 10
+)
+
+// Config is the contents of config/usage.json
+type Config struct {
+	// IntervalMinutes is how often category roots are scanned again
+	IntervalMinutes int `json:"intervalMinutes,omitempty"`
+	// Depth is how many levels of subfolders are kept
+	Depth int `json:"depth,omitempty"`
+	// Top is how many of the largest files are listed per folder
+	Top int `json:"top,omitempty"`
+}
+
+var (
+	usageConfig     *Config
+	usageConfigOnce sync.Once
+)
+
+// LoadConfig reads config/usage.json once
+func LoadConfig() *Config {
+	usageConfigOnce.Do(func() {
+		var config Config
+		path, err := configfile.Load("usage.json", &config)
+		if err != nil {
+			log.Printf("Warning: %v, using default disk usage settings", err)
+			usageConfig = &Config{}
+			return
+		}
+		log.Printf("Loaded disk usage config from: %s", path)
+		usageConfig = &config
+	})
+
+	return usageConfig
+}
+
+// Interval is how often the cache refreshes
+func (c *Config) Interval() time.Duration {
+	if c.IntervalMinutes <= 0 {
+		return defaultInterval
+	}
+	return time.Duration(c.IntervalMinutes) * time.Minute
+}
+
+// MaxDepth is how many levels of subfolders are kept
+func (c *Config) MaxDepth() int {
+	if c.Depth <= 0 {
+		return defaultDepth
+	}
+	return c.Depth
+}
+
+// TopItems is how many of the largest files are listed per folder
+func (c *Config) TopItems() int {
+	if c.Top <= 0 {
+		return defaultTop
+	}
+	return c.Top
+}
+
+// Root is a folder to scan, usually a category root
+type Root struct {
+	ID   string
+	Path string
+}
+
+// Category is the usage of one root
+type Category struct {
+	ID string `json:"id"`
+	Node
+	// Error is set when the root couldn't be scanned at all
+	Error string `json:"error,omitempty"`
+}
+
+// Report is the outcome of one scan of every root
+type Report struct {
+	Categories []Category `json:"categories"`
+	ScannedAt  time.Time  `json:"scannedAt"`
+	// DurationMs is how long the scan took
+	DurationMs int64 `json:"durationMs"`
+}
+
+// Cache keeps the latest report and refreshes it in the background, so
+// reading it never waits for a walk of a large library
+type Cache struct {
+	config *Config
+	// roots returns what to scan
+	roots func() []Root
+
+	mu       sync.Mutex
+	report   *Report
+	scanning bool
+	refresh  chan struct{}
+}
+
+// NewCache returns an empty cache for config
+func NewCache(config *Config, roots func() []Root) *Cache {
+	return &Cache{config: config, roots: roots, refresh: make(chan struct{}, 1)}
+}
+
+// Config returns the cache's config
+func (c *Cache) Config() *Config {
+	return c.config
+}
+
+// Run scans right away, then every interval and whenever Refresh asks,
+// until ctx is cancelled
+func (c *Cache) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.config.Interval())
+	defer ticker.Stop()
+
+	c.Scan()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.Scan()
+		case <-c.refresh:
+			c.Scan()
+		}
+	}
+}
+
+// Refresh asks Run for a new scan. It reports false when one is already
+// running or asked for.
+func (c *Cache) Refresh() bool {
+	c.mu.Lock()
+	scanning := c.scanning
+	c.mu.Unlock()
+	if scanning {
+		return false
+	}
+
+	select {
+	case c.refresh <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Report returns the latest report, whether there is one yet, and whether
+// a scan is running
+func (c *Cache) Report() (Report, bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.report == nil {
+		return Report{}, false, c.scanning
+	}
+	return *c.report, true, c.scanning
+}
+
+// Size returns how much the folder at path took up in the latest report.
+// It reports false before the first scan and for folders deeper than the
+// scan keeps.
+func (c *Cache) Size(path string) (int64, bool) {
+	report, ok, _ := c.Report()
+	if !ok {
+		return 0, false
+	}
+	for _, cat := range report.Categories {
+		if cat.Error != "" {
+			continue
+		}
+		if n, ok := cat.Find(path); ok {
+			return n.Bytes, true
+		}
+	}
+	return 0, false
+}
+
+// Scan scans every root now and stores the report
+func (c *Cache) Scan() Report {
+	c.mu.Lock()
+	c.scanning = true
+	c.mu.Unlock()
+
+	start := time.Now()
+	report := Report{ScannedAt: start}
+	for _, root := range c.roots() {
+		cat := Category{ID: root.ID}
+		node, err := Scan(root.Path, c.config.MaxDepth(), c.config.TopItems())
+		if err != nil {
+			cat.Node = Node{Name: root.ID, Path: root.Path}
+			cat.Error = err.Error()
+		} else {
+			cat.Node = node
+		}
+		report.Categories = append(report.Categories, cat)
+	}
+	took := time.Since(start)
+	report.DurationMs = took.Milliseconds()
+
+	c.mu.Lock()
+	c.report = &report
+	c.scanning = false
+	c.mu.Unlock()
+
+	log.Printf("Scanned disk usage of %d categories in %s", len(report.Categories), took.Round(time.Millisecond))
+	return report
+}
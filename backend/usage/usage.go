@@ -0,0 +1,184 @@
+// Package usage works out how much space category roots and the folders
+// inside them take up.
+package usage
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Item is one file or folder in a largest-items list
+type Item struct {
+	Path  string `json:"path"`
+	Bytes int64  `json:"bytes"`
+}
+
+// Node is the usage of one folder and everything below it
+type Node struct {
+	Name  string `json:"name"`
+	Path  string `json:"path"`
+	Bytes int64  `json:"bytes"`
+	Files int    `json:"files"`
+	Dirs  int    `json:"dirs"`
+	// ModTime is the latest change to the folder or anything below it
+	ModTime time.Time `json:"modTime"`
+	// Errors counts entries that couldn't be read and so aren't included
+	Errors int `json:"errors,omitempty"`
+	// Largest are the biggest files below the folder, biggest first
+	Largest []Item `json:"largest,omitempty"`
+	// Children are the subfolders, biggest first, down to the scan depth
+	Children []Node `json:"children,omitempty"`
+}
+
+// Scan walks root and returns its usage, keeping subfolders down to depth
+// levels and the top biggest files of every folder kept. Symlinks aren't
+// followed, and a file hardlinked several times below root counts once.
+func Scan(root string, depth, top int) (Node, error) {
+	info, err := os.Lstat(root)
+	if err != nil {
+		return Node{}, err
+	}
+	if !info.IsDir() {
+		return Node{Name: filepath.Base(root), Path: root, Bytes: info.Size(), Files: 1, ModTime: info.ModTime()}, nil
+	}
+	s := &scanner{top: top, seen: make(map[inode]bool)}
+	n := s.dir(root, depth)
+	if info.ModTime().After(n.ModTime) {
+		n.ModTime = info.ModTime()
+	}
+	return n, nil
+}
+
+// inode identifies a file across hardlinks
+type inode struct {
+	dev, ino uint64
+}
+
+type scanner struct {
+	top  int
+	seen map[inode]bool
+}
+
+func (s *scanner) dir(path string, depth int) Node {
+	n := Node{Name: filepath.Base(path), Path: path}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		n.Errors++
+		return n
+	}
+
+	for _, e := range entries {
+		p := filepath.Join(path, e.Name())
+		info, err := e.Info()
+		if err != nil {
+			n.Errors++
+			continue
+		}
+		if info.ModTime().After(n.ModTime) {
+			n.ModTime = info.ModTime()
+		}
+
+		if e.IsDir() {
+			child := s.dir(p, depth-1)
+			if info.ModTime().After(child.ModTime) {
+				child.ModTime = info.ModTime()
+			}
+			if child.ModTime.After(n.ModTime) {
+				n.ModTime = child.ModTime
+			}
+			n.Bytes += child.Bytes
+			n.Files += child.Files
+			n.Dirs += child.Dirs + 1
+			n.Errors += child.Errors
+			n.Largest = s.merge(n.Largest, child.Largest)
+			if depth > 0 {
+				child.Largest = s.trim(child.Largest)
+				n.Children = append(n.Children, child)
+			}
+			continue
+		}
+
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		if s.counted(info) {
+			continue
+		}
+		n.Bytes += info.Size()
+		n.Files++
+		n.Largest = s.merge(n.Largest, []Item{{Path: p, Bytes: info.Size()}})
+	}
+
+	sort.Slice(n.Children, func(i, j int) bool {
+		return n.Children[i].Bytes > n.Children[j].Bytes
+	})
+	n.Largest = s.trim(n.Largest)
+	return n
+}
+
+// counted reports whether a hardlinked file was already counted, marking
+// it counted otherwise
+func (s *scanner) counted(info os.FileInfo) bool {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink < 2 {
+		return false
+	}
+	key := inode{uint64(st.Dev), uint64(st.Ino)}
+	if s.seen[key] {
+		return true
+	}
+	s.seen[key] = true
+	return false
+}
+
+// merge adds items to a largest list, keeping it sorted and bounded
+func (s *scanner) merge(list, items []Item) []Item {
+	list = append(list, items...)
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Bytes > list[j].Bytes })
+	return s.trim(list)
+}
+
+func (s *scanner) trim(list []Item) []Item {
+	if len(list) > s.top {
+		return list[:s.top:s.top]
+	}
+	return list
+}
+
+// Trim returns a copy of n without children deeper than depth levels
+func (n Node) Trim(depth int) Node {
+	if depth <= 0 {
+		n.Children = nil
+		return n
+	}
+	children := make([]Node, len(n.Children))
+	for i, c := range n.Children {
+		children[i] = c.Trim(depth - 1)
+	}
+	n.Children = children
+	return n
+}
+
+// Find returns the node kept for the folder at path, n itself or one of
+// its descendants
+func (n Node) Find(path string) (Node, bool) {
+	path = filepath.Clean(path)
+	self := filepath.Clean(n.Path)
+	if path == self {
+		return n, true
+	}
+	if !strings.HasPrefix(path, self+string(filepath.Separator)) {
+		return Node{}, false
+	}
+	for _, c := range n.Children {
+		if found, ok := c.Find(path); ok {
+			return found, true
+		}
+	}
+	return Node{}, false
+}
@@ -0,0 +1,97 @@
+package usage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func write(t *testing.T, path string, size int) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(strings.Repeat("x", size)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScan(t *testing.T) {
+	root := t.TempDir()
+	write(t, filepath.Join(root, "Show A", "Season 1", "e1.mkv"), 500)
+	write(t, filepath.Join(root, "Show A", "Season 1", "e2.mkv"), 400)
+	write(t, filepath.Join(root, "Show A", "Season 2", "e1.mkv"), 300)
+	write(t, filepath.Join(root, "Show B", "e1.mkv"), 1000)
+	write(t, filepath.Join(root, "notes.txt"), 10)
+	if err := os.Link(filepath.Join(root, "Show B", "e1.mkv"), filepath.Join(root, "Show B", "copy.mkv")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "Show A"), filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := Scan(root, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Bytes != 2210 || n.Files != 5 || n.Dirs != 4 {
+		t.Fatalf("unexpected totals %d bytes, %d files, %d dirs", n.Bytes, n.Files, n.Dirs)
+	}
+	if len(n.Largest) != 2 || n.Largest[0].Bytes != 1000 || n.Largest[1].Bytes != 500 {
+		t.Fatalf("unexpected largest %+v", n.Largest)
+	}
+	if len(n.Children) != 2 || n.Children[0].Name != "Show A" || n.Children[0].Bytes != 1200 || n.Children[1].Bytes != 1000 {
+		t.Fatalf("unexpected children %+v", n.Children)
+	}
+	if len(n.Children[0].Children) != 0 {
+		t.Fatal("expected seasons to be below the scan depth")
+	}
+
+	deep, _ := Scan(root, 3, 2)
+	if len(deep.Children[0].Children) != 2 || deep.Trim(1).Children[0].Children != nil {
+		t.Fatalf("unexpected deep scan %+v", deep.Children[0])
+	}
+	if deep.Children[0].Children[0].Name != "Season 1" || deep.Children[0].Children[0].Largest[0].Bytes != 500 {
+		t.Fatalf("unexpected season %+v", deep.Children[0].Children[0])
+	}
+
+	later := time.Now().Add(time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(filepath.Join(root, "Show A", "Season 2", "e1.mkv"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	n, _ = Scan(root, 0, 0)
+	if !n.ModTime.Equal(later) {
+		t.Fatalf("expected the latest change below the root, got %v", n.ModTime)
+	}
+}
+
+func TestCache(t *testing.T) {
+	root := t.TempDir()
+	write(t, filepath.Join(root, "Movie", "movie.mkv"), 100)
+
+	c := NewCache(&Config{}, func() []Root {
+		return []Root{{ID: "Movies", Path: root}, {ID: "TV", Path: filepath.Join(root, "missing")}}
+	})
+	if _, ok, _ := c.Report(); ok {
+		t.Fatal("expected no report before the first scan")
+	}
+	c.Scan()
+	r, ok, scanning := c.Report()
+	if !ok || scanning || len(r.Categories) != 2 {
+		t.Fatalf("unexpected report %+v", r)
+	}
+	if r.Categories[0].Bytes != 100 || r.Categories[1].Error == "" {
+		t.Fatalf("unexpected categories %+v", r.Categories)
+	}
+	if size, ok := c.Size(filepath.Join(root, "Movie")); !ok || size != 100 {
+		t.Fatalf("unexpected cached size %d, %v", size, ok)
+	}
+	if _, ok := c.Size(filepath.Join(root, "Movie", "Extras")); ok {
+		t.Fatal("expected no size for a folder the scan didn't keep")
+	}
+	if !c.Refresh() || c.Refresh() {
+		t.Fatal("expected only one refresh to be pending")
+	}
+}
@@ -3,9 +3,15 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"log"
 	"os"
+	"strconv"
 	"strings"
 	"syscall"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hasmikatom/torrent/category"
+	"github.com/hasmikatom/torrent/seeding"
 )
 
 func SetConfigs() *Config {
@@ -15,6 +21,11 @@ func SetConfigs() *Config {
 		envPrefix = "PROD"
 	}
 
+	dataDir := os.Getenv(fmt.Sprintf("%s_DATA_DIR", envPrefix))
+	if dataDir == "" {
+		dataDir = "data"
+	}
+
 	return &Config{
 		AppPort:              os.Getenv(fmt.Sprintf("%s_APP_PORT", envPrefix)),
 		TransmissionHost:     os.Getenv(fmt.Sprintf("%s_TRANSMISSION_HOST", envPrefix)),
@@ -23,27 +34,75 @@ func SetConfigs() *Config {
 		TransmissionPassword: os.Getenv(fmt.Sprintf("%s_TRANSMISSION_PASSWORD", envPrefix)),
 		RutrackerUsername:    os.Getenv(fmt.Sprintf("%s_RUTRACKER_USERNAME", envPrefix)),
 		RutrackerPassword:    os.Getenv(fmt.Sprintf("%s_RUTRACKER_PASSWORD", envPrefix)),
+		DataDir:              dataDir,
+	}
+}
+
+// GetCategory looks up a configured category by its contentType id. Only
+// configured ids are accepted, so the download path is never built from
+// user input, and the caller's role must be allowed to use the category.
+func GetCategory(mediaType string, role string) (category.Category, error) {
+	cat, ok := category.Load().Get(mediaType)
+	if !ok {
+		return category.Category{}, fmt.Errorf("invalid content type: %s", mediaType)
+	}
+	if !cat.Allows(role) {
+		return category.Category{}, fmt.Errorf("content type %s is not available for your role", mediaType)
 	}
+	return cat, nil
 }
 
-// ValidMediaTypes defines allowed media type values to prevent path traversal
-var ValidMediaTypes = map[string]bool{
-	"Movies": true,
-	"Series": true,
-	"Music":  true,
+// GetDownloadDir returns where a torrent goes inside a category, filling the
+// category's path template from fields. When the category root is mounted
+// here the directory is created; otherwise Transmission creates it on write.
+func GetDownloadDir(cat category.Category, fields category.Fields) (string, error) {
+	dir, err := cat.Dir(fields)
+	if err != nil {
+		return "", err
+	}
+
+	if dir != cat.Root {
+		if _, err := os.Stat(cat.Root); err == nil {
+			if err := os.MkdirAll(dir, 0775); err != nil {
+				log.Printf("Failed to create download dir %s: %v", dir, err)
+			}
+		}
+	}
+
+	return dir, nil
 }
 
-// ValidateMediaType checks if the media type is allowed
-func ValidateMediaType(mediaType string) bool {
-	return ValidMediaTypes[mediaType]
+// formFields reads optional path template fields from a multipart request
+func formFields(gc *gin.Context) category.Fields {
+	year, _ := strconv.Atoi(gc.PostForm("year"))
+	season, _ := strconv.Atoi(gc.PostForm("season"))
+	return category.Fields{
+		Title:  gc.PostForm("title"),
+		Year:   year,
+		Season: season,
+		Artist: gc.PostForm("artist"),
+		Album:  gc.PostForm("album"),
+	}
 }
 
-// GetDownloadDir returns a safe download directory path
-func GetDownloadDir(mediaType string) (string, error) {
-	if !ValidateMediaType(mediaType) {
-		return "", fmt.Errorf("invalid content type: %s", mediaType)
+// applySeedingPolicy hands a torrent's seeding limits to Transmission: those
+// of the first matching rule in seeding.json, with the category's limits
+// filling in what the rule leaves unset
+func applySeedingPolicy(id int, cat category.Category) {
+	t, err := fetchTorrent(id, seeding.Fields)
+	if err != nil {
+		log.Printf("Failed to get trackers of torrent %d, using %s seeding limits: %v", id, cat.ID, err)
+	}
+
+	policy := seeding.LoadConfig().Policy(cat.ID, cat.Seeding, t)
+	args := policy.TorrentSetArgs(id)
+	if args == nil {
+		return
+	}
+
+	if _, err := client.SendRequest("torrent-set", args); err != nil {
+		log.Printf("Failed to apply %s seeding policy to torrent %d: %v", cat.ID, id, err)
 	}
-	return "/mediastorage/" + mediaType, nil
 }
 
 func getStatusString(status int) string {
@@ -0,0 +1,329 @@
+// Package watcher polls the Transmission daemon and turns changes between
+// polls into events on the bus.
+package watcher
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hasmikatom/torrent/events"
+	"github.com/hasmikatom/torrent/store"
+	"github.com/hasmikatom/torrent/transmission"
+)
+
+// Fields are the torrent-get fields the watcher needs
+var Fields = []string{
+	"id", "hashString", "name", "status", "percentDone", "metadataPercentComplete",
+	"downloadedEver", "error", "errorString", "downloadDir", "totalSize", "sizeWhenDone",
+	"addedDate", "doneDate", "peersConnected",
+}
+
+// Source returns the daemon's current torrents with the given fields
+type Source func(fields []string) ([]transmission.Torrent, error)
+
+// Options tune the watcher. A zero stall duration turns that check off.
+type Options struct {
+	// Interval between polls
+	Interval time.Duration
+	// StallAfter is how long a downloading torrent may go without progress
+	// before it is reported as stalled
+	StallAfter time.Duration
+	// NoMetadataAfter is how long a magnet may go without fetching any
+	// metadata; StallAfter covers it when unset
+	NoMetadataAfter time.Duration
+	// NoPeersAfter is how long a downloading torrent may go without a
+	// connected peer
+	NoPeersAfter time.Duration
+	// TrackerErrorAfter is how long a downloading torrent's announces may
+	// keep failing
+	TrackerErrorAfter time.Duration
+}
+
+// Stall reasons
+const (
+	StallNoMetadata   = "no_metadata"
+	StallNoProgress   = "no_progress"
+	StallNoPeers      = "no_peers"
+	StallTrackerError = "tracker_error"
+)
+
+// Stall describes why a torrent is considered stalled
+type Stall struct {
+	Reason string `json:"reason"`
+	// Detail is a readable explanation, also used as the event reason
+	Detail string    `json:"detail"`
+	Since  time.Time `json:"since"`
+}
+
+// DefaultOptions poll every 15 seconds and call a download stalled after 30 minutes
+var DefaultOptions = Options{Interval: 15 * time.Second, StallAfter: 30 * time.Minute}
+
+// state is what the watcher remembers about a torrent between polls
+type state struct {
+	Torrent       events.Torrent `json:"torrent"`
+	MetadataReady bool           `json:"metadataReady"`
+	Done          bool           `json:"done"`
+	Error         int            `json:"error"`
+	Downloaded    int64          `json:"downloaded"`
+	Metadata      float64        `json:"metadata"`
+	ProgressAt    time.Time      `json:"progressAt"`
+	PeersAt       time.Time      `json:"peersAt"`
+	TrackerOKAt   time.Time      `json:"trackerOkAt"`
+	Stalled       bool           `json:"stalled"`
+	Stall         *Stall         `json:"stall,omitempty"`
+}
+
+// snapshot is persisted so changes that happen while the backend is down
+// are still reported when it comes back
+type snapshot struct {
+	Torrents map[string]state `json:"torrents"`
+}
+
+// Watcher detects torrent state changes
+type Watcher struct {
+	source Source
+	bus    *events.Bus
+	opts   Options
+	file   *store.JSONFile
+
+	mu     sync.Mutex
+	states map[string]state
+	seeded bool
+	// restored is set until the first poll after loading a snapshot
+	restored bool
+}
+
+// New returns a watcher that keeps its snapshot in dataDir. Without a saved
+// snapshot the first poll only records the current torrents, so a fresh
+// install doesn't announce every existing torrent as added.
+func New(source Source, bus *events.Bus, dataDir string, opts Options) (*Watcher, error) {
+	w := &Watcher{
+		source: source,
+		bus:    bus,
+		opts:   opts,
+		file:   store.NewJSONFile(dataDir, "watcher-snapshot.json"),
+		states: make(map[string]state),
+	}
+
+	var saved snapshot
+	if err := w.file.Load(&saved); err != nil {
+		return nil, err
+	}
+	if saved.Torrents != nil {
+		w.states = saved.Torrents
+		w.seeded = true
+		w.restored = true
+	}
+	return w, nil
+}
+
+// Run polls until ctx is cancelled
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.Poll(time.Now()); err != nil {
+			log.Printf("Watcher: failed to poll torrents: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll fetches the torrents once and publishes what changed since the last poll
+func (w *Watcher) Poll(now time.Time) error {
+	torrents, err := w.source(Fields)
+	if err != nil {
+		// Without a reply nothing can be said about removals
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// The snapshot is only saved when something is published, so its times
+	// can be hours old. Nothing is known about the time the backend was
+	// down, so stall timers start over instead of flagging torrents at once.
+	if w.restored {
+		for key, s := range w.states {
+			s.ProgressAt, s.PeersAt, s.TrackerOKAt = now, now, now
+			w.states[key] = s
+		}
+		w.restored = false
+	}
+
+	var published []events.Event
+	publish := func(t events.Type, torrent events.Torrent, reason string) {
+		e := events.New(t, torrent, now)
+		e.Reason = reason
+		published = append(published, e)
+	}
+
+	current := make(map[string]state, len(torrents))
+	for _, t := range torrents {
+		key := strings.ToLower(t.HashString)
+		cur := state{
+			Torrent:       TorrentOf(t),
+			MetadataReady: t.MetadataPercentComplete >= 1,
+			Error:         t.Error,
+			Downloaded:    t.DownloadedEver,
+			Metadata:      t.MetadataPercentComplete,
+			ProgressAt:    now,
+			PeersAt:       now,
+			TrackerOKAt:   now,
+		}
+		cur.Done = cur.MetadataReady && t.PercentDone >= 1
+
+		prev, known := w.states[key]
+		if !known {
+			if w.seeded {
+				publish(events.Added, cur.Torrent, "")
+			}
+			current[key] = cur
+			continue
+		}
+
+		if !prev.MetadataReady && cur.MetadataReady {
+			publish(events.MetadataReady, cur.Torrent, "")
+		}
+		if !prev.Done && cur.Done {
+			publish(events.Completed, cur.Torrent, "")
+		}
+		// 1 is a tracker warning, 2 a tracker error and 3 a local error
+		if prev.Error < 2 && cur.Error >= 2 {
+			publish(events.Errored, cur.Torrent, t.ErrorString)
+		}
+
+		if t.Status == transmission.StatusDownload && !cur.Done {
+			w.checkStall(&cur, prev, t, now)
+			if cur.Stalled && !prev.Stalled {
+				publish(events.Stalled, cur.Torrent, cur.Stall.Detail)
+			}
+		}
+
+		current[key] = cur
+	}
+
+	if w.seeded {
+		for key, prev := range w.states {
+			if _, ok := current[key]; !ok {
+				publish(events.Removed, prev.Torrent, "")
+			}
+		}
+	}
+
+	changed := !w.seeded || len(published) > 0
+	w.states = current
+	w.seeded = true
+
+	if changed {
+		if err := w.file.Save(snapshot{Torrents: current}); err != nil {
+			log.Printf("Watcher: failed to save snapshot: %v", err)
+		}
+	}
+	for _, e := range published {
+		w.bus.Publish(e)
+	}
+	return nil
+}
+
+// checkStall carries the progress, peer and tracker times of a downloading
+// torrent over from the last poll and decides whether it is stalled. A
+// torrent stays stalled until whatever stalled it recovers.
+func (w *Watcher) checkStall(cur *state, prev state, t transmission.Torrent, now time.Time) {
+	// Snapshots from before a time was tracked start counting now
+	carry := func(t time.Time) time.Time {
+		if t.IsZero() {
+			return now
+		}
+		return t
+	}
+	if cur.Downloaded <= prev.Downloaded && cur.Metadata <= prev.Metadata {
+		cur.ProgressAt = carry(prev.ProgressAt)
+	}
+	if t.PeersConnected == 0 {
+		cur.PeersAt = carry(prev.PeersAt)
+	}
+	// 1 is a tracker warning and 2 a tracker error
+	if t.Error == 1 || t.Error == 2 {
+		cur.TrackerOKAt = carry(prev.TrackerOKAt)
+	}
+
+	stall := w.stall(*cur, t.ErrorString, now)
+	if prev.Stalled && prev.Stall != nil && stall != nil && stall.Reason == prev.Stall.Reason {
+		stall = prev.Stall
+	}
+	cur.Stall = stall
+	cur.Stalled = stall != nil
+}
+
+// stall returns the first check a downloading torrent fails, if any
+func (w *Watcher) stall(cur state, trackerError string, now time.Time) *Stall {
+	since := func(t time.Time) string { return t.Format(time.RFC3339) }
+	expired := func(from time.Time, after time.Duration) bool {
+		return after > 0 && now.Sub(from) >= after
+	}
+
+	noMetadataAfter := w.opts.NoMetadataAfter
+	if noMetadataAfter == 0 {
+		noMetadataAfter = w.opts.StallAfter
+	}
+	switch {
+	case !cur.MetadataReady && expired(cur.ProgressAt, noMetadataAfter):
+		return &Stall{Reason: StallNoMetadata, Detail: "no metadata since " + since(cur.ProgressAt), Since: cur.ProgressAt}
+	case expired(cur.TrackerOKAt, w.opts.TrackerErrorAfter):
+		detail := "tracker errors since " + since(cur.TrackerOKAt)
+		if trackerError != "" {
+			detail += ": " + trackerError
+		}
+		return &Stall{Reason: StallTrackerError, Detail: detail, Since: cur.TrackerOKAt}
+	case expired(cur.PeersAt, w.opts.NoPeersAfter):
+		return &Stall{Reason: StallNoPeers, Detail: "no peers since " + since(cur.PeersAt), Since: cur.PeersAt}
+	case cur.MetadataReady && expired(cur.ProgressAt, w.opts.StallAfter):
+		return &Stall{Reason: StallNoProgress, Detail: "no download progress since " + since(cur.ProgressAt), Since: cur.ProgressAt}
+	}
+	return nil
+}
+
+// Stalled returns why the watcher currently considers a torrent stalled
+func (w *Watcher) Stalled(hash string) (Stall, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	s, ok := w.states[strings.ToLower(hash)]
+	if !ok || !s.Stalled || s.Stall == nil {
+		return Stall{}, false
+	}
+	return *s.Stall, true
+}
+
+// TorrentOf converts a torrent fetched with Fields into its event snapshot
+func TorrentOf(t transmission.Torrent) events.Torrent {
+	torrent := events.Torrent{
+		ID:          t.ID,
+		Hash:        t.HashString,
+		Name:        t.Name,
+		DownloadDir: t.DownloadDir,
+		Size:        t.SizeWhenDone,
+		Error:       t.ErrorString,
+	}
+	if torrent.Size == 0 {
+		torrent.Size = t.TotalSize
+	}
+	if t.AddedDate > 0 {
+		added := time.Unix(t.AddedDate, 0)
+		torrent.AddedAt = &added
+	}
+	if t.DoneDate > 0 {
+		done := time.Unix(t.DoneDate, 0)
+		torrent.DoneAt = &done
+	}
+	return torrent
+}
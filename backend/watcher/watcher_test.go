@@ -0,0 +1,247 @@
+package watcher
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hasmikatom/torrent/events"
+	"github.com/hasmikatom/torrent/transmission"
+)
+
+// fakeDaemon serves whatever torrents the test sets
+type fakeDaemon struct {
+	torrents []transmission.Torrent
+}
+
+func (d *fakeDaemon) get([]string) ([]transmission.Torrent, error) {
+	return d.torrents, nil
+}
+
+func newWatcher(t *testing.T, d *fakeDaemon, dir string) (*Watcher, <-chan events.Event) {
+	t.Helper()
+	bus := events.NewBus()
+	ch := bus.Subscribe("test", 100)
+	w, err := New(d.get, bus, dir, Options{Interval: time.Second, StallAfter: 10 * time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w, ch
+}
+
+func drain(ch <-chan events.Event) []events.Type {
+	var types []events.Type
+	for {
+		select {
+		case e := <-ch:
+			types = append(types, e.Type)
+		default:
+			return types
+		}
+	}
+}
+
+func TestPoll_Lifecycle(t *testing.T) {
+	d := &fakeDaemon{}
+	w, ch := newWatcher(t, d, t.TempDir())
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		name     string
+		at       time.Duration
+		torrents []transmission.Torrent
+		want     []events.Type
+	}{
+		{"first poll only records", 0, nil, nil},
+		{"magnet added", time.Minute, []transmission.Torrent{
+			{ID: 1, HashString: "AAA", Status: transmission.StatusDownload},
+		}, []events.Type{events.Added}},
+		{"metadata arrives", 2 * time.Minute, []transmission.Torrent{
+			{ID: 1, HashString: "AAA", Status: transmission.StatusDownload, MetadataPercentComplete: 1, DownloadedEver: 10},
+		}, []events.Type{events.MetadataReady}},
+		{"no progress yet", 5 * time.Minute, []transmission.Torrent{
+			{ID: 1, HashString: "AAA", Status: transmission.StatusDownload, MetadataPercentComplete: 1, DownloadedEver: 10},
+		}, nil},
+		{"stalled", 13 * time.Minute, []transmission.Torrent{
+			{ID: 1, HashString: "AAA", Status: transmission.StatusDownload, MetadataPercentComplete: 1, DownloadedEver: 10},
+		}, []events.Type{events.Stalled}},
+		{"still stalled is not repeated", 20 * time.Minute, []transmission.Torrent{
+			{ID: 1, HashString: "AAA", Status: transmission.StatusDownload, MetadataPercentComplete: 1, DownloadedEver: 10},
+		}, nil},
+		{"completes", 30 * time.Minute, []transmission.Torrent{
+			{ID: 1, HashString: "AAA", Status: transmission.StatusSeed, MetadataPercentComplete: 1, PercentDone: 1, DownloadedEver: 100},
+		}, []events.Type{events.Completed}},
+		{"errors", 31 * time.Minute, []transmission.Torrent{
+			{ID: 1, HashString: "AAA", Status: transmission.StatusStopped, MetadataPercentComplete: 1, PercentDone: 1, Error: 3, ErrorString: "No data found"},
+		}, []events.Type{events.Errored}},
+		{"removed", 32 * time.Minute, nil, []events.Type{events.Removed}},
+	}
+
+	for _, step := range steps {
+		d.torrents = step.torrents
+		if err := w.Poll(start.Add(step.at)); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if got := drain(ch); !reflect.DeepEqual(got, step.want) {
+			t.Fatalf("%s: got %v, want %v", step.name, got, step.want)
+		}
+	}
+}
+
+func TestPoll_ExistingTorrentsAreNotAnnounced(t *testing.T) {
+	d := &fakeDaemon{torrents: []transmission.Torrent{{ID: 1, HashString: "AAA", MetadataPercentComplete: 1, PercentDone: 1}}}
+	w, ch := newWatcher(t, d, t.TempDir())
+
+	if err := w.Poll(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if got := drain(ch); len(got) != 0 {
+		t.Fatalf("expected no events on the first poll, got %v", got)
+	}
+}
+
+func TestPoll_ReportsChangesWhileDown(t *testing.T) {
+	dir := t.TempDir()
+	d := &fakeDaemon{torrents: []transmission.Torrent{{ID: 1, HashString: "AAA", MetadataPercentComplete: 1, PercentDone: 0.5}}}
+	w, _ := newWatcher(t, d, dir)
+	if err := w.Poll(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The backend restarts after the torrent finished
+	d.torrents[0].PercentDone = 1
+	w, ch := newWatcher(t, d, dir)
+	if err := w.Poll(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if got := drain(ch); !reflect.DeepEqual(got, []events.Type{events.Completed}) {
+		t.Fatalf("got %v, want completed", got)
+	}
+}
+
+func TestPoll_RestartDoesNotStallAtOnce(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	opts := Options{Interval: time.Second, StallAfter: time.Hour, NoPeersAfter: 20 * time.Minute}
+	d := &fakeDaemon{torrents: []transmission.Torrent{
+		{ID: 1, HashString: "AAA", Status: transmission.StatusDownload, MetadataPercentComplete: 1, DownloadedEver: 10, PeersConnected: 2},
+	}}
+	w, err := New(d.get, events.NewBus(), dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Poll(start); err != nil {
+		t.Fatal(err)
+	}
+
+	// The backend comes back hours later with a snapshot from the first
+	// poll, and the torrent momentarily has no peers
+	d.torrents[0].PeersConnected = 0
+	restart := start.Add(5 * time.Hour)
+	w, err = New(d.get, events.NewBus(), dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Poll(restart); err != nil {
+		t.Fatal(err)
+	}
+	if s, ok := w.Stalled("AAA"); ok {
+		t.Fatalf("stalled right after a restart: %+v", s)
+	}
+
+	if err := w.Poll(restart.Add(25 * time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if s, ok := w.Stalled("AAA"); !ok || s.Reason != StallNoPeers || !s.Since.Equal(restart) {
+		t.Fatalf("expected a stall counted from the restart, got %+v, %v", s, ok)
+	}
+}
+
+func TestPoll_StallReasons(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	magnet := transmission.Torrent{ID: 1, HashString: "AAA", Status: transmission.StatusDownload}
+	noPeers := transmission.Torrent{ID: 1, HashString: "AAA", Status: transmission.StatusDownload, MetadataPercentComplete: 1, DownloadedEver: 10}
+	trackerError := noPeers
+	trackerError.PeersConnected, trackerError.Error, trackerError.ErrorString = 3, 2, "Connection refused"
+
+	cases := []struct {
+		name    string
+		torrent func(step int) transmission.Torrent
+		want    string
+		detail  string
+	}{
+		{"magnet without metadata", func(int) transmission.Torrent { return magnet }, StallNoMetadata, "no metadata since"},
+		{"no peers", func(step int) transmission.Torrent {
+			tr := noPeers
+			tr.DownloadedEver += int64(step) // still progressing from the web seed
+			return tr
+		}, StallNoPeers, "no peers since"},
+		{"tracker error", func(step int) transmission.Torrent {
+			tr := trackerError
+			tr.DownloadedEver += int64(step)
+			return tr
+		}, StallTrackerError, "Connection refused"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := &fakeDaemon{}
+			bus := events.NewBus()
+			ch := bus.Subscribe("test", 100)
+			w, err := New(d.get, bus, t.TempDir(), Options{
+				Interval:          time.Second,
+				StallAfter:        time.Hour,
+				NoMetadataAfter:   20 * time.Minute,
+				NoPeersAfter:      20 * time.Minute,
+				TrackerErrorAfter: 20 * time.Minute,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []events.Event
+			for step := 0; step <= 5; step++ {
+				d.torrents = []transmission.Torrent{tc.torrent(step)}
+				if err := w.Poll(start.Add(time.Duration(step) * 5 * time.Minute)); err != nil {
+					t.Fatal(err)
+				}
+				for len(ch) > 0 {
+					got = append(got, <-ch)
+				}
+			}
+
+			var stalled []events.Event
+			for _, e := range got {
+				if e.Type == events.Stalled {
+					stalled = append(stalled, e)
+				}
+			}
+			if len(stalled) != 1 || !strings.Contains(stalled[0].Reason, tc.detail) {
+				t.Fatalf("expected one stalled event mentioning %q, got %+v", tc.detail, stalled)
+			}
+			s, ok := w.Stalled("aaa")
+			if !ok || s.Reason != tc.want || !s.Since.Equal(start) {
+				t.Fatalf("unexpected stall %+v, %v", s, ok)
+			}
+		})
+	}
+
+	t.Run("recovers", func(t *testing.T) {
+		d := &fakeDaemon{torrents: []transmission.Torrent{noPeers}}
+		w, _ := newWatcher(t, d, t.TempDir())
+		w.opts.NoPeersAfter = 10 * time.Minute
+		w.Poll(start)
+		w.Poll(start.Add(5 * time.Minute))
+		w.Poll(start.Add(15 * time.Minute))
+		if _, ok := w.Stalled("AAA"); !ok {
+			t.Fatal("expected the torrent to be stalled")
+		}
+		d.torrents[0].PeersConnected = 1
+		d.torrents[0].DownloadedEver = 50
+		w.Poll(start.Add(16 * time.Minute))
+		if _, ok := w.Stalled("AAA"); ok {
+			t.Fatal("expected the torrent to recover")
+		}
+	})
+}
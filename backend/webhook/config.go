@@ -0,0 +1,101 @@
+package webhook
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/hasmikatom/torrent/configfile"
+	"github.com/hasmikatom/torrent/events"
+)
+
+// defaultMaxAttempts is how often a delivery is tried when the hook doesn't say
+const defaultMaxAttempts = 5
+
+// Hook is an outbound webhook
+type Hook struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// Secret signs every delivery; SecretEnv names an environment variable
+	// holding it instead, to keep it out of the config file
+	Secret    string `json:"secret,omitempty"`
+	SecretEnv string `json:"secretEnv,omitempty"`
+	// Events filters what is sent, e.g. ["torrent.completed"] or ["torrent.*"];
+	// empty sends everything
+	Events      []string `json:"events,omitempty"`
+	MaxAttempts int      `json:"maxAttempts,omitempty"`
+}
+
+// Config is the contents of config/webhooks.json
+type Config struct {
+	Webhooks []Hook `json:"webhooks"`
+}
+
+var (
+	webhookConfig     *Config
+	webhookConfigOnce sync.Once
+)
+
+// LoadConfig reads config/webhooks.json once. Without it no webhooks are sent.
+func LoadConfig() *Config {
+	webhookConfigOnce.Do(func() {
+		var config Config
+		path, err := configfile.Load("webhooks.json", &config)
+		if err != nil {
+			log.Printf("Warning: %v, no webhooks configured", err)
+			webhookConfig = &Config{}
+			return
+		}
+		log.Printf("Loaded webhook config from: %s", path)
+
+		webhookConfig = &Config{Webhooks: validHooks(config.Webhooks)}
+	})
+
+	return webhookConfig
+}
+
+// validHooks resolves secrets and drops hooks that can't be used, logging why
+func validHooks(hooks []Hook) []Hook {
+	seen := make(map[string]bool)
+	var valid []Hook
+	for _, h := range hooks {
+		if h.SecretEnv != "" {
+			h.Secret = os.Getenv(h.SecretEnv)
+		}
+		if err := h.validate(); err != nil {
+			log.Printf("Warning: skipping webhook %q: %v", h.ID, err)
+			continue
+		}
+		if seen[h.ID] {
+			log.Printf("Warning: skipping duplicate webhook %q", h.ID)
+			continue
+		}
+		seen[h.ID] = true
+		if h.MaxAttempts <= 0 {
+			h.MaxAttempts = defaultMaxAttempts
+		}
+		valid = append(valid, h)
+	}
+	return valid
+}
+
+func (h Hook) validate() error {
+	if h.ID == "" {
+		return fmt.Errorf("id is required")
+	}
+	u, err := url.Parse(h.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url %q must be an absolute http(s) URL", h.URL)
+	}
+	if h.Secret == "" {
+		return fmt.Errorf("a secret is required to sign deliveries")
+	}
+	return nil
+}
+
+// Wants reports whether the hook subscribes to an event type
+func (h Hook) Wants(t events.Type) bool {
+	return events.Matches(h.Events, t)
+}
@@ -0,0 +1,114 @@
+package webhook
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hasmikatom/torrent/events"
+	"github.com/hasmikatom/torrent/store"
+)
+
+// Delivery states
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// maxLogEntries bounds the delivery log; the oldest entries go first
+const maxLogEntries = 500
+
+// Delivery records one event sent to one hook
+type Delivery struct {
+	ID         string      `json:"id"`
+	WebhookID  string      `json:"webhookId"`
+	EventID    string      `json:"eventId"`
+	EventType  events.Type `json:"eventType"`
+	TorrentID  int         `json:"torrentId"`
+	Status     string      `json:"status"`
+	Attempts   int         `json:"attempts"`
+	StatusCode int         `json:"statusCode,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	CreatedAt  time.Time   `json:"createdAt"`
+	UpdatedAt  time.Time   `json:"updatedAt"`
+	// NextAttemptAt is set while a failed attempt waits to be retried
+	NextAttemptAt *time.Time `json:"nextAttemptAt,omitempty"`
+}
+
+// Log keeps the most recent deliveries, persisted as JSON
+type Log struct {
+	mu      sync.Mutex
+	file    *store.JSONFile
+	entries []Delivery
+}
+
+// OpenLog loads the delivery log from dataDir. Deliveries that were still
+// pending when the backend stopped are marked failed; their retries were
+// only held in memory.
+func OpenLog(dataDir string) (*Log, error) {
+	l := &Log{file: store.NewJSONFile(dataDir, "webhook-deliveries.json")}
+	if err := l.file.Load(&l.entries); err != nil {
+		return nil, err
+	}
+
+	interrupted := false
+	for i := range l.entries {
+		if l.entries[i].Status == StatusPending {
+			l.entries[i].Status = StatusFailed
+			l.entries[i].Error = "interrupted by restart"
+			l.entries[i].NextAttemptAt = nil
+			interrupted = true
+		}
+	}
+	if interrupted {
+		l.save()
+	}
+	return l, nil
+}
+
+// Record adds or updates a delivery
+func (l *Log) Record(d Delivery) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i := range l.entries {
+		if l.entries[i].ID == d.ID {
+			l.entries[i] = d
+			l.save()
+			return
+		}
+	}
+
+	l.entries = append(l.entries, d)
+	if len(l.entries) > maxLogEntries {
+		l.entries = l.entries[len(l.entries)-maxLogEntries:]
+	}
+	l.save()
+}
+
+// List returns deliveries newest first, optionally only those of one hook
+// or in one status, at most limit of them (0 for all)
+func (l *Log) List(webhookID, status string, limit int) []Delivery {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	list := make([]Delivery, 0)
+	for i := len(l.entries) - 1; i >= 0; i-- {
+		d := l.entries[i]
+		if (webhookID != "" && d.WebhookID != webhookID) || (status != "" && d.Status != status) {
+			continue
+		}
+		list = append(list, d)
+		if limit > 0 && len(list) == limit {
+			break
+		}
+	}
+	return list
+}
+
+func (l *Log) save() {
+	if err := l.file.Save(l.entries); err != nil {
+		log.Printf("Failed to save webhook delivery log: %v", err)
+	}
+}
@@ -0,0 +1,208 @@
+// Package webhook delivers torrent events to outside HTTP endpoints. Every
+// delivery is signed with the hook's secret, retried with exponential
+// backoff and recorded in a delivery log.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hasmikatom/torrent/events"
+)
+
+// Headers sent with every delivery. The signature is
+// "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body)), so receivers
+// can check both the body and that the timestamp is recent.
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Options tune the dispatcher
+type Options struct {
+	// Backoff is the wait before the first retry; it doubles for each one after
+	Backoff time.Duration
+	// MaxBackoff caps the wait between retries
+	MaxBackoff time.Duration
+	// Timeout bounds a single attempt
+	Timeout time.Duration
+}
+
+// DefaultOptions retry after 5s, 10s, 20s... up to 10 minutes apart
+var DefaultOptions = Options{Backoff: 5 * time.Second, MaxBackoff: 10 * time.Minute, Timeout: 10 * time.Second}
+
+// Dispatcher sends events from the bus to the hooks that want them
+type Dispatcher struct {
+	hooks  []Hook
+	log    *Log
+	opts   Options
+	client *http.Client
+	wg     sync.WaitGroup
+}
+
+// NewDispatcher returns a dispatcher for hooks that records to log
+func NewDispatcher(hooks []Hook, log *Log, opts Options) *Dispatcher {
+	return &Dispatcher{
+		hooks:  hooks,
+		log:    log,
+		opts:   opts,
+		client: &http.Client{Timeout: opts.Timeout},
+	}
+}
+
+// Run delivers events until the channel closes or ctx is cancelled, then
+// waits for deliveries in flight. Retries of a cancelled run are abandoned.
+func (d *Dispatcher) Run(ctx context.Context, ch <-chan events.Event) {
+	defer d.wg.Wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			for _, h := range d.hooks {
+				if !h.Wants(e.Type) {
+					continue
+				}
+				d.wg.Add(1)
+				go func(h Hook) {
+					defer d.wg.Done()
+					d.Deliver(ctx, h, e)
+				}(h)
+			}
+		}
+	}
+}
+
+// Deliver sends one event to one hook, retrying until it succeeds, the hook
+// answers with a client error, MaxAttempts is reached or ctx is cancelled
+func (d *Dispatcher) Deliver(ctx context.Context, h Hook, e events.Event) Delivery {
+	now := time.Now()
+	delivery := Delivery{
+		ID:        events.NewID(),
+		WebhookID: h.ID,
+		EventID:   e.ID,
+		EventType: e.Type,
+		TorrentID: e.Torrent.ID,
+		Status:    StatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	body, err := json.Marshal(e)
+	if err != nil {
+		delivery.Status = StatusFailed
+		delivery.Error = err.Error()
+		d.log.Record(delivery)
+		return delivery
+	}
+
+	maxAttempts := h.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+
+	wait := d.opts.Backoff
+	for {
+		delivery.Attempts++
+		code, retry, err := d.attempt(ctx, h, delivery.ID, e.Type, body)
+		delivery.StatusCode = code
+		delivery.UpdatedAt = time.Now()
+		delivery.NextAttemptAt = nil
+
+		if err == nil {
+			delivery.Status = StatusDelivered
+			delivery.Error = ""
+			d.log.Record(delivery)
+			return delivery
+		}
+		delivery.Error = err.Error()
+
+		if !retry || delivery.Attempts >= maxAttempts {
+			delivery.Status = StatusFailed
+			d.log.Record(delivery)
+			return delivery
+		}
+
+		next := delivery.UpdatedAt.Add(wait)
+		delivery.NextAttemptAt = &next
+		d.log.Record(delivery)
+
+		select {
+		case <-ctx.Done():
+			delivery.Status = StatusFailed
+			delivery.Error = "cancelled while waiting to retry"
+			delivery.NextAttemptAt = nil
+			d.log.Record(delivery)
+			return delivery
+		case <-time.After(wait):
+		}
+
+		wait *= 2
+		if d.opts.MaxBackoff > 0 && wait > d.opts.MaxBackoff {
+			wait = d.opts.MaxBackoff
+		}
+	}
+}
+
+// attempt makes one request and reports the status code, whether a failure
+// is worth retrying, and the failure itself
+func (d *Dispatcher) attempt(ctx context.Context, h Hook, deliveryID string, t events.Type, body []byte) (int, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "torrent-webhooks/1")
+	req.Header.Set(HeaderEvent, string(t))
+	req.Header.Set(HeaderDelivery, deliveryID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(h.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return resp.StatusCode, false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return resp.StatusCode, true, fmt.Errorf("receiver answered %s", resp.Status)
+	default:
+		return resp.StatusCode, false, fmt.Errorf("receiver answered %s", resp.Status)
+	}
+}
+
+// Sign computes the X-Webhook-Signature value for a body sent at timestamp
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature made by Sign in constant time
+func Verify(secret, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
@@ -0,0 +1,185 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hasmikatom/torrent/events"
+)
+
+// receiver is a local webhook endpoint that answers with a scripted series
+// of status codes and keeps what it received
+type receiver struct {
+	mu       sync.Mutex
+	codes    []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+
+	code := http.StatusOK
+	if len(r.codes) > 0 {
+		code = r.codes[0]
+		r.codes = r.codes[1:]
+	}
+	w.WriteHeader(code)
+}
+
+func (r *receiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.requests)
+}
+
+func newDispatcher(t *testing.T, hooks []Hook) (*Dispatcher, *Log) {
+	t.Helper()
+	l, err := OpenLog(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewDispatcher(hooks, l, Options{Backoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond, Timeout: time.Second}), l
+}
+
+func completed() events.Event {
+	return events.New(events.Completed, events.Torrent{ID: 7, Hash: "abc", Name: "Ubuntu"}, time.Now())
+}
+
+func TestDeliver_SignsRequest(t *testing.T) {
+	r := &receiver{}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	hook := Hook{ID: "hook", URL: srv.URL, Secret: "s3cret", MaxAttempts: 3}
+	d, _ := newDispatcher(t, []Hook{hook})
+	e := completed()
+
+	got := d.Deliver(context.Background(), hook, e)
+	if got.Status != StatusDelivered || got.Attempts != 1 || got.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected delivery %+v", got)
+	}
+
+	req, body := r.requests[0], r.bodies[0]
+	if req.Header.Get(HeaderEvent) != string(events.Completed) {
+		t.Errorf("event header = %q", req.Header.Get(HeaderEvent))
+	}
+	if req.Header.Get(HeaderDelivery) != got.ID {
+		t.Errorf("delivery header = %q, want %q", req.Header.Get(HeaderDelivery), got.ID)
+	}
+	if !Verify("s3cret", req.Header.Get(HeaderTimestamp), body, req.Header.Get(HeaderSignature)) {
+		t.Error("signature does not verify")
+	}
+	if Verify("other", req.Header.Get(HeaderTimestamp), body, req.Header.Get(HeaderSignature)) {
+		t.Error("signature verifies with the wrong secret")
+	}
+
+	var sent events.Event
+	if err := json.Unmarshal(body, &sent); err != nil {
+		t.Fatal(err)
+	}
+	if sent.ID != e.ID || sent.Torrent.Name != "Ubuntu" {
+		t.Errorf("unexpected body %s", body)
+	}
+}
+
+func TestDeliver_Retries(t *testing.T) {
+	tests := []struct {
+		name         string
+		codes        []int
+		maxAttempts  int
+		wantStatus   string
+		wantAttempts int
+	}{
+		{"server error then success", []int{500, 503, 200}, 5, StatusDelivered, 3},
+		{"rate limited then success", []int{429, 204}, 5, StatusDelivered, 2},
+		{"client error is not retried", []int{404}, 5, StatusFailed, 1},
+		{"gives up after max attempts", []int{500, 500, 500, 500}, 3, StatusFailed, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &receiver{codes: tt.codes}
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+
+			hook := Hook{ID: "hook", URL: srv.URL, Secret: "s", MaxAttempts: tt.maxAttempts}
+			d, l := newDispatcher(t, []Hook{hook})
+
+			got := d.Deliver(context.Background(), hook, completed())
+			if got.Status != tt.wantStatus || got.Attempts != tt.wantAttempts {
+				t.Fatalf("got %s after %d attempts, want %s after %d", got.Status, got.Attempts, tt.wantStatus, tt.wantAttempts)
+			}
+			if r.count() != tt.wantAttempts {
+				t.Errorf("receiver saw %d requests, want %d", r.count(), tt.wantAttempts)
+			}
+
+			logged := l.List("hook", "", 0)
+			if len(logged) != 1 || logged[0].Status != tt.wantStatus || logged[0].NextAttemptAt != nil {
+				t.Errorf("unexpected log %+v", logged)
+			}
+		})
+	}
+}
+
+func TestRun_FiltersEvents(t *testing.T) {
+	all, onlyCompleted := &receiver{}, &receiver{}
+	allSrv, completedSrv := httptest.NewServer(all), httptest.NewServer(onlyCompleted)
+	defer allSrv.Close()
+	defer completedSrv.Close()
+
+	d, l := newDispatcher(t, []Hook{
+		{ID: "all", URL: allSrv.URL, Secret: "s", Events: []string{"torrent.*"}},
+		{ID: "completed", URL: completedSrv.URL, Secret: "s", Events: []string{"torrent.completed"}},
+	})
+
+	ch := make(chan events.Event, 3)
+	ch <- events.New(events.Added, events.Torrent{ID: 1}, time.Now())
+	ch <- events.New(events.Completed, events.Torrent{ID: 1}, time.Now())
+	ch <- events.New(events.Removed, events.Torrent{ID: 1}, time.Now())
+	close(ch)
+
+	d.Run(context.Background(), ch)
+
+	if all.count() != 3 {
+		t.Errorf("catch-all hook got %d deliveries, want 3", all.count())
+	}
+	if onlyCompleted.count() != 1 {
+		t.Errorf("filtered hook got %d deliveries, want 1", onlyCompleted.count())
+	}
+	if got := l.List("", StatusDelivered, 0); len(got) != 4 {
+		t.Errorf("log has %d delivered entries, want 4", len(got))
+	}
+}
+
+func TestOpenLog_FailsInterruptedDeliveries(t *testing.T) {
+	dir := t.TempDir()
+	l, err := OpenLog(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Record(Delivery{ID: "1", WebhookID: "hook", Status: StatusPending})
+	l.Record(Delivery{ID: "2", WebhookID: "hook", Status: StatusDelivered})
+
+	l, err = OpenLog(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := l.List("", StatusFailed, 0); len(got) != 1 || got[0].ID != "1" {
+		t.Fatalf("expected the pending delivery to be failed, got %+v", got)
+	}
+	if got := l.List("", "", 1); len(got) != 1 || got[0].ID != "2" {
+		t.Fatalf("expected newest first, got %+v", got)
+	}
+}
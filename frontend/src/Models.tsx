@@ -6,6 +6,9 @@ export interface TorrentStatus {
   totalSize: number;
   addedDate: number;
   status: string;
+  stallReason?: string;
+  stallDetail?: string;
+  stalledSince?: number;
 }
 
 export interface ScrapedTorrents {
@@ -1,6 +1,7 @@
-import React from 'react';
+import React, { useEffect, useState } from 'react';
 import { Label } from '@radix-ui/react-label';
 import { RadioGroup, RadioGroupItem } from '../components/ui/radio-group';
+import { apiFetch } from '../services';
 
 interface Props {
   value: string;
@@ -8,12 +9,35 @@ interface Props {
   idPrefix?: string;
 }
 
+interface Category {
+  id: string;
+  name: string;
+}
+
+const defaultCategories: Category[] = [
+  { id: 'Movies', name: 'Movie' },
+  { id: 'Series', name: 'Series' },
+  { id: 'Music', name: 'Music' },
+];
+
 export const MediaTypeSelector: React.FC<Props> = ({
   value,
   onValueChange,
   idPrefix = '',
 }) => {
   const prefix = idPrefix ? `${idPrefix}-` : '';
+  const [categories, setCategories] = useState<Category[]>(defaultCategories);
+
+  useEffect(() => {
+    apiFetch('/api/categories')
+      .then((res) => (res.ok ? res.json() : null))
+      .then((data: Category[] | null) => {
+        if (data && data.length > 0) {
+          setCategories(data);
+        }
+      })
+      .catch((error) => console.error('Failed to fetch categories:', error));
+  }, []);
 
   return (
     <div className="flex items-center space-x-2">
@@ -21,20 +45,17 @@ export const MediaTypeSelector: React.FC<Props> = ({
         <RadioGroup
           value={value}
           onValueChange={onValueChange}
-          className="flex justify-between mb-4"
+          className="flex flex-wrap justify-between gap-2 mb-4"
         >
-          <div className="flex items-center space-x-2">
-            <RadioGroupItem value="Movies" id={`${prefix}movie`} />
-            <Label htmlFor={`${prefix}movie`}>Movie</Label>
-          </div>
-          <div className="flex items-center space-x-2">
-            <RadioGroupItem value="Series" id={`${prefix}series`} />
-            <Label htmlFor={`${prefix}series`}>Series</Label>
-          </div>
-          <div className="flex items-center space-x-2">
-            <RadioGroupItem value="Music" id={`${prefix}music`} />
-            <Label htmlFor={`${prefix}music`}>Music</Label>
-          </div>
+          {categories.map((category) => {
+            const id = `${prefix}${category.id.toLowerCase().replace(/\s+/g, '-')}`;
+            return (
+              <div key={category.id} className="flex items-center space-x-2">
+                <RadioGroupItem value={category.id} id={id} />
+                <Label htmlFor={id}>{category.name}</Label>
+              </div>
+            );
+          })}
         </RadioGroup>
       </div>
     </div>
@@ -1,5 +1,5 @@
 import React, { useState, useEffect, useCallback } from 'react';
-import { HardDrive } from 'lucide-react';
+import { HardDrive, AlertTriangle } from 'lucide-react';
 import { apiFetch } from "@/services";
 
 interface StorageData {
@@ -10,6 +10,8 @@ interface StorageData {
   total: number;
   used: number;
   available: number;
+  problem?: string;
+  categories?: string[];
 }
 
 const BYTES_PER_GB = 1024 * 1024 * 1024;
@@ -125,6 +127,27 @@ export const StorageInfo: React.FC = () => {
       </div>
       <div className="flex flex-wrap justify-center gap-6">
         {sortedStorages.map((storage) => {
+          if (storage.problem) {
+            return (
+              <div
+                key={storage.path}
+                className="flex flex-col items-center max-w-[160px] text-center"
+                role="alert"
+              >
+                <AlertTriangle className="w-8 h-8 text-red-500" />
+                <div className="mt-2 text-xs font-medium truncate max-w-[120px]" title={storage.path}>
+                  {storage.path}
+                </div>
+                <div className="text-xs text-red-500">{storage.problem}</div>
+                {storage.categories && storage.categories.length > 0 && (
+                  <div className="text-xs text-muted-foreground">
+                    Downloads blocked: {storage.categories.join(', ')}
+                  </div>
+                )}
+              </div>
+            );
+          }
+
           const usedPercent = (storage.used / storage.total) * 100;
           const isLow = usedPercent > 90;
           const isWarning = usedPercent > 75 && usedPercent <= 90;
@@ -239,7 +239,12 @@ export const TorrentList: React.FC<Props> = React.memo(({ refreshTrigger }) => {
                         <p className="text-lg font-medium leading-snug break-words">{torrent.name}</p>
                       )}
                       <div className="flex flex-wrap items-center gap-1.5 mt-2">
-                        <span className="rounded-md bg-muted px-2 py-0.5 text-xs">{torrent.status}</span>
+                        <span
+                          className={`rounded-md bg-muted px-2 py-0.5 text-xs${torrent.stallReason ? " text-amber-600" : ""}`}
+                          title={torrent.stallDetail}
+                        >
+                          {torrent.status}
+                        </span>
                         <span className="rounded-md bg-muted px-2 py-0.5 text-xs">{formatSize(torrent.totalSize)}</span>
                         <span className="rounded-md bg-muted px-2 py-0.5 text-xs">{torrent.percentDone.toFixed(1)}%</span>
                         {torrent.rateDownload > 0 && (